@@ -1,16 +1,20 @@
 package assisted_installer_controller
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"math"
+	"math/rand"
 	"net"
 	"os"
 	"path"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -20,6 +24,7 @@ import (
 	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"github.com/thoas/go-funk"
 	certificatesv1 "k8s.io/api/certificates/v1"
 	v1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -55,6 +60,12 @@ const (
 	ExitWaiting               = true
 	customManifestsFile       = "custom_manifests.json"
 	kubeconfigFileName        = "kubeconfig-noingress"
+	// bounds the controller logs read while following them
+	followedLogsMaxBytes = 100 * 1024 * 1024
+	// holds the hash of the ingress CA bundle the service acknowledged
+	ingressCAUploadedAnnotation = "assisted-installer.openshift.io/uploaded-ingress-ca"
+	// prefixes the completion message of an installation whose OLM operators failed
+	completedWithWarningsPrefix = "Cluster installed with warnings"
 )
 
 var (
@@ -69,6 +80,7 @@ var (
 	FetchRetryInterval       = 10 * time.Second
 	LongWaitTimeout          = 10 * time.Hour
 	CVOMaxTimeout            = 3 * time.Hour
+	ListNodesBackoffMax      = 1 * time.Minute
 )
 
 // assisted installer controller is added to control installation process after  bootstrap pivot
@@ -89,16 +101,58 @@ type ControllerConfig struct {
 	DryRunEnabled           bool   `envconfig:"DRY_ENABLE" required:"false" default:"false"`
 	DryFakeRebootMarkerPath string `envconfig:"DRY_FAKE_REBOOT_MARKER_PATH" required:"false" default:""`
 	DryRunClusterHostsPath  string `envconfig:"DRY_CLUSTER_HOSTS_PATH"`
+	DryInventoryRecordPath  string `envconfig:"DRY_INVENTORY_RECORD_PATH" required:"false" default:""`
+	LeaderElectionEnabled   bool   `envconfig:"LEADER_ELECTION_ENABLED" required:"false" default:"false"`
+	PodName                 string `envconfig:"POD_NAME" required:"false" default:""`
+	// MaxConcurrency bounds the parallel API calls of CSR approval and node labeling
+	MaxConcurrency int `envconfig:"MAX_CONCURRENCY" required:"false" default:"4"`
+	// LogsFollowDuration makes the summary logs follow the controller logs for that long before uploading them
+	LogsFollowDuration time.Duration `envconfig:"LOGS_FOLLOW_DURATION" required:"false" default:"0s"`
+	// RedactLogs masks tokens and passwords in the uploaded pod logs
+	RedactLogs bool `envconfig:"REDACT_LOGS" required:"false" default:"false"`
+	// LogTargets are pods whose logs are uploaded together with the controller logs
+	LogTargets LogTargets `envconfig:"LOG_TARGETS" required:"false" default:""`
+	// OperatorFailureGracePeriod keeps checking OLM operators that timed out for that long before marking them failed
+	OperatorFailureGracePeriod time.Duration `envconfig:"OPERATOR_FAILURE_GRACE_PERIOD" required:"false" default:"0s"`
+	// DegradedGracePeriod reports cluster operators that became degraded more recently than that as progressing
+	DegradedGracePeriod time.Duration `envconfig:"DEGRADED_GRACE_PERIOD" required:"false" default:"0s"`
+	// WaitForMachineConfigPools waits for the machine config pools to be updated before completing the installation
+	WaitForMachineConfigPools bool `envconfig:"WAIT_FOR_MACHINE_CONFIG_POOLS" required:"false" default:"false"`
+	// UserAgent overrides the assisted-installer-controller/<version> User-Agent of the requests to the service
+	UserAgent string `envconfig:"USER_AGENT" required:"false" default:""`
+	// DisableMustGather skips collecting must-gather on errors, only the controller logs are uploaded
+	DisableMustGather bool `envconfig:"DISABLE_MUST_GATHER" required:"false" default:"false"`
+	// MustGatherMaxAttempts abandons must-gather after it failed that many times, 0 retries it until the logs upload times out
+	MustGatherMaxAttempts int `envconfig:"MUST_GATHER_MAX_ATTEMPTS" required:"false" default:"3"`
+	// WaitForClusterOperators are cluster operators, e.g. authentication,ingress, that must be available as well before completing the installation
+	WaitForClusterOperators []string `envconfig:"WAIT_FOR_CLUSTER_OPERATORS" required:"false" default:""`
+	// StartupJitterMax delays the controller start by a random duration up to it, so controllers of
+	// many clusters don't hit the service at once
+	StartupJitterMax time.Duration `envconfig:"STARTUP_JITTER_MAX" required:"false" default:"0s"`
+	// CollectNodeJournals uploads the journals of the NotReady nodes with the controller logs
+	CollectNodeJournals bool `envconfig:"COLLECT_NODE_JOURNALS" required:"false" default:"false"`
+	// StatusUpdateConcurrency bounds the parallel host progress updates sent to the service for the joined and ready nodes
+	StatusUpdateConcurrency int `envconfig:"STATUS_UPDATE_CONCURRENCY" required:"false" default:"2"`
 	// DryRunClusterHostsPath gets read parsed into ParsedClusterHosts by DryParseClusterHosts
 	ParsedClusterHosts config.DryClusterHosts
 }
+
+// Validate returns an error if a setting has an invalid value
+func (c ControllerConfig) Validate() error {
+	if c.StatusUpdateConcurrency < 1 {
+		return errors.Errorf("STATUS_UPDATE_CONCURRENCY must be positive, got %d", c.StatusUpdateConcurrency)
+	}
+	return nil
+}
+
 type Controller interface {
 	WaitAndUpdateNodesStatus(status *ControllerStatus)
 }
 
 type ControllerStatus struct {
 	errCounter uint32
-	components map[string]bool
+	// the failed operators and their namespaces
+	components map[string]string
 	lock       sync.Mutex
 }
 
@@ -109,6 +163,52 @@ type controller struct {
 	ops    ops.Ops
 	ic     inventory_client.InventoryClient
 	kc     k8s_client.K8SClient
+
+	// spaces out ListNodes calls while the API server keeps failing them
+	listNodesBackoff *utils.FailureBackoff
+	// the all nodes installed event is sent only once
+	allNodesInstalledEventSent bool
+	postInstall                *postInstallProgress
+	operatorHistory            *operatorStatusHistory
+	// counts the failed must-gather collections, shared by the controller copies
+	mustGatherFailures *uint32
+	// the nodes sharing a system UUID that were already reported, by their message
+	reportedDuplicateUUIDs map[string]struct{}
+}
+
+const (
+	postInstallStepClusterOperators = "cluster-operators"
+	postInstallStepEtcdUnpatch      = "etcd-unpatch"
+	postInstallStepOLMManifests     = "olm-manifests"
+	postInstallStepOLMOperators     = "olm-operators"
+	postInstallStepMachineConfigs   = "machine-config-pools"
+)
+
+// postInstallProgress records the post install steps that completed and the node labels applied,
+// for the installation summary. Whether a step is done again is decided by the cluster state.
+type postInstallProgress struct {
+	lock sync.Mutex
+	// the steps and the time they completed at
+	completed map[string]time.Time
+	// the labels applied to each node
+	nodeLabels map[string]string
+	summary    *installationSummary
+}
+
+func newPostInstallProgress() *postInstallProgress {
+	return &postInstallProgress{completed: make(map[string]time.Time), nodeLabels: make(map[string]string)}
+}
+
+func (p *postInstallProgress) complete(step string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.completed[step] = time.Now().UTC()
+}
+
+func (p *postInstallProgress) nodeLabelsApplied(node string, labels string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.nodeLabels[node] = labels
 }
 
 // manifest store the operator manifest used by assisted-installer to create CRs of the OLM:
@@ -121,18 +221,23 @@ type manifest struct {
 
 func NewController(log *logrus.Logger, cfg ControllerConfig, ops ops.Ops, ic inventory_client.InventoryClient, kc k8s_client.K8SClient) *controller {
 	return &controller{
-		log:              log,
-		ControllerConfig: cfg,
-		ops:              ops,
-		ic:               ic,
-		kc:               kc,
-		Status:           NewControllerStatus(),
+		log:                    log,
+		ControllerConfig:       cfg,
+		ops:                    ops,
+		ic:                     ic,
+		kc:                     kc,
+		Status:                 NewControllerStatus(),
+		listNodesBackoff:       utils.NewFailureBackoff(GeneralWaitInterval, ListNodesBackoffMax),
+		postInstall:            newPostInstallProgress(),
+		operatorHistory:        newOperatorStatusHistory(operatorHistorySize),
+		mustGatherFailures:     new(uint32),
+		reportedDuplicateUUIDs: make(map[string]struct{}),
 	}
 }
 
 func NewControllerStatus() *ControllerStatus {
 	return &ControllerStatus{
-		components: make(map[string]bool),
+		components: make(map[string]string),
 	}
 }
 
@@ -145,9 +250,17 @@ func (status *ControllerStatus) HasError() bool {
 }
 
 func (status *ControllerStatus) OperatorError(component string) {
+	status.OperatorErrorInNamespace(component, "")
+}
+
+// OperatorErrorInNamespace marks the component as failed, remembering the namespace its pods run in
+func (status *ControllerStatus) OperatorErrorInNamespace(component string, namespace string) {
 	status.lock.Lock()
 	defer status.lock.Unlock()
-	status.components[component] = true
+	if namespace == "" {
+		namespace = status.components[component]
+	}
+	status.components[component] = namespace
 }
 
 func (status *ControllerStatus) HasOperatorError() bool {
@@ -166,6 +279,20 @@ func (status *ControllerStatus) GetOperatorsInError() []string {
 	return result
 }
 
+// GetNamespacesOfOperatorsInError returns the sorted namespaces of the failed operators that have one
+func (status *ControllerStatus) GetNamespacesOfOperatorsInError() []string {
+	result := make([]string, 0)
+	status.lock.Lock()
+	defer status.lock.Unlock()
+	for _, namespace := range status.components {
+		if namespace != "" && !funk.ContainsString(result, namespace) {
+			result = append(result, namespace)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
 func logHostsStatus(log logrus.FieldLogger, hosts map[string]inventory_client.HostData) {
 	hostsStatus := make(map[string][]string)
 	for hostname, hostData := range hosts {
@@ -177,25 +304,92 @@ func logHostsStatus(log logrus.FieldLogger, hosts map[string]inventory_client.Ho
 	log.Infof("Hosts status: %v", hostsStatus)
 }
 
+// Run starts all the controller routines and blocks until all of them have exited. The routines
+// stop when ctx is done, UploadLogs performs a final logs upload before exiting.
+func (c *controller) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	// No need to cancel with context, will finish quickly
+	// we should fix try to fix dns service issue as soon as possible
+	if !c.DryRunEnabled {
+		// This check is unnecessary in dry run mode, and mocking for it is complicated
+		wg.Add(1)
+		go c.HackDNSAddressConflict(&wg)
+	}
+
+	if delay := startupDelay(c.StartupJitterMax); delay > 0 {
+		c.log.Infof("Delaying the controller start by %s", delay)
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-time.After(delay):
+		}
+	}
+	c.SetReadyState()
+
+	wg.Add(4)
+	go c.WaitAndUpdateNodesStatus(ctx, &wg)
+	go c.PostInstallConfigs(ctx, &wg)
+	go c.UpdateBMHs(ctx, &wg)
+	go c.UploadLogs(ctx, &wg)
+
+	c.log.Infof("Waiting for all controller routines to finish")
+	wg.Wait()
+	c.log.Infof("All controller routines finished")
+}
+
+// startupDelay returns a random delay in [0, max), seeded by the current time so the controllers of different
+// clusters start at different times
+func startupDelay(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.New(rand.NewSource(time.Now().UnixNano())).Int63n(int64(max)))
+}
+
 // WaitAndUpdateNodesStatus waits till all nodes joins the cluster and become ready
 // it will update joined/done status
 // approve csr will run as routine and cancelled whenever all nodes are ready and joined
 // this will allow to run it and end only when it is needed
 func (c *controller) WaitAndUpdateNodesStatus(ctx context.Context, wg *sync.WaitGroup) {
 	approveCtx, approveCancel := context.WithCancel(ctx)
+	approveDone := make(chan struct{})
 	defer func() {
 		approveCancel()
+		<-approveDone
 		c.log.Infof("WaitAndUpdateNodesStatus finished")
 		wg.Done()
 	}()
 	// starting approve csrs
-	go c.ApproveCsrs(approveCtx)
+	go func() {
+		defer close(approveDone)
+		c.ApproveCsrs(approveCtx)
+	}()
 
 	c.log.Infof("Waiting till all nodes will join and update status to assisted installer")
 	_ = utils.WaitForPredicateWithContext(ctx, LongWaitTimeout, GeneralWaitInterval, c.waitAndUpdateNodesStatus)
 }
 
+// sendAllNodesInstalledEvent marks the completion of the nodes installation, like the ready event marks the start
+func (c *controller) sendAllNodesInstalledEvent() {
+	if c.allNodesInstalledEventSent {
+		return
+	}
+	c.log.Infof("Sending all nodes installed event")
+	if _, err := c.kc.CreateEvent(c.Namespace, common.AllNodesInstalledEvent,
+		"All the cluster nodes were installed", common.AssistedControllerPrefix); err != nil && !apierrors.IsAlreadyExists(err) {
+		c.log.WithError(err).Errorf("Failed to spawn event")
+		return
+	}
+	c.allNodesInstalledEventSent = true
+}
+
 func (c *controller) waitAndUpdateNodesStatus() bool {
+	// the nodes can't be checked without ListNodes, skip the whole round while backing off
+	if !c.listNodesBackoff.Ready() {
+		return KeepWaiting
+	}
 	ignoreStatuses := []string{models.HostStatusDisabled}
 	var hostsInError int
 	ctxReq := utils.GenerateRequestContext()
@@ -222,40 +416,35 @@ func (c *controller) waitAndUpdateNodesStatus() bool {
 	//if all hosts are successfully installed, finish
 	if len(hostsInProgressMap) == 0 {
 		c.log.Infof("All nodes were successfully installed")
+		c.sendAllNodesInstalledEvent()
 		return ExitWaiting
 	}
 	//otherwise, update the progress status and keep waiting
 	log.Infof("Checking if cluster nodes are ready. %d nodes remaining", len(hostsInProgressMap))
 	nodes, err := c.kc.ListNodes()
 	if err != nil {
-		log.WithError(err).Error("Failed to get list of nodes from k8s client")
+		log.WithError(err).Errorf("Failed to get list of nodes from k8s client, next attempt in %s", c.listNodesBackoff.Failure())
 		return KeepWaiting
 	}
+	c.listNodesBackoff.Success()
+	for uuid, names := range common.DuplicateSystemUUIDs(nodes.Items) {
+		c.reportDuplicateSystemUUID(ctxReq, log, uuid, names, hostsInProgressMap)
+	}
+	var joinedNodes []v1.Node
+	var joinedHosts []inventory_client.HostData
 	for _, node := range nodes.Items {
 		host, ok := common.HostMatchByNameOrIPAddress(node, hostsInProgressMap, knownIpAddresses)
 		if !ok {
 			log.Warnf("Node %s is not in inventory hosts", strings.ToLower(node.Name))
 			continue
 		}
-
-		if host.Host.Progress.CurrentStage == models.HostStageConfiguring {
-			log.Infof("Found new joined node %s with inventory id %s, kubernetes id %s, updating its status to %s",
-				node.Name, host.Host.ID.String(), node.Status.NodeInfo.SystemUUID, models.HostStageJoined)
-			if err := c.ic.UpdateHostInstallProgress(ctxReq, host.Host.InfraEnvID.String(), host.Host.ID.String(), models.HostStageJoined, ""); err != nil {
-				log.WithError(err).Errorf("Failed to update node %s installation status", node.Name)
-				continue
-			}
-		}
-
-		if common.IsK8sNodeIsReady(node) {
-			log.Infof("Found new ready node %s with inventory id %s, kubernetes id %s, updating its status to %s",
-				node.Name, host.Host.ID.String(), node.Status.NodeInfo.SystemUUID, models.HostStageDone)
-			if err := c.ic.UpdateHostInstallProgress(ctxReq, host.Host.InfraEnvID.String(), host.Host.ID.String(), models.HostStageDone, ""); err != nil {
-				log.WithError(err).Errorf("Failed to update node %s installation status", node.Name)
-				continue
-			}
-		}
+		joinedNodes = append(joinedNodes, node)
+		joinedHosts = append(joinedHosts, host)
 	}
+	_ = utils.ForEachConcurrent(len(joinedNodes), c.StatusUpdateConcurrency, func(i int) error {
+		c.updateJoinedNodeStatus(ctxReq, log, joinedNodes[i], joinedHosts[i])
+		return nil
+	})
 
 	// Since the host statuses may have changed due to the above loop,
 	// we need to get the updated list of hosts again so we don't operate
@@ -270,6 +459,47 @@ func (c *controller) waitAndUpdateNodesStatus() bool {
 	return KeepWaiting
 }
 
+// reportDuplicateSystemUUID reports nodes sharing a system UUID once, on the inventory hosts of those nodes
+func (c *controller) reportDuplicateSystemUUID(ctx context.Context, log logrus.FieldLogger, uuid string, names []string,
+	hosts map[string]inventory_client.HostData) {
+	message := common.DuplicateSystemUUIDMessage(uuid, names)
+	if _, ok := c.reportedDuplicateUUIDs[message]; ok {
+		return
+	}
+	c.reportedDuplicateUUIDs[message] = struct{}{}
+	log.Errorf("Failed to match nodes with the inventory hosts: %s", message)
+	for _, name := range names {
+		host, ok := hosts[strings.ToLower(name)]
+		if !ok || host.Host.Progress == nil {
+			continue
+		}
+		if err := c.ic.UpdateHostInstallProgress(ctx, host.Host.InfraEnvID.String(), host.Host.ID.String(),
+			host.Host.Progress.CurrentStage, message); err != nil {
+			log.WithError(err).Warnf("Failed to report the system UUID of node %s", name)
+		}
+	}
+}
+
+// updateJoinedNodeStatus moves the host of a node that joined the cluster to joined, and to done once the node is ready
+func (c *controller) updateJoinedNodeStatus(ctx context.Context, log logrus.FieldLogger, node v1.Node, host inventory_client.HostData) {
+	if host.Host.Progress.CurrentStage == models.HostStageConfiguring {
+		log.Infof("Found new joined node %s with inventory id %s, kubernetes id %s, updating its status to %s",
+			node.Name, host.Host.ID.String(), node.Status.NodeInfo.SystemUUID, models.HostStageJoined)
+		if err := c.ic.UpdateHostInstallProgress(ctx, host.Host.InfraEnvID.String(), host.Host.ID.String(), models.HostStageJoined, ""); err != nil {
+			log.WithError(err).Errorf("Failed to update node %s installation status", node.Name)
+			return
+		}
+	}
+
+	if common.IsK8sNodeIsReady(node) {
+		log.Infof("Found new ready node %s with inventory id %s, kubernetes id %s, updating its status to %s",
+			node.Name, host.Host.ID.String(), node.Status.NodeInfo.SystemUUID, models.HostStageDone)
+		if err := c.ic.UpdateHostInstallProgress(ctx, host.Host.InfraEnvID.String(), host.Host.ID.String(), models.HostStageDone, ""); err != nil {
+			log.WithError(err).Errorf("Failed to update node %s installation status", node.Name)
+		}
+	}
+}
+
 func (c *controller) HackDNSAddressConflict(wg *sync.WaitGroup) {
 	c.log.Infof("Making sure service %s can reserve the .10 address", dnsServiceName)
 
@@ -277,17 +507,21 @@ func (c *controller) HackDNSAddressConflict(wg *sync.WaitGroup) {
 		c.log.Infof("HackDNSAddressConflict finished")
 		wg.Done()
 	}()
-	networks, err := c.kc.GetServiceNetworks()
-	if err != nil || len(networks) == 0 {
+	networks, err := c.getServiceNetworks()
+	if err != nil {
 		c.log.Errorf("Failed to get service networks: %s", err)
 		return
 	}
 
+	hasV4, hasV6 := utils.ClassifyNetworks(networks)
+	c.log.Infof("Service networks %v, IPv4: %t, IPv6: %t", networks, hasV4, hasV6)
+
+	// In dual-stack clusters the DNS service takes its address from the primary (first) service network
+	isV6, _ := utils.IsIPv6CIDR(networks[0])
 	netIp, _, _ := net.ParseCIDR(networks[0])
-	ip := netIp.To16()
-	if ip == nil {
-		c.log.Infof("Failed to parse service network cidr %s, skipping", networks[0])
-		return
+	ip := netIp.To4()
+	if isV6 {
+		ip = netIp.To16()
 	}
 
 	ip[len(ip)-1] = 10 // .10 or :a is the conflicting address
@@ -320,6 +554,26 @@ func (c *controller) HackDNSAddressConflict(wg *sync.WaitGroup) {
 	}
 }
 
+// getServiceNetworks returns the valid service networks CIDRs, invalid entries are logged and dropped
+func (c *controller) getServiceNetworks() ([]string, error) {
+	networks, err := c.kc.GetServiceNetworks()
+	if err != nil {
+		return nil, err
+	}
+	var valid []string
+	for _, network := range networks {
+		if _, _, err := net.ParseCIDR(network); err != nil {
+			c.log.WithError(err).Warnf("Ignoring invalid service network %q", network)
+			continue
+		}
+		valid = append(valid, network)
+	}
+	if len(valid) == 0 {
+		return nil, errors.Errorf("no valid service network found in %v", networks)
+	}
+	return valid, nil
+}
+
 func (c *controller) findServiceByIP(ip string, services *[]v1.Service) *v1.Service {
 	for _, s := range *services {
 		if s.Spec.ClusterIP == ip {
@@ -365,7 +619,7 @@ func (c *controller) updateConfiguringStatusIfNeeded(hosts map[string]inventory_
 	if err != nil {
 		return
 	}
-	common.SetConfiguringStatusForHosts(c.ic, hosts, logs, false, c.log)
+	common.SetConfiguringStatusForHosts(c.ic, hosts, logs, false, false, c.log)
 }
 
 func (c *controller) ApproveCsrs(ctx context.Context) {
@@ -387,14 +641,15 @@ func (c *controller) ApproveCsrs(ctx context.Context) {
 }
 
 func (c controller) approveCsrs(csrs *certificatesv1.CertificateSigningRequestList) {
-	for i := range csrs.Items {
+	// We can fail and it is ok, we will retry on the next time
+	_ = utils.ForEachConcurrent(len(csrs.Items), c.MaxConcurrency, func(i int) error {
 		csr := csrs.Items[i]
-		if !isCsrApproved(&csr) {
-			c.log.Infof("Approving CSR %s", csr.Name)
-			// We can fail and it is ok, we will retry on the next time
-			_ = c.kc.ApproveCsr(&csr)
+		if isCsrApproved(&csr) {
+			return nil
 		}
-	}
+		c.log.Infof("Approving CSR %s", csr.Name)
+		return c.kc.ApproveCsr(&csr)
+	})
 }
 
 func isCsrApproved(csr *certificatesv1.CertificateSigningRequest) bool {
@@ -424,7 +679,7 @@ func (c controller) PostInstallConfigs(ctx context.Context, wg *sync.WaitGroup)
 		return
 	}
 
-	errMessage := ""
+	started := time.Now().UTC()
 	err = c.postInstallConfigs(ctx)
 	// context was cancelled, requires usage of WaitForPredicateWithContext
 	// no reason to set error
@@ -433,19 +688,35 @@ func (c controller) PostInstallConfigs(ctx context.Context, wg *sync.WaitGroup)
 	}
 	if err != nil {
 		c.log.Error(err)
-		errMessage = err.Error()
 		c.Status.Error()
 	}
-	success := err == nil
-	c.sendCompleteInstallation(ctx, success, errMessage)
+	success, message := completionResult(err, c.Status.GetOperatorsInError())
+	c.postInstall.setSummary(c.installationSummary(started, success, message))
+	c.sendCompleteInstallation(ctx, success, message)
+}
+
+// completionResult builds the completion params. OLM operators failing doesn't fail the installation,
+// but they are listed in the message so the installation is reported as succeeded with warnings
+func completionResult(err error, operatorsInError []string) (bool, string) {
+	if err != nil {
+		return false, err.Error()
+	}
+	if len(operatorsInError) == 0 {
+		return true, ""
+	}
+	operators := append([]string{}, operatorsInError...)
+	sort.Strings(operators)
+	return true, fmt.Sprintf("%s: OLM operators %s failed", completedWithWarningsPrefix, strings.Join(operators, ", "))
 }
 
 func (c controller) postInstallConfigs(ctx context.Context) error {
 	var err error
 
+	// operators the service already acknowledged as available are neither checked nor reported again
 	if err = c.waitingForClusterOperators(ctx); err != nil {
 		return errors.Wrapf(err, "Timeout while waiting for cluster operators to be available")
 	}
+	c.postInstall.complete(postInstallStepClusterOperators)
 
 	err = utils.WaitForPredicateWithContext(ctx, WaitTimeout, GeneralWaitInterval, c.updateNodesLabels)
 	if err != nil {
@@ -465,6 +736,7 @@ func (c controller) postInstallConfigs(ctx context.Context) error {
 		if err = utils.WaitForPredicateWithContext(ctx, WaitTimeout, GeneralWaitInterval, c.unpatchEtcd); err != nil {
 			return errors.Wrapf(err, "Timeout while trying to unpatch etcd")
 		}
+		c.postInstall.complete(postInstallStepEtcdUnpatch)
 	} else {
 		c.log.Infof("Skipping etcd unpatch for cluster version %s", c.ControllerConfig.OpenshiftVersion)
 	}
@@ -473,11 +745,41 @@ func (c controller) postInstallConfigs(ctx context.Context) error {
 	if err = c.waitForOLMOperators(ctx); err != nil {
 		// no need to send error in case olm failed as service should move to degraded in that case
 		c.log.WithError(err).Warn("Error while initializing OLM operators")
+	} else {
+		c.postInstall.complete(postInstallStepOLMOperators)
+	}
+
+	if c.WaitForMachineConfigPools {
+		if err = utils.WaitForPredicateWithContext(ctx, WaitTimeout, GeneralWaitInterval, c.areMachineConfigPoolsUpdated); err != nil {
+			return errors.Wrapf(err, "Timeout while waiting for machine config pools to be updated")
+		}
+		c.postInstall.complete(postInstallStepMachineConfigs)
 	}
 
 	return nil
 }
 
+// areMachineConfigPoolsUpdated returns true once all the machine config pools rolled out their
+// machine configs, nodes reboot while the pools are updating
+func (c controller) areMachineConfigPoolsUpdated() bool {
+	pools, err := c.kc.ListMachineConfigPools()
+	if err != nil {
+		c.log.WithError(err).Warn("Failed to list machine config pools")
+		return false
+	}
+	updated := true
+	for _, pool := range pools {
+		if pool.Degraded {
+			c.log.Warnf("Machine config pool %s is degraded", pool.Name)
+		}
+		if !pool.Updated {
+			c.log.Infof("Machine config pool %s is updating, %d/%d machines updated", pool.Name, pool.UpdatedMachineCount, pool.MachineCount)
+			updated = false
+		}
+	}
+	return updated
+}
+
 func (c controller) waitForOLMOperators(ctx context.Context) error {
 	var operators []models.MonitoredOperator
 	var err error
@@ -500,13 +802,7 @@ func (c controller) waitForOLMOperators(ctx context.Context) error {
 		}
 	}()
 	// Get the monitored operators:
-	err = utils.Retry(maxFetchAttempts, FetchRetryInterval, c.log, func() error {
-		operators, err = c.ic.GetClusterMonitoredOLMOperators(context.TODO(), c.ClusterID, c.OpenshiftVersion)
-		if err != nil {
-			return errors.Wrapf(err, "Error while fetch the monitored operators from assisted-service.")
-		}
-		return nil
-	})
+	operators, err = c.getClusterMonitoredOLMOperators()
 	if err != nil {
 		return errors.Wrapf(err, "Failed to fetch monitored operators")
 	}
@@ -514,6 +810,10 @@ func (c controller) waitForOLMOperators(ctx context.Context) error {
 		c.log.Info("No OLM operators found.")
 		return nil
 	}
+	if !hasProgressingOperators(operators) {
+		c.log.Info("The service already has the final status of all the OLM operators, skipping")
+		return nil
+	}
 
 	// Get maximum wait timeout for OLM operators:
 	waitTimeout := c.getMaximumOLMTimeout(operators)
@@ -526,11 +826,12 @@ func (c controller) waitForOLMOperators(ctx context.Context) error {
 		c.log.WithError(err).Warnf("Failed to wait for some of the OLM operators to be initilized")
 	}
 
-	// Apply post install manifests
+	// Apply post install manifests, they are applied with oc apply so applying them again is harmless
 	err = utils.WaitForPredicateParamsWithContext(ctx, retryPostManifestTimeout, GeneralWaitInterval, c.applyPostInstallManifests, operators)
 	if err != nil {
 		return errors.Wrapf(err, "Failed to apply post manifests")
 	}
+	c.postInstall.complete(postInstallStepOLMManifests)
 
 	err = c.waitForCSV(ctx, waitTimeout)
 	if err != nil {
@@ -540,6 +841,15 @@ func (c controller) waitForOLMOperators(ctx context.Context) error {
 	return nil
 }
 
+func hasProgressingOperators(operators []models.MonitoredOperator) bool {
+	for _, operator := range operators {
+		if operator.Status != models.OperatorStatusAvailable && operator.Status != models.OperatorStatusFailed {
+			return true
+		}
+	}
+	return false
+}
+
 func (c controller) getReadyOperators(operators []models.MonitoredOperator) ([]string, []models.MonitoredOperator, error) {
 	var readyOperators []string
 	for index := range operators {
@@ -888,12 +1198,22 @@ func (c controller) addRouterCAToClusterCA() bool {
 		log.WithError(err).Errorf("fetching %s configmap from %s namespace", ingressConfigMapName, ingressConfigMapNamespace)
 		return false
 	}
+	caHash := fmt.Sprintf("%x", sha256.Sum256([]byte(caConfigMap.Data["ca-bundle.crt"])))
+	if caConfigMap.Annotations[ingressCAUploadedAnnotation] == caHash {
+		log.Infof("Ingress ca didn't change since it was sent to inventory, skipping")
+		return true
+	}
 	log.Infof("Sending ingress certificate to inventory service. Certificate data %s", caConfigMap.Data["ca-bundle.crt"])
 	err = c.ic.UploadIngressCa(ctx, caConfigMap.Data["ca-bundle.crt"], c.ClusterID)
 	if err != nil {
 		log.WithError(err).Errorf("Failed to upload ingress ca to assisted-service")
 		return false
 	}
+	// a failure only means the ingress ca is sent again on the next run
+	if err = c.kc.PatchConfigMapAnnotations(ingressConfigMapNamespace, ingressConfigMapName,
+		map[string]string{ingressCAUploadedAnnotation: caHash}); err != nil {
+		log.WithError(err).Warnf("Failed to mark the ingress ca as sent to inventory")
+	}
 	log.Infof("Ingress ca successfully sent to inventory")
 	return true
 
@@ -908,9 +1228,24 @@ func (c controller) getMaximumOLMTimeout(operators []models.MonitoredOperator) t
 	return time.Duration(timeout * float64(time.Second))
 }
 
+// getClusterMonitoredOLMOperators retries fetching the OLM operators so a transient service
+// failure doesn't abort their monitoring
+func (c controller) getClusterMonitoredOLMOperators() ([]models.MonitoredOperator, error) {
+	var operators []models.MonitoredOperator
+	err := utils.Retry(maxFetchAttempts, FetchRetryInterval, c.log, func() error {
+		var err error
+		operators, err = c.ic.GetClusterMonitoredOLMOperators(context.TODO(), c.ClusterID, c.OpenshiftVersion)
+		if err != nil {
+			return errors.Wrapf(err, "Error while fetch the monitored operators from assisted-service.")
+		}
+		return nil
+	})
+	return operators, err
+}
+
 func (c controller) getProgressingOLMOperators() ([]*models.MonitoredOperator, error) {
 	ret := make([]*models.MonitoredOperator, 0)
-	operators, err := c.ic.GetClusterMonitoredOLMOperators(context.TODO(), c.ClusterID, c.OpenshiftVersion)
+	operators, err := c.getClusterMonitoredOLMOperators()
 	if err != nil {
 		c.log.WithError(err).Warningf("Failed to connect to assisted service")
 		return ret, err
@@ -930,7 +1265,8 @@ func (c controller) updatePendingOLMOperators(ctx context.Context) error {
 		return err
 	}
 	for _, operator := range operators {
-		c.Status.OperatorError(operator.Name)
+		c.Status.OperatorErrorInNamespace(operator.Name, operator.Namespace)
+		c.operatorHistory.record(operator.Name, models.OperatorStatusFailed, "Waiting for operator timed out")
 		err := c.ic.UpdateClusterOperator(ctx, c.ClusterID, operator.Name, models.OperatorStatusFailed, "Waiting for operator timed out")
 		if err != nil {
 			c.log.WithError(err).Warnf("Failed to update olm %s status", operator.Name)
@@ -968,7 +1304,19 @@ func (c controller) waitForCSV(ctx context.Context, waitTimeout time.Duration) e
 		return false
 	}
 
-	return utils.WaitForPredicateWithContext(ctx, waitTimeout, GeneralWaitInterval, areOLMOperatorsAvailable)
+	err = utils.WaitForPredicateWithContext(ctx, waitTimeout, GeneralWaitInterval, areOLMOperatorsAvailable)
+	if err == nil || c.OperatorFailureGracePeriod <= 0 || ctx.Err() != nil {
+		return err
+	}
+
+	// some operators become available shortly after their timeout, give them a last chance
+	pending := make([]string, 0, len(handlers))
+	for name := range handlers {
+		pending = append(pending, name)
+	}
+	c.log.Infof("OLM operators %v are not available after %s, waiting %s more before failing them",
+		pending, waitTimeout, c.OperatorFailureGracePeriod)
+	return utils.WaitForPredicateImmediateWithContext(ctx, c.OperatorFailureGracePeriod, GeneralWaitInterval, areOLMOperatorsAvailable)
 }
 
 // waitingForClusterOperators checks Console operator and the Cluster Version Operator availability in the
@@ -981,10 +1329,16 @@ func (c controller) waitingForClusterOperators(ctx context.Context) error {
 	ctxWithTimeout, cancel := context.WithTimeout(ctx, CVOMaxTimeout)
 	defer cancel()
 	isClusterVersionAvailable := func(timer *time.Timer) bool {
-		result := c.isOperatorAvailable(NewClusterOperatorHandler(c.kc, consoleOperatorName))
+		result := c.isOperatorAvailable(NewClusterOperatorHandler(c.kc, consoleOperatorName, c.DegradedGracePeriod, c.log))
 
 		if c.WaitForClusterVersion {
-			result = c.isOperatorAvailable(NewClusterVersionHandler(c.kc, timer)) && result
+			result = c.isOperatorAvailable(NewClusterVersionHandler(c.kc, timer, c.DegradedGracePeriod, c.log)) && result
+		}
+
+		for _, operatorName := range c.WaitForClusterOperators {
+			if operatorName != "" {
+				result = c.isClusterOperatorAvailable(operatorName) && result
+			}
 		}
 
 		return result
@@ -1017,31 +1371,36 @@ func (c *controller) updateNodesLabels() bool {
 		return KeepWaiting
 	}
 
-	retry := false
-
+	var hostnames []string
 	for hostname, hostData := range assistedNodesMap {
-
-		if len(hostData.Host.NodeLabels) == 0 {
-			continue
+		if len(hostData.Host.NodeLabels) > 0 {
+			hostnames = append(hostnames, hostname)
 		}
+	}
+
+	err = utils.ForEachConcurrent(len(hostnames), c.MaxConcurrency, func(i int) error {
+		hostname := hostnames[i]
+		nodeLabels := assistedNodesMap[hostname].Host.NodeLabels
 
 		node, err := c.kc.GetNode(hostname)
 		if err != nil {
 			log.WithError(err).Errorf("Failed to get node %s from k8s client", hostname)
-			retry = true
-			continue
-		} else if areNodeLabelsUpdated(node, hostData.Host.NodeLabels) {
-			continue
+			return err
+		} else if areNodeLabelsUpdated(node, nodeLabels) {
+			c.postInstall.nodeLabelsApplied(node.Name, nodeLabels)
+			return nil
 		}
 
-		err = c.kc.PatchNodeLabels(node.Name, hostData.Host.NodeLabels)
+		err = c.kc.PatchNodeLabels(node.Name, nodeLabels)
 		if err != nil {
-			log.WithError(err).Errorf("Failed to patch node %s with node labels %s", node.Name, hostData.Host.NodeLabels)
-			retry = true
+			log.WithError(err).Errorf("Failed to patch node %s with node labels %s", node.Name, nodeLabels)
+			return err
 		}
-	}
+		c.postInstall.nodeLabelsApplied(node.Name, nodeLabels)
+		return nil
+	})
 
-	if retry {
+	if err != nil {
 		return KeepWaiting
 	} else {
 		return ExitWaiting
@@ -1074,6 +1433,103 @@ func (c controller) logClusterOperatorsStatus() {
 	}
 }
 
+// getControllerLogs returns the controller logs, following them for LogsFollowDuration when it's set
+func (c controller) getControllerLogs(podName string, namespace string, sinceSeconds int64) (*bytes.Buffer, error) {
+	if c.LogsFollowDuration <= 0 {
+		return c.kc.GetPodLogsAsBuffer(namespace, podName, sinceSeconds)
+	}
+	podLogs, err := c.kc.FollowPodLogsAsBuffer(namespace, podName, sinceSeconds, c.LogsFollowDuration, followedLogsMaxBytes)
+	if err == nil && podLogs.Len() >= followedLogsMaxBytes {
+		c.log.Warnf("Logs of %s were truncated to %d bytes", podName, followedLogsMaxBytes)
+	}
+	return podLogs, err
+}
+
+// logTargets adds the namespaces of the failed operators to the configured log targets, so their
+// pod logs are uploaded even when must-gather isn't
+func (c controller) logTargets() LogTargets {
+	targets := append(LogTargets{}, c.LogTargets...)
+	for _, namespace := range c.Status.GetNamespacesOfOperatorsInError() {
+		targets = append(targets, LogTarget{Namespace: namespace})
+	}
+	return targets
+}
+
+// collectLogTargets returns the logs of the pods selected by the log targets. Failing to collect
+// them doesn't fail the upload of the other logs.
+func (c controller) collectLogTargets(targets LogTargets, sinceSeconds int64) []utils.TarEntry {
+	tarentries := make([]utils.TarEntry, 0)
+	for _, target := range targets {
+		pods, err := c.kc.GetPods(target.Namespace, target.Labels, "")
+		if err != nil {
+			c.log.WithError(err).Warnf("Failed to list the pods of log target %s", target)
+			continue
+		}
+		for _, pod := range pods {
+			podLogs, err := c.kc.GetPodLogsAsBuffer(target.Namespace, pod.Name, sinceSeconds)
+			if err != nil {
+				c.log.WithError(err).Warnf("Failed to get logs of pod %s in %s", pod.Name, target.Namespace)
+				continue
+			}
+			var logsReader io.Reader = podLogs
+			if c.RedactLogs {
+				logsReader = utils.NewRedactingReader(podLogs)
+			}
+			tarentries = append(tarentries,
+				*utils.NewTarEntry(logsReader, nil, int64(podLogs.Len()), fmt.Sprintf("%s_%s.logs", target.Namespace, pod.Name)))
+		}
+	}
+	return tarentries
+}
+
+// collectNodeJournals reads the journals of the nodes that are not ready, they usually explain why
+// the kubelet didn't come up while the pod logs are empty
+func (c controller) collectNodeJournals(ctx context.Context) []utils.TarEntry {
+	tarentries := make([]utils.TarEntry, 0)
+	nodes, err := c.kc.ListNodes()
+	if err != nil {
+		c.log.WithError(err).Warnf("Failed to list nodes for collecting their journals")
+		return tarentries
+	}
+	notReady := make([]string, 0)
+	for _, node := range nodes.Items {
+		if !common.IsK8sNodeIsReady(node) {
+			notReady = append(notReady, node.Name)
+		}
+	}
+	if len(notReady) == 0 {
+		return tarentries
+	}
+
+	tempDir, err := ioutil.TempDir("", "controller-node-journals-")
+	if err != nil {
+		c.log.WithError(err).Warnf("Failed to create temp directory for node journals")
+		return tarentries
+	}
+	defer os.RemoveAll(tempDir)
+	kubeconfigPath, err := c.downloadKubeconfigNoingress(ctx, tempDir)
+	if err != nil {
+		c.log.WithError(err).Warnf("Failed to download kubeconfig for collecting node journals")
+		return tarentries
+	}
+
+	for _, name := range notReady {
+		c.log.Infof("Collecting the journal of NotReady node %s", name)
+		journal, err := c.ops.GetNodeJournalLogs(kubeconfigPath, name)
+		if err != nil {
+			c.log.WithError(err).Warnf("Failed to get the journal of node %s", name)
+			continue
+		}
+		var logsReader io.Reader = strings.NewReader(journal)
+		if c.RedactLogs {
+			logsReader = utils.NewRedactingReader(logsReader)
+		}
+		tarentries = append(tarentries,
+			*utils.NewTarEntry(logsReader, nil, int64(len(journal)), fmt.Sprintf("%s_journal.logs", name)))
+	}
+	return tarentries
+}
+
 /**
  * This function upload the following logs at once to the service at the end of the installation process
  * It takes a lenient approach so if some logs are not available it ignores them and moves on
@@ -1090,29 +1546,57 @@ func (c controller) uploadSummaryLogs(podName string, namespace string, sinceSec
 	c.logClusterOperatorsStatus()
 	if c.Status.HasError() || c.Status.HasOperatorError() {
 		c.log.Infof("Uploading cluster operator status logs before must-gather")
-		err := common.UploadPodLogs(c.kc, c.ic, c.ClusterID, podName, c.Namespace, controllerLogsSecondsAgo, c.log)
+		err := common.UploadPodLogs(c.kc, c.ic, c.ClusterID, podName, c.Namespace, controllerLogsSecondsAgo, c.RedactLogs, c.log)
 		if err != nil {
 			c.log.WithError(err).Warnf("Failed to upload controller logs")
 		}
-		c.log.Infof("Uploading oc must-gather logs")
-		images := c.parseMustGatherImages()
-		if tarfile, err := c.collectMustGatherLogs(ctx, images...); err == nil {
-			if entry, tarerr := utils.NewTarEntryFromFile(tarfile); tarerr == nil {
-				tarentries = append(tarentries, *entry)
-			}
+		failures := atomic.LoadUint32(c.mustGatherFailures)
+		if c.DisableMustGather {
+			c.log.Infof("must-gather is disabled, skipping it")
+		} else if c.MustGatherMaxAttempts > 0 && failures >= uint32(c.MustGatherMaxAttempts) {
+			c.log.Errorf("must-gather failed %d times, giving up on it", failures)
 		} else {
-			ok = false
+			c.log.Infof("Uploading oc must-gather logs")
+			images := c.parseMustGatherImages()
+			if tarfile, err := c.collectMustGatherLogs(ctx, images...); err == nil {
+				if entry, tarerr := utils.NewTarEntryFromFile(tarfile); tarerr == nil {
+					tarentries = append(tarentries, *entry)
+				}
+			} else {
+				atomic.AddUint32(c.mustGatherFailures, 1)
+				ok = false
+			}
 		}
 	}
 
 	c.log.Infof("Uploading logs for %s in %s", podName, namespace)
-	if podLogs, err := c.kc.GetPodLogsAsBuffer(namespace, podName, sinceSeconds); err == nil {
+	if podLogs, err := c.getControllerLogs(podName, namespace, sinceSeconds); err == nil {
+		var logsReader io.Reader = podLogs
+		if c.RedactLogs {
+			logsReader = utils.NewRedactingReader(podLogs)
+		}
 		tarentries = append(tarentries,
-			*utils.NewTarEntry(podLogs, nil, int64(podLogs.Len()), fmt.Sprintf("%s.logs", podName)))
+			*utils.NewTarEntry(logsReader, nil, int64(podLogs.Len()), fmt.Sprintf("%s.logs", podName)))
 	} else {
 		ok = false
 	}
 
+	tarentries = append(tarentries, c.collectLogTargets(c.logTargets(), sinceSeconds)...)
+
+	if c.CollectNodeJournals {
+		tarentries = append(tarentries, c.collectNodeJournals(ctx)...)
+	}
+
+	if history := c.operatorHistory.dump(); history.Len() > 0 {
+		tarentries = append(tarentries, *utils.NewTarEntry(history, nil, int64(history.Len()), operatorHistoryFileName))
+	}
+
+	if summary, err := c.postInstall.dumpSummary(); err != nil {
+		c.log.WithError(err).Warnf("Failed to encode the installation summary")
+	} else if summary != nil {
+		tarentries = append(tarentries, *utils.NewTarEntry(summary, nil, int64(summary.Len()), installationSummaryFileName))
+	}
+
 	if len(tarentries) == 0 {
 		return errors.New("No logs are available for sending summary logs")
 	}
@@ -1261,7 +1745,7 @@ func (c *controller) UploadLogs(ctx context.Context, wg *sync.WaitGroup) {
 
 			//on normal flow, keep updating the controller log output every 5 minutes
 			c.log.Infof("Start uploading controller logs (intermediate snapshot)")
-			err := common.UploadPodLogs(c.kc, c.ic, c.ClusterID, podName, c.Namespace, controllerLogsSecondsAgo, c.log)
+			err := common.UploadPodLogs(c.kc, c.ic, c.ClusterID, podName, c.Namespace, controllerLogsSecondsAgo, c.RedactLogs, c.log)
 			if err != nil {
 				c.log.WithError(err).Warnf("Failed to upload controller logs")
 				continue
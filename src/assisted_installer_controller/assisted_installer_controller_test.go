@@ -1,14 +1,24 @@
 package assisted_installer_controller
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -142,6 +152,11 @@ var _ = Describe("installer HostRoleMaster role", func() {
 		mockk8sclient.EXPECT().ListNodes().Return(GetKubeNodes(kubeNamesIds), nil).Times(1)
 	}
 
+	allNodesInstalledEventSuccess := func() {
+		mockk8sclient.EXPECT().CreateEvent(defaultTestControllerConf.Namespace, common.AllNodesInstalledEvent, gomock.Any(),
+			common.AssistedControllerPrefix).Return(nil, nil).Times(1)
+	}
+
 	logClusterOperatorsSuccess := func() {
 		operators := configv1.ClusterOperatorList{}
 		operators.Items = []configv1.ClusterOperator{{Status: configv1.ClusterOperatorStatus{Conditions: []configv1.ClusterOperatorStatusCondition{{Type: configv1.OperatorAvailable,
@@ -196,6 +211,20 @@ var _ = Describe("installer HostRoleMaster role", func() {
 		cm := v1.ConfigMap{Data: testIngressConfigMap}
 		mockk8sclient.EXPECT().GetConfigMap(ingressConfigMapNamespace, ingressConfigMapName).Return(&cm, nil).Times(1)
 		mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), testIngressConfigMap["ca-bundle.crt"], clusterID).Return(nil).Times(1)
+		mockk8sclient.EXPECT().PatchConfigMapAnnotations(ingressConfigMapNamespace, ingressConfigMapName, gomock.Any()).Return(nil).Times(1)
+	}
+
+	// serveIngressConfigMap keeps the annotations the controller patches the ingress configmap with
+	serveIngressConfigMap := func(cm *v1.ConfigMap) {
+		mockk8sclient.EXPECT().GetConfigMap(ingressConfigMapNamespace, ingressConfigMapName).DoAndReturn(
+			func(namespace, name string) (*v1.ConfigMap, error) {
+				return cm.DeepCopy(), nil
+			}).AnyTimes()
+		mockk8sclient.EXPECT().PatchConfigMapAnnotations(ingressConfigMapNamespace, ingressConfigMapName, gomock.Any()).DoAndReturn(
+			func(namespace, name string, annotations map[string]string) error {
+				cm.Annotations = annotations
+				return nil
+			}).AnyTimes()
 	}
 
 	setControllerWaitForOLMOperators := func(clusterID string) {
@@ -285,10 +314,29 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			hosts := create3Hosts(models.HostStatusInstalled, models.HostStageDone, "")
 			mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any(), []string{models.HostStatusDisabled}).
 				Return(hosts, nil).Times(1)
+			allNodesInstalledEventSuccess()
 			exit := assistedController.waitAndUpdateNodesStatus()
 			Expect(exit).Should(Equal(true))
 		})
 
+		It("waitAndUpdateNodesStatus sends the all nodes installed event once", func() {
+			hosts := create3Hosts(models.HostStatusInstalled, models.HostStageDone, "")
+			mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any(), []string{models.HostStatusDisabled}).
+				Return(hosts, nil).Times(2)
+			allNodesInstalledEventSuccess()
+			Expect(assistedController.waitAndUpdateNodesStatus()).Should(Equal(true))
+			Expect(assistedController.waitAndUpdateNodesStatus()).Should(Equal(true))
+		})
+
+		It("waitAndUpdateNodesStatus finishes even if the all nodes installed event fails", func() {
+			hosts := create3Hosts(models.HostStatusInstalled, models.HostStageDone, "")
+			mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any(), []string{models.HostStatusDisabled}).
+				Return(hosts, nil).Times(1)
+			mockk8sclient.EXPECT().CreateEvent(defaultTestControllerConf.Namespace, common.AllNodesInstalledEvent, gomock.Any(),
+				common.AssistedControllerPrefix).Return(nil, fmt.Errorf("dummy")).Times(1)
+			Expect(assistedController.waitAndUpdateNodesStatus()).Should(Equal(true))
+		})
+
 		It("WaitAndUpdateNodesStatus including joined state", func() {
 			joined := []models.HostStage{models.HostStageJoined,
 				models.HostStageJoined,
@@ -331,6 +379,29 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			Expect(exit).Should(Equal(false))
 		})
 
+		It("reports nodes sharing a system UUID once", func() {
+			done := []models.HostStage{models.HostStageDone,
+				models.HostStageDone,
+				models.HostStageDone}
+
+			hosts := create3Hosts(models.HostStatusInstalling, models.HostStageJoined, "")
+			mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any(), []string{models.HostStatusDisabled}).
+				Return(hosts, nil).Times(4)
+			kubeNamesIds["node1"] = kubeNamesIds["node0"]
+			mockk8sclient.EXPECT().ListNodes().Return(GetKubeNodes(kubeNamesIds), nil).Times(2)
+			updateProgressSuccess(done, inventoryNamesIds)
+			updateProgressSuccess(done, inventoryNamesIds)
+			message := common.DuplicateSystemUUIDMessage(kubeNamesIds["node0"], []string{"node0", "node1"})
+			for _, name := range []string{"node0", "node1"} {
+				mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), hosts[name].Host.InfraEnvID.String(), hosts[name].Host.ID.String(),
+					models.HostStageJoined, message).Return(nil).Times(1)
+			}
+			configuringSuccess()
+
+			Expect(assistedController.waitAndUpdateNodesStatus()).Should(Equal(false))
+			Expect(assistedController.waitAndUpdateNodesStatus()).Should(Equal(false))
+		})
+
 		It("2aitAndUpdateNodesStatus getHost failure", func() {
 			mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any(), []string{models.HostStatusDisabled}).
 				Return(map[string]inventory_client.HostData{}, fmt.Errorf("dummy")).Times(1)
@@ -387,6 +458,7 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			updateProgressSuccess(defaultStages, inventoryNamesIds)
 			listNodesOneByOne()
 			configuringSuccess()
+			allNodesInstalledEventSuccess()
 
 			// first host set to installed
 			exit := assistedController.waitAndUpdateNodesStatus()
@@ -427,6 +499,7 @@ var _ = Describe("installer HostRoleMaster role", func() {
 				Return(hosts, nil).Times(1)
 
 			configuringSuccess()
+			allNodesInstalledEventSuccess()
 
 			mockk8sclient.EXPECT().ListCsrs().Return(nil, fmt.Errorf("no matter what")).AnyTimes()
 			go assistedController.WaitAndUpdateNodesStatus(context.TODO(), &wg)
@@ -451,6 +524,7 @@ var _ = Describe("installer HostRoleMaster role", func() {
 
 			listNodesOneFailure()
 			configuringSuccess()
+			allNodesInstalledEventSuccess()
 
 			mockk8sclient.EXPECT().ListCsrs().Return(nil, fmt.Errorf("no matter what")).AnyTimes()
 			go assistedController.WaitAndUpdateNodesStatus(context.TODO(), &wg)
@@ -508,6 +582,97 @@ var _ = Describe("installer HostRoleMaster role", func() {
 		})
 	})
 
+	Context("MaxConcurrency", func() {
+		var inFlight, maxInFlight int32
+		track := func() {
+			current := atomic.AddInt32(&inFlight, 1)
+			for {
+				seen := atomic.LoadInt32(&maxInFlight)
+				if current <= seen || atomic.CompareAndSwapInt32(&maxInFlight, seen, current) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+		}
+		BeforeEach(func() {
+			inFlight, maxInFlight = 0, 0
+			assistedController.MaxConcurrency = 2
+		})
+
+		It("bounds the parallel CSR approvals", func() {
+			testList := certificatesv1.CertificateSigningRequestList{}
+			for i := 0; i < 6; i++ {
+				csr := certificatesv1.CertificateSigningRequest{}
+				csr.Name = fmt.Sprintf("csr-%d", i)
+				testList.Items = append(testList.Items, csr)
+			}
+			mockk8sclient.EXPECT().ApproveCsr(gomock.Any()).DoAndReturn(func(csr *certificatesv1.CertificateSigningRequest) error {
+				track()
+				return nil
+			}).Times(6)
+			assistedController.approveCsrs(&testList)
+			Expect(maxInFlight).To(BeNumerically("<=", 2))
+		})
+
+		It("bounds the parallel host status updates by StatusUpdateConcurrency", func() {
+			assistedController.MaxConcurrency = 10
+			assistedController.StatusUpdateConcurrency = 2
+			hosts := create3Hosts(models.HostStatusInstalling, models.HostStageConfiguring, "")
+			mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any(), []string{models.HostStatusDisabled}).
+				Return(hosts, nil).Times(2)
+			configuringSuccess()
+			listNodes()
+			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), gomock.Any(), gomock.Any(),
+				gomock.Not(models.HostStageConfiguring), "").DoAndReturn(
+				func(ctx context.Context, infraEnvId, hostId string, stage models.HostStage, info string) error {
+					track()
+					return nil
+				}).Times(6)
+			Expect(assistedController.waitAndUpdateNodesStatus()).To(Equal(KeepWaiting))
+			Expect(maxInFlight).To(BeNumerically("==", 2))
+		})
+
+		It("requires a positive StatusUpdateConcurrency", func() {
+			conf := defaultTestControllerConf
+			conf.StatusUpdateConcurrency = 3
+			Expect(conf.Validate()).To(Succeed())
+			conf.StatusUpdateConcurrency = 0
+			Expect(conf.Validate()).To(MatchError(ContainSubstring("STATUS_UPDATE_CONCURRENCY must be positive")))
+		})
+
+		It("bounds the parallel node label patches", func() {
+			nodeLabels := `{"node.ocs.openshift.io/storage":""}`
+			hosts := create3Hosts(models.HostStatusInstalled, models.HostStageDone, nodeLabels)
+			mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any(), []string{models.HostStatusDisabled, models.HostStatusError}).
+				Return(hosts, nil).Times(1)
+			nodes := GetKubeNodes(kubeNamesIds)
+			for i := range nodes.Items {
+				mockk8sclient.EXPECT().GetNode(nodes.Items[i].Name).Return(&nodes.Items[i], nil).Times(1)
+			}
+			mockk8sclient.EXPECT().PatchNodeLabels(gomock.Any(), nodeLabels).DoAndReturn(func(name, labels string) error {
+				track()
+				return nil
+			}).Times(3)
+			Expect(assistedController.updateNodesLabels()).To(Equal(ExitWaiting))
+			Expect(maxInFlight).To(BeNumerically("<=", 2))
+		})
+
+		It("retries the node labels if one of the patches failed", func() {
+			nodeLabels := `{"node.ocs.openshift.io/storage":""}`
+			hosts := create3Hosts(models.HostStatusInstalled, models.HostStageDone, nodeLabels)
+			mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any(), []string{models.HostStatusDisabled, models.HostStatusError}).
+				Return(hosts, nil).Times(1)
+			nodes := GetKubeNodes(kubeNamesIds)
+			for i := range nodes.Items {
+				mockk8sclient.EXPECT().GetNode(nodes.Items[i].Name).Return(&nodes.Items[i], nil).Times(1)
+			}
+			mockk8sclient.EXPECT().PatchNodeLabels(gomock.Any(), nodeLabels).Return(nil).Times(2)
+			mockk8sclient.EXPECT().PatchNodeLabels(gomock.Any(), nodeLabels).Return(fmt.Errorf("dummy")).Times(1)
+			Expect(assistedController.updateNodesLabels()).To(Equal(KeepWaiting))
+		})
+	})
+
 	Context("validating AddRouterCAToClusterCA", func() {
 		BeforeEach(func() {
 			assistedController.WaitForClusterVersion = true
@@ -518,6 +683,14 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			res := assistedController.addRouterCAToClusterCA()
 			Expect(res).Should(Equal(true))
 		})
+		It("skips the upload when the ingress ca was already sent", func() {
+			cm := v1.ConfigMap{Data: testIngressConfigMap}
+			serveIngressConfigMap(&cm)
+			mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), testIngressConfigMap["ca-bundle.crt"], assistedController.ClusterID).Return(nil).Times(1)
+			Expect(assistedController.addRouterCAToClusterCA()).Should(Equal(true))
+			Expect(cm.Annotations).To(HaveKey(ingressCAUploadedAnnotation))
+			Expect(assistedController.addRouterCAToClusterCA()).Should(Equal(true))
+		})
 		It("Get Config map failed", func() {
 			mockk8sclient.EXPECT().GetConfigMap(ingressConfigMapNamespace, ingressConfigMapName).Return(nil, fmt.Errorf("dummy")).Times(1)
 			res := assistedController.addRouterCAToClusterCA()
@@ -580,7 +753,126 @@ var _ = Describe("installer HostRoleMaster role", func() {
 		})
 	})
 
+	Context("completionResult", func() {
+		It("reports success without a message when everything succeeded", func() {
+			success, message := completionResult(nil, []string{})
+			Expect(success).To(BeTrue())
+			Expect(message).To(BeEmpty())
+		})
+
+		It("reports success with warnings when OLM operators failed", func() {
+			success, message := completionResult(nil, []string{"ocs", "lso"})
+			Expect(success).To(BeTrue())
+			Expect(message).To(Equal("Cluster installed with warnings: OLM operators lso, ocs failed"))
+		})
+
+		It("reports a failure with its error", func() {
+			success, message := completionResult(fmt.Errorf("Timeout while waiting router ca data"), []string{"lso"})
+			Expect(success).To(BeFalse())
+			Expect(message).To(Equal("Timeout while waiting router ca data"))
+		})
+	})
+
 	Context("PostInstallConfigs", func() {
+		Context("rerun", func() {
+			BeforeEach(func() {
+				GeneralWaitInterval = 1 * time.Millisecond
+				assistedController.OpenshiftVersion = "4.6"
+			})
+
+			It("skips the steps that completed on the first run", func() {
+				setConsoleAsAvailable(assistedController.ClusterID)
+				hosts := create3Hosts(models.HostStatusInstalled, models.HostStageDone, "")
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any(), []string{models.HostStatusDisabled, models.HostStatusError}).
+					Return(hosts, nil).Times(2)
+				serveIngressConfigMap(&v1.ConfigMap{Data: testIngressConfigMap})
+				mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), testIngressConfigMap["ca-bundle.crt"], assistedController.ClusterID).Return(nil).Times(1)
+				mockk8sclient.EXPECT().UnPatchEtcd().Return(nil).Times(2)
+				// the service has the final status of the OLM operators, their CSVs aren't checked
+				mockbmclient.EXPECT().GetClusterMonitoredOLMOperators(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return([]models.MonitoredOperator{{Name: "lso", Status: models.OperatorStatusAvailable, OperatorType: models.OperatorTypeOlm}}, nil).Times(2)
+
+				Expect(assistedController.postInstallConfigs(context.TODO())).To(Succeed())
+				Expect(assistedController.postInstallConfigs(context.TODO())).To(Succeed())
+			})
+
+			It("uploads the ingress ca again if it changed", func() {
+				setConsoleAsAvailable(assistedController.ClusterID)
+				hosts := create3Hosts(models.HostStatusInstalled, models.HostStageDone, "")
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any(), []string{models.HostStatusDisabled, models.HostStatusError}).
+					Return(hosts, nil).Times(2)
+				cm := v1.ConfigMap{Data: testIngressConfigMap}
+				serveIngressConfigMap(&cm)
+				mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), testIngressConfigMap["ca-bundle.crt"], assistedController.ClusterID).Return(nil).Times(1)
+				mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), "rotated CA", assistedController.ClusterID).Return(nil).Times(1)
+				mockk8sclient.EXPECT().UnPatchEtcd().Return(nil).Times(2)
+				mockGetOLMOperators([]models.MonitoredOperator{})
+				mockGetOLMOperators([]models.MonitoredOperator{})
+
+				Expect(assistedController.postInstallConfigs(context.TODO())).To(Succeed())
+				cm.Data = map[string]string{"ca-bundle.crt": "rotated CA"}
+				Expect(assistedController.postInstallConfigs(context.TODO())).To(Succeed())
+			})
+
+			It("redoes the steps that didn't complete", func() {
+				setConsoleAsAvailable(assistedController.ClusterID)
+				hosts := create3Hosts(models.HostStatusInstalled, models.HostStageDone, "")
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any(), []string{models.HostStatusDisabled, models.HostStatusError}).
+					Return(hosts, nil).Times(2)
+				serveIngressConfigMap(&v1.ConfigMap{Data: testIngressConfigMap})
+				mockbmclient.EXPECT().UploadIngressCa(gomock.Any(), testIngressConfigMap["ca-bundle.crt"], assistedController.ClusterID).Return(nil).Times(1)
+				unpatchErr := fmt.Errorf("dummy")
+				mockk8sclient.EXPECT().UnPatchEtcd().DoAndReturn(func() error { return unpatchErr }).MinTimes(2)
+				Expect(assistedController.postInstallConfigs(context.TODO())).NotTo(Succeed())
+
+				unpatchErr = nil
+				mockGetOLMOperators([]models.MonitoredOperator{})
+				Expect(assistedController.postInstallConfigs(context.TODO())).To(Succeed())
+			})
+		})
+
+		Context("waiting for machine config pools", func() {
+			var (
+				updating = []k8s_client.MachineConfigPool{
+					{Name: "master", MachineCount: 3, UpdatedMachineCount: 3, Updated: true},
+					{Name: "worker", MachineCount: 2, UpdatedMachineCount: 1},
+				}
+				updated = []k8s_client.MachineConfigPool{
+					{Name: "master", MachineCount: 3, UpdatedMachineCount: 3, Updated: true},
+					{Name: "worker", MachineCount: 2, UpdatedMachineCount: 2, Updated: true},
+				}
+			)
+
+			BeforeEach(func() {
+				GeneralWaitInterval = 1 * time.Millisecond
+				assistedController.OpenshiftVersion = "4.6"
+				assistedController.WaitForMachineConfigPools = true
+				setConsoleAsAvailable(assistedController.ClusterID)
+				hosts := create3Hosts(models.HostStatusInstalled, models.HostStageDone, "")
+				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any(), []string{models.HostStatusDisabled, models.HostStatusError}).
+					Return(hosts, nil).Times(1)
+				uploadIngressCert(assistedController.ClusterID)
+				mockk8sclient.EXPECT().UnPatchEtcd().Return(nil).Times(1)
+				mockGetOLMOperators([]models.MonitoredOperator{})
+			})
+
+			It("waits for the updating pools to be updated", func() {
+				gomock.InOrder(
+					mockk8sclient.EXPECT().ListMachineConfigPools().Return(nil, fmt.Errorf("dummy")).Times(1),
+					mockk8sclient.EXPECT().ListMachineConfigPools().Return(updating, nil).Times(2),
+					mockk8sclient.EXPECT().ListMachineConfigPools().Return(updated, nil).Times(1),
+				)
+				Expect(assistedController.postInstallConfigs(context.TODO())).To(Succeed())
+			})
+
+			It("fails when the pools keep updating", func() {
+				WaitTimeout = 50 * time.Millisecond
+				mockk8sclient.EXPECT().ListMachineConfigPools().Return(updating, nil).MinTimes(1)
+				err := assistedController.postInstallConfigs(context.TODO())
+				Expect(err).To(MatchError(ContainSubstring("Timeout while waiting for machine config pools to be updated")))
+			})
+		})
+
 		Context("waiting for cluster version", func() {
 			BeforeEach(func() {
 				assistedController.WaitForClusterVersion = true
@@ -870,7 +1162,8 @@ var _ = Describe("installer HostRoleMaster role", func() {
 				})
 
 				mockbmclient.EXPECT().UpdateClusterOperator(gomock.Any(), "cluster-id", "lso", models.OperatorStatusFailed, "Waiting for operator timed out").Return(nil).Times(1)
-				mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true, "").Return(nil).Times(1)
+				mockbmclient.EXPECT().CompleteInstallation(gomock.Any(), "cluster-id", true,
+					"Cluster installed with warnings: OLM operators lso failed").Return(nil).Times(1)
 
 				hosts := create3Hosts(models.HostStatusInstalled, models.HostStageDone, "")
 				mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any(), []string{models.HostStatusDisabled, models.HostStatusError}).
@@ -1083,6 +1376,132 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			Expect(err).NotTo(HaveOccurred())
 		})
 
+		It("Validate upload logs follows the controller logs when configured", func() {
+			assistedController.LogsFollowDuration = time.Minute
+			r := bytes.NewBuffer([]byte("test"))
+			mockk8sclient.EXPECT().FollowPodLogsAsBuffer(assistedController.Namespace, "test", int64(controllerLogsSecondsAgo),
+				time.Minute, int64(followedLogsMaxBytes)).Return(r, nil).Times(1)
+			mockbmclient.EXPECT().UploadLogs(gomock.Any(), assistedController.ClusterID, models.LogsTypeController, gomock.Any()).Return(nil).Times(1)
+			logClusterOperatorsSuccess()
+			reportLogProgressSuccess()
+			err := assistedController.uploadSummaryLogs("test", assistedController.Namespace, controllerLogsSecondsAgo)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Validate upload logs redacts secrets when configured", func() {
+			const fakeToken = "sha256~AbCdEfGhIjKlMnOpQrStUvWxYz0123456789"
+			assistedController.RedactLogs = true
+			r := bytes.NewBuffer([]byte("starting\nlogin with token=" + fakeToken + "\n"))
+			mockk8sclient.EXPECT().GetPodLogsAsBuffer(assistedController.Namespace, "test", gomock.Any()).Return(r, nil).Times(1)
+			var uploaded string
+			mockbmclient.EXPECT().UploadLogs(gomock.Any(), assistedController.ClusterID, models.LogsTypeController, gomock.Any()).DoAndReturn(
+				func(ctx context.Context, clusterId string, logsType models.LogsType, reader io.Reader) error {
+					gz, err := gzip.NewReader(reader)
+					Expect(err).NotTo(HaveOccurred())
+					tr := tar.NewReader(gz)
+					_, err = tr.Next()
+					Expect(err).NotTo(HaveOccurred())
+					content, err := ioutil.ReadAll(tr)
+					Expect(err).NotTo(HaveOccurred())
+					uploaded = string(content)
+					return nil
+				}).Times(1)
+			logClusterOperatorsSuccess()
+			reportLogProgressSuccess()
+			err := assistedController.uploadSummaryLogs("test", assistedController.Namespace, controllerLogsSecondsAgo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uploaded).To(Equal("starting\nlogin with token=" + strings.Repeat("*", len(fakeToken)) + "\n"))
+		})
+
+		It("Validate upload logs collects the logs of the log targets", func() {
+			Expect(assistedController.LogTargets.Decode("openshift-ingress:app=router")).To(Succeed())
+			mockk8sclient.EXPECT().GetPodLogsAsBuffer(assistedController.Namespace, "test", gomock.Any()).Return(bytes.NewBufferString("controller"), nil).Times(1)
+			mockk8sclient.EXPECT().GetPods("openshift-ingress", map[string]string{"app": "router"}, "").Return(
+				[]v1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "router-1"}}}, nil).Times(1)
+			mockk8sclient.EXPECT().GetPodLogsAsBuffer("openshift-ingress", "router-1", gomock.Any()).Return(bytes.NewBufferString("router"), nil).Times(1)
+			uploaded := map[string]string{}
+			mockbmclient.EXPECT().UploadLogs(gomock.Any(), assistedController.ClusterID, models.LogsTypeController, gomock.Any()).DoAndReturn(
+				func(ctx context.Context, clusterId string, logsType models.LogsType, reader io.Reader) error {
+					gz, err := gzip.NewReader(reader)
+					Expect(err).NotTo(HaveOccurred())
+					tr := tar.NewReader(gz)
+					for header, err := tr.Next(); err == nil; header, err = tr.Next() {
+						content, readErr := ioutil.ReadAll(tr)
+						Expect(readErr).NotTo(HaveOccurred())
+						uploaded[header.Name] = string(content)
+					}
+					return nil
+				}).Times(1)
+			logClusterOperatorsSuccess()
+			reportLogProgressSuccess()
+			err := assistedController.uploadSummaryLogs("test", assistedController.Namespace, controllerLogsSecondsAgo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uploaded).To(Equal(map[string]string{"test.logs": "controller", "openshift-ingress_router-1.logs": "router"}))
+		})
+
+		It("Validate upload logs collects the pod logs of failed operators", func() {
+			assistedController.DisableMustGather = true
+			assistedController.Status.OperatorErrorInNamespace("lso", "openshift-local-storage")
+			mockk8sclient.EXPECT().GetPodLogsAsBuffer(assistedController.Namespace, "test", gomock.Any()).DoAndReturn(
+				func(namespace, podName string, sinceSeconds int64) (*bytes.Buffer, error) {
+					return bytes.NewBufferString("controller"), nil
+				}).Times(2)
+			mockk8sclient.EXPECT().GetPods("openshift-local-storage", nil, "").Return(
+				[]v1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "lso-operator"}}}, nil).Times(1)
+			mockk8sclient.EXPECT().GetPodLogsAsBuffer("openshift-local-storage", "lso-operator", gomock.Any()).Return(bytes.NewBufferString("lso"), nil).Times(1)
+			uploaded := map[string]string{}
+			mockbmclient.EXPECT().UploadLogs(gomock.Any(), assistedController.ClusterID, models.LogsTypeController, gomock.Any()).DoAndReturn(
+				func(ctx context.Context, clusterId string, logsType models.LogsType, reader io.Reader) error {
+					gz, err := gzip.NewReader(reader)
+					Expect(err).NotTo(HaveOccurred())
+					tr := tar.NewReader(gz)
+					for header, err := tr.Next(); err == nil; header, err = tr.Next() {
+						content, readErr := ioutil.ReadAll(tr)
+						Expect(readErr).NotTo(HaveOccurred())
+						uploaded[header.Name] = string(content)
+					}
+					return nil
+				}).Times(2)
+			logClusterOperatorsSuccess()
+			reportLogProgressSuccess()
+			err := assistedController.uploadSummaryLogs("test", assistedController.Namespace, controllerLogsSecondsAgo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uploaded).To(HaveKeyWithValue("openshift-local-storage_lso-operator.logs", "lso"))
+		})
+
+		It("Validate upload logs collects the journals of NotReady nodes only", func() {
+			assistedController.CollectNodeJournals = true
+			nodeWithReadiness := func(name string, status v1.ConditionStatus) v1.Node {
+				return v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name},
+					Status: v1.NodeStatus{Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: status}}}}
+			}
+			mockk8sclient.EXPECT().ListNodes().Return(&v1.NodeList{Items: []v1.Node{
+				nodeWithReadiness("node0", v1.ConditionTrue),
+				nodeWithReadiness("node1", v1.ConditionFalse),
+			}}, nil).Times(1)
+			mockbmclient.EXPECT().DownloadClusterCredentials(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1)
+			mockops.EXPECT().GetNodeJournalLogs(gomock.Any(), "node1").Return("kubelet failed", nil).Times(1)
+			mockk8sclient.EXPECT().GetPodLogsAsBuffer(assistedController.Namespace, "test", gomock.Any()).Return(bytes.NewBufferString("controller"), nil).Times(1)
+			uploaded := map[string]string{}
+			mockbmclient.EXPECT().UploadLogs(gomock.Any(), assistedController.ClusterID, models.LogsTypeController, gomock.Any()).DoAndReturn(
+				func(ctx context.Context, clusterId string, logsType models.LogsType, reader io.Reader) error {
+					gz, err := gzip.NewReader(reader)
+					Expect(err).NotTo(HaveOccurred())
+					tr := tar.NewReader(gz)
+					for header, err := tr.Next(); err == nil; header, err = tr.Next() {
+						content, readErr := ioutil.ReadAll(tr)
+						Expect(readErr).NotTo(HaveOccurred())
+						uploaded[header.Name] = string(content)
+					}
+					return nil
+				}).Times(1)
+			logClusterOperatorsSuccess()
+			reportLogProgressSuccess()
+			err := assistedController.uploadSummaryLogs("test", assistedController.Namespace, controllerLogsSecondsAgo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uploaded).To(Equal(map[string]string{"test.logs": "controller", "node1_journal.logs": "kubelet failed"}))
+		})
+
 		It("Validate upload logs happy flow (controllers logs only) and list operators failed ", func() {
 			reportLogProgressSuccess()
 			mockk8sclient.EXPECT().ListClusterOperators().Return(nil, fmt.Errorf("dummy"))
@@ -1152,6 +1571,26 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			callUploadLogs(50 * time.Millisecond)
 		})
 
+		It("Validate must-gather is abandoned after the maximum attempts", func() {
+			assistedController.MustGatherMaxAttempts = 2
+			successUpload()
+			logClusterOperatorsSuccess()
+			mockops.EXPECT().GetMustGatherLogs(gomock.Any(), gomock.Any(), gomock.Any()).Return("", fmt.Errorf("failed")).Times(2)
+			mockbmclient.EXPECT().DownloadClusterCredentials(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(2)
+			assistedController.Status.Error()
+			callUploadLogs(100 * time.Millisecond)
+		})
+
+		It("Validate must-gather logs are not collected when disabled", func() {
+			assistedController.DisableMustGather = true
+			successUpload()
+			logClusterOperatorsSuccess()
+			mockops.EXPECT().GetMustGatherLogs(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			mockbmclient.EXPECT().DownloadClusterCredentials(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			assistedController.Status.Error()
+			callUploadLogs(50 * time.Millisecond)
+		})
+
 		It("Validate must-gather logs are retried on error - while cluster error occurred", func() {
 			successUpload()
 			logClusterOperatorsSuccess()
@@ -1224,12 +1663,34 @@ var _ = Describe("installer HostRoleMaster role", func() {
 		BeforeEach(func() {
 			GeneralWaitInterval = 100 * time.Millisecond
 			WaitTimeout = 150 * time.Millisecond
+			FetchRetryInterval = time.Millisecond
 		})
 
 		It("List is empty", func() {
 			mockbmclient.EXPECT().GetClusterMonitoredOLMOperators(gomock.Any(), gomock.Any(), gomock.Any()).Return([]models.MonitoredOperator{}, nil).Times(1)
 			Expect(assistedController.waitForOLMOperators(context.TODO())).To(BeNil())
 		})
+		It("retries a transient failure to list the operators", func() {
+			gomock.InOrder(
+				mockbmclient.EXPECT().GetClusterMonitoredOLMOperators(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("service unavailable")).Times(2),
+				mockbmclient.EXPECT().GetClusterMonitoredOLMOperators(gomock.Any(), gomock.Any(), gomock.Any()).Return([]models.MonitoredOperator{}, nil).Times(1),
+			)
+			Expect(assistedController.waitForOLMOperators(context.TODO())).To(Succeed())
+		})
+		It("retries a transient failure to list the progressing operators", func() {
+			FetchRetryInterval = time.Millisecond
+			operators := []models.MonitoredOperator{
+				{
+					SubscriptionName: subscriptionName, Namespace: namespaceName,
+					Name: operatorName, Status: models.OperatorStatusAvailable, OperatorType: models.OperatorTypeOlm,
+				},
+			}
+			gomock.InOrder(
+				mockbmclient.EXPECT().GetClusterMonitoredOLMOperators(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("service unavailable")).Times(1),
+				mockbmclient.EXPECT().GetClusterMonitoredOLMOperators(gomock.Any(), gomock.Any(), gomock.Any()).Return(operators, nil).Times(1),
+			)
+			Expect(assistedController.waitForCSV(context.TODO(), WaitTimeout)).To(Succeed())
+		})
 		It("progressing - no update (empty message)", func() {
 			operators := []models.MonitoredOperator{
 				{
@@ -1318,6 +1779,57 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			Expect(assistedController.waitForCSV(context.TODO(), LongWaitTimeout)).To(BeNil())
 		})
 
+		It("recovers within the failure grace period", func() {
+			assistedController.OperatorFailureGracePeriod = time.Second
+			operators := []models.MonitoredOperator{
+				{
+					SubscriptionName: subscriptionName, Namespace: namespaceName,
+					Name: operatorName, Status: models.OperatorStatusProgressing, OperatorType: models.OperatorTypeOlm,
+				},
+			}
+
+			mockGetOLMOperators(operators)
+			// times out
+			mockGetServiceOperators(operators)
+			mockGetCSV(
+				operators[0],
+				&olmv1alpha1.ClusterServiceVersion{Status: olmv1alpha1.ClusterServiceVersionStatus{Phase: olmv1alpha1.CSVPhaseInstalling}},
+			)
+			// becomes available during the grace period
+			mockGetServiceOperators(operators)
+			mockGetCSV(
+				operators[0],
+				&olmv1alpha1.ClusterServiceVersion{Status: olmv1alpha1.ClusterServiceVersionStatus{Phase: olmv1alpha1.CSVPhaseSucceeded}},
+			)
+			mockbmclient.EXPECT().UpdateClusterOperator(gomock.Any(), gomock.Any(), operatorName, models.OperatorStatusAvailable, gomock.Any()).Return(nil).Times(1)
+			available := []models.MonitoredOperator{operators[0]}
+			available[0].Status = models.OperatorStatusAvailable
+			mockGetServiceOperators(available)
+
+			Expect(assistedController.waitForCSV(context.TODO(), WaitTimeout)).To(Succeed())
+		})
+
+		It("fails after the failure grace period", func() {
+			assistedController.OperatorFailureGracePeriod = 250 * time.Millisecond
+			operators := []models.MonitoredOperator{
+				{
+					SubscriptionName: subscriptionName, Namespace: namespaceName,
+					Name: operatorName, Status: models.OperatorStatusProgressing, OperatorType: models.OperatorTypeOlm,
+				},
+			}
+
+			mockGetOLMOperators(operators)
+			// checked during the timeout, right after it and during the grace period
+			mockbmclient.EXPECT().GetClusterMonitoredOperator(gomock.Any(), gomock.Any(), operatorName, gomock.Any()).Return(&operators[0], nil).MinTimes(3)
+			mockk8sclient.EXPECT().GetCSVFromSubscription(namespaceName, subscriptionName).Return("lso-csv", nil).MinTimes(3)
+			mockk8sclient.EXPECT().GetCSV(namespaceName, "lso-csv").Return(
+				&olmv1alpha1.ClusterServiceVersion{Status: olmv1alpha1.ClusterServiceVersionStatus{Phase: olmv1alpha1.CSVPhaseInstalling}}, nil).MinTimes(3)
+
+			start := time.Now()
+			Expect(assistedController.waitForCSV(context.TODO(), WaitTimeout)).To(HaveOccurred())
+			Expect(time.Since(start)).To(BeNumerically(">=", WaitTimeout+assistedController.OperatorFailureGracePeriod))
+		})
+
 		It("multiple OLMs", func() {
 			operators := []models.MonitoredOperator{
 				{
@@ -1556,6 +2068,290 @@ var _ = Describe("installer HostRoleMaster role", func() {
 		})
 	})
 
+	Context("Startup delay", func() {
+		It("is bounded by the configured maximum", func() {
+			for i := 0; i < 100; i++ {
+				delay := startupDelay(time.Second)
+				Expect(delay).To(BeNumerically(">=", 0))
+				Expect(delay).To(BeNumerically("<", time.Second))
+			}
+		})
+
+		It("is disabled by a zero maximum", func() {
+			Expect(startupDelay(0)).To(BeZero())
+		})
+	})
+
+	Context("waitingForClusterOperators with extra cluster operators", func() {
+		const authenticationOperatorName = "authentication"
+
+		clusterOperator := func(conditionType configv1.ClusterStatusConditionType, message string) *configv1.ClusterOperator {
+			return &configv1.ClusterOperator{Status: configv1.ClusterOperatorStatus{
+				Conditions: []configv1.ClusterOperatorStatusCondition{{Type: conditionType, Status: configv1.ConditionTrue, Message: message}},
+			}}
+		}
+
+		BeforeEach(func() {
+			GeneralProgressUpdateInt = 10 * time.Millisecond
+			WaitTimeout = 150 * time.Millisecond
+			CVOMaxTimeout = 1 * time.Second
+			assistedController.WaitForClusterOperators = []string{authenticationOperatorName}
+			mockbmclient.EXPECT().GetClusterMonitoredOperator(gomock.Any(), gomock.Any(), consoleOperatorName, gomock.Any()).
+				Return(&models.MonitoredOperator{Status: models.OperatorStatusAvailable}, nil).AnyTimes()
+		})
+
+		It("waits for the extra operator to be available", func() {
+			gomock.InOrder(
+				mockk8sclient.EXPECT().GetClusterOperator(authenticationOperatorName).Return(clusterOperator(configv1.OperatorProgressing, "rolling out"), nil).Times(2),
+				mockk8sclient.EXPECT().GetClusterOperator(authenticationOperatorName).Return(clusterOperator(configv1.OperatorAvailable, ""), nil).Times(1),
+			)
+			// the service keeps the last reported status
+			inService := &models.MonitoredOperator{Name: authenticationOperatorName}
+			mockbmclient.EXPECT().GetClusterMonitoredOperator(gomock.Any(), gomock.Any(), authenticationOperatorName, gomock.Any()).
+				DoAndReturn(func(_ context.Context, _, _, _ string) (*models.MonitoredOperator, error) {
+					operator := *inService
+					return &operator, nil
+				}).Times(3)
+			report := func(_ context.Context, _, _ string, status models.OperatorStatus, message string) error {
+				inService.Status, inService.StatusInfo = status, message
+				return nil
+			}
+			mockbmclient.EXPECT().UpdateClusterOperator(gomock.Any(), gomock.Any(), authenticationOperatorName, models.OperatorStatusProgressing, "rolling out").
+				DoAndReturn(report).Times(1)
+			mockbmclient.EXPECT().UpdateClusterOperator(gomock.Any(), gomock.Any(), authenticationOperatorName, models.OperatorStatusAvailable, "").
+				DoAndReturn(report).Times(1)
+
+			Expect(assistedController.waitingForClusterOperators(context.TODO())).To(Succeed())
+		})
+
+		It("doesn't report an extra operator the service doesn't monitor", func() {
+			gomock.InOrder(
+				mockk8sclient.EXPECT().GetClusterOperator(authenticationOperatorName).Return(clusterOperator(configv1.OperatorProgressing, "rolling out"), nil).Times(1),
+				mockk8sclient.EXPECT().GetClusterOperator(authenticationOperatorName).Return(clusterOperator(configv1.OperatorAvailable, ""), nil).Times(1),
+			)
+			mockbmclient.EXPECT().GetClusterMonitoredOperator(gomock.Any(), gomock.Any(), authenticationOperatorName, gomock.Any()).
+				Return(nil, fmt.Errorf("operator %s not found", authenticationOperatorName)).Times(2)
+			mockbmclient.EXPECT().UpdateClusterOperator(gomock.Any(), gomock.Any(), authenticationOperatorName, gomock.Any(), gomock.Any()).Times(0)
+
+			Expect(assistedController.waitingForClusterOperators(context.TODO())).To(Succeed())
+		})
+
+		It("fails when the extra operator isn't available in time", func() {
+			mockk8sclient.EXPECT().GetClusterOperator(authenticationOperatorName).Return(nil, fmt.Errorf("not found")).MinTimes(1)
+
+			Expect(assistedController.waitingForClusterOperators(context.TODO())).To(HaveOccurred())
+		})
+	})
+
+	Context("Operator status history", func() {
+		It("records the transitions of a flapping operator", func() {
+			statuses := []configv1.ClusterOperatorStatusCondition{
+				{Type: configv1.OperatorProgressing, Status: configv1.ConditionTrue, Message: "rolling out"},
+				{Type: configv1.OperatorDegraded, Status: configv1.ConditionTrue, Message: "pods crashing"},
+				{Type: configv1.OperatorProgressing, Status: configv1.ConditionTrue, Message: "rolling out"},
+				{Type: configv1.OperatorProgressing, Status: configv1.ConditionTrue, Message: "rolling out"},
+			}
+			call := 0
+			mockk8sclient.EXPECT().GetClusterOperator(consoleOperatorName).DoAndReturn(func(name string) (*configv1.ClusterOperator, error) {
+				co := &configv1.ClusterOperator{Status: configv1.ClusterOperatorStatus{
+					Conditions: []configv1.ClusterOperatorStatusCondition{statuses[call]}}}
+				call++
+				return co, nil
+			}).Times(len(statuses))
+			mockbmclient.EXPECT().GetClusterMonitoredOperator(gomock.Any(), gomock.Any(), consoleOperatorName, gomock.Any()).
+				Return(&models.MonitoredOperator{Status: models.OperatorStatusProgressing}, nil).Times(len(statuses))
+			mockbmclient.EXPECT().UpdateClusterOperator(gomock.Any(), gomock.Any(), consoleOperatorName, gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+			handler := NewClusterOperatorHandler(mockk8sclient, consoleOperatorName, 0, l)
+			for range statuses {
+				Expect(assistedController.isOperatorAvailable(handler)).To(BeFalse())
+			}
+
+			transitions := assistedController.operatorHistory.list()
+			Expect(transitions).To(HaveLen(3))
+			Expect(transitions[0].Status).To(Equal(models.OperatorStatusProgressing))
+			Expect(transitions[1].Status).To(Equal(models.OperatorStatusFailed))
+			Expect(transitions[1].Message).To(Equal("pods crashing"))
+			Expect(transitions[2].Status).To(Equal(models.OperatorStatusProgressing))
+		})
+
+		It("reports a recently degraded operator as progressing within the degraded grace period", func() {
+			co := &configv1.ClusterOperator{Status: configv1.ClusterOperatorStatus{
+				Conditions: []configv1.ClusterOperatorStatusCondition{
+					{Type: configv1.OperatorDegraded, Status: configv1.ConditionTrue, Message: "rolling out",
+						LastTransitionTime: metav1.NewTime(time.Now().Add(-time.Minute))},
+				}}}
+			mockk8sclient.EXPECT().GetClusterOperator(consoleOperatorName).Return(co, nil).Times(2)
+
+			status, _, err := NewClusterOperatorHandler(mockk8sclient, consoleOperatorName, 10*time.Minute, l).GetStatus()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status).To(Equal(models.OperatorStatusProgressing))
+
+			status, _, err = NewClusterOperatorHandler(mockk8sclient, consoleOperatorName, 0, l).GetStatus()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status).To(Equal(models.OperatorStatusFailed))
+		})
+
+		It("includes the history in the uploaded logs", func() {
+			assistedController.operatorHistory.record("lso", models.OperatorStatusProgressing, "installing")
+			assistedController.operatorHistory.record("lso", models.OperatorStatusFailed, "install failed")
+			mockk8sclient.EXPECT().GetPodLogsAsBuffer(assistedController.Namespace, "test", gomock.Any()).Return(bytes.NewBufferString("controller"), nil).Times(1)
+			uploaded := map[string]string{}
+			mockbmclient.EXPECT().UploadLogs(gomock.Any(), assistedController.ClusterID, models.LogsTypeController, gomock.Any()).DoAndReturn(
+				func(ctx context.Context, clusterId string, logsType models.LogsType, reader io.Reader) error {
+					gz, err := gzip.NewReader(reader)
+					Expect(err).NotTo(HaveOccurred())
+					tr := tar.NewReader(gz)
+					for header, err := tr.Next(); err == nil; header, err = tr.Next() {
+						content, readErr := ioutil.ReadAll(tr)
+						Expect(readErr).NotTo(HaveOccurred())
+						uploaded[header.Name] = string(content)
+					}
+					return nil
+				}).Times(1)
+			mockk8sclient.EXPECT().ListClusterOperators().Return(&configv1.ClusterOperatorList{}, nil).Times(1)
+
+			Expect(assistedController.uploadSummaryLogs("test", assistedController.Namespace, controllerLogsSecondsAgo)).To(Succeed())
+			Expect(uploaded).To(HaveKey(operatorHistoryFileName))
+			lines := strings.Split(strings.TrimSpace(uploaded[operatorHistoryFileName]), "\n")
+			Expect(lines).To(HaveLen(2))
+			Expect(lines[0]).To(HaveSuffix("lso progressing installing"))
+			Expect(lines[1]).To(HaveSuffix("lso failed install failed"))
+		})
+	})
+
+	Context("node debug view", func() {
+		bootstrapperCsr := func(name, nodeName string) certificatesv1.CertificateSigningRequest {
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			request, err := x509.CreateCertificateRequest(rand.Reader,
+				&x509.CertificateRequest{Subject: pkix.Name{CommonName: "system:node:" + nodeName}}, key)
+			Expect(err).NotTo(HaveOccurred())
+			return certificatesv1.CertificateSigningRequest{ObjectMeta: metav1.ObjectMeta{Name: name},
+				Spec: certificatesv1.CertificateSigningRequestSpec{
+					Username: "system:serviceaccount:openshift-machine-config-operator:node-bootstrapper",
+					Request:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: request}),
+				}}
+		}
+		servingCsr := func(name, nodeName string, conditions ...certificatesv1.RequestConditionType) certificatesv1.CertificateSigningRequest {
+			csr := certificatesv1.CertificateSigningRequest{ObjectMeta: metav1.ObjectMeta{Name: name},
+				Spec: certificatesv1.CertificateSigningRequestSpec{Username: "system:node:" + nodeName}}
+			for _, condition := range conditions {
+				csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{Type: condition})
+			}
+			return csr
+		}
+
+		It("assembles the view of a single node", func() {
+			status := models.HostStatusInstalling
+			hosts := map[string]inventory_client.HostData{
+				"node0": {Host: &models.Host{RequestedHostname: "node0", Status: &status}},
+				"node1": {Host: &models.Host{RequestedHostname: "node1", Status: &status}},
+			}
+			mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any(), []string{models.HostStatusDisabled}).Return(hosts, nil).Times(1)
+			conditions := []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionFalse}}
+			mockk8sclient.EXPECT().ListNodes().Return(&v1.NodeList{Items: []v1.Node{
+				{ObjectMeta: metav1.ObjectMeta{Name: "node0"}, Status: v1.NodeStatus{Conditions: conditions}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+			}}, nil).Times(1)
+			mockk8sclient.EXPECT().ListMachines().Return(&machinev1beta1.MachineList{Items: []machinev1beta1.Machine{
+				{ObjectMeta: metav1.ObjectMeta{Name: "machine0", Annotations: map[string]string{"metal3.io/BareMetalHost": "openshift-machine-api/bmh0"}},
+					Status: machinev1beta1.MachineStatus{NodeRef: &v1.ObjectReference{Name: "node0"}}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "machine1", Annotations: map[string]string{"metal3.io/BareMetalHost": "openshift-machine-api/bmh1"}},
+					Status: machinev1beta1.MachineStatus{NodeRef: &v1.ObjectReference{Name: "node1"}}},
+			}}, nil).Times(1)
+			bmh := &metal3v1alpha1.BareMetalHost{ObjectMeta: metav1.ObjectMeta{Name: "bmh0"}}
+			mockk8sclient.EXPECT().GetBMH("bmh0").Return(bmh, nil).Times(1)
+			mockk8sclient.EXPECT().ListCsrs().Return(&certificatesv1.CertificateSigningRequestList{Items: []certificatesv1.CertificateSigningRequest{
+				bootstrapperCsr("csr-client", "node0"),
+				servingCsr("csr-serving", "node0"),
+				servingCsr("csr-approved", "node0", certificatesv1.CertificateApproved),
+				servingCsr("csr-denied", "node0", certificatesv1.CertificateDenied),
+				servingCsr("csr-other-node", "node1"),
+				bootstrapperCsr("csr-other-node-client", "node1"),
+			}}, nil).Times(1)
+
+			view, err := assistedController.GetNodeDebugView(context.TODO(), "node0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(view.Name).To(Equal("node0"))
+			Expect(view.Host.Host.RequestedHostname).To(Equal("node0"))
+			Expect(view.Conditions).To(Equal(conditions))
+			Expect(view.Machine.Name).To(Equal("machine0"))
+			Expect(view.BMH).To(Equal(bmh))
+			Expect(view.PendingCsrs).To(HaveLen(2))
+			Expect([]string{view.PendingCsrs[0].Name, view.PendingCsrs[1].Name}).To(Equal([]string{"csr-client", "csr-serving"}))
+			Expect(view.Errors).To(BeEmpty())
+		})
+
+		It("returns a partial view when some calls fail", func() {
+			mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any(), []string{models.HostStatusDisabled}).Return(nil, fmt.Errorf("dummy")).Times(1)
+			mockk8sclient.EXPECT().ListNodes().Return(&v1.NodeList{Items: []v1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "node0"}}}}, nil).Times(1)
+			mockk8sclient.EXPECT().ListMachines().Return(nil, fmt.Errorf("dummy")).Times(1)
+			mockk8sclient.EXPECT().ListCsrs().Return(&certificatesv1.CertificateSigningRequestList{}, nil).Times(1)
+
+			view, err := assistedController.GetNodeDebugView(context.TODO(), "node0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(view.Host).To(BeNil())
+			Expect(view.Machine).To(BeNil())
+			Expect(view.Errors).To(HaveLen(2))
+		})
+
+		It("fails for an unknown node", func() {
+			mockbmclient.EXPECT().GetHosts(gomock.Any(), gomock.Any(), []string{models.HostStatusDisabled}).Return(map[string]inventory_client.HostData{}, nil).Times(1)
+			mockk8sclient.EXPECT().ListNodes().Return(&v1.NodeList{}, nil).Times(1)
+			_, err := assistedController.GetNodeDebugView(context.TODO(), "node0")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("Installation summary", func() {
+		It("uploads the summary with the logs once the post installation completed", func() {
+			started := time.Now().UTC().Add(-time.Minute)
+			assistedController.operatorHistory.record("lso", models.OperatorStatusAvailable, "installed")
+			assistedController.postInstall.complete(postInstallStepClusterOperators)
+			assistedController.postInstall.nodeLabelsApplied("node0", `{"node.ocs.openshift.io/storage":""}`)
+			assistedController.postInstall.setSummary(assistedController.installationSummary(started, true, ""))
+
+			mockk8sclient.EXPECT().GetPodLogsAsBuffer(assistedController.Namespace, "test", gomock.Any()).Return(bytes.NewBufferString("controller"), nil).Times(1)
+			uploaded := map[string]string{}
+			mockbmclient.EXPECT().UploadLogs(gomock.Any(), assistedController.ClusterID, models.LogsTypeController, gomock.Any()).DoAndReturn(
+				func(ctx context.Context, clusterId string, logsType models.LogsType, reader io.Reader) error {
+					gz, err := gzip.NewReader(reader)
+					Expect(err).NotTo(HaveOccurred())
+					tr := tar.NewReader(gz)
+					for header, err := tr.Next(); err == nil; header, err = tr.Next() {
+						content, readErr := ioutil.ReadAll(tr)
+						Expect(readErr).NotTo(HaveOccurred())
+						uploaded[header.Name] = string(content)
+					}
+					return nil
+				}).Times(1)
+			mockk8sclient.EXPECT().ListClusterOperators().Return(&configv1.ClusterOperatorList{}, nil).Times(1)
+
+			Expect(assistedController.uploadSummaryLogs("test", assistedController.Namespace, controllerLogsSecondsAgo)).To(Succeed())
+			Expect(uploaded).To(HaveKey(installationSummaryFileName))
+			var summary installationSummary
+			Expect(json.Unmarshal([]byte(uploaded[installationSummaryFileName]), &summary)).To(Succeed())
+			Expect(summary.ClusterID).To(Equal(assistedController.ClusterID))
+			Expect(summary.Success).To(BeTrue())
+			Expect(summary.StartedAt).To(BeTemporally("==", started))
+			Expect(summary.CompletedAt).To(BeTemporally(">", started))
+			Expect(summary.Duration).To(Equal("1m0s"))
+			Expect(summary.CompletedSteps).To(HaveKey(postInstallStepClusterOperators))
+			Expect(summary.Operators).To(HaveLen(1))
+			Expect(summary.Operators[0].Name).To(Equal("lso"))
+			Expect(summary.Operators[0].Status).To(Equal(models.OperatorStatusAvailable))
+			Expect(summary.FailedOperators).To(BeEmpty())
+			Expect(summary.NodeLabels).To(Equal(map[string]string{"node0": `{"node.ocs.openshift.io/storage":""}`}))
+		})
+
+		It("doesn't upload a summary before the post installation completed", func() {
+			summary, err := assistedController.postInstall.dumpSummary()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(summary).To(BeNil())
+		})
+	})
+
 	Context("Hack deleting service that conflicts with DNS IP address", func() {
 
 		const (
@@ -1586,6 +2382,35 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			returnServiceWithAddress(dnsServiceName, dnsServiceNamespace, "2002:db8::a")
 			hackConflict()
 		})
+		It("Use the primary network in a dual-stack env", func() {
+			mockk8sclient.EXPECT().GetServiceNetworks().Return([]string{"2002:db8::/64", "10.56.20.0/24"}, nil)
+			returnServiceWithAddress(dnsServiceName, dnsServiceNamespace, "2002:db8::a")
+			hackConflict()
+		})
+		It("Exit if the service network is invalid", func() {
+			mockk8sclient.EXPECT().GetServiceNetworks().Return([]string{"10.56.20.0"}, nil)
+			hackConflict()
+		})
+		It("Skip invalid service networks", func() {
+			mockk8sclient.EXPECT().GetServiceNetworks().Return([]string{"", "not-a-cidr", "10.56.20.0/24"}, nil)
+			returnServiceWithDot10Address(dnsServiceName, dnsServiceNamespace)
+			hackConflict()
+		})
+		It("Exit if no service networks returned", func() {
+			mockk8sclient.EXPECT().GetServiceNetworks().Return([]string{}, nil)
+			hackConflict()
+		})
+		It("getServiceNetworks filters invalid networks", func() {
+			mockk8sclient.EXPECT().GetServiceNetworks().Return([]string{"10.56.20.0/24", "10.56.20.0", "fd02::/112", "fd02::"}, nil)
+			networks, err := assistedController.getServiceNetworks()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(networks).To(Equal([]string{"10.56.20.0/24", "fd02::/112"}))
+		})
+		It("getServiceNetworks fails if no network is valid", func() {
+			mockk8sclient.EXPECT().GetServiceNetworks().Return([]string{"10.56.20.0", "fd02::"}, nil)
+			_, err := assistedController.getServiceNetworks()
+			Expect(err).To(HaveOccurred())
+		})
 		It("Retry if list services fails", func() {
 			returnServiceNetwork()
 			mockk8sclient.EXPECT().ListServices("").Return(nil, errors.New("list services failed"))
@@ -1642,6 +2467,39 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			hackConflict()
 		})
 	})
+	Context("Run", func() {
+		BeforeEach(func() {
+			GeneralWaitInterval = time.Hour
+			LogsUploadPeriod = time.Hour
+			WaitTimeout = 5 * time.Second
+		})
+		AfterEach(func() {
+			LogsUploadPeriod = 5 * time.Minute
+		})
+		It("all routines finish once the context is cancelled", func() {
+			mockk8sclient.EXPECT().GetServiceNetworks().Return(nil, errors.New("get service network failed")).Times(1)
+			mockbmclient.EXPECT().GetCluster(gomock.Any(), false).Return(nil, nil).Times(1)
+			mockk8sclient.EXPECT().ListNodes().Return(nil, nil).Times(1)
+			ready := make(chan struct{})
+			mockk8sclient.EXPECT().CreateEvent(assistedController.Namespace, common.AssistedControllerIsReadyEvent, gomock.Any(), common.AssistedControllerPrefix).
+				DoAndReturn(func(namespace, name, message, component string) (*v1.Event, error) {
+					close(ready)
+					return nil, nil
+				}).Times(1)
+			mockbmclient.EXPECT().ClusterLogProgressReport(gomock.Any(), assistedController.ClusterID, models.LogsStateCompleted).Times(1)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				assistedController.Run(ctx)
+			}()
+			Eventually(ready, 5*time.Second).Should(BeClosed())
+			Consistently(done, 100*time.Millisecond).ShouldNot(BeClosed())
+			cancel()
+			Eventually(done, 5*time.Second).Should(BeClosed())
+		})
+	})
 })
 
 func GetKubeNodes(kubeNamesIds map[string]string) *v1.NodeList {
@@ -1689,3 +2547,43 @@ func create3Hosts(currentStatus string, stage models.HostStage, nodeLabels strin
 		"node1": {Host: &models.Host{InfraEnvID: infraEnvId, ID: &node1Id, NodeLabels: nodeLabels, Progress: &currentState, Status: &currentStatus}},
 		"node2": {Host: &models.Host{InfraEnvID: infraEnvId, ID: &node2Id, NodeLabels: nodeLabels, Progress: &currentState, Status: &currentStatus}}}
 }
+
+var _ = Describe("LogTargets", func() {
+	It("decodes namespace and label selector targets", func() {
+		var targets LogTargets
+		Expect(targets.Decode("openshift-ingress:app=router; openshift-etcd:app=etcd,k8s-app=etcd;")).To(Succeed())
+		Expect(targets).To(Equal(LogTargets{
+			{Namespace: "openshift-ingress", Labels: map[string]string{"app": "router"}},
+			{Namespace: "openshift-etcd", Labels: map[string]string{"app": "etcd", "k8s-app": "etcd"}},
+		}))
+	})
+
+	It("rejects invalid targets", func() {
+		for _, value := range []string{"openshift-ingress", ":app=router", "openshift-ingress:", "openshift-ingress:app", "openshift-ingress:app!=router"} {
+			var targets LogTargets
+			Expect(targets.Decode(value)).NotTo(Succeed(), value)
+		}
+	})
+})
+
+var _ = Describe("operatorStatusHistory", func() {
+	It("keeps the newest transitions in order once full", func() {
+		history := newOperatorStatusHistory(3)
+		for i := 0; i < 5; i++ {
+			history.record(fmt.Sprintf("op%d", i), models.OperatorStatusProgressing, "")
+		}
+		transitions := history.list()
+		Expect(transitions).To(HaveLen(3))
+		for i, t := range transitions {
+			Expect(t.Operator).To(Equal(fmt.Sprintf("op%d", i+2)))
+		}
+	})
+
+	It("skips statuses that didn't change", func() {
+		history := newOperatorStatusHistory(10)
+		history.record("lso", models.OperatorStatusProgressing, "")
+		history.record("lso", models.OperatorStatusProgressing, "")
+		history.record("lso", models.OperatorStatusProgressing, "waiting")
+		Expect(history.list()).To(HaveLen(2))
+	})
+})
@@ -0,0 +1,84 @@
+package assisted_installer_controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/openshift/assisted-service/models"
+)
+
+const installationSummaryFileName = "installation_summary.json"
+
+type operatorSummary struct {
+	Name    string                `json:"name"`
+	Status  models.OperatorStatus `json:"status"`
+	Message string                `json:"message,omitempty"`
+	Time    time.Time             `json:"time"`
+}
+
+// installationSummary is uploaded with the controller logs as a one file overview of the post
+// installation
+type installationSummary struct {
+	ClusterID       string               `json:"cluster_id"`
+	Success         bool                 `json:"success"`
+	Message         string               `json:"message,omitempty"`
+	StartedAt       time.Time            `json:"started_at"`
+	CompletedAt     time.Time            `json:"completed_at"`
+	Duration        string               `json:"duration"`
+	CompletedSteps  map[string]time.Time `json:"completed_steps"`
+	Operators       []operatorSummary    `json:"operators"`
+	FailedOperators []string             `json:"failed_operators"`
+	NodeLabels      map[string]string    `json:"node_labels"`
+}
+
+func (c controller) installationSummary(started time.Time, success bool, message string) *installationSummary {
+	completed := time.Now().UTC()
+	summary := &installationSummary{
+		ClusterID:       c.ClusterID,
+		Success:         success,
+		Message:         message,
+		StartedAt:       started,
+		CompletedAt:     completed,
+		Duration:        completed.Sub(started).Round(time.Second).String(),
+		CompletedSteps:  make(map[string]time.Time),
+		Operators:       make([]operatorSummary, 0),
+		FailedOperators: c.Status.GetOperatorsInError(),
+		NodeLabels:      make(map[string]string),
+	}
+	sort.Strings(summary.FailedOperators)
+	for _, t := range c.operatorHistory.latest() {
+		summary.Operators = append(summary.Operators, operatorSummary{Name: t.Operator, Status: t.Status, Message: t.Message, Time: t.Time})
+	}
+
+	c.postInstall.lock.Lock()
+	defer c.postInstall.lock.Unlock()
+	for step, t := range c.postInstall.completed {
+		summary.CompletedSteps[step] = t
+	}
+	for node, labels := range c.postInstall.nodeLabels {
+		summary.NodeLabels[node] = labels
+	}
+	return summary
+}
+
+func (p *postInstallProgress) setSummary(summary *installationSummary) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.summary = summary
+}
+
+// dumpSummary returns the JSON encoded summary, or nil until the post installation completed
+func (p *postInstallProgress) dumpSummary() (*bytes.Buffer, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.summary == nil {
+		return nil, nil
+	}
+	data, err := json.MarshalIndent(p.summary, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewBuffer(data), nil
+}
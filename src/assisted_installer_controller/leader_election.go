@@ -0,0 +1,89 @@
+package assisted_installer_controller
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/tools/leaderelection"
+)
+
+const leaderElectionLeaseName = "assisted-installer-controller-leader"
+
+var (
+	LeaseDuration      = 60 * time.Second
+	LeaseRenewDeadline = 40 * time.Second
+	LeaseRetryPeriod   = 15 * time.Second
+)
+
+// leaderElectionIdentity returns the identity this instance holds the leader lease with. Every replica
+// must have its own, the pod hostname is used when POD_NAME isn't set.
+func (c *controller) leaderElectionIdentity() (string, error) {
+	if c.PodName != "" {
+		return c.PodName, nil
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", errors.Wrap(err, "POD_NAME is not set and the hostname is not available")
+	}
+	if hostname == "" {
+		return "", errors.New("POD_NAME is not set and the hostname is empty")
+	}
+	return hostname, nil
+}
+
+// AcquireLeadership blocks until this controller instance holds the leader lease. While waiting the
+// controller stays warm, the active reconciliation should only start after it returns. The lease is
+// renewed until the context is done, onLost is called if it can't be renewed and another instance
+// may take over.
+func (c *controller) AcquireLeadership(ctx context.Context, onLost func()) error {
+	identity, err := c.leaderElectionIdentity()
+	if err != nil {
+		return err
+	}
+	elected := make(chan struct{})
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            c.kc.LeaderElectionLock(c.Namespace, leaderElectionLeaseName, identity),
+		LeaseDuration:   LeaseDuration,
+		RenewDeadline:   LeaseRenewDeadline,
+		RetryPeriod:     LeaseRetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            leaderElectionLeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(context.Context) {
+				c.log.Infof("Acquired leader lease %s/%s", c.Namespace, leaderElectionLeaseName)
+				close(elected)
+			},
+			OnStoppedLeading: func() {
+				select {
+				case <-elected:
+				default:
+					// never led, nothing to lose
+					return
+				}
+				if ctx.Err() == nil {
+					c.log.Errorf("Lost leader lease %s/%s", c.Namespace, leaderElectionLeaseName)
+					onLost()
+				}
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					c.log.Infof("Leader lease is held by %s", leader)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to create the leader elector")
+	}
+
+	c.log.Infof("Waiting to acquire leader lease %s/%s as %s", c.Namespace, leaderElectionLeaseName, identity)
+	go elector.Run(ctx)
+	select {
+	case <-elected:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
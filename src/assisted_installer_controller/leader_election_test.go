@@ -0,0 +1,161 @@
+package assisted_installer_controller
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/openshift/assisted-installer/src/inventory_client"
+	"github.com/openshift/assisted-installer/src/k8s_client"
+	"github.com/openshift/assisted-installer/src/ops"
+)
+
+// memoryLease is a lease shared by the locks of all the controller instances of a test
+type memoryLease struct {
+	sync.Mutex
+	record *resourcelock.LeaderElectionRecord
+	err    error
+}
+
+type memoryLock struct {
+	lease    *memoryLease
+	identity string
+}
+
+func (l *memoryLease) holder() string {
+	l.Lock()
+	defer l.Unlock()
+	return l.record.HolderIdentity
+}
+
+func (l *memoryLock) Get(ctx context.Context) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	l.lease.Lock()
+	defer l.lease.Unlock()
+	if l.lease.err != nil {
+		return nil, nil, l.lease.err
+	}
+	if l.lease.record == nil {
+		return nil, nil, apierrors.NewNotFound(schema.GroupResource{Group: "coordination.k8s.io", Resource: "leases"}, leaderElectionLeaseName)
+	}
+	record := *l.lease.record
+	raw, err := json.Marshal(record)
+	return &record, raw, err
+}
+
+func (l *memoryLock) Create(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	return l.Update(ctx, ler)
+}
+
+func (l *memoryLock) Update(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	l.lease.Lock()
+	defer l.lease.Unlock()
+	if l.lease.err != nil {
+		return l.lease.err
+	}
+	l.lease.record = &ler
+	return nil
+}
+
+func (l *memoryLock) RecordEvent(string) {}
+
+func (l *memoryLock) Identity() string {
+	return l.identity
+}
+
+func (l *memoryLock) Describe() string {
+	return leaderElectionLeaseName
+}
+
+var _ = Describe("Leader election", func() {
+	var (
+		l             = logrus.New()
+		ctrl          *gomock.Controller
+		mockk8sclient *k8s_client.MockK8SClient
+		lease         *memoryLease
+		podName       = "assisted-installer-controller-abcde"
+	)
+	l.SetOutput(ioutil.Discard)
+
+	newController := func(podName string) *controller {
+		conf := defaultTestControllerConf
+		conf.LeaderElectionEnabled = true
+		conf.PodName = podName
+		return NewController(l, conf, ops.NewMockOps(ctrl), inventory_client.NewMockInventoryClient(ctrl), mockk8sclient)
+	}
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockk8sclient = k8s_client.NewMockK8SClient(ctrl)
+		lease = &memoryLease{}
+		mockk8sclient.EXPECT().LeaderElectionLock(defaultTestControllerConf.Namespace, leaderElectionLeaseName, gomock.Any()).DoAndReturn(
+			func(namespace, name, identity string) resourcelock.Interface {
+				return &memoryLock{lease: lease, identity: identity}
+			}).AnyTimes()
+		LeaseDuration = 2 * time.Second
+		LeaseRenewDeadline = time.Second
+		LeaseRetryPeriod = 10 * time.Millisecond
+	})
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+
+	It("acquires a missing lease", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		Expect(newController(podName).AcquireLeadership(ctx, func() {})).To(Succeed())
+		Expect(lease.holder()).To(Equal(podName))
+	})
+
+	It("holds the lease with the hostname when the pod name isn't set", func() {
+		hostname, err := os.Hostname()
+		Expect(err).NotTo(HaveOccurred())
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		Expect(newController("").AcquireLeadership(ctx, func() {})).To(Succeed())
+		Expect(lease.holder()).To(Equal(hostname))
+	})
+
+	It("follower stays idle while the lease is held", func() {
+		leaderCtx, leaderCancel := context.WithCancel(context.Background())
+		defer leaderCancel()
+		Expect(newController(podName).AcquireLeadership(leaderCtx, func() {})).To(Succeed())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+		Expect(newController("other-pod").AcquireLeadership(ctx, func() {})).To(Equal(context.DeadlineExceeded))
+		Expect(lease.holder()).To(Equal(podName))
+	})
+
+	It("follower becomes leader once the leader releases the lease", func() {
+		leaderCtx, leaderCancel := context.WithCancel(context.Background())
+		Expect(newController(podName).AcquireLeadership(leaderCtx, func() {})).To(Succeed())
+
+		time.AfterFunc(50*time.Millisecond, leaderCancel)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		Expect(newController("other-pod").AcquireLeadership(ctx, func() {})).To(Succeed())
+		Expect(lease.holder()).To(Equal("other-pod"))
+	})
+
+	It("reports lost leadership when the lease can't be renewed", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		lost := make(chan struct{})
+		Expect(newController(podName).AcquireLeadership(ctx, func() { close(lost) })).To(Succeed())
+		lease.Lock()
+		lease.err = apierrors.NewServiceUnavailable("dummy")
+		lease.Unlock()
+		Eventually(lost, 5*time.Second).Should(BeClosed())
+	})
+})
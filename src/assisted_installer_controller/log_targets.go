@@ -0,0 +1,48 @@
+package assisted_installer_controller
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// LogTarget selects pods whose logs are collected with the controller logs
+type LogTarget struct {
+	Namespace string
+	Labels    map[string]string
+}
+
+// LogTargets is decoded by envconfig from a semicolon separated list of namespace:labelSelector
+// targets, e.g. "openshift-ingress:app=router;openshift-etcd:app=etcd,k8s-app=etcd"
+type LogTargets []LogTarget
+
+func (t *LogTargets) Decode(value string) error {
+	targets := LogTargets{}
+	for _, target := range strings.Split(value, ";") {
+		target = strings.TrimSpace(target)
+		if target == "" {
+			continue
+		}
+		parts := strings.SplitN(target, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return errors.Errorf("invalid log target %q, expected namespace:labelSelector", target)
+		}
+		labels := map[string]string{}
+		for _, label := range strings.Split(parts[1], ",") {
+			kv := strings.SplitN(label, "=", 2)
+			if len(kv) != 2 || len(validation.IsQualifiedName(strings.TrimSpace(kv[0]))) > 0 {
+				return errors.Errorf("invalid label %q in log target %q, only key=value selectors are supported", label, target)
+			}
+			labels[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+		targets = append(targets, LogTarget{Namespace: parts[0], Labels: labels})
+	}
+	*t = targets
+	return nil
+}
+
+func (t LogTarget) String() string {
+	return fmt.Sprintf("%s:%v", t.Namespace, t.Labels)
+}
@@ -0,0 +1,130 @@
+package assisted_installer_controller
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/openshift/assisted-installer/src/inventory_client"
+	"github.com/openshift/assisted-service/models"
+	mapiv1beta1 "github.com/openshift/machine-api-operator/pkg/apis/machine/v1beta1"
+	"github.com/pkg/errors"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// bmhMachineAnnotation is set by the baremetal machine actuator on the machine it provisioned from a BMH
+	bmhMachineAnnotation = "metal3.io/BareMetalHost"
+	nodeUserPrefix       = "system:node:"
+)
+
+// NodeDebugView gathers what the service and the cluster know about a single node, for support tooling
+type NodeDebugView struct {
+	Name        string
+	Host        *inventory_client.HostData
+	Conditions  []v1.NodeCondition
+	Machine     *mapiv1beta1.Machine
+	BMH         *metal3v1alpha1.BareMetalHost
+	PendingCsrs []certificatesv1.CertificateSigningRequest
+	// Errors are the failures of the calls whose part of the view is missing
+	Errors []string
+}
+
+// GetNodeDebugView returns the view of the node, the parts that couldn't be fetched are listed in its
+// Errors. It fails only if neither the service nor the cluster know the node.
+func (c controller) GetNodeDebugView(ctx context.Context, nodeName string) (*NodeDebugView, error) {
+	view := &NodeDebugView{Name: nodeName}
+	addError := func(err error, format string, args ...interface{}) {
+		err = errors.Wrapf(err, format, args...)
+		c.log.WithError(err).Warnf("Node %s debug view is partial", nodeName)
+		view.Errors = append(view.Errors, err.Error())
+	}
+
+	hosts, err := c.ic.GetHosts(ctx, c.log, []string{models.HostStatusDisabled})
+	if err != nil {
+		addError(err, "failed to get the hosts from the service")
+	} else if host, ok := hosts[strings.ToLower(nodeName)]; ok {
+		view.Host = &host
+	}
+
+	nodeFound := false
+	nodes, err := c.kc.ListNodes()
+	if err != nil {
+		addError(err, "failed to list the nodes")
+	} else {
+		for _, node := range nodes.Items {
+			if node.Name == nodeName {
+				nodeFound = true
+				view.Conditions = node.Status.Conditions
+			}
+		}
+	}
+	if view.Host == nil && !nodeFound && len(view.Errors) == 0 {
+		return nil, errors.Errorf("node %s is known neither to the service nor to the cluster", nodeName)
+	}
+
+	machines, err := c.kc.ListMachines()
+	if err != nil {
+		addError(err, "failed to list the machines")
+	} else {
+		for i := range machines.Items {
+			if nodeRef := machines.Items[i].Status.NodeRef; nodeRef != nil && nodeRef.Name == nodeName {
+				view.Machine = &machines.Items[i]
+			}
+		}
+	}
+
+	if view.Machine != nil {
+		if bmhName := view.Machine.Annotations[bmhMachineAnnotation]; bmhName != "" {
+			// the annotation is namespace/name
+			bmhName = bmhName[strings.LastIndex(bmhName, "/")+1:]
+			if view.BMH, err = c.kc.GetBMH(bmhName); err != nil {
+				addError(err, "failed to get BMH %s", bmhName)
+			}
+		}
+	}
+
+	csrs, err := c.kc.ListCsrs()
+	if err != nil {
+		addError(err, "failed to list the CSRs")
+	} else {
+		for _, csr := range csrs.Items {
+			if !isCsrApproved(&csr) && !isCsrDenied(&csr) && csrNodeName(&csr) == nodeName {
+				view.PendingCsrs = append(view.PendingCsrs, csr)
+			}
+		}
+	}
+	return view, nil
+}
+
+func isCsrDenied(csr *certificatesv1.CertificateSigningRequest) bool {
+	for _, condition := range csr.Status.Conditions {
+		if condition.Type == certificatesv1.CertificateDenied || condition.Type == certificatesv1.CertificateFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// csrNodeName returns the node a CSR was requested for, the serving CSRs are requested by the node
+// itself while the client CSRs are requested by the node bootstrapper with the node in their subject
+func csrNodeName(csr *certificatesv1.CertificateSigningRequest) string {
+	if strings.HasPrefix(csr.Spec.Username, nodeUserPrefix) {
+		return strings.TrimPrefix(csr.Spec.Username, nodeUserPrefix)
+	}
+	block, _ := pem.Decode(csr.Spec.Request)
+	if block == nil {
+		return ""
+	}
+	request, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return ""
+	}
+	if !strings.HasPrefix(request.Subject.CommonName, nodeUserPrefix) {
+		return ""
+	}
+	return strings.TrimPrefix(request.Subject.CommonName, nodeUserPrefix)
+}
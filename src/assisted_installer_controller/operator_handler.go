@@ -4,9 +4,11 @@ import (
 	"context"
 	"time"
 
+	configv1 "github.com/openshift/api/config/v1"
 	"github.com/openshift/assisted-installer/src/k8s_client"
 	"github.com/openshift/assisted-installer/src/utils"
 	"github.com/openshift/assisted-service/models"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -35,6 +37,7 @@ func (c controller) isOperatorAvailable(handler OperatorHandler) bool {
 		c.log.WithError(err).Warnf("Failed to get <%s> operator", operatorName)
 		return false
 	}
+	c.operatorHistory.record(operatorName, operatorStatus, operatorMessage)
 
 	if operatorStatusInService.Status != operatorStatus || (operatorStatusInService.StatusInfo != operatorMessage && operatorMessage != "") {
 		c.log.Infof("Operator <%s> updated, status: %s -> %s, message: %s -> %s.", operatorName, operatorStatusInService.Status, operatorStatus, operatorStatusInService.StatusInfo, operatorMessage)
@@ -53,6 +56,39 @@ func (c controller) isOperatorAvailable(handler OperatorHandler) bool {
 	return false
 }
 
+// isClusterOperatorAvailable checks a cluster operator the service may not monitor, so its availability
+// is decided by the cluster operator itself. Its status changes are reported to the service if it monitors it.
+func (c controller) isClusterOperatorAvailable(operatorName string) bool {
+	c.log.Infof("Checking <%s> operator availability status", operatorName)
+	operatorStatus, operatorMessage, err := NewClusterOperatorHandler(c.kc, operatorName, c.DegradedGracePeriod, c.log).GetStatus()
+	if err != nil {
+		c.log.WithError(err).Warnf("Failed to get <%s> operator", operatorName)
+		return false
+	}
+	c.operatorHistory.record(operatorName, operatorStatus, operatorMessage)
+	c.updateMonitoredOperator(operatorName, operatorStatus, operatorMessage)
+	return operatorStatus == models.OperatorStatusAvailable
+}
+
+// updateMonitoredOperator reports the operator status to the service when it differs from the status the
+// service has. Operators the service doesn't monitor aren't reported.
+func (c controller) updateMonitoredOperator(operatorName string, operatorStatus models.OperatorStatus, operatorMessage string) {
+	operatorStatusInService, err := c.ic.GetClusterMonitoredOperator(utils.GenerateRequestContext(), c.ClusterID, operatorName, c.OpenshiftVersion)
+	if err != nil {
+		c.log.WithError(err).Debugf("Not reporting <%s> operator status, it isn't monitored by the service", operatorName)
+		return
+	}
+	if operatorStatusInService.Status == operatorStatus && (operatorStatusInService.StatusInfo == operatorMessage || operatorMessage == "") {
+		return
+	}
+	c.log.Infof("Operator <%s> updated, status: %s -> %s, message: %s -> %s.", operatorName, operatorStatusInService.Status, operatorStatus,
+		operatorStatusInService.StatusInfo, operatorMessage)
+	err = c.ic.UpdateClusterOperator(context.TODO(), c.ClusterID, operatorName, operatorStatus, operatorMessage)
+	if err != nil {
+		c.log.WithError(err).Warnf("Failed to update %s operator status %s with message %s", operatorName, operatorStatus, operatorMessage)
+	}
+}
+
 func (c controller) isOperatorAvailableInService(operatorName string, openshiftVersion string) (*models.MonitoredOperator, bool) {
 	operatorStatusInService, err := c.ic.GetClusterMonitoredOperator(utils.GenerateRequestContext(), c.ClusterID, operatorName, openshiftVersion)
 	if err != nil {
@@ -68,13 +104,24 @@ func (c controller) isOperatorAvailableInService(operatorName string, openshiftV
 	return operatorStatusInService, false
 }
 
+// logDecidingCondition logs at debug level as it's called on every poll, the status changes are logged when reported
+func logDecidingCondition(log logrus.FieldLogger, operatorName string, status models.OperatorStatus, condition configv1.ClusterStatusConditionType) {
+	if condition == "" {
+		log.Debugf("Operator <%s> is %s, no condition is true", operatorName, status)
+		return
+	}
+	log.Debugf("Operator <%s> is %s via %s", operatorName, status, condition)
+}
+
 type ClusterOperatorHandler struct {
-	kc           k8s_client.K8SClient
-	operatorName string
+	kc            k8s_client.K8SClient
+	operatorName  string
+	degradedGrace time.Duration
+	log           logrus.FieldLogger
 }
 
-func NewClusterOperatorHandler(kc k8s_client.K8SClient, operatorName string) *ClusterOperatorHandler {
-	return &ClusterOperatorHandler{kc: kc, operatorName: operatorName}
+func NewClusterOperatorHandler(kc k8s_client.K8SClient, operatorName string, degradedGrace time.Duration, log logrus.FieldLogger) *ClusterOperatorHandler {
+	return &ClusterOperatorHandler{kc: kc, operatorName: operatorName, degradedGrace: degradedGrace, log: log}
 }
 
 func (handler ClusterOperatorHandler) GetName() string { return handler.operatorName }
@@ -87,19 +134,23 @@ func (handler ClusterOperatorHandler) GetStatus() (models.OperatorStatus, string
 		return "", "", err
 	}
 
-	operatorStatus, operatorMessage := utils.ClusterOperatorConditionsToMonitoredOperatorStatus(co.Status.Conditions)
+	operatorStatus, operatorMessage, condition := utils.ClusterOperatorConditionsToMonitoredOperatorStatusWithGrace(co.Status.Conditions,
+		handler.degradedGrace, time.Now())
+	logDecidingCondition(handler.log, handler.operatorName, operatorStatus, condition)
 	return operatorStatus, operatorMessage, nil
 }
 
 func (handler ClusterOperatorHandler) OnChange(_ models.OperatorStatus) bool { return true }
 
 type ClusterVersionHandler struct {
-	kc    k8s_client.K8SClient
-	timer *time.Timer
+	kc            k8s_client.K8SClient
+	timer         *time.Timer
+	degradedGrace time.Duration
+	log           logrus.FieldLogger
 }
 
-func NewClusterVersionHandler(kc k8s_client.K8SClient, timer *time.Timer) *ClusterVersionHandler {
-	return &ClusterVersionHandler{kc: kc, timer: timer}
+func NewClusterVersionHandler(kc k8s_client.K8SClient, timer *time.Timer, degradedGrace time.Duration, log logrus.FieldLogger) *ClusterVersionHandler {
+	return &ClusterVersionHandler{kc: kc, timer: timer, degradedGrace: degradedGrace, log: log}
 }
 
 func (handler ClusterVersionHandler) GetName() string { return cvoOperatorName }
@@ -112,7 +163,9 @@ func (handler ClusterVersionHandler) GetStatus() (models.OperatorStatus, string,
 		return "", "", err
 	}
 
-	operatorStatus, operatorMessage := utils.ClusterOperatorConditionsToMonitoredOperatorStatus(co.Status.Conditions)
+	operatorStatus, operatorMessage, condition := utils.ClusterOperatorConditionsToMonitoredOperatorStatusWithGrace(co.Status.Conditions,
+		handler.degradedGrace, time.Now())
+	logDecidingCondition(handler.log, cvoOperatorName, operatorStatus, condition)
 	return operatorStatus, operatorMessage, nil
 }
 
@@ -162,8 +215,8 @@ func (handler ClusterServiceVersionHandler) GetStatus() (models.OperatorStatus,
 	if err != nil {
 		return "", "", err
 	}
-	operatorStatus := utils.CsvStatusToOperatorStatus(string(csv.Status.Phase))
-	return operatorStatus, csv.Status.Message, nil
+	operatorStatus, operatorMessage := utils.CsvStatusToOperatorStatusAndMessage(string(csv.Status.Phase), csv.Status.Message)
+	return operatorStatus, operatorMessage, nil
 }
 
 func (handler ClusterServiceVersionHandler) OnChange(newStatus models.OperatorStatus) bool {
@@ -174,7 +227,7 @@ func (handler ClusterServiceVersionHandler) OnChange(newStatus models.OperatorSt
 			handler.retries++
 			return false
 		}
-		handler.status.OperatorError(handler.operator.Name)
+		handler.status.OperatorErrorInNamespace(handler.operator.Name, handler.operator.Namespace)
 	}
 
 	return true
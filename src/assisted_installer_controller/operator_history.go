@@ -0,0 +1,88 @@
+package assisted_installer_controller
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/openshift/assisted-service/models"
+)
+
+const (
+	operatorHistorySize     = 500
+	operatorHistoryFileName = "operators_status_history.log"
+)
+
+type operatorStatusTransition struct {
+	Time     time.Time
+	Operator string
+	Status   models.OperatorStatus
+	Message  string
+}
+
+// operatorStatusHistory keeps the last operator status transitions seen by the controller, so
+// operators that flapped before settling can be spotted in the uploaded logs
+type operatorStatusHistory struct {
+	lock        sync.Mutex
+	transitions []operatorStatusTransition
+	next        int
+	full        bool
+	last        map[string]operatorStatusTransition
+}
+
+func newOperatorStatusHistory(size int) *operatorStatusHistory {
+	return &operatorStatusHistory{
+		transitions: make([]operatorStatusTransition, size),
+		last:        make(map[string]operatorStatusTransition),
+	}
+}
+
+// record adds a transition unless the operator status and message didn't change since the last one,
+// it returns whether the transition was added
+func (h *operatorStatusHistory) record(operator string, status models.OperatorStatus, message string) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if last, ok := h.last[operator]; ok && last.Status == status && last.Message == message {
+		return false
+	}
+	transition := operatorStatusTransition{Time: time.Now().UTC(), Operator: operator, Status: status, Message: message}
+	h.last[operator] = transition
+	h.transitions[h.next] = transition
+	h.next = (h.next + 1) % len(h.transitions)
+	if h.next == 0 {
+		h.full = true
+	}
+	return true
+}
+
+// list returns the recorded transitions from the oldest to the newest
+func (h *operatorStatusHistory) list() []operatorStatusTransition {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if !h.full {
+		return append([]operatorStatusTransition{}, h.transitions[:h.next]...)
+	}
+	return append(append([]operatorStatusTransition{}, h.transitions[h.next:]...), h.transitions[:h.next]...)
+}
+
+// latest returns the last transition of each operator, sorted by operator name
+func (h *operatorStatusHistory) latest() []operatorStatusTransition {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	result := make([]operatorStatusTransition, 0, len(h.last))
+	for _, t := range h.last {
+		result = append(result, t)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Operator < result[j].Operator })
+	return result
+}
+
+func (h *operatorStatusHistory) dump() *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	for _, t := range h.list() {
+		fmt.Fprintf(buf, "%s %s %s %s\n", t.Time.Format(time.RFC3339), t.Operator, t.Status, t.Message)
+	}
+	return buf
+}
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"net"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/openshift/assisted-installer/src/inventory_client"
@@ -20,6 +22,7 @@ import (
 const (
 	ControllerLogsSecondsAgo       = 60 * 60
 	AssistedControllerIsReadyEvent = "AssistedControllerIsReady"
+	AllNodesInstalledEvent         = "AssistedControllerAllNodesInstalled"
 	AssistedControllerPrefix       = "assisted-installer-controller"
 )
 
@@ -33,31 +36,106 @@ func GetHostsInStatus(hosts map[string]inventory_client.HostData, status []strin
 	return hostsbystatus
 }
 
+// mcsLogsFormatWarningLines is the number of MCS log lines after which not finding a single
+// ignition request is suspicious enough to warn about a possible log format change
+const mcsLogsFormatWarningLines = 100
+
+// mcsClientAddressRegexes match the client address field of the MCS access log lines, other
+// addresses on the line, like the one the server listens on, must not be taken for a host
+var mcsClientAddressRegexes = []*regexp.Regexp{
+	// the text log, `Pool master requested by 10.0.0.1:4567 User-Agent:"Ignition/2.6.0"`
+	regexp.MustCompile(`requested by (\S+)`),
+	// the structured log, `{"msg":"Pool master requested","remoteAddr":"10.0.0.1:4567",...}`
+	regexp.MustCompile(`"remoteAddr"\s*:\s*"([^"]+)"`),
+	// the dry run log, `10.0.0.1.(Ignition)`
+	regexp.MustCompile(`^(\S+)\.\(Ignition\)`),
+}
+
+// parseClientAddress returns the normalized IP of a client address like "10.0.0.1", "10.0.0.1:4567"
+// or "[fe80::1%ens3]:4567", or an empty string if the address isn't an IP address
+func parseClientAddress(address string) string {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	address = strings.Trim(address, "[]")
+	if i := strings.Index(address, "%"); i >= 0 {
+		address = address[:i]
+	}
+	if ip := net.ParseIP(address); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+func normalizeIP(address string) string {
+	if ip, _, err := net.ParseCIDR(address); err == nil {
+		return ip.String()
+	}
+	if ip := net.ParseIP(address); ip != nil {
+		return ip.String()
+	}
+	return address
+}
+
+// GetIgnitionRequestIPs returns the IPs that requested ignition according to the MCS logs. Only the
+// client address field of the ignition requests is taken, in any of the known log formats
+func GetIgnitionRequestIPs(mcsLogs string, log logrus.FieldLogger) map[string]struct{} {
+	ips := make(map[string]struct{})
+	lines := strings.Split(strings.TrimSpace(mcsLogs), "\n")
+	for _, line := range lines {
+		if !strings.Contains(strings.ToLower(line), "ignition") {
+			continue
+		}
+		for _, regex := range mcsClientAddressRegexes {
+			if match := regex.FindStringSubmatch(line); match != nil {
+				if ip := parseClientAddress(match[1]); ip != "" {
+					ips[ip] = struct{}{}
+				}
+				break
+			}
+		}
+	}
+	if len(ips) == 0 && len(lines) >= mcsLogsFormatWarningLines {
+		log.Warnf("No ignition requests were found in %d lines of MCS logs, the log format may have changed", len(lines))
+	}
+	return ips
+}
+
+func hostPulledIgnition(host inventory_client.HostData, ignitionRequestIPs map[string]struct{}) bool {
+	for _, ip := range host.IPs {
+		if _, ok := ignitionRequestIPs[normalizeIP(ip)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SetConfiguringStatusForHosts moves the hosts that pulled ignition according to the MCS logs to
+// configuring, in preview mode the matches are only logged
 func SetConfiguringStatusForHosts(client inventory_client.InventoryClient, inventoryHostsMapWithIp map[string]inventory_client.HostData,
-	mcsLogs string, fromBootstrap bool, log logrus.FieldLogger) {
+	mcsLogs string, fromBootstrap bool, preview bool, log logrus.FieldLogger) {
 	notValidStates := map[models.HostStage]struct{}{models.HostStageConfiguring: {}, models.HostStageJoined: {}, models.HostStageDone: {}}
 	if fromBootstrap {
 		notValidStates[models.HostStageWaitingForIgnition] = struct{}{}
 	}
+	ignitionRequestIPs := GetIgnitionRequestIPs(mcsLogs, log)
 	for hostName, host := range inventoryHostsMapWithIp {
 		_, ok := notValidStates[host.Host.Progress.CurrentStage]
 		if ok {
 			continue
 		}
 		log.Infof("Verifying if host %s pulled ignition", hostName)
-		pat := fmt.Sprintf("(%s).{1,40}(Ignition)", strings.Join(host.IPs, "|"))
-		pattern, err := regexp.Compile(pat)
-		if err != nil {
-			log.WithError(err).Errorf("Failed to compile regex from host %s ips list", hostName)
-			return
-		}
-		if pattern.MatchString(mcsLogs) {
+		if hostPulledIgnition(host, ignitionRequestIPs) {
 			status := models.HostStageConfiguring
 			if fromBootstrap && host.Host.Role == models.HostRoleWorker {
 				status = models.HostStageWaitingForIgnition
 			}
 			ctx := utils.GenerateRequestContext()
 			requestLog := utils.RequestIDLogger(ctx, log)
+			if preview {
+				requestLog.Infof("Host %s %q found in mcs logs, would move it to %s state (preview, not updating)", hostName, host.Host.ID.String(), status)
+				continue
+			}
 			requestLog.Infof("Host %s %q found in mcs logs, moving it to %s state", hostName, host.Host.ID.String(), status)
 			if err := client.UpdateHostInstallProgress(ctx, host.Host.InfraEnvID.String(), host.Host.ID.String(), status, ""); err != nil {
 				requestLog.Errorf("Failed to update node installation status, %s", err)
@@ -93,8 +171,9 @@ func GetPodInStatus(k8Client k8s_client.K8SClient, podNamePrefix string, namespa
 // write tar.gz to pipe in a routine
 // upload tar.gz from pipe to assisted service.
 // close read and write pipes
+// secrets are masked in the uploaded logs when redact is set
 func UploadPodLogs(kc k8s_client.K8SClient, ic inventory_client.InventoryClient, clusterId string, podName string, namespace string,
-	sinceSeconds int64, log logrus.FieldLogger) error {
+	sinceSeconds int64, redact bool, log logrus.FieldLogger) error {
 	log.Infof("Uploading logs for %s in %s", podName, namespace)
 	podLogs, err := kc.GetPodLogsAsBuffer(namespace, podName, sinceSeconds)
 	if err != nil {
@@ -106,7 +185,11 @@ func UploadPodLogs(kc k8s_client.K8SClient, ic inventory_client.InventoryClient,
 
 	go func() {
 		defer pw.Close()
-		tarEntry := utils.NewTarEntry(podLogs, nil, int64(podLogs.Len()), fmt.Sprintf("%s.logs", podName))
+		var logsReader io.Reader = podLogs
+		if redact {
+			logsReader = utils.NewRedactingReader(podLogs)
+		}
+		tarEntry := utils.NewTarEntry(logsReader, nil, int64(podLogs.Len()), fmt.Sprintf("%s.logs", podName))
 		err = utils.WriteToTarGz(pw, []utils.TarEntry{*tarEntry})
 		if err != nil {
 			log.WithError(err).Warnf("Failed to create tar.gz")
@@ -125,12 +208,80 @@ func UploadPodLogs(kc k8s_client.K8SClient, ic inventory_client.InventoryClient,
 }
 
 func IsK8sNodeIsReady(node v1.Node) bool {
+	return DefaultNodeReadiness.IsReady(node)
+}
+
+// NodeReadiness maps node condition types to the status they must have for the node to be ready
+type NodeReadiness map[v1.NodeConditionType]v1.ConditionStatus
+
+// DefaultNodeReadiness only requires the Ready condition
+var DefaultNodeReadiness = NodeReadiness{v1.NodeReady: v1.ConditionTrue}
+
+// ParseNodeReadiness parses Type=Status conditions, e.g. DiskPressure=False, the Ready condition
+// is always required
+func ParseNodeReadiness(conditions []string) (NodeReadiness, error) {
+	readiness := NodeReadiness{v1.NodeReady: v1.ConditionTrue}
+	for _, condition := range conditions {
+		parts := strings.SplitN(condition, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("invalid node condition %q, expected Type=Status", condition)
+		}
+		status := v1.ConditionStatus(parts[1])
+		if status != v1.ConditionTrue && status != v1.ConditionFalse && status != v1.ConditionUnknown {
+			return nil, errors.Errorf("invalid status %q of node condition %s", parts[1], parts[0])
+		}
+		readiness[v1.NodeConditionType(parts[0])] = status
+	}
+	return readiness, nil
+}
+
+// IsReady checks the required conditions of the node, a missing condition only satisfies a
+// False requirement since nodes don't always report the conditions that don't apply to them
+func (r NodeReadiness) IsReady(node v1.Node) bool {
+	if len(r) == 0 {
+		r = DefaultNodeReadiness
+	}
+	statuses := make(map[v1.NodeConditionType]v1.ConditionStatus)
 	for _, cond := range node.Status.Conditions {
-		if cond.Type == v1.NodeReady && cond.Status == v1.ConditionTrue {
-			return true
+		statuses[cond.Type] = cond.Status
+	}
+	for condType, required := range r {
+		status, ok := statuses[condType]
+		if !ok && required == v1.ConditionFalse {
+			continue
+		}
+		if status != required {
+			return false
 		}
 	}
-	return false
+	return true
+}
+
+// NodeNotReadyReasons describes the conditions keeping a node from being ready: a Ready condition
+// that isn't True and any pressure or network condition that is True
+func NodeNotReadyReasons(node v1.Node) []string {
+	var reasons []string
+	foundReady := false
+	for _, cond := range node.Status.Conditions {
+		switch {
+		case cond.Type == v1.NodeReady:
+			foundReady = true
+			if cond.Status == v1.ConditionTrue {
+				continue
+			}
+		case cond.Status != v1.ConditionTrue:
+			continue
+		}
+		reason := fmt.Sprintf("%s=%s", cond.Type, cond.Status)
+		if cond.Reason != "" || cond.Message != "" {
+			reason = fmt.Sprintf("%s (%s: %s)", reason, cond.Reason, cond.Message)
+		}
+		reasons = append(reasons, reason)
+	}
+	if !foundReady {
+		reasons = append(reasons, "no Ready condition")
+	}
+	return reasons
 }
 
 // BuildHostsMapIPAddressBased builds a map containing all the IP addresses of the hosts in the
@@ -145,6 +296,31 @@ func BuildHostsMapIPAddressBased(inventoryHostsMap map[string]inventory_client.H
 	return knownIpAddresses
 }
 
+// DuplicateSystemUUIDs returns the system UUIDs reported by more than one node with the names of those
+// nodes. Cloned VMs may share a UUID, which breaks matching the nodes with the inventory hosts.
+func DuplicateSystemUUIDs(nodes []v1.Node) map[string][]string {
+	namesByUUID := map[string][]string{}
+	for _, node := range nodes {
+		if uuid := node.Status.NodeInfo.SystemUUID; uuid != "" {
+			namesByUUID[uuid] = append(namesByUUID[uuid], node.Name)
+		}
+	}
+	duplicates := map[string][]string{}
+	for uuid, names := range namesByUUID {
+		if len(names) > 1 {
+			sort.Strings(names)
+			duplicates[uuid] = names
+		}
+	}
+	return duplicates
+}
+
+// DuplicateSystemUUIDMessage describes nodes sharing a system UUID
+func DuplicateSystemUUIDMessage(uuid string, names []string) string {
+	return fmt.Sprintf("nodes %s report the same system UUID %s, they were probably cloned from the same VM",
+		strings.Join(names, ", "), uuid)
+}
+
 // Matching of the host happens based on 2 rules
 //   * if the name of the host and in the inventory is exactly the same, use use it
 //   * if the name is not known in the inventory, we check if the IP address of the
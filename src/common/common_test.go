@@ -14,6 +14,7 @@ import (
 	"github.com/openshift/assisted-installer/src/inventory_client"
 	"github.com/openshift/assisted-service/models"
 	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 	v1 "k8s.io/api/core/v1"
 )
 
@@ -46,20 +47,87 @@ var _ = Describe("verify common", func() {
 			// note that in the MCS log we use node 1 IPv6 address
 			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), infraEnvId.String(), node1Id.String(), models.HostStageConfiguring, gomock.Any()).Return(fmt.Errorf("dummy")).Times(1)
 			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), infraEnvId.String(), node2Id.String(), models.HostStageWaitingForIgnition, gomock.Any()).Return(nil).Times(1)
-			SetConfiguringStatusForHosts(mockbmclient, testInventoryIdsIps, logs, true, l)
+			SetConfiguringStatusForHosts(mockbmclient, testInventoryIdsIps, logs, true, false, l)
 			Expect(testInventoryIdsIps["node0"].Host.Progress.CurrentStage).Should(Equal(models.HostStageRebooting))
 			Expect(testInventoryIdsIps["node1"].Host.Progress.CurrentStage).Should(Equal(models.HostStageRebooting))
 			Expect(testInventoryIdsIps["node2"].Host.Progress.CurrentStage).Should(Equal(models.HostStageWaitingForIgnition))
 
 			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), infraEnvId.String(), node1Id.String(), models.HostStageConfiguring, gomock.Any()).Return(nil).Times(1)
 			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), infraEnvId.String(), node2Id.String(), models.HostStageConfiguring, gomock.Any()).Return(nil).Times(1)
-			SetConfiguringStatusForHosts(mockbmclient, testInventoryIdsIps, logs, false, l)
+			SetConfiguringStatusForHosts(mockbmclient, testInventoryIdsIps, logs, false, false, l)
 			Expect(testInventoryIdsIps["node1"].Host.Progress.CurrentStage).Should(Equal(models.HostStageConfiguring))
 			Expect(testInventoryIdsIps["node2"].Host.Progress.CurrentStage).Should(Equal(models.HostStageConfiguring))
 			Expect(testInventoryIdsIps["node0"].Host.Progress.CurrentStage).Should(Equal(models.HostStageRebooting))
 		})
 	})
 
+	Context("SetConfiguringStatusForHosts preview", func() {
+		It("logs the matched hosts without updating them", func() {
+			logsInBytes, _ := ioutil.ReadFile("../../test_files/mcs_logs.txt")
+			infraEnvId := strfmt.UUID("eb82821f-bf21-4614-9a3b-ecb07929f250")
+			node1Id := strfmt.UUID("eb82821f-bf21-4614-9a3b-ecb07929f239")
+			testInventoryIdsIps := map[string]inventory_client.HostData{
+				"node1": {Host: &models.Host{InfraEnvID: infraEnvId, ID: &node1Id, Progress: &models.HostProgressInfo{CurrentStage: models.HostStageRebooting}, Role: models.HostRoleMaster},
+					IPs: []string{"192.168.126.11", "192.168.11.123", "fe80::5054:ff:fe9a:4739"}}}
+			logger, hook := test.NewNullLogger()
+			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			SetConfiguringStatusForHosts(mockbmclient, testInventoryIdsIps, string(logsInBytes), true, true, logger)
+			Expect(testInventoryIdsIps["node1"].Host.Progress.CurrentStage).Should(Equal(models.HostStageRebooting))
+			Expect(hook.LastEntry().Message).To(ContainSubstring(fmt.Sprintf("Host node1 %q found in mcs logs, would move it to %s state", node1Id, models.HostStageConfiguring)))
+		})
+	})
+
+	Context("GetIgnitionRequestIPs", func() {
+		It("matches the current MCS log format", func() {
+			logsInBytes, _ := ioutil.ReadFile("../../test_files/mcs_logs.txt")
+			ips := GetIgnitionRequestIPs(string(logsInBytes), l)
+			Expect(ips).To(HaveLen(2))
+			Expect(ips).To(HaveKey("192.168.126.12"))
+			Expect(ips).To(HaveKey("fe80::5054:ff:fe9a:4739"))
+		})
+
+		It("matches structured MCS log lines", func() {
+			logs := `{"level":"info","ts":"2022-03-01T10:00:00Z","msg":"Pool worker requested","remoteAddr":"192.168.126.11:40548","userAgent":"Ignition/2.14.0"}
+{"level":"info","ts":"2022-03-01T10:00:01Z","msg":"Pool master requested","remoteAddr":"[fd2e:6f44:5dd8::5]:40550","userAgent":"Ignition/2.14.0"}
+{"level":"info","ts":"2022-03-01T10:00:02Z","msg":"Pool worker requested","remoteAddr":"192.168.126.13:40552","userAgent":"curl/7.61.1"}`
+			ips := GetIgnitionRequestIPs(logs, l)
+			Expect(ips).To(HaveLen(2))
+			Expect(ips).To(HaveKey("192.168.126.11"))
+			Expect(ips).To(HaveKey("fd2e:6f44:5dd8::5"))
+		})
+
+		It("only matches the client address of the request", func() {
+			logs := `I0701 16:57:08.449808       1 api.go:102] Pool master requested by 192.168.126.12:32780 on 192.168.126.100:22623 User-Agent:"Ignition/2.6.0"
+{"level":"info","msg":"Pool worker requested","serverAddr":"192.168.126.100:22623","remoteAddr":"192.168.126.11:40548","userAgent":"Ignition/2.14.0"}`
+			ips := GetIgnitionRequestIPs(logs, l)
+			Expect(ips).To(HaveLen(2))
+			Expect(ips).To(HaveKey("192.168.126.12"))
+			Expect(ips).To(HaveKey("192.168.126.11"))
+		})
+
+		It("matches the dry run MCS log format", func() {
+			ips := GetIgnitionRequestIPs("192.168.126.10.(Ignition)\n192.168.126.11.(Ignition)\n", l)
+			Expect(ips).To(HaveLen(2))
+			Expect(ips).To(HaveKey("192.168.126.10"))
+			Expect(ips).To(HaveKey("192.168.126.11"))
+		})
+
+		It("warns when many lines have no ignition requests", func() {
+			logger, hook := test.NewNullLogger()
+			var logs string
+			for i := 0; i < mcsLogsFormatWarningLines; i++ {
+				logs += fmt.Sprintf("I0701 16:56:38.177133       1 api.go:56] unknown line format %d\n", i)
+			}
+			Expect(GetIgnitionRequestIPs(logs, logger)).To(BeEmpty())
+			Expect(hook.LastEntry()).NotTo(BeNil())
+			Expect(hook.LastEntry().Level).To(Equal(logrus.WarnLevel))
+
+			hook.Reset()
+			Expect(GetIgnitionRequestIPs("I0701 16:56:38.177133       1 api.go:56] Launching server on :22623", logger)).To(BeEmpty())
+			Expect(hook.LastEntry()).To(BeNil())
+		})
+	})
+
 	Context("GetHostsInStatus", func() {
 		var (
 			testID     = strfmt.UUID(uuid.New().String())
@@ -158,6 +226,60 @@ var _ = Describe("verify common", func() {
 			Expect(match.Host.ID).To(Equal(&node1Id))
 		})
 
+		It("describes why a node isn't ready", func() {
+			node := GetKubeNodes(map[string]string{"node0": "6d6f00e8-dead-beef-cafe-0f1459485ad9"}).Items[0]
+			node.Status.Conditions = []v1.NodeCondition{
+				{Type: v1.NodeMemoryPressure, Status: v1.ConditionTrue, Reason: "KubeletHasInsufficientMemory", Message: "kubelet has insufficient memory available"},
+				{Type: v1.NodeDiskPressure, Status: v1.ConditionFalse},
+				{Type: v1.NodeReady, Status: v1.ConditionFalse, Reason: "KubeletNotReady", Message: "container runtime network not ready"},
+			}
+			Expect(NodeNotReadyReasons(node)).To(Equal([]string{
+				"MemoryPressure=True (KubeletHasInsufficientMemory: kubelet has insufficient memory available)",
+				"Ready=False (KubeletNotReady: container runtime network not ready)",
+			}))
+			node.Status.Conditions = nil
+			Expect(NodeNotReadyReasons(node)).To(Equal([]string{"no Ready condition"}))
+		})
+
+		Context("node readiness", func() {
+			withConditions := func(conditions ...v1.NodeCondition) v1.Node {
+				node := GetKubeNodes(map[string]string{"node0": "6d6f00e8-dead-beef-cafe-0f1459485ad9"}).Items[0]
+				node.Status.Conditions = conditions
+				return node
+			}
+			ready := v1.NodeCondition{Type: v1.NodeReady, Status: v1.ConditionTrue}
+
+			It("only requires the Ready condition by default", func() {
+				readiness, err := ParseNodeReadiness(nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(readiness).To(Equal(DefaultNodeReadiness))
+				Expect(readiness.IsReady(withConditions(ready, v1.NodeCondition{Type: v1.NodeDiskPressure, Status: v1.ConditionTrue}))).To(BeTrue())
+				Expect(readiness.IsReady(withConditions(v1.NodeCondition{Type: v1.NodeReady, Status: v1.ConditionFalse}))).To(BeFalse())
+				Expect(NodeReadiness(nil).IsReady(withConditions(ready))).To(BeTrue())
+			})
+			It("requires the extra conditions", func() {
+				readiness, err := ParseNodeReadiness([]string{"DiskPressure=False", "NetworkUnavailable=False"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(readiness.IsReady(withConditions(ready,
+					v1.NodeCondition{Type: v1.NodeDiskPressure, Status: v1.ConditionFalse},
+					v1.NodeCondition{Type: v1.NodeNetworkUnavailable, Status: v1.ConditionFalse}))).To(BeTrue())
+				Expect(readiness.IsReady(withConditions(ready,
+					v1.NodeCondition{Type: v1.NodeDiskPressure, Status: v1.ConditionTrue}))).To(BeFalse())
+				Expect(readiness.IsReady(withConditions(v1.NodeCondition{Type: v1.NodeDiskPressure, Status: v1.ConditionFalse}))).To(BeFalse())
+			})
+			It("accepts missing conditions that are required to be False", func() {
+				readiness, err := ParseNodeReadiness([]string{"NetworkUnavailable=False"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(readiness.IsReady(withConditions(ready))).To(BeTrue())
+			})
+			It("rejects malformed conditions", func() {
+				for _, condition := range []string{"DiskPressure", "=False", "DiskPressure=No"} {
+					_, err := ParseNodeReadiness([]string{condition})
+					Expect(err).To(HaveOccurred(), condition)
+				}
+			})
+		})
+
 		It("test HostMatchByNameOrIPAddress by IP", func() {
 			nodes := GetKubeNodes(map[string]string{"some-fake-name": "6d6f00e8-dead-beef-cafe-0f1459485ad9"})
 			Expect(len(nodes.Items)).To(Equal(1))
@@ -166,6 +288,16 @@ var _ = Describe("verify common", func() {
 			Expect(ok).To(Equal(true))
 			Expect(match.Host.ID).To(Equal(&node0Id))
 		})
+
+		It("finds nodes sharing a system UUID", func() {
+			nodes := GetKubeNodes(map[string]string{"node0": "6d6f00e8-dead-beef-cafe-0f1459485ad9",
+				"node1": "6d6f00e8-dead-beef-cafe-0f1459485ad9", "node2": "57df89ee-3546-48a5-859a-0f1459485a66"})
+			Expect(DuplicateSystemUUIDs(nodes.Items)).To(Equal(map[string][]string{
+				"6d6f00e8-dead-beef-cafe-0f1459485ad9": {"node0", "node1"},
+			}))
+			Expect(DuplicateSystemUUIDs(GetKubeNodes(map[string]string{"node0": "6d6f00e8-dead-beef-cafe-0f1459485ad9",
+				"node1": "57df89ee-3546-48a5-859a-0f1459485a66"}).Items)).To(BeEmpty())
+		})
 	})
 })
 
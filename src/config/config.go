@@ -4,14 +4,45 @@ import (
 	"encoding/json"
 	"flag"
 	"os"
+	"path"
+	"regexp"
+	"strings"
 
 	"fmt"
+	"time"
 
+	"github.com/google/shlex"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/openshift/assisted-installer/src/utils"
 	"github.com/openshift/assisted-service/models"
 )
 
+const (
+	LogsSinkService   = "service"
+	LogsSinkLocalDir  = "local-dir"
+	LogsSinkCustomURL = "custom-url"
+)
+
+// policies of the nodes that match no inventory host, e.g. nodes added to the cluster outside of the installation
+const (
+	UnmatchedNodePolicyError  = "error"
+	UnmatchedNodePolicyWarn   = "warn"
+	UnmatchedNodePolicyIgnore = "ignore"
+)
+
+const (
+	DefaultSshDir          = "/root/.ssh"
+	DefaultSshManifestPath = "/opt/openshift/openshift/99_openshift-machineconfig_99-assisted-installer-master-ssh.yaml"
+	sshKeyName             = "id_rsa"
+	// DefaultDockerConfigPath is also where the bootstrap ignition carries the pull secret
+	DefaultDockerConfigPath = "/root/.docker/config.json"
+)
+
+// DefaultBootstrapServices are the units started on the bootstrap node when no others were configured
+var DefaultBootstrapServices = []string{"bootkube.service", "approve-csr.service", "progress.service"}
+
+var systemdUnitNameRegex = regexp.MustCompile(`^[a-zA-Z0-9:_.\\@-]+\.(service|target|socket|timer|path|mount)$`)
+
 type Config struct {
 	DryRunConfig
 	Role                        string
@@ -37,7 +68,40 @@ type Config struct {
 	CheckClusterVersion         bool
 	MustGatherImage             string
 	DisksToFormat               ArrayFlags
+	SkipFormattingEmptyDisks    bool
 	SkipInstallationDiskCleanup bool
+	ProgressFilePath            string
+	LogsSink                    string
+	LogsSinkDir                 string
+	LogsSinkURL                 string
+	ConfiguringStuckThreshold   time.Duration
+	ConfiguringStatusInterval   time.Duration
+	BootstrapServices           ArrayFlags
+	SshDir                      string
+	SshKeyPath                  string
+	SshManifestPath             string
+	ForceSshKeyGeneration       bool
+	PreserveDevices             ArrayFlags
+	EtcdDevice                  string
+	WipeEtcdDevice              bool
+	DockerConfigPath            string
+	FailOnBootOrderError        bool
+	MaxClockSkew                time.Duration
+	FailOnClockSkew             bool
+	UserAgent                   string
+	FileDownloadTimeout         time.Duration
+	MasterCount                 int
+	MinReadyMasters             int
+	NodeReadyConditions         ArrayFlags
+	OverallInstallTimeout       time.Duration
+	ConfiguringFilteredStages   ArrayFlags
+	StageTimeouts               StageTimeouts
+	DefaultStageTimeout         time.Duration
+	ConfirmLogsUploadTimeout    time.Duration
+	AdditionalTrustBundlePath   string
+	UnmatchedNodePolicy         string
+	UploadPreflightReport       bool
+	PreviewConfiguringStatus    bool
 }
 
 func printHelpAndExit(err error) {
@@ -66,6 +130,8 @@ func (c *Config) ProcessArgs(args []string) {
 		"Assisted Installer Agent image URL that will be used to send logs on successful installation")
 	flagSet.BoolVar(&c.SkipCertVerification, "insecure", false, "Do not validate TLS certificate")
 	flagSet.StringVar(&c.CACertPath, "cacert", "", "Path to custom CA certificate in PEM format")
+	flagSet.StringVar(&c.AdditionalTrustBundlePath, "additional-trust-bundle", "",
+		"Path to CA certificates in PEM format the host trusts before pulling images, e.g. the CA of a private registry (default the additional trust bundle of the ignition)")
 	flagSet.StringVar(&c.HTTPProxy, "http-proxy", "", "A proxy URL to use for creating HTTP connections outside the cluster")
 	flagSet.StringVar(&c.HTTPSProxy, "https-proxy", "", "A proxy URL to use for creating HTTPS connections outside the cluster")
 	flagSet.StringVar(&c.NoProxy, "no-proxy", "", "A comma-separated list of destination domain names, domains, IP addresses, or other network CIDRs to exclude proxying")
@@ -74,10 +140,59 @@ func (c *Config) ProcessArgs(args []string) {
 	flagSet.BoolVar(&c.CheckClusterVersion, "check-cluster-version", false, "Do not monitor CVO")
 	flagSet.StringVar(&c.MustGatherImage, "must-gather-image", "", "Custom must-gather image")
 	flagSet.Var(&c.DisksToFormat, "format-disk", "Disk to format. Can be specified multiple times")
+	flagSet.BoolVar(&c.SkipFormattingEmptyDisks, "skip-formatting-empty-disks", false,
+		"Don't format the disks that have no partition table or filesystem signature, instead of always formatting them")
+	flagSet.BoolVar(&c.FailOnBootOrderError, "fail-on-boot-order-error", false, "Fail the installation if the boot order can't be set instead of only warning about it")
 	flagSet.BoolVar(&c.SkipInstallationDiskCleanup, "skip-installation-disk-cleanup", false, "Skip installation disk cleanup gives disk management to coreos-installer in case needed")
+	flagSet.Var(&c.PreserveDevices, "preserve-device", "Disk or partition the installation disk cleanup must never touch, including VGs and raid arrays it's part of. Can be specified multiple times")
+	flagSet.StringVar(&c.EtcdDevice, "etcd-device", "", "Optional disk dedicated to etcd, it's validated before the installation and left untouched unless wipe-etcd-device is set")
+	flagSet.BoolVar(&c.WipeEtcdDevice, "wipe-etcd-device", false, "Wipe the etcd device during the installation disk cleanup")
+	flagSet.StringVar(&c.ProgressFilePath, "progress-file-path", "/var/log/assisted-installer-progress.json",
+		"Path of a local JSON file reflecting the current installation stage, leave empty to disable")
+	flagSet.StringVar(&c.LogsSink, "logs-sink", LogsSinkService,
+		fmt.Sprintf("Where to send the installation logs before reboot, one of %s, %s or %s", LogsSinkService, LogsSinkLocalDir, LogsSinkCustomURL))
+	flagSet.StringVar(&c.LogsSinkDir, "logs-sink-dir", "/var/log/assisted-installer", "Directory to write the installation logs to when using the local-dir logs sink")
+	flagSet.StringVar(&c.LogsSinkURL, "logs-sink-url", "", "Alternative service URL to upload the installation logs to when using the custom-url logs sink")
+	flagSet.Var(&c.BootstrapServices, "bootstrap-service",
+		fmt.Sprintf("Systemd unit to start on the bootstrap node, in order. Can be specified multiple times (default %s)", strings.Join(DefaultBootstrapServices, ",")))
+	flagSet.StringVar(&c.SshDir, "ssh-dir", DefaultSshDir, "Directory in which the bootstrap SSH key pair is generated")
+	flagSet.StringVar(&c.SshKeyPath, "ssh-key-path", "", fmt.Sprintf("Path of the bootstrap SSH private key, the public key is written next to it (default <ssh-dir>/%s)", sshKeyName))
+	flagSet.StringVar(&c.SshManifestPath, "ssh-manifest-path", DefaultSshManifestPath, "Path of the MachineConfig manifest adding the bootstrap SSH public key to the masters")
+	flagSet.StringVar(&c.DockerConfigPath, "docker-config-path", DefaultDockerConfigPath, "Path the pull secret is written to and read from when pulling images on the bootstrap")
+	flagSet.BoolVar(&c.ForceSshKeyGeneration, "force-ssh-keygen", false, "Regenerate the bootstrap SSH key pair even if a valid one already exists")
+	flagSet.DurationVar(&c.ConfiguringStuckThreshold, "configuring-stuck-threshold", 30*time.Minute,
+		"Time after which a host that pulled ignition but is still configuring is reported as stuck, 0 disables the check")
+	flagSet.DurationVar(&c.ConfiguringStatusInterval, "configuring-status-interval", 30*time.Second,
+		"How often the bootstrap polls the MCS logs for hosts that pulled ignition")
+	flagSet.DurationVar(&c.MaxClockSkew, "max-clock-skew", 2*time.Minute,
+		"Maximum difference between the host and the service clocks before warning about it, 0 disables the check")
+	flagSet.StringVar(&c.UserAgent, "user-agent", "", "User-Agent of the requests to the service (default assisted-installer/<version> (host <host-id>))")
+	flagSet.DurationVar(&c.FileDownloadTimeout, "file-download-timeout", 10*time.Minute,
+		"Time after which a stuck download of a file from the service is cancelled and retried, 0 disables the timeout")
+	flagSet.IntVar(&c.MasterCount, "master-count", 3, "Number of masters of a highly available cluster")
+	flagSet.IntVar(&c.MinReadyMasters, "min-ready-masters", 2, "Number of ready masters the bootstrap and the workers wait for before rebooting")
+	flagSet.Var(&c.NodeReadyConditions, "node-ready-condition",
+		"Additional Type=Status node condition a master must have to be counted as ready, e.g. DiskPressure=False. Can be specified multiple times")
+	flagSet.Var(&c.ConfiguringFilteredStages, "configuring-filtered-stage",
+		"Stage of the hosts the bootstrap doesn't move to configuring, replaces the default stages. Can be specified multiple times")
+	flagSet.DurationVar(&c.OverallInstallTimeout, "overall-install-timeout", 0,
+		"Time after which the whole installation of the node is failed, 0 disables the timeout")
+	flagSet.Var(&c.StageTimeouts, "stage-timeout",
+		"Stage=duration time after which the installation is failed if it's still in that stage, e.g. \"Waiting for control plane=1h\". Can be specified multiple times")
+	flagSet.DurationVar(&c.DefaultStageTimeout, "default-stage-timeout", 0,
+		"Timeout of the stages that have no stage-timeout, 0 disables it")
+	flagSet.DurationVar(&c.ConfirmLogsUploadTimeout, "confirm-logs-upload-timeout", 0,
+		"How long the bootstrap and single node wait for the service to confirm it received the logs before rebooting, 0 disables the confirmation")
+	flagSet.StringVar(&c.UnmatchedNodePolicy, "unmatched-node-policy", UnmatchedNodePolicyError,
+		fmt.Sprintf("How a ready master that matches no inventory host is handled, one of %s, %s or %s", UnmatchedNodePolicyError, UnmatchedNodePolicyWarn, UnmatchedNodePolicyIgnore))
+	flagSet.BoolVar(&c.UploadPreflightReport, "upload-preflight-report", false,
+		"Upload a report of the preflight checks, disks, network and certificates of the host to the service before touching the node")
+	flagSet.BoolVar(&c.PreviewConfiguringStatus, "preview-configuring-status", false,
+		"Only log the hosts the MCS logs would move to configuring instead of updating their status, for debugging")
+	flagSet.BoolVar(&c.FailOnClockSkew, "fail-on-clock-skew", false, "Fail the installation if the host clock skew is above max-clock-skew instead of only warning about it")
 
 	var installerArgs string
-	flagSet.StringVar(&installerArgs, "installer-args", "", "JSON array of additional coreos-installer arguments")
+	flagSet.StringVar(&installerArgs, "installer-args", "", "JSON array or shell-like quoted string of additional coreos-installer arguments")
 	h := flagSet.Bool("help", false, "Help message")
 
 	// Add dry-run specific flag bindings.
@@ -91,6 +206,9 @@ func (c *Config) ProcessArgs(args []string) {
 	flagSet.StringVar(&c.ForcedHostID, "force-id", DefaultDryRunConfig.ForcedHostID, "The fake host ID to give to the host")
 	flagSet.StringVar(&c.FakeRebootMarkerPath, "fake-reboot-marker-path", DefaultDryRunConfig.FakeRebootMarkerPath, "A path whose existence indicates a fake reboot happened")
 	flagSet.StringVar(&c.DryRunClusterHostsPath, "dry-run-cluster-hosts-path", DefaultDryRunConfig.DryRunClusterHostsPath, "A path to a JSON file with information about hosts in the cluster")
+	flagSet.StringVar(&c.DryInventoryRecordPath, "dry-run-inventory-record-path", DefaultDryRunConfig.DryInventoryRecordPath, "A path to a JSONL file that inventory calls are recorded to instead of being sent to the service")
+	flagSet.StringVar(&c.DryMastersWaitOutcome, "dry-run-masters-wait-outcome", DefaultDryRunConfig.DryMastersWaitOutcome,
+		fmt.Sprintf("For testing only, in dry run a worker doesn't wait for the ready masters and behaves as if the wait ended as %s or %s", DryMastersWaitReady, DryMastersWaitFailed))
 
 	err = flagSet.Parse(args)
 	if err != nil {
@@ -109,6 +227,19 @@ func (c *Config) ProcessArgs(args []string) {
 		printHelpAndExit(err)
 	}
 
+	if err := c.validateLogsSink(); err != nil {
+		printHelpAndExit(err)
+	}
+	if err := c.validateBootstrapServices(); err != nil {
+		printHelpAndExit(err)
+	}
+	if err := c.validateUnmatchedNodePolicy(); err != nil {
+		printHelpAndExit(err)
+	}
+	if err := c.validateDryMastersWaitOutcome(); err != nil {
+		printHelpAndExit(err)
+	}
+
 	if h != nil && *h {
 		printHelpAndExit(nil)
 	}
@@ -120,9 +251,102 @@ func (c *Config) ProcessArgs(args []string) {
 	c.SetDefaults()
 }
 
+// reservedInstallerArgs are the coreos-installer install flags the installer sets itself, passing
+// them with installer-args would write another ignition than the host's
+var reservedInstallerArgs = map[string]bool{
+	"-i":              true,
+	"--ignition-file": true,
+	"-I":              true,
+	"--ignition-url":  true,
+}
+
+// SetInstallerArgs accepts either a JSON array or a shell-like quoted string of arguments
 func (c *Config) SetInstallerArgs(installerArgs string) error {
-	if installerArgs != "" {
-		return json.Unmarshal([]byte(installerArgs), &c.InstallerArgs)
+	var args []string
+	installerArgs = strings.TrimSpace(installerArgs)
+	switch {
+	case installerArgs == "":
+		return nil
+	case strings.HasPrefix(installerArgs, "["):
+		if err := json.Unmarshal([]byte(installerArgs), &args); err != nil {
+			return err
+		}
+	default:
+		var err error
+		if args, err = shlex.Split(installerArgs); err != nil {
+			return fmt.Errorf("failed to split installer args: %w", err)
+		}
+	}
+	if err := validateInstallerArgs(args); err != nil {
+		return err
+	}
+	c.InstallerArgs = args
+	return nil
+}
+
+// validateInstallerArgs rejects the arguments the installer sets itself, the ignition and the
+// destination device. Any other coreos-installer flag is passed through as is.
+func validateInstallerArgs(args []string) error {
+	for i, arg := range args {
+		name := strings.SplitN(arg, "=", 2)[0]
+		if reservedInstallerArgs[name] {
+			return fmt.Errorf("installer argument %s is set by the installer", name)
+		}
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+		// a value follows a flag that doesn't have one yet, anything else is a destination device
+		previous := ""
+		if i > 0 {
+			previous = args[i-1]
+		}
+		if !strings.HasPrefix(previous, "-") || strings.Contains(previous, "=") || strings.HasPrefix(arg, "/dev/") {
+			return fmt.Errorf("unexpected installer argument %q, the destination device is set by the installer", arg)
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateLogsSink() error {
+	switch c.LogsSink {
+	case "", LogsSinkService:
+	case LogsSinkLocalDir:
+		if c.LogsSinkDir == "" {
+			return fmt.Errorf("logs-sink-dir is required when using the %s logs sink", LogsSinkLocalDir)
+		}
+	case LogsSinkCustomURL:
+		if c.LogsSinkURL == "" {
+			return fmt.Errorf("logs-sink-url is required when using the %s logs sink", LogsSinkCustomURL)
+		}
+	default:
+		return fmt.Errorf("unknown logs sink %s", c.LogsSink)
+	}
+	return nil
+}
+
+func (c *Config) validateUnmatchedNodePolicy() error {
+	switch c.UnmatchedNodePolicy {
+	case "", UnmatchedNodePolicyError, UnmatchedNodePolicyWarn, UnmatchedNodePolicyIgnore:
+		return nil
+	default:
+		return fmt.Errorf("unknown unmatched node policy %s", c.UnmatchedNodePolicy)
+	}
+}
+
+func (c *Config) validateDryMastersWaitOutcome() error {
+	switch c.DryMastersWaitOutcome {
+	case "", DryMastersWaitReady, DryMastersWaitFailed:
+		return nil
+	default:
+		return fmt.Errorf("unknown masters wait outcome %s", c.DryMastersWaitOutcome)
+	}
+}
+
+func (c *Config) validateBootstrapServices() error {
+	for _, service := range c.BootstrapServices {
+		if !systemdUnitNameRegex.MatchString(service) {
+			return fmt.Errorf("invalid bootstrap service unit name %q", service)
+		}
 	}
 	return nil
 }
@@ -136,4 +360,24 @@ func (c *Config) SetDefaults() {
 	if c.InfraEnvID == "" {
 		c.InfraEnvID = c.ClusterID
 	}
+
+	c.SetSshDefaults()
+}
+
+// SetSshDefaults fills the SSH paths that were left empty
+func (c *Config) SetSshDefaults() {
+	if c.SshDir == "" {
+		c.SshDir = DefaultSshDir
+	}
+	if c.SshKeyPath == "" {
+		c.SshKeyPath = path.Join(c.SshDir, sshKeyName)
+	}
+	if c.SshManifestPath == "" {
+		c.SshManifestPath = DefaultSshManifestPath
+	}
+}
+
+// SshPubKeyPath is where ssh-keygen writes the public key of SshKeyPath
+func (c *Config) SshPubKeyPath() string {
+	return c.SshKeyPath + ".pub"
 }
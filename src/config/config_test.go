@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -24,11 +25,11 @@ var _ = Describe("ProcessArgs", func() {
 
 	It("Should deserialize installer args correctly when they are supplied correctly.", func() {
 		config := &Config{}
-		arguments := []string{"--role", "worker", "--cluster-id", "0ae63135-5f7c-431e-9c72-0efaf2cb83b8", "--installer-args", "[\"arg1=foo\", \"arg2=bar\"]"}
+		arguments := []string{"--role", "worker", "--cluster-id", "0ae63135-5f7c-431e-9c72-0efaf2cb83b8", "--installer-args", "[\"--append-karg\", \"arg1=foo\"]"}
 		config.ProcessArgs(arguments)
 		Expect(len(config.InstallerArgs)).To(Equal(2))
-		Expect(config.InstallerArgs[0]).To(Equal("arg1=foo"))
-		Expect(config.InstallerArgs[1]).To(Equal("arg2=bar"))
+		Expect(config.InstallerArgs[0]).To(Equal("--append-karg"))
+		Expect(config.InstallerArgs[1]).To(Equal("arg1=foo"))
 	})
 
 	It("HighAvailabilityMode should be set to empty string if the host role is worker.", func() {
@@ -66,14 +67,184 @@ var _ = Describe("ProcessArgs", func() {
 		Expect(config.InfraEnvID).To(Equal("9f2a26d7-10a6-4be0-b1c2-e895ad3b04b8"))
 	})
 
+	It("SSH paths should keep their defaults if not overridden", func() {
+		config := &Config{}
+		config.ProcessArgs([]string{"--role", string(models.HostRoleBootstrap)})
+		Expect(config.SshDir).To(Equal(DefaultSshDir))
+		Expect(config.SshKeyPath).To(Equal("/root/.ssh/id_rsa"))
+		Expect(config.SshPubKeyPath()).To(Equal("/root/.ssh/id_rsa.pub"))
+		Expect(config.SshManifestPath).To(Equal(DefaultSshManifestPath))
+	})
+
+	It("SSH key path should follow an overridden SSH dir", func() {
+		config := &Config{}
+		config.ProcessArgs([]string{"--role", string(models.HostRoleBootstrap), "--ssh-dir", "/var/home/core/.ssh",
+			"--ssh-manifest-path", "/tmp/manifests/99-ssh.yaml"})
+		Expect(config.SshDir).To(Equal("/var/home/core/.ssh"))
+		Expect(config.SshKeyPath).To(Equal("/var/home/core/.ssh/id_rsa"))
+		Expect(config.SshManifestPath).To(Equal("/tmp/manifests/99-ssh.yaml"))
+	})
+
+	It("SSH key path should be used as is when set", func() {
+		config := &Config{}
+		config.ProcessArgs([]string{"--role", string(models.HostRoleBootstrap), "--ssh-key-path", "/tmp/keys/bootstrap"})
+		Expect(config.SshDir).To(Equal(DefaultSshDir))
+		Expect(config.SshKeyPath).To(Equal("/tmp/keys/bootstrap"))
+		Expect(config.SshPubKeyPath()).To(Equal("/tmp/keys/bootstrap.pub"))
+	})
+
 })
 
 var _ = Describe("SetInstallerArgs", func() {
 
 	It("Should raise an error when supplied installer args could not be parsed.", func() {
 		config := &Config{}
-		Expect(config.SetInstallerArgs("Non JSON string!!!")).Error()
+		Expect(config.SetInstallerArgs("[\"--append-karg\"")).NotTo(Succeed())
+		Expect(config.SetInstallerArgs("--append-karg 'unterminated")).NotTo(Succeed())
 		Expect(len(config.InstallerArgs)).To(BeZero())
 	})
 
+	It("Should parse the same arguments from JSON and from a quoted string.", func() {
+		expected := []string{"--append-karg", "ip=192.168.1.2::192.168.1.1:255.255.255.0:my host:eth0:none", "-n", "--delete-karg=console=ttyS0"}
+		fromJSON := &Config{}
+		Expect(fromJSON.SetInstallerArgs(`["--append-karg", "ip=192.168.1.2::192.168.1.1:255.255.255.0:my host:eth0:none", "-n", "--delete-karg=console=ttyS0"]`)).To(Succeed())
+		Expect(fromJSON.InstallerArgs).To(Equal(expected))
+		fromString := &Config{}
+		Expect(fromString.SetInstallerArgs(`--append-karg "ip=192.168.1.2::192.168.1.1:255.255.255.0:my host:eth0:none" -n --delete-karg='console=ttyS0'`)).To(Succeed())
+		Expect(fromString.InstallerArgs).To(Equal(expected))
+	})
+
+	It("Should pass through the coreos-installer flags the installer doesn't set.", func() {
+		config := &Config{}
+		Expect(config.SetInstallerArgs(`--append-karg foo=bar --copy-network --console ttyS0,115200n8 --offline`)).To(Succeed())
+		Expect(config.InstallerArgs).To(Equal([]string{"--append-karg", "foo=bar", "--copy-network", "--console", "ttyS0,115200n8", "--offline"}))
+	})
+
+	It("Should reject the arguments the installer sets itself.", func() {
+		for args, expected := range map[string]string{
+			`["--ignition-url", "http://example.com/evil.ign"]`: "installer argument --ignition-url is set by the installer",
+			`-i /tmp/other.ign`:              "installer argument -i is set by the installer",
+			`--ignition-file=/tmp/other.ign`: "installer argument --ignition-file is set by the installer",
+			`--append-karg foo=bar /dev/sdb`: `unexpected installer argument "/dev/sdb", the destination device is set by the installer`,
+			`--copy-network /dev/sdb`:        `unexpected installer argument "/dev/sdb", the destination device is set by the installer`,
+			`/dev/sdb`:                       `unexpected installer argument "/dev/sdb", the destination device is set by the installer`,
+		} {
+			config := &Config{}
+			err := config.SetInstallerArgs(args)
+			Expect(err).To(HaveOccurred(), args)
+			Expect(err.Error()).To(Equal(expected), args)
+			Expect(config.InstallerArgs).To(BeEmpty(), args)
+		}
+	})
+
+})
+
+var _ = Describe("validateLogsSink", func() {
+
+	It("Should accept the default service sink.", func() {
+		config := &Config{}
+		Expect(config.validateLogsSink()).To(Succeed())
+		config.LogsSink = LogsSinkService
+		Expect(config.validateLogsSink()).To(Succeed())
+	})
+
+	It("Should require a directory for the local-dir sink.", func() {
+		config := &Config{LogsSink: LogsSinkLocalDir}
+		Expect(config.validateLogsSink()).NotTo(Succeed())
+		config.LogsSinkDir = "/var/log/assisted-installer"
+		Expect(config.validateLogsSink()).To(Succeed())
+	})
+
+	It("Should require a URL for the custom-url sink.", func() {
+		config := &Config{LogsSink: LogsSinkCustomURL}
+		Expect(config.validateLogsSink()).NotTo(Succeed())
+		config.LogsSinkURL = "https://logs.example.com"
+		Expect(config.validateLogsSink()).To(Succeed())
+	})
+
+	It("Should reject an unknown sink.", func() {
+		config := &Config{LogsSink: "s3"}
+		Expect(config.validateLogsSink()).NotTo(Succeed())
+	})
+
+})
+
+var _ = Describe("validateUnmatchedNodePolicy", func() {
+
+	It("Should accept the known policies.", func() {
+		for _, policy := range []string{"", UnmatchedNodePolicyError, UnmatchedNodePolicyWarn, UnmatchedNodePolicyIgnore} {
+			config := &Config{UnmatchedNodePolicy: policy}
+			Expect(config.validateUnmatchedNodePolicy()).To(Succeed(), policy)
+		}
+	})
+
+	It("Should reject an unknown policy.", func() {
+		config := &Config{UnmatchedNodePolicy: "fail"}
+		Expect(config.validateUnmatchedNodePolicy()).NotTo(Succeed())
+	})
+
+})
+
+var _ = Describe("validateDryMastersWaitOutcome", func() {
+
+	It("Should accept no outcome and the known outcomes.", func() {
+		for _, outcome := range []string{"", DryMastersWaitReady, DryMastersWaitFailed} {
+			config := &Config{DryRunConfig: DryRunConfig{DryMastersWaitOutcome: outcome}}
+			Expect(config.validateDryMastersWaitOutcome()).To(Succeed(), outcome)
+		}
+	})
+
+	It("Should reject an unknown outcome.", func() {
+		config := &Config{DryRunConfig: DryRunConfig{DryMastersWaitOutcome: "timeout"}}
+		Expect(config.validateDryMastersWaitOutcome()).NotTo(Succeed())
+	})
+
+})
+
+var _ = Describe("validateBootstrapServices", func() {
+
+	It("Should accept the default services.", func() {
+		config := &Config{}
+		Expect(config.validateBootstrapServices()).To(Succeed())
+		config.BootstrapServices = ArrayFlags(DefaultBootstrapServices)
+		Expect(config.validateBootstrapServices()).To(Succeed())
+	})
+
+	It("Should accept other unit types.", func() {
+		config := &Config{BootstrapServices: ArrayFlags{"custom@instance.service", "extra.target"}}
+		Expect(config.validateBootstrapServices()).To(Succeed())
+	})
+
+	It("Should reject invalid unit names.", func() {
+		for _, name := range []string{"bootkube", "boot kube.service", "bootkube.service; reboot", ""} {
+			config := &Config{BootstrapServices: ArrayFlags{name}}
+			Expect(config.validateBootstrapServices()).NotTo(Succeed(), name)
+		}
+	})
+
+})
+
+var _ = Describe("StageTimeouts", func() {
+
+	It("Should parse timeouts of several stages.", func() {
+		config := &Config{}
+		arguments := []string{"--role", "worker", "--cluster-id", "0ae63135-5f7c-431e-9c72-0efaf2cb83b8",
+			"--stage-timeout", "Writing image to disk=1h", "--stage-timeout", "Starting installation=5m",
+			"--default-stage-timeout", "30m"}
+		config.ProcessArgs(arguments)
+		Expect(config.StageTimeouts).To(Equal(StageTimeouts{
+			models.HostStageWritingImageToDisk:   time.Hour,
+			models.HostStageStartingInstallation: 5 * time.Minute,
+		}))
+		Expect(config.DefaultStageTimeout).To(Equal(30 * time.Minute))
+	})
+
+	It("Should reject unknown stages and invalid durations.", func() {
+		timeouts := StageTimeouts{}
+		Expect(timeouts.Set("Writing image to disk")).NotTo(Succeed())
+		Expect(timeouts.Set("Unknown stage=1h")).NotTo(Succeed())
+		Expect(timeouts.Set("Rebooting=soon")).NotTo(Succeed())
+		Expect(timeouts.Set("Rebooting=-1m")).NotTo(Succeed())
+		Expect(timeouts).To(BeEmpty())
+	})
 })
@@ -11,15 +11,28 @@ type DryRunConfig struct {
 	FakeRebootMarkerPath   string `envconfig:"DRY_FAKE_REBOOT_MARKER_PATH"`
 	ForcedHostID           string `envconfig:"DRY_HOST_ID"`
 	DryRunClusterHostsPath string `envconfig:"DRY_CLUSTER_HOSTS_PATH"`
+	// When set, inventory calls are appended to this JSONL file instead of being sent to the service
+	DryInventoryRecordPath string `envconfig:"DRY_INVENTORY_RECORD_PATH"`
+	// DryMastersWaitOutcome replaces the wait of a worker for the ready masters with a fixed outcome, so
+	// the worker flow can be tested without a control plane. Only used in dry run
+	DryMastersWaitOutcome string `envconfig:"DRY_MASTERS_WAIT_OUTCOME"`
 	// DryRunClusterHostsPath gets read parsed into ParsedClusterHosts by DryParseClusterHosts
 	ParsedClusterHosts DryClusterHosts
 }
 
+// outcomes of the stubbed wait for the ready masters
+const (
+	DryMastersWaitReady  = "ready"
+	DryMastersWaitFailed = "failed"
+)
+
 var DefaultDryRunConfig = DryRunConfig{
 	DryRunEnabled:          false,
 	FakeRebootMarkerPath:   "",
 	ForcedHostID:           "",
 	DryRunClusterHostsPath: "",
+	DryInventoryRecordPath: "",
+	DryMastersWaitOutcome:  "",
 }
 
 type DryClusterHost struct {
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openshift/assisted-service/models"
+)
+
+// StageTimeouts is a flag.Value of Stage=duration pairs, e.g. "Waiting for control plane=1h",
+// the flag can be specified once per stage
+type StageTimeouts map[models.HostStage]time.Duration
+
+// String is implemented to fit the flag.Value interface
+func (s *StageTimeouts) String() string {
+	if s == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*s))
+	for stage, timeout := range *s {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", stage, timeout))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set is implemented to fit the flag.Value interface
+func (s *StageTimeouts) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid stage timeout %q, expected Stage=duration", value)
+	}
+	stage := models.HostStage(strings.TrimSpace(parts[0]))
+	if err := stage.Validate(nil); err != nil {
+		return fmt.Errorf("invalid stage in stage timeout %q: %w", value, err)
+	}
+	timeout, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return fmt.Errorf("invalid duration in stage timeout %q: %w", value, err)
+	}
+	if timeout < 0 {
+		return fmt.Errorf("negative duration in stage timeout %q", value)
+	}
+	if *s == nil {
+		*s = StageTimeouts{}
+	}
+	(*s)[stage] = timeout
+	return nil
+}
@@ -2,10 +2,21 @@ package installer
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/go-openapi/swag"
@@ -36,7 +47,6 @@ const (
 	InstallDir                   = "/opt/install-dir"
 	KubeconfigPath               = "/opt/openshift/auth/kubeconfig"
 	minMasterNodes               = 2
-	dockerConfigFile             = "/root/.docker/config.json"
 	assistedControllerNamespace  = "assisted-installer"
 	extractRetryCount            = 3
 	waitForeverTimeout           = time.Duration(1<<63 - 1) // wait forever ~ 292 years
@@ -45,17 +55,110 @@ const (
 	singleNodeMasterIgnitionPath = "/opt/openshift/master.ign"
 	waitingForMastersStatusInfo  = "Waiting for masters to join bootstrap control plane"
 	waitingForBootstrapToPrepare = "Waiting for bootstrap node preparation"
+	uploadLogsMaxAttempts        = 3
+	resolvConfPath               = "/etc/resolv.conf"
+	diskInventoryColumns         = "NAME,TYPE,SIZE,FSTYPE,LABEL,MOUNTPOINT"
+	systemctlMaxAttempts         = 3
+	wipefsMaxAttempts            = 3
+	configuringStuckInfo         = "Host pulled ignition but is still configuring after %s"
+	mcsLogsFailuresBeforeWarning = 10
+	downloadTimeoutAttempts      = 3
+	memInfoPath                  = "/proc/meminfo"
+	// podman exits with 128+SIGKILL when the container is OOM killed
+	oomKilledExitCode = 137
+	// ignitionTrustBundlePath is where the ignition carries the additional trust bundle of the install config
+	ignitionTrustBundlePath = "/etc/pki/ca-trust/source/anchors/ca.crt"
+	hostTrustBundlePath     = "/etc/pki/ca-trust/source/anchors/assisted-installer-ca.crt"
 )
 
-var generalWaitTimeout = 30 * time.Second
+var (
+	// diskIOErrorRegex matches the errors of a disk with bad sectors, e.g. "Input/output error (os error 5)"
+	diskIOErrorRegex                 = regexp.MustCompile(`(?i)input/output error|\bI/O error\b`)
+	partitionSuffixRegex             = regexp.MustCompile(`^[0-9]+$`)
+	numberedDiskPartitionSuffixRegex = regexp.MustCompile(`^p[0-9]+$`)
+	outOfMemoryRegex                 = regexp.MustCompile(`(?i)out of memory|oom[- ]?kill`)
+)
+
+// defaultConfiguringStatusInterval is used when Config.ConfiguringStatusInterval isn't set
+var defaultConfiguringStatusInterval = 30 * time.Second
 var generalWaitInterval = 5 * time.Second
+var uploadLogsRetryInterval = 5 * time.Second
+var uploadLogsRetryMaxInterval = 30 * time.Second
+var confirmLogsUploadInterval = 10 * time.Second
+var listNodesBackoffMax = 1 * time.Minute
+var serviceActiveTimeout = 30 * time.Second
+var systemctlRetryInterval = 2 * time.Second
+var systemctlRetryMaxInterval = 10 * time.Second
+var wipefsRetryInterval = 2 * time.Second
+var resolvConfSettleTimeout = 10 * time.Second
+
+// defaultConfiguringFilteredStages are the stages of hosts that are past pulling their ignition, or
+// don't need to be moved to configuring by the bootstrap
+var defaultConfiguringFilteredStages = []models.HostStage{models.HostStageConfiguring, models.HostStageJoined,
+	models.HostStageDone, models.HostStageWaitingForIgnition}
+
+// minimal requirements of a single node cluster, the host is only warned about as the service
+// validates the resources before the installation starts
+var (
+	singleNodeMinCPUCores    int64 = 8
+	singleNodeMinMemoryBytes int64 = 16 * 1024 * 1024 * 1024
+)
+
+var (
+	// ErrBootstrapFailed is returned when the bootstrap flow running next to the installation fails
+	ErrBootstrapFailed = errors.New("bootstrap failed")
+	// ErrControlPlaneTimeout is returned when the bootstrap node fails waiting for the control plane
+	ErrControlPlaneTimeout = errors.New("waiting for control plane failed")
+	// ErrOverallInstallTimeout is returned when the installation takes longer than Config.OverallInstallTimeout
+	ErrOverallInstallTimeout = errors.New("overall install timeout")
+	// ErrStageTimeout is returned when a stage takes longer than its Config.StageTimeouts or Config.DefaultStageTimeout
+	ErrStageTimeout = errors.New("stage timeout")
+)
+
+// installPhaseError tells which phase of the installation failed while keeping the original error
+type installPhaseError struct {
+	phase error
+	cause error
+}
+
+func (e *installPhaseError) Error() string {
+	return fmt.Sprintf("%s: %s", e.phase, e.cause)
+}
+
+func (e *installPhaseError) Is(target error) bool {
+	return target == e.phase
+}
+
+func (e *installPhaseError) Unwrap() error {
+	return e.cause
+}
 
 // Installer will run the install operations on the node
 type Installer interface {
 	// FormatDisks formats all disks that have been configured to be formatted
 	FormatDisks() error
 	InstallNode() error
+	// InstallNodeWithContext is like InstallNode but stops the installation once ctx is cancelled
+	InstallNodeWithContext(ctx context.Context) error
+	// InstallNodeWithResult is like InstallNodeWithContext but also describes how the installation went,
+	// the result is returned even if the installation failed
+	InstallNodeWithResult(ctx context.Context) (*InstallResult, error)
 	UpdateHostInstallProgress(newStage models.HostStage, info string)
+	// OnStageChange registers a callback that is invoked whenever the installation stage changes
+	OnStageChange(callback StageChangeCallback)
+}
+
+// StageChangeCallback is called with the previous and the new installation stage
+type StageChangeCallback func(oldStage, newStage models.HostStage, info string)
+
+// InstallResult describes how the installation of the node went
+type InstallResult struct {
+	// Role is the role the node was installed as, a bootstrap ends up as a master
+	Role string
+	// StageDurations is the time spent in every stage the installation went through
+	StageDurations map[models.HostStage]time.Duration
+	// Warnings are the failures of optional steps that didn't fail the installation
+	Warnings []string
 }
 
 type installer struct {
@@ -65,9 +168,25 @@ type installer struct {
 	inventoryClient inventory_client.InventoryClient
 	kcBuilder       k8s_client.K8SClientBuilder
 	ign             ignition.Ignition
+	stageLock       sync.Mutex
+	currentStage    models.HostStage
+	onStageChange   StageChangeCallback
+	stageStartedAt  time.Time
+	stageDurations  map[models.HostStage]time.Duration
+	warnings        []string
+	clock           utils.Clock
+	// mcsLogsFailures counts the consecutive failures to get the MCS logs
+	mcsLogsFailures int
+	nodeReadiness   common.NodeReadiness
+	// stageChanged is closed and replaced on every stage change to wake up enforceStageTimeouts
+	stageChanged  chan struct{}
+	timedOutStage models.HostStage
+	// preflightReport is added to the installation logs, their upload replaces the early preflight report
+	preflightReport []byte
 }
 
 func NewAssistedInstaller(log logrus.FieldLogger, cfg config.Config, ops ops.Ops, ic inventory_client.InventoryClient, kcb k8s_client.K8SClientBuilder, ign ignition.Ignition) *installer {
+	cfg.SetSshDefaults()
 	return &installer{
 		log:             log,
 		Config:          cfg,
@@ -75,25 +194,162 @@ func NewAssistedInstaller(log logrus.FieldLogger, cfg config.Config, ops ops.Ops
 		inventoryClient: ic,
 		kcBuilder:       kcb,
 		ign:             ign,
+		clock:           utils.RealClock{},
+		stageDurations:  make(map[models.HostStage]time.Duration),
+		stageChanged:    make(chan struct{}),
 	}
 }
 
 func (i *installer) FormatDisks() {
+	if len(i.Config.DisksToFormat) == 0 {
+		i.log.Info("No disks configured for formatting")
+		return
+	}
+	i.log.Infof("%d disks requested for formatting: %s", len(i.Config.DisksToFormat), strings.Join(i.Config.DisksToFormat, ", "))
+	formatted := 0
+	installDevice := i.ops.EvaluateDiskSymlink(i.Config.Device)
 	for _, diskToFormat := range i.Config.DisksToFormat {
+		if err := i.verifyDiskCanBeFormatted(diskToFormat, installDevice); err != nil {
+			i.log.WithError(err).Errorf("Refusing to format disk %s", diskToFormat)
+			continue
+		}
+		if i.SkipFormattingEmptyDisks {
+			empty, err := i.ops.IsDiskEmpty(diskToFormat)
+			if err != nil {
+				i.log.WithError(err).Warnf("Failed to check if disk %s is empty, formatting it", diskToFormat)
+			} else if empty {
+				i.log.Infof("Disk %s has no partition table or filesystem signature, skipping formatting it", diskToFormat)
+				continue
+			}
+		}
 		if err := i.ops.FormatDisk(diskToFormat); err != nil {
 			// This is best effort - keep trying to format other disks
 			// and go on with the installation, log a warning
 			i.log.Warnf("Failed to format disk %s, err %s", diskToFormat, err)
+			continue
 		}
+		i.log.Infof("Formatted disk %s", diskToFormat)
+		formatted++
 	}
+	i.log.Infof("Formatted %d of the %d disks requested for formatting", formatted, len(i.Config.DisksToFormat))
+}
+
+// verifyDiskCanBeFormatted makes sure we never wipe the installation device or a disk
+// that is in use by the running system
+func (i *installer) verifyDiskCanBeFormatted(disk, installDevice string) error {
+	if i.ops.EvaluateDiskSymlink(disk) == installDevice {
+		return errors.Errorf("disk %s is the installation device", disk)
+	}
+	mountPoints, err := i.ops.GetMountPoints(disk)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get mount points of disk %s", disk)
+	}
+	if len(mountPoints) > 0 {
+		return errors.Errorf("disk %s is mounted on %s", disk, strings.Join(mountPoints, ", "))
+	}
+	return nil
 }
 
 func (i *installer) InstallNode() error {
+	return i.InstallNodeWithContext(context.Background())
+}
+
+func (i *installer) InstallNodeWithContext(ctx context.Context) error {
+	_, err := i.InstallNodeWithResult(ctx)
+	return err
+}
+
+func (i *installer) InstallNodeWithResult(ctx context.Context) (*InstallResult, error) {
+	if i.OverallInstallTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, i.OverallInstallTimeout)
+		defer cancel()
+	}
+	stageCtx, cancelStage := context.WithCancel(ctx)
+	defer cancelStage()
+	go i.enforceStageTimeouts(stageCtx, cancelStage)
+	err := i.installNode(stageCtx)
+	if err != nil && i.OverallInstallTimeout > 0 && ctx.Err() == context.DeadlineExceeded {
+		i.log.Errorf("Installation didn't complete within %s", i.OverallInstallTimeout)
+		err = &installPhaseError{phase: ErrOverallInstallTimeout, cause: err}
+	} else if stage := i.getTimedOutStage(); err != nil && stage != "" {
+		err = &installPhaseError{phase: ErrStageTimeout,
+			cause: errors.Wrapf(err, "stage %s didn't complete within %s", stage, i.stageTimeout(stage))}
+	}
+	return i.installResult(), err
+}
+
+// stageTimeout returns the timeout of the stage, falling back to the default one for stages that
+// have no specific timeout
+func (i *installer) stageTimeout(stage models.HostStage) time.Duration {
+	if stage == "" {
+		return 0
+	}
+	if timeout, ok := i.StageTimeouts[stage]; ok {
+		return timeout
+	}
+	return i.DefaultStageTimeout
+}
+
+// enforceStageTimeouts cancels the installation once the current stage exceeds its timeout, it
+// returns when ctx is done
+func (i *installer) enforceStageTimeouts(ctx context.Context, cancel context.CancelFunc) {
+	for {
+		i.stageLock.Lock()
+		stage, changed := i.currentStage, i.stageChanged
+		i.stageLock.Unlock()
+		var expired <-chan time.Time
+		timeout := i.stageTimeout(stage)
+		if timeout > 0 {
+			expired = i.clock.After(timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		case <-expired:
+			i.stageLock.Lock()
+			// the stage may have changed while the timer fired
+			if i.stageChanged != changed {
+				i.stageLock.Unlock()
+				continue
+			}
+			i.timedOutStage = stage
+			i.stageLock.Unlock()
+			i.log.Errorf("Stage %s didn't complete within %s, failing the installation", stage, timeout)
+			cancel()
+			return
+		}
+	}
+}
+
+func (i *installer) getTimedOutStage() models.HostStage {
+	i.stageLock.Lock()
+	defer i.stageLock.Unlock()
+	return i.timedOutStage
+}
+
+func (i *installer) installNode(ctx context.Context) error {
 	i.log.Infof("Installing node with role: %s", i.Config.Role)
 
 	i.UpdateHostInstallProgress(models.HostStageStartingInstallation, i.Config.Role)
-	i.Config.Device = i.ops.EvaluateDiskSymlink(i.Config.Device)
-	err := i.cleanupInstallDevice()
+	if err := i.validateHighAvailabilityMode(); err != nil {
+		i.log.WithError(err).Error("Invalid installer configuration")
+		return err
+	}
+	if err := i.setNodeReadiness(); err != nil {
+		i.log.WithError(err).Error("Invalid installer configuration")
+		return err
+	}
+	checks, err := i.runPreflightChecks()
+	if i.UploadPreflightReport && !i.DryRunEnabled {
+		i.uploadPreflightReport(checks)
+	}
+	if err != nil {
+		return err
+	}
+	i.logDiskInventory()
+	err = i.cleanupInstallDevice(ctx)
 	if err != nil {
 		i.log.Errorf("failed to prepare install device %s, err %s", i.Device, err)
 		return err
@@ -103,15 +359,16 @@ func (i *installer) InstallNode() error {
 		i.log.Errorf("Failed to create install dir: %s", err)
 		return err
 	}
-	ctx, cancel := context.WithCancel(context.Background())
-	bootstrapErrGroup, _ := errgroup.WithContext(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	// the bootstrap is cancelled with the installation
+	bootstrapErrGroup, bootstrapCtx := errgroup.WithContext(ctx)
 	//cancel the context in case this method ends
 	defer cancel()
 	isBootstrap := false
 	if i.Config.Role == string(models.HostRoleBootstrap) && i.HighAvailabilityMode != models.ClusterHighAvailabilityModeNone {
 		isBootstrap = true
 		bootstrapErrGroup.Go(func() error {
-			return i.startBootstrap()
+			return i.startBootstrap(bootstrapCtx)
 		})
 		go i.updateConfiguringStatus(ctx)
 		i.Config.Role = string(models.HostRoleMaster)
@@ -125,36 +382,38 @@ func (i *installer) InstallNode() error {
 	// as it is of no consequence to them.
 	if i.HighAvailabilityMode == models.ClusterHighAvailabilityModeNone {
 		i.log.Info("Installing single node openshift")
-		ignitionPath, err = i.createSingleNodeMasterIgnition()
+		ignitionPath, err = i.createSingleNodeMasterIgnition(ctx)
 		if err != nil {
 			return err
 		}
 	} else {
-		ignitionPath, err = i.downloadHostIgnition()
+		ignitionPath, err = i.downloadHostIgnition(ctx)
 		if err != nil {
 			return err
 		}
 
 	}
 
-	if err = i.writeImageToDisk(ignitionPath); err != nil {
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	if err = i.writeImageToDisk(ctx, ignitionPath); err != nil {
 		return err
 	}
 
-	if err = i.ops.SetBootOrder(i.Device); err != nil {
-		i.log.WithError(err).Warnf("Failed to set boot order")
-		// Ignore the error for now so it doesn't fail the installation in case it fails
-		//return err
+	if err = i.setBootOrder(); err != nil {
+		return err
 	}
 
 	if isBootstrap {
 		i.UpdateHostInstallProgress(models.HostStageWaitingForControlPlane, waitingForBootstrapToPrepare)
-		if err = bootstrapErrGroup.Wait(); err != nil {
+		if err = waitForErrGroup(ctx, bootstrapErrGroup); err != nil {
 			i.log.Errorf("Bootstrap failed %s", err)
-			return err
+			return &installPhaseError{phase: ErrBootstrapFailed, cause: err}
 		}
 		if err = i.waitForControlPlane(ctx); err != nil {
-			return err
+			i.log.Errorf("Waiting for control plane failed %s", err)
+			return &installPhaseError{phase: ErrControlPlaneTimeout, cause: err}
 		}
 		i.log.Info("Setting bootstrap node new role to master")
 
@@ -164,16 +423,168 @@ func (i *installer) InstallNode() error {
 			return err
 		}
 	}
+	// never reboot the node if the installation was cancelled
+	if err = ctx.Err(); err != nil {
+		return err
+	}
 	//upload host logs and report log status before reboot
 	i.log.Infof("Uploading logs and reporting status before rebooting the node %s for cluster %s", i.Config.HostID, i.Config.ClusterID)
 	i.inventoryClient.HostLogProgressReport(ctx, i.Config.InfraEnvID, i.Config.HostID, models.LogsStateRequested)
-	_, err = i.ops.UploadInstallationLogs(isBootstrap || i.HighAvailabilityMode == models.ClusterHighAvailabilityModeNone)
+	isSNO := i.HighAvailabilityMode == models.ClusterHighAvailabilityModeNone
+	err = i.uploadInstallationLogsWithRetry(isBootstrap || isSNO)
 	if err != nil {
 		i.log.Errorf("upload installation logs %s", err)
+		i.addWarning(fmt.Sprintf("failed to upload installation logs: %s", err))
+	} else if isBootstrap || isSNO {
+		i.confirmLogsUpload(ctx)
 	}
 	return i.finalize()
 }
 
+// confirmLogsUpload waits, up to the configured timeout, for the service to report the logs of the host
+// as collected. The bootstrap and the single node don't come back soon after the reboot, so logs that
+// didn't reach the service are lost. The node is rebooted anyway when the confirmation times out.
+func (i *installer) confirmLogsUpload(ctx context.Context) {
+	if i.ConfirmLogsUploadTimeout <= 0 || (i.LogsSink != "" && i.LogsSink != config.LogsSinkService) {
+		return
+	}
+	i.log.Infof("Waiting up to %s for the service to confirm it received the logs", i.ConfirmLogsUploadTimeout)
+	err := utils.WaitForPredicateWithContext(ctx, i.ConfirmLogsUploadTimeout, confirmLogsUploadInterval, func() bool {
+		host, err := i.inventoryClient.GetHost(ctx, i.Config.InfraEnvID, i.Config.HostID)
+		if err != nil {
+			i.log.WithError(err).Warn("Failed to get the host logs state from the service")
+			return false
+		}
+		return host.LogsInfo == models.LogsStateCompleted
+	})
+	if err != nil {
+		i.log.WithError(err).Warn("The service didn't confirm it received the logs, rebooting anyway")
+		i.addWarning(fmt.Sprintf("the service didn't confirm it received the installation logs within %s", i.ConfirmLogsUploadTimeout))
+		return
+	}
+	i.log.Info("The service confirmed it received the logs")
+}
+
+// setBootOrder ignores the boot order errors by default so they don't fail the installation, unless
+// configured otherwise
+func (i *installer) setBootOrder() error {
+	err := i.ops.SetBootOrder(i.Device)
+	if err != nil {
+		err = errors.Wrap(err, "failed to set boot order")
+	} else {
+		err = i.verifyEfiBootEntry()
+	}
+	if err == nil {
+		return nil
+	}
+	if i.FailOnBootOrderError {
+		i.log.WithError(err).Error("Boot order error")
+		return err
+	}
+	i.log.WithError(err).Warn("Ignoring boot order error")
+	i.addWarning(err.Error())
+	return nil
+}
+
+// verifyEfiBootEntry makes sure the boot entry created by SetBootOrder exists and boots from the
+// installation disk, as some firmwares silently drop efibootmgr changes
+func (i *installer) verifyEfiBootEntry() error {
+	entries, err := i.ops.GetEfiBootEntries()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	out, err := i.ops.ExecPrivilegeCommand(nil, "lsblk", "--noheadings", "--output", "PARTUUID", i.Device)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get the partitions of %s", i.Device)
+	}
+	partUUIDs := make(map[string]bool)
+	for _, partUUID := range strings.Fields(out) {
+		partUUIDs[strings.ToLower(partUUID)] = true
+	}
+	for _, entry := range entries {
+		if entry.Label == ops.EfiBootLabel && partUUIDs[entry.PartUUID] {
+			i.log.Infof("EFI boot entry Boot%s %q boots from %s", entry.Number, entry.Label, i.Device)
+			return nil
+		}
+	}
+	return errors.Errorf("EFI boot entry %q booting from %s is missing", ops.EfiBootLabel, i.Device)
+}
+
+// waitForErrGroup waits for the group to finish, but returns right away once ctx is cancelled
+func waitForErrGroup(ctx context.Context, group *errgroup.Group) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- group.Wait()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// uploadInstallationLogsWithRetry retries the upload with an increasing interval, these logs
+// are the last chance to get information from the node before it reboots
+func (i *installer) uploadInstallationLogsWithRetry(isBootstrap bool) error {
+	return utils.RetryAllWithBackoff(uploadLogsMaxAttempts, uploadLogsRetryInterval, uploadLogsRetryMaxInterval, i.log, func() error {
+		return i.uploadInstallationLogs(isBootstrap)
+	})
+}
+
+func (i *installer) uploadInstallationLogs(isBootstrap bool) error {
+	if i.LogsSink == config.LogsSinkLocalDir {
+		return i.writeInstallationLogsToDir(isBootstrap)
+	}
+	if i.preflightReport != nil {
+		// the logs sender collects the installer journal
+		i.log.Infof("Preflight report:\n%s", i.preflightReport)
+	}
+	// the service and custom-url sinks are both handled by the logs sender
+	_, err := i.ops.UploadInstallationLogs(isBootstrap)
+	return err
+}
+
+type journalLog struct {
+	fileName string
+	args     []string
+}
+
+// writeInstallationLogsToDir dumps the node journal into the configured logs sink directory
+// for environments where the logs can't be sent anywhere
+func (i *installer) writeInstallationLogsToDir(isBootstrap bool) error {
+	journals := []journalLog{{fileName: "journal.log", args: []string{"--no-pager", "-b"}}}
+	if isBootstrap {
+		journals = append(journals, journalLog{fileName: "bootkube.log", args: []string{"--no-pager", "-b", "-u", "bootkube.service"}})
+	}
+
+	if err := os.MkdirAll(i.LogsSinkDir, 0755); err != nil {
+		return errors.Wrapf(err, "failed to create logs directory %s", i.LogsSinkDir)
+	}
+	for _, journal := range journals {
+		out, err := i.ops.ExecPrivilegeCommand(nil, "journalctl", journal.args...)
+		if err != nil {
+			return errors.Wrapf(err, "failed to collect %s", journal.fileName)
+		}
+		path := filepath.Join(i.LogsSinkDir, fmt.Sprintf("%s_%s", i.HostID, journal.fileName))
+		if err = ioutil.WriteFile(path, []byte(out), 0644); err != nil {
+			return errors.Wrapf(err, "failed to write logs to %s", path)
+		}
+		i.log.Infof("Wrote installation logs to %s", path)
+	}
+	if i.preflightReport != nil {
+		path := filepath.Join(i.LogsSinkDir, fmt.Sprintf("%s_%s", i.HostID, preflightReportFileName))
+		if err := ioutil.WriteFile(path, i.preflightReport, 0644); err != nil {
+			return errors.Wrapf(err, "failed to write the preflight report to %s", path)
+		}
+		i.log.Infof("Wrote the preflight report to %s", path)
+	}
+	return nil
+}
+
 func (i *installer) finalize() error {
 	//update installation progress
 	i.UpdateHostInstallProgress(models.HostStageRebooting, "")
@@ -206,12 +617,12 @@ func (i *installer) finalize() error {
 }
 
 //updateSingleNodeIgnition will download the host ignition config and add the files under storage
-func (i *installer) updateSingleNodeIgnition(singleNodeIgnitionPath string) error {
+func (i *installer) updateSingleNodeIgnition(ctx context.Context, singleNodeIgnitionPath string) error {
 	if i.DryRunEnabled {
 		return nil
 	}
 
-	hostIgnitionPath, err := i.downloadHostIgnition()
+	hostIgnitionPath, err := i.downloadHostIgnition(ctx)
 	if err != nil {
 		return err
 	}
@@ -238,11 +649,19 @@ func (i *installer) updateSingleNodeIgnition(singleNodeIgnitionPath string) erro
 	return nil
 }
 
-func (i *installer) writeImageToDisk(ignitionPath string) error {
+func (i *installer) writeImageToDisk(ctx context.Context, ignitionPath string) error {
 	i.UpdateHostInstallProgress(models.HostStageWritingImageToDisk, "")
 	interval := time.Second
 	err := utils.Retry(3, interval, i.log, func() error {
-		return i.ops.WriteImageToDisk(ignitionPath, i.Device, i.inventoryClient, i.Config.InstallerArgs)
+		if ctx.Err() != nil {
+			return utils.StopRetry(ctx.Err())
+		}
+		err := i.ops.WriteImageToDisk(ctx, ignitionPath, i.Device, i.inventoryClient, i.Config.InstallerArgs)
+		if err != nil && diskIOErrorRegex.MatchString(err.Error()) {
+			// bad sectors fail every attempt the same way
+			return utils.StopRetry(errors.Wrapf(err, "disk %s appears faulty, it failed with an I/O error", i.Device))
+		}
+		return err
 	})
 	if err != nil {
 		i.log.Errorf("Failed to write image to disk %s", err)
@@ -252,44 +671,47 @@ func (i *installer) writeImageToDisk(ignitionPath string) error {
 	return nil
 }
 
-func (i *installer) startBootstrap() error {
+func (i *installer) startBootstrap(ctx context.Context) error {
 	i.log.Infof("Running bootstrap")
 	// This is required for the log collection command to work since it will try to mount this directory
 	// This directory is also required by `generateSshKeyPair` as it will place the key there
-	if err := i.ops.Mkdir(sshDir); err != nil {
+	if err := i.ops.Mkdir(i.SshDir); err != nil {
 		i.log.WithError(err).Error("Failed to create SSH dir")
 		return err
 	}
 	ignitionFileName := "bootstrap.ign"
-	ignitionPath, err := i.getFileFromService(ignitionFileName)
+	ignitionPath, err := i.getFileFromService(ctx, ignitionFileName)
 	if err != nil {
 		return err
 	}
 
 	// We need to extract pull secret from ignition and save it in docker config
 	// to be able to pull MCO official image
-	if err = i.ops.ExtractFromIgnition(ignitionPath, dockerConfigFile); err != nil {
+	if err = i.ops.ExtractFromIgnition(ignitionPath, config.DefaultDockerConfigPath, i.dockerConfigPath()); err != nil {
+		return err
+	}
+	if err = i.verifyPullSecret(); err != nil {
+		i.log.WithError(err).Error("Invalid pull secret in the bootstrap ignition")
 		return err
 	}
 
-	err = i.extractIgnitionToFS(ignitionPath)
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	err = i.extractIgnitionToFS(ctx, ignitionPath)
 	if err != nil {
 		return err
 	}
 
 	if i.HighAvailabilityMode != models.ClusterHighAvailabilityModeNone {
-		err = i.generateSshKeyPair()
-		if err != nil {
-			return err
-		}
-		err = i.ops.CreateOpenshiftSshManifest(assistedInstallerSshManifest, sshManifestTmpl, sshPubKeyPath)
+		err = i.setupBootstrapSsh()
 		if err != nil {
 			return err
 		}
 	}
 
 	// reload systemd configurations from filesystem and regenerate dependency trees
-	err = i.ops.SystemctlAction("daemon-reload")
+	err = i.systemctlWithRetry("daemon-reload")
 	if err != nil {
 		return err
 	}
@@ -306,83 +728,444 @@ func (i *installer) startBootstrap() error {
 	}
 
 	// restart NetworkManager to trigger NetworkManager/dispatcher.d/30-local-dns-prepender
-	err = i.ops.SystemctlAction("restart", "NetworkManager.service")
+	resolvConf := i.snapshotResolvConf()
+	err = i.systemctlWithRetry("restart", "NetworkManager.service")
 	if err != nil {
 		i.log.Error(err)
 		return err
 	}
+	i.ensureResolvConf(resolvConf)
 
+	if err = ctx.Err(); err != nil {
+		return err
+	}
 	if err = i.ops.PrepareController(); err != nil {
 		i.log.Error(err)
 		return err
 	}
 
-	servicesToStart := []string{"bootkube.service", "approve-csr.service", "progress.service"}
-	for _, service := range servicesToStart {
-		err = i.ops.SystemctlAction("start", service)
+	if err = i.startBootstrapServices(); err != nil {
+		return err
+	}
+	i.log.Info("Done setting up bootstrap")
+	return nil
+}
+
+// systemctlWithRetry retries systemctl actions with an increasing interval, they may fail on transient
+// dbus errors right after boot. The error of the last attempt is returned as is
+func (i *installer) systemctlWithRetry(action string, args ...string) error {
+	return utils.RetryAllWithBackoff(systemctlMaxAttempts, systemctlRetryInterval, systemctlRetryMaxInterval, i.log, func() error {
+		return i.ops.SystemctlAction(action, args...)
+	})
+}
+
+// snapshotResolvConf returns the current resolv.conf content, or an empty string if it can't be read
+func (i *installer) snapshotResolvConf() string {
+	if i.DryRunEnabled {
+		return ""
+	}
+	content, err := i.ops.ReadHostFile(resolvConfPath)
+	if err != nil {
+		i.log.WithError(err).Warnf("Failed to read %s before restarting NetworkManager", resolvConfPath)
+		return ""
+	}
+	return content
+}
+
+// ensureResolvConf waits for resolv.conf to have nameservers after NetworkManager was restarted.
+// If they don't show up, the snapshot taken before the restart is written back
+func (i *installer) ensureResolvConf(snapshot string) {
+	if !hasNameserver(snapshot) {
+		return
+	}
+	err := utils.WaitForPredicateImmediate(resolvConfSettleTimeout, generalWaitInterval, func() bool {
+		content, err := i.ops.ReadHostFile(resolvConfPath)
 		if err != nil {
+			i.log.WithError(err).Warnf("Failed to read %s", resolvConfPath)
+			return false
+		}
+		return hasNameserver(content)
+	})
+	if err == nil {
+		return
+	}
+	i.log.Warnf("%s has no nameservers after restarting NetworkManager, restoring its previous content", resolvConfPath)
+	if err = i.ops.WriteHostFile(resolvConfPath, snapshot); err != nil {
+		i.log.WithError(err).Errorf("Failed to restore %s", resolvConfPath)
+	}
+}
+
+func hasNameserver(resolvConf string) bool {
+	for _, line := range strings.Split(resolvConf, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 1 && fields[0] == "nameserver" {
+			return true
+		}
+	}
+	return false
+}
+
+// startBootstrapServices starts the configured bootstrap units in order, or the default ones
+func (i *installer) startBootstrapServices() error {
+	servicesToStart := []string(i.BootstrapServices)
+	if len(servicesToStart) == 0 {
+		servicesToStart = config.DefaultBootstrapServices
+	}
+	for _, service := range servicesToStart {
+		if err := i.ops.SystemctlAction("start", service); err != nil {
+			return err
+		}
+	}
+	// a unit may start successfully and fail right after, catch it here instead of waiting for bootkube
+	for _, service := range servicesToStart {
+		if err := i.waitForServiceActive(service); err != nil {
 			return err
 		}
 	}
-	i.log.Info("Done setting up bootstrap")
 	return nil
 }
 
-func (i *installer) extractIgnitionToFS(ignitionPath string) (err error) {
+func (i *installer) waitForServiceActive(service string) error {
+	if i.DryRunEnabled {
+		return nil
+	}
+	var state string
+	completed := false
+	err := utils.WaitForPredicateImmediate(serviceActiveTimeout, generalWaitInterval, func() bool {
+		out, _ := i.ops.ExecPrivilegeCommand(nil, "systemctl", "is-active", service)
+		state = strings.TrimSpace(out)
+		if state == "inactive" {
+			completed = i.serviceCompleted(service)
+			return completed
+		}
+		return state == "active" || state == "failed"
+	})
+	if state == "active" || completed {
+		return nil
+	}
+	if err != nil {
+		return errors.Errorf("service %s did not become active within %s, current state: %s", service, serviceActiveTimeout, state)
+	}
+	return errors.Errorf("service %s failed after being started, check its journal with journalctl -u %s", service, service)
+}
+
+// serviceCompleted tells whether an inactive unit is a oneshot one that already ran to completion
+func (i *installer) serviceCompleted(service string) bool {
+	out, err := i.ops.ExecPrivilegeCommand(nil, "systemctl", "show", service,
+		"--property=Result", "--property=ExecMainStatus", "--property=ExecMainStartTimestampMonotonic")
+	if err != nil {
+		i.log.WithError(err).Warnf("Failed to get the result of service %s", service)
+		return false
+	}
+	properties := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		if parts := strings.SplitN(strings.TrimSpace(line), "=", 2); len(parts) == 2 {
+			properties[parts[0]] = parts[1]
+		}
+	}
+	// a unit that never ran has no start timestamp
+	return properties["Result"] == "success" && properties["ExecMainStatus"] == "0" &&
+		properties["ExecMainStartTimestampMonotonic"] != "" && properties["ExecMainStartTimestampMonotonic"] != "0"
+}
+
+// verifyPullSecret makes sure the extracted docker config can be used to pull images, a broken pull
+// secret otherwise only shows up as image pull failures later on
+func (i *installer) verifyPullSecret() error {
+	if i.DryRunEnabled {
+		return nil
+	}
+	content, err := i.ops.ReadHostFile(i.dockerConfigPath())
+	if err != nil {
+		return errors.Wrapf(err, "failed to read the pull secret from %s", i.dockerConfigPath())
+	}
+	unusable, err := validatePullSecret(content)
+	if err != nil {
+		return errors.Wrapf(err, "pull secret extracted to %s", i.dockerConfigPath())
+	}
+	for _, registry := range unusable {
+		i.log.Warnf("Pull secret extracted to %s has no usable credentials for registry %s", i.dockerConfigPath(), registry)
+	}
+	return nil
+}
+
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth          string `json:"auth"`
+		IdentityToken string `json:"identitytoken"`
+		Username      string `json:"username"`
+		Password      string `json:"password"`
+	} `json:"auths"`
+}
+
+// validatePullSecret checks the docker config has at least one registry with usable credentials, an
+// auth, an identity token or a username and password, and returns the registries without. The errors
+// never include the content as it's a secret.
+func validatePullSecret(content string) ([]string, error) {
+	var cfg dockerConfig
+	if err := json.Unmarshal([]byte(content), &cfg); err != nil {
+		return nil, errors.New("is not valid JSON")
+	}
+	if len(cfg.Auths) == 0 {
+		return nil, errors.New("has no registry auths")
+	}
+	var unusable []string
+	for registry, auth := range cfg.Auths {
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		switch {
+		case auth.Auth != "" && err == nil && strings.Contains(string(decoded), ":"):
+		case auth.IdentityToken != "":
+		case auth.Username != "" && auth.Password != "":
+		default:
+			unusable = append(unusable, registry)
+		}
+	}
+	if len(unusable) == len(cfg.Auths) {
+		return nil, errors.New("has no usable registry auth")
+	}
+	sort.Strings(unusable)
+	return unusable, nil
+}
+
+// logImageRegistry logs where podman is going to pull image from, so failing pulls in disconnected
+// environments can be told apart from missing mirrors. Podman resolves the mirrors from the host
+// registries config by itself, this is only informational.
+func (i *installer) logImageRegistry(image string) {
+	registriesConf, err := i.ops.ReadHostFile(utils.RegistriesConfPath)
+	if err != nil {
+		i.log.WithError(err).Warnf("Failed to read %s, can't tell which registry %s is pulled from", utils.RegistriesConfPath, image)
+		return
+	}
+	if mirrors := utils.GetRegistryMirrors(registriesConf, image); len(mirrors) > 0 {
+		i.log.Infof("Pulling %s through the mirrors %s", image, strings.Join(mirrors, ", "))
+		return
+	}
+	i.log.Infof("Pulling %s from its registry, no mirror is configured for it", image)
+}
+
+// dockerConfigPath is where the pull secret extracted from the bootstrap ignition is kept
+func (i *installer) dockerConfigPath() string {
+	if i.DockerConfigPath != "" {
+		return i.DockerConfigPath
+	}
+	return config.DefaultDockerConfigPath
+}
+
+func (i *installer) extractIgnitionToFS(ctx context.Context, ignitionPath string) (err error) {
 	if i.DryRunEnabled {
 		return nil
 	}
 
 	mcoImage := i.MCOImage
 
+	// a private registry of a disconnected install may be signed by a CA the host doesn't trust yet
+	if err = i.trustAdditionalCA(ignitionPath); err != nil {
+		return err
+	}
+
 	i.log.Infof("Extracting ignition to disk using %s mcoImage", mcoImage)
+	i.logImageRegistry(mcoImage)
 	for j := 0; j < extractRetryCount; j++ {
-		_, err = i.ops.ExecPrivilegeCommand(utils.NewLogWriter(i.log), "podman", "run", "--net", "host",
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		_, err = i.ops.ExecPrivilegeCommandContext(ctx, utils.NewLogWriter(i.log), "podman", "run", "--net", "host",
 			"--pid=host",
 			"--volume", "/:/rootfs:rw",
 			"--volume", "/usr/bin/rpm-ostree:/usr/bin/rpm-ostree",
 			"--privileged",
+			"--authfile", i.dockerConfigPath(),
 			"--entrypoint", "/usr/bin/machine-config-daemon",
 			mcoImage,
 			"start", "--node-name", "localhost", "--root-mount", "/rootfs", "--once-from", ignitionPath, "--skip-reboot")
-		if err != nil {
-			i.log.WithError(err).Error("Failed to extract ignition to disk")
-		} else {
+		if err == nil {
 			i.log.Info("Done extracting ignition to filesystem")
 			return nil
 		}
+		// retrying won't help, the host won't have more memory
+		if isOutOfMemoryError(err) {
+			err = errors.Errorf("ran out of memory extracting ignition, host memory: %s: %s", i.hostMemory(), err)
+			i.log.Error(err)
+			return err
+		}
+		i.log.WithError(err).Error("Failed to extract ignition to disk")
 	}
 	i.log.Errorf("Failed to extract ignition to disk, giving up")
 	return err
 }
 
+// additionalTrustBundle returns the configured CA bundle, or the one of the ignition when none is configured.
+// The ignition bundle is best effort, the pull fails anyway if the CA was needed.
+func (i *installer) additionalTrustBundle(ignitionPath string) (string, error) {
+	if i.AdditionalTrustBundlePath != "" {
+		bundle, err := ioutil.ReadFile(i.AdditionalTrustBundlePath)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to read additional trust bundle %s", i.AdditionalTrustBundlePath)
+		}
+		if block, _ := pem.Decode(bundle); block == nil || block.Type != "CERTIFICATE" {
+			return "", errors.Errorf("additional trust bundle %s has no PEM certificate", i.AdditionalTrustBundlePath)
+		}
+		return string(bundle), nil
+	}
+	ignitionData, err := ioutil.ReadFile(ignitionPath)
+	if err != nil {
+		i.log.WithError(err).Warnf("Failed to read %s, can't tell if it has an additional trust bundle", ignitionPath)
+		return "", nil
+	}
+	bundle, err := utils.GetFileContentFromIgnition(ignitionData, ignitionTrustBundlePath)
+	if err != nil {
+		i.log.Debugf("No additional trust bundle in %s: %s", ignitionPath, err)
+		return "", nil
+	}
+	return string(bundle), nil
+}
+
+// trustAdditionalCA adds the additional CA bundle to the host trust store so podman trusts it when pulling
+func (i *installer) trustAdditionalCA(ignitionPath string) error {
+	bundle, err := i.additionalTrustBundle(ignitionPath)
+	if err != nil || strings.TrimSpace(bundle) == "" {
+		return err
+	}
+	i.log.Infof("Adding the additional trust bundle to the host trust store as %s", hostTrustBundlePath)
+	if err = i.ops.WriteHostFile(hostTrustBundlePath, bundle); err != nil {
+		return err
+	}
+	if _, err = i.ops.ExecPrivilegeCommand(utils.NewLogWriter(i.log), "update-ca-trust", "extract"); err != nil {
+		return errors.Wrap(err, "failed to update the host trust store")
+	}
+	return nil
+}
+
+// isOutOfMemoryError returns true if the command was OOM killed
+func isOutOfMemoryError(err error) bool {
+	var execErr *ops.ExecCommandError
+	if !errors.As(err, &execErr) {
+		return false
+	}
+	return execErr.WaitStatus == oomKilledExitCode || outOfMemoryRegex.MatchString(execErr.Output)
+}
+
+// hostMemory describes the total and available memory of the host from /proc/meminfo
+func (i *installer) hostMemory() string {
+	memInfo, err := i.ops.ReadHostFile(memInfoPath)
+	if err != nil {
+		i.log.WithError(err).Warnf("Failed to read %s", memInfoPath)
+		return "unknown"
+	}
+	fields := make([]string, 0, 2)
+	for _, line := range strings.Split(memInfo, "\n") {
+		parts := strings.Fields(line)
+		if len(parts) < 2 || (parts[0] != "MemTotal:" && parts[0] != "MemAvailable:") {
+			continue
+		}
+		kib, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		fields = append(fields, fmt.Sprintf("%s %.1f GiB", strings.TrimSuffix(parts[0], ":"), float64(kib)/(1024*1024)))
+	}
+	if len(fields) == 0 {
+		return "unknown"
+	}
+	return strings.Join(fields, ", ")
+}
+
+// sshKeyPairExists returns true if the private key can be read and the public key next to it matches it
+func (i *installer) sshKeyPairExists() bool {
+	derived, err := i.ops.ExecPrivilegeCommand(nil, "ssh-keygen", "-y", "-f", i.SshKeyPath)
+	if err != nil {
+		i.log.Debugf("No usable SSH private key at %s: %s", i.SshKeyPath, err)
+		return false
+	}
+	pubKey, err := i.ops.ReadHostFile(i.SshPubKeyPath())
+	if err != nil {
+		i.log.Debugf("No SSH public key at %s: %s", i.SshPubKeyPath(), err)
+		return false
+	}
+	// the public key file may have a comment the derived key doesn't have
+	derivedFields, pubKeyFields := strings.Fields(derived), strings.Fields(pubKey)
+	if len(derivedFields) < 2 || len(pubKeyFields) < 2 ||
+		derivedFields[0] != pubKeyFields[0] || derivedFields[1] != pubKeyFields[1] {
+		i.log.Warnf("SSH public key %s doesn't match %s", i.SshPubKeyPath(), i.SshKeyPath)
+		return false
+	}
+	return true
+}
+
+// setupBootstrapSsh generates the bootstrap SSH key pair and the manifest that authorizes it on the masters
+func (i *installer) setupBootstrapSsh() error {
+	if err := i.generateSshKeyPair(); err != nil {
+		return err
+	}
+	return i.ops.CreateOpenshiftSshManifest(i.SshManifestPath, sshManifestTmpl, i.SshPubKeyPath())
+}
+
 func (i *installer) generateSshKeyPair() error {
 	if i.DryRunEnabled {
 		return nil
 	}
 
+	if !i.ForceSshKeyGeneration && i.sshKeyPairExists() {
+		i.log.Infof("Using existing SSH key pair %s", i.SshKeyPath)
+		return nil
+	}
+
 	i.log.Info("Generating new SSH key pair")
-	if _, err := i.ops.ExecPrivilegeCommand(utils.NewLogWriter(i.log), "ssh-keygen", "-q", "-f", sshKeyPath, "-N", ""); err != nil {
+	// ssh-keygen asks before overwriting, remove whatever is left from a previous run first
+	if _, err := i.ops.ExecPrivilegeCommand(nil, "rm", "-f", i.SshKeyPath, i.SshPubKeyPath()); err != nil {
+		i.log.WithError(err).Error("Failed to remove the existing SSH key pair")
+		return err
+	}
+	if _, err := i.ops.ExecPrivilegeCommand(utils.NewLogWriter(i.log), "ssh-keygen", "-q", "-f", i.SshKeyPath, "-N", ""); err != nil {
 		i.log.WithError(err).Error("Failed to generate SSH key pair")
 		return err
 	}
 	return nil
 }
 
-func (i *installer) getFileFromService(filename string) (string, error) {
-	ctx := utils.GenerateRequestContext()
-	log := utils.RequestIDLogger(ctx, i.log)
-	log.Infof("Getting %s file", filename)
+// getFileFromService cancels downloads that take longer than FileDownloadTimeout and retries them,
+// the other errors are already retried by the inventory client
+func (i *installer) getFileFromService(ctx context.Context, filename string) (string, error) {
 	dest := filepath.Join(InstallDir, filename)
-	err := i.inventoryClient.DownloadFile(ctx, filename, dest)
-	if err != nil {
+	var err error
+	if utils.Retry(downloadTimeoutAttempts, 0, i.log, func() error {
+		requestCtx := utils.GenerateChildRequestContext(ctx)
+		log := utils.RequestIDLogger(requestCtx, i.log)
+		log.Infof("Getting %s file", filename)
+		cancel := func() {}
+		if i.FileDownloadTimeout > 0 {
+			requestCtx, cancel = context.WithTimeout(requestCtx, i.FileDownloadTimeout)
+		}
+		err = i.inventoryClient.DownloadFile(requestCtx, filename, dest)
+		// only the download timeout is retried, not the cancellation of the installation
+		timedOut := requestCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+		cancel()
+		if err == nil {
+			return nil
+		}
 		log.Errorf("Failed to fetch file (%s) from server. err: %s", filename, err)
+		if isNonRetryableDownloadError(err) {
+			log.Errorf("Download of %s won't succeed when retried", filename)
+			return utils.StopRetry(err)
+		}
+		if !timedOut {
+			return utils.StopRetry(err)
+		}
+		log.Warnf("Download of %s didn't complete within %s", filename, i.FileDownloadTimeout)
+		return err
+	}) != nil {
+		return dest, err
 	}
-	return dest, err
+	return dest, nil
 }
 
-func (i *installer) downloadHostIgnition() (string, error) {
-	ctx := utils.GenerateRequestContext()
+// isNonRetryableDownloadError returns true if the download failed in a way retrying can't fix, e.g. a 404
+func isNonRetryableDownloadError(err error) bool {
+	var downloadErr *inventory_client.DownloadError
+	return errors.As(err, &downloadErr) && !downloadErr.Retryable()
+}
+
+func (i *installer) downloadHostIgnition(ctx context.Context) (string, error) {
+	ctx = utils.GenerateChildRequestContext(ctx)
 	log := utils.RequestIDLogger(ctx, i.log)
 	filename := fmt.Sprintf("%s-%s.ign", i.Config.Role, i.Config.HostID)
 	log.Infof("Getting %s file", filename)
@@ -406,7 +1189,7 @@ func (i *installer) waitForNetworkType(kc k8s_client.K8SClient) error {
 }
 
 func (i *installer) waitForControlPlane(ctx context.Context) error {
-	err := i.ops.ReloadHostFile("/etc/resolv.conf")
+	err := i.ops.ReloadHostFile(resolvConfPath)
 	if err != nil {
 		i.log.WithError(err).Error("Failed to reload resolv.conf")
 		return err
@@ -416,11 +1199,15 @@ func (i *installer) waitForControlPlane(ctx context.Context) error {
 		i.log.Error(err)
 		return err
 	}
+	i.logInstallTopology(kc)
 	i.UpdateHostInstallProgress(models.HostStageWaitingForControlPlane, waitingForMastersStatusInfo)
 
 	if err = i.waitForMinMasterNodes(ctx, kc); err != nil {
 		return err
 	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
 
 	patch, err := utils.EtcdPatchRequired(i.Config.OpenshiftVersion)
 	if err != nil {
@@ -437,6 +1224,9 @@ func (i *installer) waitForControlPlane(ctx context.Context) error {
 	}
 
 	i.waitForBootkube(ctx)
+	if err = ctx.Err(); err != nil {
+		return err
+	}
 
 	// waiting for controller pod to be running
 	if err := i.waitForController(kc); err != nil {
@@ -457,36 +1247,85 @@ func numDone(hosts models.HostList) int {
 	return numDone
 }
 
+// workerWaitFor2ReadyMasters doesn't wait on day-2 clusters, their masters are already running
 func (i *installer) workerWaitFor2ReadyMasters(ctx context.Context) error {
+	if i.DryRunEnabled && i.DryMastersWaitOutcome != "" {
+		return i.stubbedWaitForReadyMasters()
+	}
 	var cluster *models.Cluster
+	err := utils.WaitForPredicateWithContext(ctx, waitForeverTimeout, generalWaitInterval, func() bool {
+		var callErr error
+		cluster, callErr = i.inventoryClient.GetCluster(ctx, false)
+		if callErr != nil {
+			i.log.WithError(callErr).Errorf("Getting cluster %s", i.ClusterID)
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if swag.StringValue(cluster.Kind) == models.ClusterKindAddHostsCluster {
+		i.log.Info("Adding a worker to an installed cluster, not waiting for ready masters")
+		return nil
+	}
 
 	i.log.Info("Waiting for 2 ready masters")
 	i.UpdateHostInstallProgress(models.HostStageWaitingForControlPlane, "")
-	_ = utils.WaitForPredicate(waitForeverTimeout, generalWaitInterval, func() bool {
-		if cluster == nil {
-			var callErr error
-			cluster, callErr = i.inventoryClient.GetCluster(ctx, false)
-			if callErr != nil {
-				i.log.WithError(callErr).Errorf("Getting cluster %s", i.ClusterID)
-				return false
-			}
-		}
-		if swag.StringValue(cluster.Kind) == models.ClusterKindAddHostsCluster {
-			return true
-		}
-
+	err = utils.WaitForPredicateWithContext(ctx, waitForeverTimeout, generalWaitInterval, func() bool {
 		hosts, callErr := i.inventoryClient.ListsHostsForRole(ctx, string(models.HostRoleMaster))
 		if callErr != nil {
 			i.log.WithError(callErr).Errorf("Getting cluster %s hosts", i.ClusterID)
 			return false
 		}
-		return numDone(hosts) >= minMasterNodes
+		return numDone(hosts) >= i.minReadyMasterNodes()
 
 	})
 
+	return err
+}
+
+// stubbedWaitForReadyMasters replaces the wait for the ready masters with the configured outcome, for testing
+// the worker flow without a control plane in dry run
+func (i *installer) stubbedWaitForReadyMasters() error {
+	i.log.Warnf("Not waiting for ready masters, the wait is stubbed to end as %s", i.DryMastersWaitOutcome)
+	i.UpdateHostInstallProgress(models.HostStageWaitingForControlPlane, "")
+	if i.DryMastersWaitOutcome == config.DryMastersWaitFailed {
+		return errors.New("stubbed wait for ready masters failed")
+	}
 	return nil
 }
 
+// logInstallTopology logs the topology the installer believes the cluster has and warns if the control
+// plane replicas don't match the high availability mode. Values that can't be read yet are logged as unknown.
+func (i *installer) logInstallTopology(kc k8s_client.K8SClient) {
+	networkType := "unknown"
+	if nt, err := kc.GetNetworkType(); err != nil {
+		i.log.WithError(err).Debug("Failed to get network type for the install topology summary")
+	} else {
+		networkType = nt
+	}
+	replicas := "unknown"
+	controlPlaneReplicas, err := kc.GetControlPlaneReplicas()
+	if err != nil {
+		i.log.WithError(err).Debug("Failed to get control plane replicas for the install topology summary")
+	} else {
+		replicas = strconv.Itoa(controlPlaneReplicas)
+	}
+	i.log.Infof("Install topology: high availability mode %q, role %s, network type %s, control plane replicas %s",
+		i.HighAvailabilityMode, i.Config.Role, networkType, replicas)
+
+	if err != nil {
+		return
+	}
+	switch {
+	case i.HighAvailabilityMode == models.ClusterHighAvailabilityModeNone && controlPlaneReplicas != 1:
+		i.log.Warnf("Control plane replicas %d don't match high availability mode %s, expected 1", controlPlaneReplicas, i.HighAvailabilityMode)
+	case i.HighAvailabilityMode == models.ClusterHighAvailabilityModeFull && controlPlaneReplicas != i.expectedMasterNodes():
+		i.log.Warnf("Control plane replicas %d don't match high availability mode %s, expected %d", controlPlaneReplicas, i.HighAvailabilityMode, i.expectedMasterNodes())
+	}
+}
+
 func (i *installer) shouldControlPlaneReplicasPatchApplied(kc k8s_client.K8SClient) (bool, error) {
 	controlPlanePatchRequired, err := utils.IsVersionLessThan47(i.Config.OpenshiftVersion)
 	if err != nil {
@@ -513,8 +1352,8 @@ func (i *installer) shouldControlPlaneReplicasPatchApplied(kc k8s_client.K8SClie
 	// OVNKubernetes waits the number that is defined in controlPlane.Replicas to be
 	// available before starting OVN.  Since assisted installer has a bootstrap node
 	// that later becomes a master, there is a need to patch the install-config to
-	// set the controlPlane.replicas to 2 until all masters which are not the
-	// bootstrap are ready.
+	// set the controlPlane.replicas to the minimum number of ready masters until
+	// the masters which are not the bootstrap are ready.
 	// On single node this is not the case since bootstrap in place is used.
 	// Therefore, the patch is not relevant to single node.
 	origControlPlaneReplicas, err := kc.GetControlPlaneReplicas()
@@ -522,28 +1361,44 @@ func (i *installer) shouldControlPlaneReplicasPatchApplied(kc k8s_client.K8SClie
 		i.log.WithError(err).Error("Failed to get control plane replicas")
 		return false, err
 	}
-	if origControlPlaneReplicas != numMasterNodes {
-		i.log.Infof("Control plane replicas patch not required due to control plane replicas %d not equal to %d", origControlPlaneReplicas, numMasterNodes)
+	if origControlPlaneReplicas != i.expectedMasterNodes() {
+		i.log.Infof("Control plane replicas patch not required due to control plane replicas %d not equal to %d", origControlPlaneReplicas, i.expectedMasterNodes())
 		return false, nil
 	}
 	i.log.Info("Applying control plane replicas patch")
 	return true, nil
 }
 
+// expectedMasterNodes is the number of masters of a highly available cluster, numMasterNodes unless configured
+func (i *installer) expectedMasterNodes() int {
+	if i.MasterCount > 0 {
+		return i.MasterCount
+	}
+	return numMasterNodes
+}
+
+// minReadyMasterNodes is the number of ready masters to wait for, minMasterNodes unless configured
+func (i *installer) minReadyMasterNodes() int {
+	if i.MinReadyMasters > 0 {
+		return i.MinReadyMasters
+	}
+	return minMasterNodes
+}
+
 func (i *installer) waitForMinMasterNodes(ctx context.Context, kc k8s_client.K8SClient) error {
 	shouldPatchControlPlaneReplicas, err := i.shouldControlPlaneReplicasPatchApplied(kc)
 	if err != nil {
 		return err
 	}
 	if shouldPatchControlPlaneReplicas {
-		if err = kc.PatchControlPlaneReplicas(); err != nil {
+		if err = kc.PatchControlPlaneReplicas(i.minReadyMasterNodes()); err != nil {
 			i.log.WithError(err).Error("Failed to patch control plane replicas")
 			return err
 		}
 	}
-	i.waitForMasterNodes(ctx, minMasterNodes, kc)
+	i.waitForMasterNodes(ctx, i.minReadyMasterNodes(), kc)
 	if shouldPatchControlPlaneReplicas {
-		if err = kc.UnPatchControlPlaneReplicas(); err != nil {
+		if err = kc.UnPatchControlPlaneReplicas(i.expectedMasterNodes()); err != nil {
 			i.log.WithError(err).Error("Failed to unPatch control plane replicas")
 			return err
 		}
@@ -551,14 +1406,106 @@ func (i *installer) waitForMinMasterNodes(ctx context.Context, kc k8s_client.K8S
 	return nil
 }
 
-func (i *installer) UpdateHostInstallProgress(newStage models.HostStage, info string) {
-	ctx := utils.GenerateRequestContext()
-	log := utils.RequestIDLogger(ctx, i.log)
-	log.Infof("Updating node installation stage: %s - %s", newStage, info)
-	if i.HostID != "" {
-		if err := i.inventoryClient.UpdateHostInstallProgress(ctx, i.Config.InfraEnvID, i.Config.HostID, newStage, info); err != nil {
-			log.Errorf("Failed to update node installation stage, %s", err)
-		}
+func (i *installer) UpdateHostInstallProgress(newStage models.HostStage, info string) {
+	ctx := utils.GenerateRequestContext()
+	log := utils.RequestIDLogger(ctx, i.log)
+	log.Infof("Updating node installation stage: %s - %s", newStage, info)
+	if i.HostID != "" {
+		if err := i.inventoryClient.UpdateHostInstallProgress(ctx, i.Config.InfraEnvID, i.Config.HostID, newStage, info); err != nil {
+			log.Errorf("Failed to update node installation stage, %s", err)
+		}
+	}
+	i.writeProgressFile(log, newStage, info)
+	i.notifyStageChange(newStage, info)
+}
+
+func (i *installer) OnStageChange(callback StageChangeCallback) {
+	i.stageLock.Lock()
+	defer i.stageLock.Unlock()
+	i.onStageChange = callback
+}
+
+func (i *installer) notifyStageChange(newStage models.HostStage, info string) {
+	i.stageLock.Lock()
+	oldStage := i.currentStage
+	if oldStage != newStage {
+		now := i.clock.Now()
+		if oldStage != "" {
+			i.stageDurations[oldStage] += now.Sub(i.stageStartedAt)
+		}
+		i.stageStartedAt = now
+		if i.stageChanged != nil {
+			close(i.stageChanged)
+		}
+		i.stageChanged = make(chan struct{})
+	}
+	i.currentStage = newStage
+	callback := i.onStageChange
+	i.stageLock.Unlock()
+
+	if callback != nil && oldStage != newStage {
+		callback(oldStage, newStage, info)
+	}
+}
+
+func (i *installer) addWarning(warning string) {
+	i.stageLock.Lock()
+	defer i.stageLock.Unlock()
+	i.warnings = append(i.warnings, warning)
+}
+
+// addWarningOnce adds the warning unless it was already added, for checks that are repeated while waiting
+func (i *installer) addWarningOnce(warning string) {
+	i.stageLock.Lock()
+	defer i.stageLock.Unlock()
+	if !funk.ContainsString(i.warnings, warning) {
+		i.warnings = append(i.warnings, warning)
+	}
+}
+
+// installResult counts the current stage up to now, as the installation doesn't leave its last stage
+func (i *installer) installResult() *InstallResult {
+	i.stageLock.Lock()
+	defer i.stageLock.Unlock()
+	durations := make(map[models.HostStage]time.Duration, len(i.stageDurations)+1)
+	for stage, duration := range i.stageDurations {
+		durations[stage] = duration
+	}
+	if i.currentStage != "" {
+		durations[i.currentStage] += i.clock.Now().Sub(i.stageStartedAt)
+	}
+	return &InstallResult{
+		Role:           i.Config.Role,
+		StageDurations: durations,
+		Warnings:       append([]string{}, i.warnings...),
+	}
+}
+
+// progressFile is the content of the local progress file, it lets external
+// watchers follow the installation without talking to the service
+type progressFile struct {
+	Stage     models.HostStage `json:"stage"`
+	Info      string           `json:"info"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+func (i *installer) writeProgressFile(log logrus.FieldLogger, stage models.HostStage, info string) {
+	if i.ProgressFilePath == "" {
+		return
+	}
+	data, err := json.Marshal(progressFile{Stage: stage, Info: info, UpdatedAt: time.Now().UTC()})
+	if err != nil {
+		log.WithError(err).Warnf("Failed to marshal installation progress")
+		return
+	}
+	// write to a temporary file and rename it so readers never see a partial file
+	tmpPath := i.ProgressFilePath + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		log.WithError(err).Warnf("Failed to write installation progress to %s", tmpPath)
+		return
+	}
+	if err = os.Rename(tmpPath, i.ProgressFilePath); err != nil {
+		log.WithError(err).Warnf("Failed to write installation progress to %s", i.ProgressFilePath)
 	}
 }
 
@@ -571,7 +1518,7 @@ func (i *installer) waitForBootkube(ctx context.Context) {
 		case <-ctx.Done():
 			i.log.Info("Context cancelled, terminating wait for bootkube\n")
 			return
-		case <-time.After(generalWaitInterval):
+		case <-i.clock.After(generalWaitInterval):
 			// check if bootkube is done every 5 seconds
 			if _, err := i.ops.ExecPrivilegeCommand(nil, "stat", "/opt/openshift/.bootkube.done"); err == nil {
 				// in case bootkube is done log the status and return
@@ -614,7 +1561,7 @@ func (i *installer) uploadControllerLogs(kc k8s_client.K8SClient) {
 		//since controller may not be ready at all and we'll end up waiting for a timeout to expire
 		//in the service with no good reason before giving up on the logs
 		//when controller is ready - it will report its log progress by itself
-		err := common.UploadPodLogs(kc, i.inventoryClient, i.ClusterID, controllerPod.Name, assistedControllerNamespace, common.ControllerLogsSecondsAgo, i.log)
+		err := common.UploadPodLogs(kc, i.inventoryClient, i.ClusterID, controllerPod.Name, assistedControllerNamespace, common.ControllerLogsSecondsAgo, false, i.log)
 		// if failed to upload logs, log why and continue
 		if err != nil {
 			i.log.WithError(err).Warnf("Failed to upload controller logs")
@@ -648,6 +1595,9 @@ func (i *installer) waitForMasterNodes(ctx context.Context, minMasterNodes int,
 
 	var readyMasters []string
 	var inventoryHostsMap map[string]inventory_client.HostData
+	// the API server is often unavailable for a while during the bootstrap to control plane pivot,
+	// back off on consecutive failures instead of hammering it every interval
+	listNodesBackoff := utils.NewFailureBackoff(generalWaitInterval, listNodesBackoffMax)
 	i.log.Infof("Waiting for %d master nodes", minMasterNodes)
 	sufficientMasterNodes := func() bool {
 		var err error
@@ -655,11 +1605,15 @@ func (i *installer) waitForMasterNodes(ctx context.Context, minMasterNodes int,
 		if err != nil {
 			return false
 		}
+		if !listNodesBackoff.Ready() {
+			return false
+		}
 		nodes, err := kc.ListMasterNodes()
 		if err != nil {
-			i.log.Warnf("Still waiting for master nodes: %v", err)
+			i.log.Warnf("Still waiting for master nodes, next attempt in %s: %v", listNodesBackoff.Failure(), err)
 			return false
 		}
+		listNodesBackoff.Success()
 		if err = i.updateReadyMasters(nodes, &readyMasters, inventoryHostsMap); err != nil {
 			i.log.WithError(err).Warnf("Failed to update ready with masters")
 			return false
@@ -672,37 +1626,35 @@ func (i *installer) waitForMasterNodes(ctx context.Context, minMasterNodes int,
 		return false
 	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			i.log.Info("Context cancelled, terminating wait for master nodes\n")
-			return
-		case <-time.After(generalWaitInterval):
-			// check if we have sufficient master nodes is done every 5 seconds
-			if sufficientMasterNodes() {
-				return
-			}
-		}
+	// check if we have sufficient master nodes is done every 5 seconds
+	elapsed, err := utils.WaitForPredicateWithElapsed(ctx, waitForeverTimeout, generalWaitInterval, sufficientMasterNodes)
+	if err != nil {
+		i.log.Infof("Context cancelled after %s, terminating wait for master nodes", elapsed.Round(time.Second))
+		return
 	}
+	i.log.Infof("%d master nodes ready after %s", minMasterNodes, elapsed.Round(time.Second))
 }
 
+// getInventoryHostsMap returns hostsMap if set, otherwise the enabled hosts but the current one. The
+// returned map is a copy the caller owns, the inventory map may be shared with other goroutines.
 func (i *installer) getInventoryHostsMap(hostsMap map[string]inventory_client.HostData) (map[string]inventory_client.HostData, error) {
-	var err error
-	if hostsMap == nil {
-		ctx := utils.GenerateRequestContext()
-		log := utils.RequestIDLogger(ctx, i.log)
-		hostsMap, err = i.inventoryClient.GetEnabledHostsNamesHosts(ctx, log)
-		if err != nil {
-			log.Warnf("Failed to get hosts info from inventory, err %s", err)
-			return nil, err
-		}
+	if hostsMap != nil {
+		return hostsMap, nil
+	}
+	ctx := utils.GenerateRequestContext()
+	log := utils.RequestIDLogger(ctx, i.log)
+	inventoryHostsMap, err := i.inventoryClient.GetEnabledHostsNamesHosts(ctx, log)
+	if err != nil {
+		log.Warnf("Failed to get hosts info from inventory, err %s", err)
+		return nil, err
+	}
+	hostsMap = make(map[string]inventory_client.HostData, len(inventoryHostsMap))
+	for name, hostData := range inventoryHostsMap {
 		// no need for current host
-		for name, hostData := range hostsMap {
-			if hostData.Host.ID.String() == i.HostID {
-				delete(hostsMap, name)
-				break
-			}
+		if hostData.Host != nil && hostData.Host.ID != nil && hostData.Host.ID.String() == i.HostID {
+			continue
 		}
+		hostsMap[name] = hostData
 	}
 	return hostsMap, nil
 }
@@ -710,10 +1662,19 @@ func (i *installer) getInventoryHostsMap(hostsMap map[string]inventory_client.Ho
 func (i *installer) updateReadyMasters(nodes *v1.NodeList, readyMasters *[]string, inventoryHostsMap map[string]inventory_client.HostData) error {
 	nodeNameAndCondition := map[string][]v1.NodeCondition{}
 	knownIpAddresses := common.BuildHostsMapIPAddressBased(inventoryHostsMap)
+	for uuid, names := range common.DuplicateSystemUUIDs(nodes.Items) {
+		message := common.DuplicateSystemUUIDMessage(uuid, names)
+		i.log.Error(message)
+		i.addWarningOnce(message)
+	}
 
 	for _, node := range nodes.Items {
 		nodeNameAndCondition[node.Name] = node.Status.Conditions
-		if common.IsK8sNodeIsReady(node) && !funk.ContainsString(*readyMasters, node.Name) {
+		if !i.nodeReadiness.IsReady(node) {
+			i.log.Debugf("Master node %s isn't ready: %s", node.Name, strings.Join(common.NodeNotReadyReasons(node), ", "))
+			continue
+		}
+		if !funk.ContainsString(*readyMasters, node.Name) {
 			ctx := utils.GenerateRequestContext()
 			log := utils.RequestIDLogger(ctx, i.log)
 			log.Infof("Found a new ready master node %s with id %s", node.Name, node.Status.NodeInfo.SystemUUID)
@@ -721,7 +1682,16 @@ func (i *installer) updateReadyMasters(nodes *v1.NodeList, readyMasters *[]strin
 
 			host, ok := common.HostMatchByNameOrIPAddress(node, inventoryHostsMap, knownIpAddresses)
 			if !ok {
-				return fmt.Errorf("Node %s is not in inventory hosts", node.Name)
+				switch i.UnmatchedNodePolicy {
+				case config.UnmatchedNodePolicyWarn:
+					log.Warnf("Node %s is not in inventory hosts, not updating its installation status", node.Name)
+					continue
+				case config.UnmatchedNodePolicyIgnore:
+					log.Debugf("Node %s is not in inventory hosts", node.Name)
+					continue
+				default:
+					return fmt.Errorf("Node %s is not in inventory hosts", node.Name)
+				}
 			}
 			ctx = utils.GenerateRequestContext()
 			if err := i.inventoryClient.UpdateHostInstallProgress(ctx, host.Host.InfraEnvID.String(), host.Host.ID.String(), models.HostStageJoined, ""); err != nil {
@@ -734,14 +1704,60 @@ func (i *installer) updateReadyMasters(nodes *v1.NodeList, readyMasters *[]strin
 	return nil
 }
 
-func (i *installer) cleanupInstallDevice() error {
+// logDiskInventory logs the block devices as they were before the installer touched them,
+// so a failed installation can be compared with the disk state it started from
+func (i *installer) logDiskInventory() {
+	if i.DryRunEnabled {
+		return
+	}
+
+	lsblk, err := i.ops.ExecPrivilegeCommand(nil, "lsblk", "--paths", "--output", diskInventoryColumns)
+	if err != nil {
+		i.log.WithError(err).Warn("Failed to list block devices")
+	} else {
+		i.log.Infof("Block devices before installation:\n%s", lsblk)
+	}
+
+	fields := logrus.Fields{"device": i.Device}
+	if vgName, err := i.ops.GetVGByPV(i.Device); err != nil {
+		i.log.WithError(err).Warnf("Failed to get the volume group of %s", i.Device)
+	} else if vgName != "" {
+		fields["volumeGroup"] = vgName
+	}
+	if i.ops.IsRaidMember(i.Device) {
+		raidDevices, err := i.ops.GetRaidDevices(i.Device)
+		if err != nil {
+			i.log.WithError(err).Warnf("Failed to get the raid devices of %s", i.Device)
+		}
+		fields["raidDevices"] = raidDevices
+	}
+	i.log.WithFields(fields).Info("Install device inventory")
+}
+
+func (i *installer) cleanupInstallDevice(ctx context.Context) error {
 
 	if i.DryRunEnabled || i.Config.SkipInstallationDiskCleanup {
 		return nil
 	}
 
+	preserved := i.resolvePreservedDevices()
+	for _, device := range preserved {
+		if isPreservedDevice(i.Device, []string{device}) || isPreservedDevice(device, []string{i.Device}) {
+			return errors.Errorf("installation device %s overlaps preserved device %s", i.Device, device)
+		}
+	}
+
 	i.log.Infof("Start cleaning up device %s", i.Device)
-	err := i.cleanupDevice(i.Device)
+	err := i.cleanupDevice(i.Device, preserved)
+
+	if err != nil {
+		return err
+	}
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	err = i.closeLuksMappings()
 
 	if err != nil {
 		return err
@@ -756,9 +1772,21 @@ func (i *installer) cleanupInstallDevice() error {
 			return err
 		}
 
+		degraded, degradedErr := i.ops.GetDegradedRaidDevices(i.Device)
+		if degradedErr != nil {
+			i.log.WithError(degradedErr).Warnf("Failed to check if the raid devices of %s are degraded", i.Device)
+		} else if len(degraded) > 0 {
+			i.log.Warnf("Raid devices %s of %s are degraded, looking for stale superblocks of their missing members after cleaning",
+				strings.Join(degraded, ", "), i.Device)
+		}
+
 		for _, device := range devices {
+			if isPreservedDevice(device, preserved) {
+				i.log.Warnf("Raid device %s is preserved - not cleaning it", device)
+				continue
+			}
 			// Cleaning the raid device itself before removing membership.
-			err = i.cleanupDevice(device)
+			err = i.cleanupDevice(device, preserved)
 
 			if err != nil {
 				return err
@@ -770,20 +1798,199 @@ func (i *installer) cleanupInstallDevice() error {
 		if err != nil {
 			return err
 		}
+		if len(degraded) > 0 {
+			var zeroed []string
+			if zeroed, err = i.ops.ZeroRaidSuperblocks(i.Device); err != nil {
+				return errors.Wrapf(err, "failed to zero the stale raid superblocks of %s", i.Device)
+			}
+			if len(zeroed) > 0 {
+				i.log.Infof("Zeroed the stale raid superblocks of %s", strings.Join(zeroed, ", "))
+			} else {
+				i.log.Infof("No stale raid superblocks left on %s", i.Device)
+			}
+		}
 		i.log.Infof("Finished cleaning up device %s", i.Device)
 	}
 
-	return i.ops.Wipefs(i.Device)
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	if err = i.wipeInstallDevice(ctx); err != nil {
+		return err
+	}
+	if err = i.verifyInstallDeviceWiped(); err != nil {
+		return err
+	}
+	return i.cleanupEtcdDevice(preserved)
+}
+
+// validateHighAvailabilityMode makes sure masters don't take the worker branches because of a
+// missing HA mode, workers don't use it
+func (i *installer) validateHighAvailabilityMode() error {
+	switch i.Config.Role {
+	case string(models.HostRoleMaster), string(models.HostRoleBootstrap):
+		if i.HighAvailabilityMode != models.ClusterHighAvailabilityModeFull && i.HighAvailabilityMode != models.ClusterHighAvailabilityModeNone {
+			return errors.Errorf("role %s requires high-availability-mode %s or %s, got %q", i.Config.Role,
+				models.ClusterHighAvailabilityModeFull, models.ClusterHighAvailabilityModeNone, i.HighAvailabilityMode)
+		}
+		if i.minReadyMasterNodes() > i.expectedMasterNodes() {
+			return errors.Errorf("min-ready-masters %d is larger than master-count %d", i.minReadyMasterNodes(), i.expectedMasterNodes())
+		}
+	case string(models.HostRoleWorker):
+		if i.HighAvailabilityMode != "" {
+			i.log.Debugf("Ignoring high-availability-mode %s on a worker", i.HighAvailabilityMode)
+		}
+	default:
+		return errors.Errorf("unsupported role %q", i.Config.Role)
+	}
+	return nil
+}
+
+// setNodeReadiness parses the conditions a master node must have to be counted as ready
+func (i *installer) setNodeReadiness() error {
+	nodeReadiness, err := common.ParseNodeReadiness(i.NodeReadyConditions)
+	if err != nil {
+		return err
+	}
+	i.nodeReadiness = nodeReadiness
+	return nil
+}
+
+// validateEtcdDevice makes sure the optional etcd device isn't part of the installation device
+// and isn't in use
+func (i *installer) validateEtcdDevice() error {
+	if i.EtcdDevice == "" {
+		return nil
+	}
+	if i.Config.Role == string(models.HostRoleWorker) {
+		i.log.Warnf("Ignoring etcd device %s, etcd doesn't run on workers", i.EtcdDevice)
+		i.Config.EtcdDevice = ""
+		return nil
+	}
+
+	i.Config.EtcdDevice = i.ops.EvaluateDiskSymlink(i.EtcdDevice)
+	if isPreservedDevice(i.EtcdDevice, []string{i.Device}) || isPreservedDevice(i.Device, []string{i.EtcdDevice}) {
+		return errors.Errorf("etcd device %s overlaps installation device %s", i.EtcdDevice, i.Device)
+	}
+	if !i.DryRunEnabled {
+		mountPoints, err := i.ops.GetMountPoints(i.EtcdDevice)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get the mount points of etcd device %s", i.EtcdDevice)
+		}
+		if len(mountPoints) > 0 {
+			return errors.Errorf("etcd device %s is mounted on %s", i.EtcdDevice, strings.Join(mountPoints, ", "))
+		}
+	}
+	i.log.Infof("Using %s as the etcd device", i.EtcdDevice)
+	return nil
+}
+
+// cleanupEtcdDevice wipes the etcd device when requested, so nothing from a previous cluster is left on it
+func (i *installer) cleanupEtcdDevice(preserved []string) error {
+	if i.EtcdDevice == "" || !i.WipeEtcdDevice {
+		return nil
+	}
+	if isPreservedDevice(i.EtcdDevice, preserved) {
+		return errors.Errorf("etcd device %s is preserved and can't be wiped", i.EtcdDevice)
+	}
+
+	i.log.Infof("Start cleaning up etcd device %s", i.EtcdDevice)
+	if err := i.cleanupDevice(i.EtcdDevice, preserved); err != nil {
+		return err
+	}
+	return i.ops.Wipefs(i.EtcdDevice)
+}
+
+// wipeInstallDevice retries wipefs, as right after removing VGs or RAID members the kernel
+// may not have released the device yet and wipefs fails with EBUSY
+func (i *installer) wipeInstallDevice(ctx context.Context) error {
+	var err error
+	if utils.Retry(wipefsMaxAttempts, wipefsRetryInterval, i.log, func() error {
+		if err = ctx.Err(); err != nil {
+			return utils.StopRetry(err)
+		}
+		if settleErr := i.ops.UdevSettle(); settleErr != nil {
+			i.log.WithError(settleErr).Warn("udevadm settle failed")
+		}
+		err = i.ops.Wipefs(i.Device)
+		return err
+	}) != nil {
+		return err
+	}
+	return nil
+}
+
+// verifyInstallDeviceWiped re-scans the device after wiping it, a wipefs that silently left signatures
+// behind would otherwise only surface as a confusing failure to write the image
+func (i *installer) verifyInstallDeviceWiped() error {
+	signatures, err := i.ops.GetDeviceSignatures(i.Device)
+	if err != nil {
+		return errors.Wrapf(err, "failed to verify that device %s was wiped", i.Device)
+	}
+	if len(signatures) > 0 {
+		return errors.Errorf("device %s still has signatures after wiping it: %s, make sure the device isn't in use and is writable",
+			i.Device, strings.Join(signatures, ", "))
+	}
+	return nil
+}
+
+// validateInstallDevice makes sure the installation device is a whole disk, coreos-installer writes
+// a whole disk image with its own partition table that can't boot from inside a partition
+func (i *installer) validateInstallDevice() error {
+	disk, err := i.ops.GetPartitionParent(i.Device)
+	if err != nil {
+		i.log.WithError(err).Warnf("Failed to check if %s is a partition, handling it as a whole disk", i.Device)
+		return nil
+	}
+	if disk != "" {
+		return errors.Errorf("installation device %s is a partition of %s, the image can only be written to a whole disk", i.Device, disk)
+	}
+	return nil
+}
+
+// closeLuksMappings closes the dm-crypt mappings left open on the install device,
+// an open mapping keeps the device busy and wipefs would fail
+func (i *installer) closeLuksMappings() error {
+	mappings, err := i.ops.GetLuksMappings(i.Device)
+	if err != nil {
+		return err
+	}
+
+	for _, mapping := range mappings {
+		i.log.Infof("An open LUKS mapping %s was detected on the installation device (%s) - closing", mapping, i.Device)
+		// The mapping may hold a volume group of its own
+		if err = i.cleanupDevice(mapping, nil); err != nil {
+			return err
+		}
+		if err = i.ops.CloseLuksMapping(mapping); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (i *installer) cleanupDevice(device string) error {
+func (i *installer) cleanupDevice(device string, preserved []string) error {
 	vgName, err := i.ops.GetVGByPV(device)
 	if err != nil {
 		return err
 	}
 
+	if vgName != "" && len(preserved) > 0 {
+		var pvs []string
+		pvs, err = i.ops.GetPVsByVG(vgName)
+		if err != nil {
+			return err
+		}
+		for _, pv := range pvs {
+			if isPreservedDevice(pv, preserved) {
+				return errors.Errorf("volume group %s on device %s has a physical volume on preserved device %s and can't be removed, "+
+					"remove the device from the volume group or stop preserving %s", vgName, device, pv, pv)
+			}
+		}
+	}
+
 	if vgName != "" {
-		i.log.Infof("A virtual group was detected on the installation device (%s) - cleaning", i.Device)
+		i.log.Infof("A virtual group was detected on the device (%s) - cleaning", device)
 		err = i.ops.RemoveVG(vgName)
 
 		if err != nil {
@@ -800,18 +2007,70 @@ func (i *installer) cleanupDevice(device string) error {
 	return nil
 }
 
+// resolvePreservedDevices returns the devices to preserve with their symlinks evaluated
+func (i *installer) resolvePreservedDevices() []string {
+	preserved := make([]string, 0, len(i.PreserveDevices))
+	for _, device := range i.PreserveDevices {
+		preserved = append(preserved, i.ops.EvaluateDiskSymlink(device))
+	}
+	return preserved
+}
+
+// isPreservedDevice returns true if the device or the disk it's a partition of is preserved
+func isPreservedDevice(device string, preserved []string) bool {
+	for _, p := range preserved {
+		if device == p {
+			return true
+		}
+		// partitions are named sda1, or nvme0n1p1 for disks whose name ends with a digit
+		suffixRegex := partitionSuffixRegex
+		if p != "" && p[len(p)-1] >= '0' && p[len(p)-1] <= '9' {
+			suffixRegex = numberedDiskPartitionSuffixRegex
+		}
+		if suffix := strings.TrimPrefix(device, p); suffix != device && suffixRegex.MatchString(suffix) {
+			return true
+		}
+	}
+	return false
+}
+
 func (i *installer) verifyHostCanMoveToConfigurationStatus(inventoryHostsMapWithIp map[string]inventory_client.HostData) {
 	logs, err := i.ops.GetMCSLogs()
 	if err != nil {
-		i.log.Infof("Failed to get MCS logs, will retry")
+		i.mcsLogsFailures++
+		if i.mcsLogsFailures >= mcsLogsFailuresBeforeWarning {
+			i.log.WithError(err).Warnf("Failed to get MCS logs %d times in a row, hosts can't move to configuring until they are available, will retry",
+				i.mcsLogsFailures)
+		} else {
+			i.log.Infof("Failed to get MCS logs, will retry")
+		}
 		return
 	}
-	common.SetConfiguringStatusForHosts(i.inventoryClient, inventoryHostsMapWithIp, logs, true, i.log)
+	if i.mcsLogsFailures >= mcsLogsFailuresBeforeWarning {
+		i.log.Infof("Got MCS logs after %d consecutive failures", i.mcsLogsFailures)
+	}
+	i.mcsLogsFailures = 0
+	common.SetConfiguringStatusForHosts(i.inventoryClient, inventoryHostsMapWithIp, logs, true, i.PreviewConfiguringStatus, i.log)
+}
+
+// configuringFilteredStages returns the configured stages to filter, defaultConfiguringFilteredStages unless configured
+func (i *installer) configuringFilteredStages() map[models.HostStage]struct{} {
+	stages := defaultConfiguringFilteredStages
+	if len(i.ConfiguringFilteredStages) > 0 {
+		stages = make([]models.HostStage, 0, len(i.ConfiguringFilteredStages))
+		for _, stage := range i.ConfiguringFilteredStages {
+			stages = append(stages, models.HostStage(stage))
+		}
+	}
+	statesToFilter := make(map[models.HostStage]struct{}, len(stages))
+	for _, stage := range stages {
+		statesToFilter[stage] = struct{}{}
+	}
+	return statesToFilter
 }
 
 func (i *installer) filterAlreadyUpdatedHosts(inventoryHostsMapWithIp map[string]inventory_client.HostData) {
-	statesToFilter := map[models.HostStage]struct{}{models.HostStageConfiguring: {}, models.HostStageJoined: {},
-		models.HostStageDone: {}, models.HostStageWaitingForIgnition: {}}
+	statesToFilter := i.configuringFilteredStages()
 	for name, host := range inventoryHostsMapWithIp {
 		fmt.Println(name, host.Host.Progress.CurrentStage)
 		_, ok := statesToFilter[host.Host.Progress.CurrentStage]
@@ -821,28 +2080,83 @@ func (i *installer) filterAlreadyUpdatedHosts(inventoryHostsMapWithIp map[string
 	}
 }
 
+// trackConfiguringHosts remembers when each host was first seen in configuring
+func (i *installer) trackConfiguringHosts(inventoryHostsMapWithIp map[string]inventory_client.HostData, configuringSince map[string]time.Time) {
+	if i.ConfiguringStuckThreshold == 0 {
+		return
+	}
+	for name, host := range inventoryHostsMapWithIp {
+		if _, ok := configuringSince[name]; !ok && host.Host.Progress != nil && host.Host.Progress.CurrentStage == models.HostStageConfiguring {
+			configuringSince[name] = i.clock.Now()
+		}
+	}
+}
+
+// reportStuckConfiguringHosts flags hosts that pulled ignition but didn't advance past configuring
+// within the threshold. Hosts that advanced or were flagged already are not tracked anymore
+func (i *installer) reportStuckConfiguringHosts(configuringSince map[string]time.Time) {
+	if len(configuringSince) == 0 {
+		return
+	}
+	ctx := utils.GenerateRequestContext()
+	log := utils.RequestIDLogger(ctx, i.log)
+	hostsMap, err := i.inventoryClient.GetEnabledHostsNamesHosts(ctx, log)
+	if err != nil {
+		log.Warnf("Failed to get hosts info from inventory, err %s", err)
+		return
+	}
+	for name, since := range configuringSince {
+		host, ok := hostsMap[name]
+		if !ok || host.Host.Progress == nil || host.Host.Progress.CurrentStage != models.HostStageConfiguring {
+			delete(configuringSince, name)
+			continue
+		}
+		stuckFor := i.clock.Now().Sub(since)
+		if stuckFor < i.ConfiguringStuckThreshold {
+			continue
+		}
+		info := fmt.Sprintf(configuringStuckInfo, stuckFor.Round(time.Second))
+		log.Warnf("Host %s %q pulled ignition but is still configuring after %s", name, host.Host.ID.String(), stuckFor.Round(time.Second))
+		if err = i.inventoryClient.UpdateHostInstallProgress(ctx, host.Host.InfraEnvID.String(), host.Host.ID.String(), models.HostStageConfiguring, info); err != nil {
+			log.Errorf("Failed to update node installation status, %s", err)
+			continue
+		}
+		delete(configuringSince, name)
+	}
+}
+
 // will run as go routine and tries to find nodes that pulled ignition from mcs
 // it will get mcs logs of static pod that runs on bootstrap and will search for matched ip
 // when match is found it will update inventory service with new host status
 func (i *installer) updateConfiguringStatus(ctx context.Context) {
-	i.log.Infof("Start waiting for configuring state")
-	ticker := time.NewTicker(generalWaitTimeout)
+	interval := i.ConfiguringStatusInterval
+	if interval <= 0 {
+		interval = defaultConfiguringStatusInterval
+	}
+	i.log.Infof("Start waiting for configuring state, polling MCS logs every %s", interval)
+	ticker := i.clock.NewTicker(interval)
+	defer ticker.Stop()
 	var inventoryHostsMapWithIp map[string]inventory_client.HostData
+	configuringSince := make(map[string]time.Time)
 	var err error
 	for {
 		select {
 		case <-ctx.Done():
 			i.log.Infof("Exiting updateConfiguringStatus go routine")
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			i.log.Infof("searching for hosts that pulled ignition already")
 			inventoryHostsMapWithIp, err = i.getInventoryHostsMap(inventoryHostsMapWithIp)
 			if err != nil {
 				continue
 			}
-			i.verifyHostCanMoveToConfigurationStatus(inventoryHostsMapWithIp)
+			if len(inventoryHostsMapWithIp) > 0 {
+				i.verifyHostCanMoveToConfigurationStatus(inventoryHostsMapWithIp)
+			}
+			i.trackConfiguringHosts(inventoryHostsMapWithIp, configuringSince)
 			i.filterAlreadyUpdatedHosts(inventoryHostsMapWithIp)
-			if len(inventoryHostsMapWithIp) == 0 {
+			i.reportStuckConfiguringHosts(configuringSince)
+			if len(inventoryHostsMapWithIp) == 0 && len(configuringSince) == 0 {
 				i.log.Infof("Exiting updateConfiguringStatus go routine")
 				return
 			}
@@ -852,19 +2166,22 @@ func (i *installer) updateConfiguringStatus(ctx context.Context) {
 
 // createSingleNodeMasterIgnition will start the bootstrap flow and wait for bootkube
 // when bootkube complete the single node master ignition will be under singleNodeMasterIgnitionPath
-func (i *installer) createSingleNodeMasterIgnition() (string, error) {
-	if err := i.startBootstrap(); err != nil {
+func (i *installer) createSingleNodeMasterIgnition(ctx context.Context) (string, error) {
+	if err := i.startBootstrap(ctx); err != nil {
 		i.log.Errorf("Bootstrap failed %s", err)
 		return "", err
 	}
-	i.waitForBootkube(context.Background())
+	i.waitForBootkube(ctx)
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	_, err := i.ops.ExecPrivilegeCommand(utils.NewLogWriter(i.log), "stat", singleNodeMasterIgnitionPath)
 	if err != nil {
 		i.log.Errorf("Failed to find single node master ignition: %s", err)
 		return "", err
 	}
 	i.Config.Role = string(models.HostRoleMaster)
-	err = i.updateSingleNodeIgnition(singleNodeMasterIgnitionPath)
+	err = i.updateSingleNodeIgnition(ctx, singleNodeMasterIgnitionPath)
 	if err != nil {
 		return "", err
 	}
@@ -872,6 +2189,92 @@ func (i *installer) createSingleNodeMasterIgnition() (string, error) {
 	return singleNodeMasterIgnitionPath, nil
 }
 
+// requiredBinaries lists the host executables the installation of this node runs. The MCO image
+// brings its own machine-config-daemon so it isn't listed.
+func (i *installer) requiredBinaries() []string {
+	binaries := []string{"coreos-installer", "lsblk", "wipefs", "udevadm", "systemctl"}
+	if i.Config.Role == string(models.HostRoleBootstrap) || i.HighAvailabilityMode == models.ClusterHighAvailabilityModeNone {
+		binaries = append(binaries, "podman", "stat")
+	}
+	if i.Config.Role == string(models.HostRoleBootstrap) && i.HighAvailabilityMode != models.ClusterHighAvailabilityModeNone {
+		binaries = append(binaries, "ssh-keygen")
+	}
+	return binaries
+}
+
+// verifyRequiredBinaries makes sure all the required host executables exist before anything on the
+// node is touched, and reports all the missing ones at once
+func (i *installer) verifyRequiredBinaries() error {
+	if i.DryRunEnabled {
+		return nil
+	}
+	binaries := i.requiredBinaries()
+	// command -v prints the path of every executable it finds, the missing ones shouldn't fail the command
+	output, err := i.ops.ExecPrivilegeCommand(nil, "bash", "-c", fmt.Sprintf("command -v %s || true", strings.Join(binaries, " ")))
+	if err != nil {
+		return errors.Wrap(err, "failed to look for the required host executables")
+	}
+	found := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		found[filepath.Base(strings.TrimSpace(line))] = true
+	}
+	var missing []string
+	for _, binary := range binaries {
+		if !found[binary] {
+			missing = append(missing, binary)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("missing required host executables: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// validateSingleNodePreflight makes sure the cluster really has a single host before anything on the
+// node is touched, and warns when this host doesn't meet the single node minimums
+func (i *installer) validateSingleNodePreflight() error {
+	if i.DryRunEnabled {
+		return nil
+	}
+	ctx := utils.GenerateRequestContext()
+	log := utils.RequestIDLogger(ctx, i.log)
+	hostsMap, err := i.inventoryClient.GetEnabledHostsNamesHosts(ctx, log)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the cluster hosts for single node validation")
+	}
+	if len(hostsMap) != 1 {
+		return errors.Errorf("single node installation requires exactly one enabled host but the cluster has %d, "+
+			"make sure the cluster high availability mode is correct", len(hostsMap))
+	}
+	var host *inventory_client.HostData
+	for name := range hostsMap {
+		hostData := hostsMap[name]
+		if hostData.Host != nil && hostData.Host.ID != nil && hostData.Host.ID.String() == i.HostID {
+			host = &hostData
+		}
+	}
+	if host == nil {
+		return errors.Errorf("host %s is not the single host of the cluster", i.HostID)
+	}
+	if host.Inventory == nil || host.Inventory.CPU == nil || host.Inventory.Memory == nil {
+		log.Warnf("Host %s inventory is not available, skipping single node resources validation", i.HostID)
+		return nil
+	}
+	if host.Inventory.CPU.Count < singleNodeMinCPUCores {
+		warning := fmt.Sprintf("single node installation requires at least %d CPU cores but the host has %d",
+			singleNodeMinCPUCores, host.Inventory.CPU.Count)
+		log.Warn(warning)
+		i.addWarning(warning)
+	}
+	if host.Inventory.Memory.PhysicalBytes < singleNodeMinMemoryBytes {
+		warning := fmt.Sprintf("single node installation requires at least %d GiB of memory but the host has %.1f GiB",
+			singleNodeMinMemoryBytes/(1024*1024*1024), float64(host.Inventory.Memory.PhysicalBytes)/(1024*1024*1024))
+		log.Warn(warning)
+		i.addWarning(warning)
+	}
+	return nil
+}
+
 func (i *installer) checkLocalhostName() error {
 	if i.DryRunEnabled {
 		return nil
@@ -902,19 +2305,30 @@ func RunInstaller(installerConfig *config.Config, logger logrus.FieldLogger) err
 		numRetries = dryRunMaximumInventoryClientRetries
 	}
 
-	client, err := inventory_client.CreateInventoryClientWithDelay(
-		installerConfig.ClusterID,
-		installerConfig.URL,
-		installerConfig.PullSecretToken,
-		installerConfig.SkipCertVerification,
-		installerConfig.CACertPath,
-		logger,
-		http.ProxyFromEnvironment,
-		inventory_client.DefaultRetryMinDelay,
-		inventory_client.DefaultRetryMaxDelay,
-		numRetries,
-		inventory_client.DefaultMinRetries,
-	)
+	var client inventory_client.InventoryClient
+	var err error
+	if installerConfig.DryRunEnabled && installerConfig.DryInventoryRecordPath != "" {
+		client, err = inventory_client.CreateRecordingInventoryClient(installerConfig.DryInventoryRecordPath, logger)
+	} else {
+		userAgent := installerConfig.UserAgent
+		if userAgent == "" {
+			userAgent = inventory_client.DefaultUserAgent("assisted-installer", installerConfig.HostID)
+		}
+		client, err = inventory_client.CreateInventoryClientWithDelay(
+			installerConfig.ClusterID,
+			installerConfig.URL,
+			installerConfig.PullSecretToken,
+			installerConfig.SkipCertVerification,
+			installerConfig.CACertPath,
+			logger,
+			http.ProxyFromEnvironment,
+			inventory_client.DefaultRetryMinDelay,
+			inventory_client.DefaultRetryMaxDelay,
+			numRetries,
+			inventory_client.DefaultMinRetries,
+			userAgent,
+		)
+	}
 
 	if err != nil {
 		logger.Fatalf("Failed to create inventory client %e", err)
@@ -937,12 +2351,69 @@ func RunInstaller(installerConfig *config.Config, logger logrus.FieldLogger) err
 		ignition.NewIgnition(),
 	)
 
+	// certificates issued during the installation are rejected by hosts with a skewed clock
+	if !installerConfig.DryRunEnabled {
+		if err = checkClockSkew(context.Background(), client, installerConfig.MaxClockSkew, installerConfig.FailOnClockSkew, logger); err != nil {
+			ai.UpdateHostInstallProgress(models.HostStageFailed, err.Error())
+			return err
+		}
+	}
+
 	// Try to format requested disks. May fail formatting some disks, this is not an error.
 	ai.FormatDisks()
 
-	if err = ai.InstallNode(); err != nil {
+	// stop the installation cleanly instead of being killed in the middle of it
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	result, err := ai.InstallNodeWithResult(ctx)
+	logInstallResult(logger, result)
+	if err != nil {
 		ai.UpdateHostInstallProgress(models.HostStageFailed, err.Error())
 		return err
 	}
 	return nil
 }
+
+// checkClockSkew compares the host clock with the service one, the skew is only an error when
+// fail is set. Failing to get the service time is never an error.
+func checkClockSkew(ctx context.Context, ic inventory_client.InventoryClient, maxSkew time.Duration, fail bool, log logrus.FieldLogger) error {
+	if maxSkew <= 0 {
+		return nil
+	}
+	before := time.Now()
+	serviceTime, err := ic.GetServiceTime(ctx)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get the service time, skipping the clock skew check")
+		return nil
+	}
+	// compare with the middle of the call to ignore its duration, the Date header is in seconds anyway
+	hostTime := before.Add(time.Since(before) / 2)
+	skew := hostTime.Sub(serviceTime)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew <= maxSkew {
+		log.Debugf("Host clock skew %s is within %s", skew.Round(time.Second), maxSkew)
+		return nil
+	}
+	msg := fmt.Sprintf("host clock is %s away from the service clock (host %s, service %s), more than the allowed %s",
+		skew.Round(time.Second), hostTime.UTC().Format(time.RFC3339), serviceTime.UTC().Format(time.RFC3339), maxSkew)
+	if fail {
+		return errors.New(msg)
+	}
+	log.Warn(msg + ", the installation may fail on certificates validation")
+	return nil
+}
+
+func logInstallResult(log logrus.FieldLogger, result *InstallResult) {
+	stages := make([]string, 0, len(result.StageDurations))
+	for stage, duration := range result.StageDurations {
+		stages = append(stages, fmt.Sprintf("%s=%s", stage, duration.Round(time.Second)))
+	}
+	sort.Strings(stages)
+	log.WithFields(logrus.Fields{
+		"role":           result.Role,
+		"stageDurations": strings.Join(stages, ", "),
+		"warnings":       result.Warnings,
+	}).Info("Installation result")
+}
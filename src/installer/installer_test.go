@@ -1,23 +1,35 @@
 package installer
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
+	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/go-openapi/strfmt"
+	"github.com/go-openapi/swag"
 	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/openshift/assisted-installer/src/common"
 	"github.com/openshift/assisted-installer/src/ignition"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/thoas/go-funk"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -25,6 +37,7 @@ import (
 	"github.com/openshift/assisted-installer/src/inventory_client"
 	"github.com/openshift/assisted-installer/src/k8s_client"
 	"github.com/openshift/assisted-installer/src/ops"
+	"github.com/openshift/assisted-installer/src/utils"
 	"github.com/openshift/assisted-service/models"
 )
 
@@ -33,6 +46,11 @@ func TestValidator(t *testing.T) {
 	RunSpecs(t, "installer_test")
 }
 
+const validResolvConf = "search example.com\nnameserver 192.168.126.1\n"
+
+// the auth is "user:password" encoded
+const validPullSecret = `{"auths":{"quay.io":{"auth":"dXNlcjpwYXNzd29yZA==","email":"user@example.com"}}}`
+
 var _ = Describe("installer HostRoleMaster role", func() {
 	var (
 		l                  = logrus.New()
@@ -50,14 +68,31 @@ var _ = Describe("installer HostRoleMaster role", func() {
 		kubeNamesIds       map[string]string
 		events             v1.EventList
 	)
-	generalWaitTimeout = 100 * time.Millisecond
+	defaultConfiguringStatusInterval = 100 * time.Millisecond
 	generalWaitInterval = 5 * time.Millisecond
+	uploadLogsRetryInterval = time.Millisecond
+	systemctlRetryInterval = time.Millisecond
+	wipefsRetryInterval = time.Millisecond
 	device := "/dev/vda"
 	events = v1.EventList{TypeMeta: metav1.TypeMeta{},
 		ListMeta: metav1.ListMeta{}, Items: []v1.Event{{TypeMeta: metav1.TypeMeta{}, ObjectMeta: metav1.ObjectMeta{UID: "7916fa89-ea7a-443e-a862-b3e930309f65", Name: common.AssistedControllerIsReadyEvent}, Message: "aaaa"}}}
 	l.SetOutput(ioutil.Discard)
 	evaluateDiskSymlinkSuccess := func() {
 		mockops.EXPECT().EvaluateDiskSymlink(device).Return(device).Times(1)
+		mockops.EXPECT().GetPartitionParent(device).Return("", nil).Times(1)
+	}
+	// requiredBinariesFound answers the lookup of the required binaries, except for the missing ones
+	requiredBinariesFound := func(missing ...string) {
+		mockops.EXPECT().ExecPrivilegeCommand(nil, "bash", "-c", gomock.Any()).DoAndReturn(
+			func(liveLogger io.Writer, command string, args ...string) (string, error) {
+				var paths []string
+				for _, binary := range strings.Fields(strings.TrimSuffix(strings.TrimPrefix(args[1], "command -v "), " || true")) {
+					if !funk.ContainsString(missing, binary) {
+						paths = append(paths, "/usr/bin/"+binary)
+					}
+				}
+				return strings.Join(paths, "\n"), nil
+			}).Times(1)
 	}
 
 	mkdirSuccess := func(filepath string) {
@@ -83,10 +118,20 @@ var _ = Describe("installer HostRoleMaster role", func() {
 		mockIgnition.EXPECT().WriteIgnitionFile(singleNodeMasterIgnitionPath, gomock.Any()).Return(nil).Times(1)
 	}
 
+	diskInventoryLogged := func() {
+		mockops.EXPECT().ExecPrivilegeCommand(nil, "lsblk", "--paths", "--output", diskInventoryColumns).Return("NAME TYPE\n/dev/vda disk", nil).Times(1)
+		mockops.EXPECT().GetVGByPV(device).Return("", nil).Times(1)
+		mockops.EXPECT().IsRaidMember(device).Return(false).Times(1)
+	}
+
 	cleanInstallDevice := func() {
+		diskInventoryLogged()
 		mockops.EXPECT().GetVGByPV(device).Return("", nil).Times(1)
+		mockops.EXPECT().GetLuksMappings(device).Return(nil, nil).Times(1)
 		mockops.EXPECT().IsRaidMember(device).Return(false).Times(1)
+		mockops.EXPECT().UdevSettle().Return(nil).Times(1)
 		mockops.EXPECT().Wipefs(device).Return(nil).Times(1)
+		mockops.EXPECT().GetDeviceSignatures(device).Return(nil, nil).Times(1)
 	}
 
 	updateProgressSuccess := func(stages [][]string) {
@@ -100,11 +145,12 @@ var _ = Describe("installer HostRoleMaster role", func() {
 	}
 
 	writeToDiskSuccess := func(extra interface{}) {
-		mockops.EXPECT().WriteImageToDisk(filepath.Join(InstallDir, "master-host-id.ign"), device, mockbmclient, extra).Return(nil).Times(1)
+		mockops.EXPECT().WriteImageToDisk(gomock.Any(), filepath.Join(InstallDir, "master-host-id.ign"), device, mockbmclient, extra).Return(nil).Times(1)
 	}
 
 	setBootOrderSuccess := func(extra interface{}) {
 		mockops.EXPECT().SetBootOrder(device).Return(nil).Times(1)
+		mockops.EXPECT().GetEfiBootEntries().Return(nil, nil).Times(1)
 	}
 
 	uploadLogsSuccess := func(bootstrap bool) {
@@ -123,6 +169,9 @@ var _ = Describe("installer HostRoleMaster role", func() {
 		mockbmclient.EXPECT().UploadLogs(gomock.Any(), clusterId, models.LogsTypeController, gomock.Any()).Return(nil).Times(1)
 	}
 
+	serviceIsActive := func(service string) {
+		mockops.EXPECT().ExecPrivilegeCommand(gomock.Any(), "systemctl", "is-active", service).Return("active", nil).Times(1)
+	}
 	resolvConfSuccess := func() {
 		mockops.EXPECT().ReloadHostFile("/etc/resolv.conf").Return(nil).Times(1)
 	}
@@ -154,26 +203,32 @@ var _ = Describe("installer HostRoleMaster role", func() {
 	Context("Bootstrap role", func() {
 
 		conf := config.Config{Role: string(models.HostRoleBootstrap),
-			ClusterID:        "cluster-id",
-			InfraEnvID:       "infra-env-id",
-			HostID:           "host-id",
-			Device:           "/dev/vda",
-			URL:              "https://assisted-service.com:80",
-			OpenshiftVersion: openShiftVersion,
-			MCOImage:         "quay.io/openshift-release-dev/ocp-v4.0-art-dev@sha256:dc1a34f55c712b2b9c5e5a14dd85e67cbdae11fd147046ac2fef9eaf179ab221",
+			ClusterID:            "cluster-id",
+			InfraEnvID:           "infra-env-id",
+			HostID:               "host-id",
+			Device:               "/dev/vda",
+			URL:                  "https://assisted-service.com:80",
+			OpenshiftVersion:     openShiftVersion,
+			MCOImage:             "quay.io/openshift-release-dev/ocp-v4.0-art-dev@sha256:dc1a34f55c712b2b9c5e5a14dd85e67cbdae11fd147046ac2fef9eaf179ab221",
+			HighAvailabilityMode: models.ClusterHighAvailabilityModeFull,
 		}
 		BeforeEach(func() {
 			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			requiredBinariesFound()
 			evaluateDiskSymlinkSuccess()
 		})
 		mcoImage := conf.MCOImage
+		readRegistriesConfSuccess := func() {
+			mockops.EXPECT().ReadHostFile(utils.RegistriesConfPath).Return("", nil).Times(1)
+		}
 		extractIgnitionToFS := func(out string, err error) {
-			mockops.EXPECT().ExecPrivilegeCommand(
-				gomock.Any(), "podman", "run", "--net", "host",
+			mockops.EXPECT().ExecPrivilegeCommandContext(
+				gomock.Any(), gomock.Any(), "podman", "run", "--net", "host",
 				"--pid=host",
 				"--volume", "/:/rootfs:rw",
 				"--volume", "/usr/bin/rpm-ostree:/usr/bin/rpm-ostree",
 				"--privileged",
+				"--authfile", config.DefaultDockerConfigPath,
 				"--entrypoint", "/usr/bin/machine-config-daemon",
 				mcoImage,
 				"start", "--node-name", "localhost", "--root-mount", "/rootfs", "--once-from",
@@ -183,7 +238,13 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			mockops.EXPECT().SystemctlAction("daemon-reload").Return(err).Times(1)
 		}
 		restartNetworkManager := func(err error) {
-			mockops.EXPECT().SystemctlAction("restart", "NetworkManager.service").Return(err).Times(1)
+			if err != nil {
+				mockops.EXPECT().ReadHostFile("/etc/resolv.conf").Return(validResolvConf, nil).Times(1)
+				mockops.EXPECT().SystemctlAction("restart", "NetworkManager.service").Return(err).Times(systemctlMaxAttempts)
+				return
+			}
+			mockops.EXPECT().ReadHostFile("/etc/resolv.conf").Return(validResolvConf, nil).Times(2)
+			mockops.EXPECT().SystemctlAction("restart", "NetworkManager.service").Return(nil).Times(1)
 		}
 		checkLocalHostname := func(hostname string, err error) {
 			mockops.EXPECT().GetHostname().Return(hostname, err).Times(1)
@@ -195,6 +256,7 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			services := []string{"bootkube.service", "progress.service", "approve-csr.service"}
 			for i := range services {
 				mockops.EXPECT().SystemctlAction("start", services[i]).Return(nil).Times(1)
+				serviceIsActive(services[i])
 			}
 		}
 		WaitMasterNodesSucccess := func() {
@@ -217,11 +279,15 @@ var _ = Describe("installer HostRoleMaster role", func() {
 		getControlPlaneReplicasSuccess := func() {
 			mockk8sclient.EXPECT().GetControlPlaneReplicas().Return(3, nil).Times(1)
 		}
+		logInstallTopologySuccess := func() {
+			mockk8sclient.EXPECT().GetNetworkType().Return("OVNKubernetes", nil).Times(1)
+			mockk8sclient.EXPECT().GetControlPlaneReplicas().Return(3, nil).Times(1)
+		}
 		patchControlPlaneReplicasSuccess := func() {
-			mockk8sclient.EXPECT().PatchControlPlaneReplicas().Return(nil).Times(1)
+			mockk8sclient.EXPECT().PatchControlPlaneReplicas(2).Return(nil).Times(1)
 		}
 		unpatchControlPlaneReplicasSuccess := func() {
-			mockk8sclient.EXPECT().UnPatchControlPlaneReplicas().Return(nil).Times(1)
+			mockk8sclient.EXPECT().UnPatchControlPlaneReplicas(3).Return(nil).Times(1)
 		}
 		prepareControllerSuccess := func() {
 			mockops.EXPECT().PrepareController().Return(nil).Times(1)
@@ -235,21 +301,25 @@ var _ = Describe("installer HostRoleMaster role", func() {
 		}
 
 		extractSecretFromIgnitionSuccess := func() {
-			mockops.EXPECT().ExtractFromIgnition(filepath.Join(InstallDir, bootstrapIgn), dockerConfigFile).Return(nil).Times(1)
+			mockops.EXPECT().ExtractFromIgnition(filepath.Join(InstallDir, bootstrapIgn), config.DefaultDockerConfigPath, config.DefaultDockerConfigPath).Return(nil).Times(1)
+			mockops.EXPECT().ReadHostFile(config.DefaultDockerConfigPath).Return(validPullSecret, nil).Times(1)
 		}
 		generateSshKeyPairSuccess := func() {
-			mockops.EXPECT().ExecPrivilegeCommand(gomock.Any(), "ssh-keygen", "-q", "-f", sshKeyPath, "-N", "").Return("OK", nil).Times(1)
+			mockops.EXPECT().ExecPrivilegeCommand(nil, "ssh-keygen", "-y", "-f", config.DefaultSshDir+"/id_rsa").Return("", fmt.Errorf("No such file or directory")).Times(1)
+			mockops.EXPECT().ExecPrivilegeCommand(nil, "rm", "-f", config.DefaultSshDir+"/id_rsa", config.DefaultSshDir+"/id_rsa.pub").Return("", nil).Times(1)
+			mockops.EXPECT().ExecPrivilegeCommand(gomock.Any(), "ssh-keygen", "-q", "-f", config.DefaultSshDir+"/id_rsa", "-N", "").Return("OK", nil).Times(1)
 		}
 		createOpenshiftSshManifestSuccess := func() {
-			mockops.EXPECT().CreateOpenshiftSshManifest(assistedInstallerSshManifest, sshManifestTmpl, sshPubKeyPath).Return(nil).Times(1)
+			mockops.EXPECT().CreateOpenshiftSshManifest(config.DefaultSshManifestPath, sshManifestTmpl, config.DefaultSshDir+"/id_rsa.pub").Return(nil).Times(1)
 		}
 
 		bootstrapSetup := func() {
 			cleanInstallDevice()
-			mkdirSuccess(sshDir)
+			mkdirSuccess(config.DefaultSshDir)
 			mkdirSuccess(InstallDir)
 			downloadFileSuccess(bootstrapIgn)
 			extractSecretFromIgnitionSuccess()
+			readRegistriesConfSuccess()
 			extractIgnitionToFS("Success", nil)
 			generateSshKeyPairSuccess()
 			createOpenshiftSshManifestSuccess()
@@ -276,6 +346,7 @@ var _ = Describe("installer HostRoleMaster role", func() {
 					restartNetworkManager(nil)
 					prepareControllerSuccess()
 					startServicesSuccess()
+					logInstallTopologySuccess()
 					if conf.OpenshiftVersion == "4.6" {
 						getNetworkTypeSuccessOpenshiftSDN()
 					}
@@ -308,6 +379,7 @@ var _ = Describe("installer HostRoleMaster role", func() {
 					restartNetworkManager(nil)
 					prepareControllerSuccess()
 					startServicesSuccess()
+					logInstallTopologySuccess()
 					if conf.OpenshiftVersion == "4.6" {
 						getNetworkTypeSuccessOVNKubernetes()
 						getControlPlaneReplicasSuccess()
@@ -340,13 +412,14 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			})
 			cleanInstallDevice()
 			mkdirSuccess(InstallDir)
-			mkdirSuccess(sshDir)
+			mkdirSuccess(config.DefaultSshDir)
 			downloadFileSuccess(bootstrapIgn)
 			extractSecretFromIgnitionSuccess()
+			readRegistriesConfSuccess()
 			extractIgnitionToFS("Success", nil)
 			generateSshKeyPairSuccess()
 			err := fmt.Errorf("generate SSH keys failed")
-			mockops.EXPECT().CreateOpenshiftSshManifest(assistedInstallerSshManifest, sshManifestTmpl, sshPubKeyPath).Return(err).Times(1)
+			mockops.EXPECT().CreateOpenshiftSshManifest(config.DefaultSshManifestPath, sshManifestTmpl, config.DefaultSshDir+"/id_rsa.pub").Return(err).Times(1)
 			//HostRoleMaster flow:
 			downloadHostIgnitionSuccess(infraEnvId, hostId, "master-host-id.ign")
 			writeToDiskSuccess(gomock.Any())
@@ -368,6 +441,7 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			restartNetworkManager(nil)
 			prepareControllerSuccess()
 			startServicesSuccess()
+			logInstallTopologySuccess()
 			WaitMasterNodesSucccess()
 			waitForBootkubeSuccess()
 			bootkubeStatusSuccess()
@@ -384,6 +458,41 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			ret := installerObj.InstallNode()
 			Expect(ret).Should(BeNil())
 		})
+		It("bootstrap role result reflects the transition to master", func() {
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role},
+				{string(models.HostStageWaitingForControlPlane), waitingForBootstrapToPrepare},
+				{string(models.HostStageWaitingForControlPlane), waitingForMastersStatusInfo},
+				{string(models.HostStageInstalling), string(models.HostRoleMaster)},
+				{string(models.HostStageWritingImageToDisk)},
+				{string(models.HostStageRebooting)},
+			})
+			bootstrapSetup()
+			checkLocalHostname("not localhost", nil)
+			restartNetworkManager(nil)
+			prepareControllerSuccess()
+			startServicesSuccess()
+			logInstallTopologySuccess()
+			WaitMasterNodesSucccess()
+			waitForBootkubeSuccess()
+			bootkubeStatusSuccess()
+			resolvConfSuccess()
+			waitForControllerSuccessfully(conf.ClusterID)
+			//HostRoleMaster flow:
+			downloadHostIgnitionSuccess(infraEnvId, hostId, "master-host-id.ign")
+			writeToDiskSuccess(gomock.Any())
+			mockops.EXPECT().SetBootOrder(device).Return(fmt.Errorf("no efibootmgr")).Times(1)
+			uploadLogsSuccess(true)
+			reportLogProgressSuccess()
+			ironicAgentDoesntExist()
+			rebootSuccess()
+			result, err := installerObj.InstallNodeWithResult(context.Background())
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(result.Role).To(Equal(string(models.HostRoleMaster)))
+			Expect(result.StageDurations).To(HaveKey(models.HostStageStartingInstallation))
+			Expect(result.StageDurations).To(HaveKey(models.HostStageWaitingForControlPlane))
+			Expect(result.StageDurations).To(HaveKey(models.HostStageRebooting))
+			Expect(result.Warnings).To(Equal([]string{"failed to set boot order: no efibootmgr"}))
+		})
 		It("bootstrap role extract ignition retry exhausted", func() {
 			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role},
 				{string(models.HostStageInstalling), string(models.HostRoleMaster)},
@@ -392,17 +501,19 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			})
 			cleanInstallDevice()
 			mkdirSuccess(InstallDir)
-			mkdirSuccess(sshDir)
+			mkdirSuccess(config.DefaultSshDir)
 			downloadFileSuccess(bootstrapIgn)
 			downloadHostIgnitionSuccess(infraEnvId, hostId, "master-host-id.ign")
 			writeToDiskSuccess(gomock.Any())
 			setBootOrderSuccess(gomock.Any())
 			extractSecretFromIgnitionSuccess()
+			readRegistriesConfSuccess()
 			extractIgnitionToFS("extract failure", fmt.Errorf("extract failed"))
 			extractIgnitionToFS("extract failure", fmt.Errorf("extract failed"))
 			extractIgnitionToFS("extract failure", fmt.Errorf("extract failed"))
 			ret := installerObj.InstallNode()
-			Expect(ret).Should(Equal(fmt.Errorf("extract failed")))
+			Expect(errors.Is(ret, ErrBootstrapFailed)).Should(BeTrue())
+			Expect(errors.Unwrap(ret)).Should(Equal(fmt.Errorf("extract failed")))
 		})
 
 		It("bootstrap fail to restart NetworkManager", func() {
@@ -420,19 +531,46 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			writeToDiskSuccess(gomock.Any())
 			setBootOrderSuccess(gomock.Any())
 			ret := installerObj.InstallNode()
-			Expect(ret).Should(Equal(err))
+			Expect(errors.Is(ret, ErrBootstrapFailed)).Should(BeTrue())
+			Expect(errors.Is(ret, ErrControlPlaneTimeout)).Should(BeFalse())
+			Expect(errors.Unwrap(ret)).Should(Equal(err))
+		})
+
+		It("bootstrap fails waiting for control plane", func() {
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role},
+				{string(models.HostStageInstalling), string(models.HostRoleMaster)},
+				{string(models.HostStageWritingImageToDisk)},
+				{string(models.HostStageWaitingForControlPlane), waitingForBootstrapToPrepare},
+			})
+			bootstrapSetup()
+			checkLocalHostname("not localhost", nil)
+			restartNetworkManager(nil)
+			prepareControllerSuccess()
+			startServicesSuccess()
+			err := fmt.Errorf("Failed to reload resolv.conf")
+			mockops.EXPECT().ReloadHostFile("/etc/resolv.conf").Return(err).Times(1)
+			//HostRoleMaster flow:
+			downloadHostIgnitionSuccess(infraEnvId, hostId, "master-host-id.ign")
+			writeToDiskSuccess(gomock.Any())
+			setBootOrderSuccess(gomock.Any())
+			ret := installerObj.InstallNode()
+			Expect(errors.Is(ret, ErrControlPlaneTimeout)).Should(BeTrue())
+			Expect(errors.Is(ret, ErrBootstrapFailed)).Should(BeFalse())
+			Expect(errors.Unwrap(ret)).Should(Equal(err))
+			Expect(ret.Error()).Should(HavePrefix(ErrControlPlaneTimeout.Error()))
 		})
 	})
 	Context("Bootstrap role waiting for control plane", func() {
 
 		conf := config.Config{Role: string(models.HostRoleBootstrap),
-			ClusterID:        "cluster-id",
-			InfraEnvID:       "infra-env-id",
-			HostID:           "host-id",
-			Device:           "/dev/vda",
-			URL:              "https://assisted-service.com:80",
-			OpenshiftVersion: openShiftVersion,
-			MCOImage:         "quay.io/openshift-release-dev/ocp-v4.0-art-dev@sha256:dc1a34f55c712b2b9c5e5a14dd85e67cbdae11fd147046ac2fef9eaf179ab221",
+			ClusterID:            "cluster-id",
+			InfraEnvID:           "infra-env-id",
+			HostID:               "host-id",
+			Device:               "/dev/vda",
+			URL:                  "https://assisted-service.com:80",
+			OpenshiftVersion:     openShiftVersion,
+			MCOImage:             "quay.io/openshift-release-dev/ocp-v4.0-art-dev@sha256:dc1a34f55c712b2b9c5e5a14dd85e67cbdae11fd147046ac2fef9eaf179ab221",
+			HighAvailabilityMode: models.ClusterHighAvailabilityModeFull,
 		}
 		BeforeEach(func() {
 			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
@@ -444,6 +582,88 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			Expect(err).To(HaveOccurred())
 		})
 
+		It("escalates to a warning when MCS logs keep failing", func() {
+			logger, hook := test.NewNullLogger()
+			installerObj = NewAssistedInstaller(logger, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			mockops.EXPECT().GetMCSLogs().Return("", fmt.Errorf("dummy")).Times(mcsLogsFailuresBeforeWarning)
+			for i := 1; i < mcsLogsFailuresBeforeWarning; i++ {
+				installerObj.verifyHostCanMoveToConfigurationStatus(nil)
+				Expect(hook.LastEntry().Level).To(Equal(logrus.InfoLevel))
+			}
+			installerObj.verifyHostCanMoveToConfigurationStatus(nil)
+			Expect(hook.LastEntry().Level).To(Equal(logrus.WarnLevel))
+			Expect(hook.LastEntry().Message).To(ContainSubstring(fmt.Sprintf("%d times in a row", mcsLogsFailuresBeforeWarning)))
+
+			By("resetting the counter once the logs are available")
+			mockops.EXPECT().GetMCSLogs().Return("", nil).Times(1)
+			installerObj.verifyHostCanMoveToConfigurationStatus(nil)
+			Expect(installerObj.mcsLogsFailures).To(BeZero())
+		})
+		Context("moving hosts to configuring", func() {
+			infraEnvID := strfmt.UUID("eb82821f-bf21-4614-9a3b-ecb07929f250")
+			workerID := strfmt.UUID("eb82821f-bf21-4614-9a3b-ecb07929f240")
+			var hosts map[string]inventory_client.HostData
+			var mcsLogs string
+
+			BeforeEach(func() {
+				logs, err := ioutil.ReadFile("../../test_files/mcs_logs.txt")
+				Expect(err).NotTo(HaveOccurred())
+				mcsLogs = string(logs)
+				hosts = map[string]inventory_client.HostData{"node2": {Host: &models.Host{InfraEnvID: infraEnvID, ID: &workerID,
+					Progress: &models.HostProgressInfo{CurrentStage: models.HostStageRebooting}, Role: models.HostRoleWorker},
+					IPs: []string{"192.168.126.12"}}}
+			})
+
+			It("updates the hosts in dry run", func() {
+				installerObj.DryRunEnabled = true
+				mockops.EXPECT().GetMCSLogs().Return(mcsLogs, nil).Times(1)
+				mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), infraEnvID.String(), workerID.String(), models.HostStageWaitingForIgnition, "").Return(nil).Times(1)
+				installerObj.verifyHostCanMoveToConfigurationStatus(hosts)
+				Expect(hosts["node2"].Host.Progress.CurrentStage).To(Equal(models.HostStageWaitingForIgnition))
+			})
+
+			It("only logs the hosts in preview", func() {
+				installerObj.PreviewConfiguringStatus = true
+				mockops.EXPECT().GetMCSLogs().Return(mcsLogs, nil).Times(1)
+				mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				installerObj.verifyHostCanMoveToConfigurationStatus(hosts)
+				Expect(hosts["node2"].Host.Progress.CurrentStage).To(Equal(models.HostStageRebooting))
+			})
+		})
+		Context("install topology summary", func() {
+			var hook *test.Hook
+
+			BeforeEach(func() {
+				var logger *logrus.Logger
+				logger, hook = test.NewNullLogger()
+				installerObj = NewAssistedInstaller(logger, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			})
+
+			It("logs the install topology", func() {
+				installerObj.HighAvailabilityMode = models.ClusterHighAvailabilityModeFull
+				mockk8sclient.EXPECT().GetNetworkType().Return("OVNKubernetes", nil).Times(1)
+				mockk8sclient.EXPECT().GetControlPlaneReplicas().Return(3, nil).Times(1)
+				installerObj.logInstallTopology(mockk8sclient)
+				Expect(hook.Entries).To(HaveLen(1))
+				Expect(hook.LastEntry().Level).To(Equal(logrus.InfoLevel))
+				Expect(hook.LastEntry().Message).To(Equal(`Install topology: high availability mode "Full", role bootstrap, network type OVNKubernetes, control plane replicas 3`))
+			})
+			It("logs unknown values it failed to read", func() {
+				mockk8sclient.EXPECT().GetNetworkType().Return("", fmt.Errorf("dummy")).Times(1)
+				mockk8sclient.EXPECT().GetControlPlaneReplicas().Return(0, fmt.Errorf("dummy")).Times(1)
+				installerObj.logInstallTopology(mockk8sclient)
+				Expect(hook.LastEntry().Level).To(Equal(logrus.InfoLevel))
+				Expect(hook.LastEntry().Message).To(ContainSubstring("network type unknown, control plane replicas unknown"))
+			})
+			It("warns when control plane replicas don't match the high availability mode", func() {
+				installerObj.HighAvailabilityMode = models.ClusterHighAvailabilityModeNone
+				mockk8sclient.EXPECT().GetNetworkType().Return("OVNKubernetes", nil).Times(1)
+				mockk8sclient.EXPECT().GetControlPlaneReplicas().Return(3, nil).Times(1)
+				installerObj.logInstallTopology(mockk8sclient)
+				Expect(hook.LastEntry().Level).To(Equal(logrus.WarnLevel))
+				Expect(hook.LastEntry().Message).To(ContainSubstring("expected 1"))
+			})
+		})
 		It("waitForController reload get pods fails then succeeds", func() {
 			reportLogProgressSuccess()
 			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), infraEnvId, hostId, models.HostStageWaitingForController, "waiting for controller pod ready event").Return(nil).Times(1)
@@ -506,21 +726,68 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			defer cancel()
 			installerObj.updateConfiguringStatus(ctx)
 		})
+		Context("hosts stuck in configuring", func() {
+			infraEnvId := strfmt.UUID("eb82821f-bf21-4614-9a3b-ecb07929f250")
+			node1Id := strfmt.UUID("eb82821f-bf21-4614-9a3b-ecb07929f239")
+			hostsInStage := func(stage models.HostStage) map[string]inventory_client.HostData {
+				return map[string]inventory_client.HostData{
+					"node1": {Host: &models.Host{InfraEnvID: infraEnvId, ID: &node1Id, Progress: &models.HostProgressInfo{CurrentStage: stage}}, IPs: []string{"192.168.126.11", "192.168.11.123", "fe80::5054:ff:fe9a:4739"}}}
+			}
+			var fakeClock *utils.FakeClock
+			var configuringSince map[string]time.Time
+
+			BeforeEach(func() {
+				fakeClock = utils.NewFakeClock(time.Now())
+				installerObj.clock = fakeClock
+				installerObj.ConfiguringStuckThreshold = time.Hour
+				configuringSince = map[string]time.Time{}
+			})
+
+			It("Configuring state, host stuck in configuring is reported", func() {
+				mockbmclient.EXPECT().GetEnabledHostsNamesHosts(gomock.Any(), gomock.Any()).Return(hostsInStage(models.HostStageConfiguring), nil).Times(2)
+				mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), infraEnvId.String(), node1Id.String(), models.HostStageConfiguring,
+					fmt.Sprintf(configuringStuckInfo, time.Hour)).Return(nil).Times(1)
+
+				installerObj.trackConfiguringHosts(hostsInStage(models.HostStageConfiguring), configuringSince)
+				Expect(configuringSince).To(HaveKey("node1"))
+				fakeClock.Step(30 * time.Minute)
+				installerObj.reportStuckConfiguringHosts(configuringSince)
+				Expect(configuringSince).To(HaveKey("node1"))
+				fakeClock.Step(30 * time.Minute)
+				installerObj.reportStuckConfiguringHosts(configuringSince)
+				Expect(configuringSince).To(BeEmpty())
+			})
+			It("Configuring state, host that advanced is not reported", func() {
+				mockbmclient.EXPECT().GetEnabledHostsNamesHosts(gomock.Any(), gomock.Any()).Return(hostsInStage(models.HostStageJoined), nil).Times(1)
+				mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+				installerObj.trackConfiguringHosts(hostsInStage(models.HostStageConfiguring), configuringSince)
+				fakeClock.Step(2 * time.Hour)
+				installerObj.reportStuckConfiguringHosts(configuringSince)
+				Expect(configuringSince).To(BeEmpty())
+			})
+			It("Configuring state, host without progress is not tracked", func() {
+				installerObj.trackConfiguringHosts(map[string]inventory_client.HostData{"node1": {Host: &models.Host{ID: &node1Id}}}, configuringSince)
+				Expect(configuringSince).To(BeEmpty())
+			})
+		})
 	})
 	Context("Master role", func() {
 		installerArgs := []string{"-n", "--append-karg", "nameserver=8.8.8.8"}
 		raidDevice := "/dev/md0"
 		conf := config.Config{Role: string(models.HostRoleMaster),
-			ClusterID:        "cluster-id",
-			InfraEnvID:       "infra-env-id",
-			HostID:           "host-id",
-			Device:           "/dev/vda",
-			URL:              "https://assisted-service.com:80",
-			OpenshiftVersion: openShiftVersion,
-			InstallerArgs:    installerArgs,
+			ClusterID:            "cluster-id",
+			InfraEnvID:           "infra-env-id",
+			HostID:               "host-id",
+			Device:               "/dev/vda",
+			URL:                  "https://assisted-service.com:80",
+			OpenshiftVersion:     openShiftVersion,
+			InstallerArgs:        installerArgs,
+			HighAvailabilityMode: models.ClusterHighAvailabilityModeFull,
 		}
 		BeforeEach(func() {
 			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			requiredBinariesFound()
 			evaluateDiskSymlinkSuccess()
 
 		})
@@ -543,14 +810,197 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			Expect(ret).Should(BeNil())
 		})
 
+		Context("etcd device", func() {
+			const etcdDevice = "/dev/vdb"
+
+			BeforeEach(func() {
+				installerObj.Config.EtcdDevice = etcdDevice
+			})
+			evaluateEtcdDeviceSymlink := func(resolved string) {
+				mockops.EXPECT().EvaluateDiskSymlink(etcdDevice).Return(resolved).Times(1)
+			}
+
+			It("validates and wipes the etcd device", func() {
+				installerObj.Config.WipeEtcdDevice = true
+				updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role},
+					{string(models.HostStageInstalling), conf.Role},
+					{string(models.HostStageWritingImageToDisk)},
+					{string(models.HostStageRebooting)},
+				})
+				evaluateEtcdDeviceSymlink(etcdDevice)
+				mockops.EXPECT().GetMountPoints(etcdDevice).Return(nil, nil).Times(1)
+				cleanInstallDevice()
+				mockops.EXPECT().GetVGByPV(etcdDevice).Return("", nil).Times(1)
+				mockops.EXPECT().Wipefs(etcdDevice).Return(nil).Times(1)
+				mkdirSuccess(InstallDir)
+				downloadHostIgnitionSuccess(infraEnvId, hostId, "master-host-id.ign")
+				writeToDiskSuccess(installerArgs)
+				setBootOrderSuccess(gomock.Any())
+				uploadLogsSuccess(false)
+				reportLogProgressSuccess()
+				ironicAgentDoesntExist()
+				rebootSuccess()
+				ret := installerObj.InstallNode()
+				Expect(ret).Should(BeNil())
+			})
+			It("leaves the etcd device untouched unless asked to wipe it", func() {
+				updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role},
+					{string(models.HostStageInstalling), conf.Role},
+					{string(models.HostStageWritingImageToDisk)},
+					{string(models.HostStageRebooting)},
+				})
+				evaluateEtcdDeviceSymlink(etcdDevice)
+				mockops.EXPECT().GetMountPoints(etcdDevice).Return(nil, nil).Times(1)
+				cleanInstallDevice()
+				mkdirSuccess(InstallDir)
+				downloadHostIgnitionSuccess(infraEnvId, hostId, "master-host-id.ign")
+				writeToDiskSuccess(installerArgs)
+				setBootOrderSuccess(gomock.Any())
+				uploadLogsSuccess(false)
+				reportLogProgressSuccess()
+				ironicAgentDoesntExist()
+				rebootSuccess()
+				ret := installerObj.InstallNode()
+				Expect(ret).Should(BeNil())
+			})
+			It("fails when the etcd device is mounted", func() {
+				updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
+				evaluateEtcdDeviceSymlink(etcdDevice)
+				mockops.EXPECT().GetMountPoints(etcdDevice).Return([]string{"/var/lib/etcd"}, nil).Times(1)
+				ret := installerObj.InstallNode()
+				Expect(ret).Should(HaveOccurred())
+				Expect(ret.Error()).To(ContainSubstring("/var/lib/etcd"))
+			})
+			It("fails when the etcd device is the installation device", func() {
+				evaluateEtcdDeviceSymlink(device + "2")
+				updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
+				ret := installerObj.InstallNode()
+				Expect(ret).Should(HaveOccurred())
+				Expect(ret.Error()).To(ContainSubstring("overlaps installation device"))
+			})
+			It("fails wiping a preserved etcd device", func() {
+				installerObj.Config.WipeEtcdDevice = true
+				installerObj.Config.PreserveDevices = config.ArrayFlags{etcdDevice}
+				updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
+				evaluateEtcdDeviceSymlink(etcdDevice)
+				mockops.EXPECT().GetMountPoints(etcdDevice).Return(nil, nil).Times(1)
+				// evaluated once more when resolving the preserved devices
+				evaluateEtcdDeviceSymlink(etcdDevice)
+				cleanInstallDevice()
+				ret := installerObj.InstallNode()
+				Expect(ret).Should(HaveOccurred())
+				Expect(ret.Error()).To(ContainSubstring("is preserved"))
+			})
+		})
+
+		It("master role ignores boot order errors by default", func() {
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role},
+				{string(models.HostStageInstalling), conf.Role},
+				{string(models.HostStageWritingImageToDisk)},
+				{string(models.HostStageRebooting)},
+			})
+			cleanInstallDevice()
+			mkdirSuccess(InstallDir)
+			downloadHostIgnitionSuccess(infraEnvId, hostId, "master-host-id.ign")
+			writeToDiskSuccess(installerArgs)
+			mockops.EXPECT().SetBootOrder(device).Return(fmt.Errorf("no efibootmgr")).Times(1)
+			uploadLogsSuccess(false)
+			reportLogProgressSuccess()
+			ironicAgentDoesntExist()
+			rebootSuccess()
+			ret := installerObj.InstallNode()
+			Expect(ret).Should(BeNil())
+		})
+
+		It("master role fails on boot order errors when configured to", func() {
+			installerObj.Config.FailOnBootOrderError = true
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role},
+				{string(models.HostStageInstalling), conf.Role},
+				{string(models.HostStageWritingImageToDisk)},
+			})
+			cleanInstallDevice()
+			mkdirSuccess(InstallDir)
+			downloadHostIgnitionSuccess(infraEnvId, hostId, "master-host-id.ign")
+			writeToDiskSuccess(installerArgs)
+			mockops.EXPECT().SetBootOrder(device).Return(fmt.Errorf("no efibootmgr")).Times(1)
+			ret := installerObj.InstallNode()
+			Expect(ret).Should(HaveOccurred())
+			Expect(ret.Error()).To(Equal("failed to set boot order: no efibootmgr"))
+		})
+
+		Context("EFI boot entry", func() {
+			const partUUID = "1a2b3c4d-0000-4000-8000-000000000002"
+
+			efiBootEntries := func(entries ...ops.EfiBootEntry) {
+				mockops.EXPECT().SetBootOrder(device).Return(nil).Times(1)
+				mockops.EXPECT().GetEfiBootEntries().Return(entries, nil).Times(1)
+				mockops.EXPECT().ExecPrivilegeCommand(nil, "lsblk", "--noheadings", "--output", "PARTUUID", device).
+					Return("\n1A2B3C4D-0000-4000-8000-000000000001\n1A2B3C4D-0000-4000-8000-000000000002", nil).Times(1)
+			}
+			installUntilBootOrder := func() {
+				cleanInstallDevice()
+				mkdirSuccess(InstallDir)
+				downloadHostIgnitionSuccess(infraEnvId, hostId, "master-host-id.ign")
+				writeToDiskSuccess(installerArgs)
+			}
+
+			It("succeeds when the entry boots from the installation disk", func() {
+				updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role},
+					{string(models.HostStageInstalling), conf.Role},
+					{string(models.HostStageWritingImageToDisk)},
+					{string(models.HostStageRebooting)},
+				})
+				installUntilBootOrder()
+				efiBootEntries(ops.EfiBootEntry{Number: "0001", Label: "UEFI PXEv4", Active: true},
+					ops.EfiBootEntry{Number: "0003", Label: ops.EfiBootLabel, Active: true, PartUUID: partUUID})
+				uploadLogsSuccess(false)
+				reportLogProgressSuccess()
+				ironicAgentDoesntExist()
+				rebootSuccess()
+				result, err := installerObj.InstallNodeWithResult(context.Background())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(result.Warnings).To(BeEmpty())
+			})
+			It("warns when the entry is missing", func() {
+				updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role},
+					{string(models.HostStageInstalling), conf.Role},
+					{string(models.HostStageWritingImageToDisk)},
+					{string(models.HostStageRebooting)},
+				})
+				installUntilBootOrder()
+				efiBootEntries(ops.EfiBootEntry{Number: "0001", Label: "UEFI PXEv4", Active: true})
+				uploadLogsSuccess(false)
+				reportLogProgressSuccess()
+				ironicAgentDoesntExist()
+				rebootSuccess()
+				result, err := installerObj.InstallNodeWithResult(context.Background())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(result.Warnings).To(Equal([]string{`EFI boot entry "Red Hat Enterprise Linux" booting from /dev/vda is missing`}))
+			})
+			It("fails when the entry boots from another disk and boot order errors are fatal", func() {
+				installerObj.Config.FailOnBootOrderError = true
+				updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role},
+					{string(models.HostStageInstalling), conf.Role},
+					{string(models.HostStageWritingImageToDisk)},
+				})
+				installUntilBootOrder()
+				efiBootEntries(ops.EfiBootEntry{Number: "0003", Label: ops.EfiBootLabel, Active: true, PartUUID: "ffffffff-0000-4000-8000-000000000002"})
+				ret := installerObj.InstallNode()
+				Expect(ret).Should(HaveOccurred())
+				Expect(ret.Error()).To(ContainSubstring("is missing"))
+			})
+		})
+
 		It("HostRoleMaster role happy flow with skipping disk cleanup", func() {
 			installerObj.Config.SkipInstallationDiskCleanup = true
 			// verify none of cleanup function runs
 			mockops.EXPECT().GetVGByPV(device).Return("vg1", nil).Times(0)
 			mockops.EXPECT().RemoveVG("vg1").Return(nil).Times(0)
 			mockops.EXPECT().IsRaidMember(device).Return(false).Times(0)
+			mockops.EXPECT().UdevSettle().Return(nil).Times(0)
 			mockops.EXPECT().Wipefs(device).Return(nil).Times(0)
 			mockops.EXPECT().RemovePV(device).Return(nil).Times(0)
+			diskInventoryLogged()
 			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role},
 				{string(models.HostStageInstalling), conf.Role},
 				{string(models.HostStageWritingImageToDisk)},
@@ -570,10 +1020,14 @@ var _ = Describe("installer HostRoleMaster role", func() {
 
 		It("HostRoleMaster role happy flow with disk cleanup", func() {
 			cleanInstallDeviceClean := func() {
+				diskInventoryLogged()
 				mockops.EXPECT().GetVGByPV(device).Return("vg1", nil).Times(1)
 				mockops.EXPECT().RemoveVG("vg1").Return(nil).Times(1)
+				mockops.EXPECT().GetLuksMappings(device).Return(nil, nil).Times(1)
 				mockops.EXPECT().IsRaidMember(device).Return(false).Times(1)
+				mockops.EXPECT().UdevSettle().Return(nil).Times(1)
 				mockops.EXPECT().Wipefs(device).Return(nil).Times(1)
+				mockops.EXPECT().GetDeviceSignatures(device).Return(nil, nil).Times(1)
 				mockops.EXPECT().RemovePV(device).Return(nil).Times(1)
 			}
 			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
@@ -583,9 +1037,45 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			ret := installerObj.InstallNode()
 			Expect(ret).Should(Equal(err))
 		})
+		It("HostRoleMaster role logs the disk inventory before cleaning up the disk", func() {
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
+			gomock.InOrder(
+				mockops.EXPECT().ExecPrivilegeCommand(nil, "lsblk", "--paths", "--output", diskInventoryColumns).Return("", nil).Times(1),
+				mockops.EXPECT().GetVGByPV(device).Return("vg1", nil).Times(1),
+				mockops.EXPECT().IsRaidMember(device).Return(true).Times(1),
+				mockops.EXPECT().GetRaidDevices(device).Return([]string{raidDevice}, nil).Times(1),
+				mockops.EXPECT().GetVGByPV(device).Return("", nil).Times(1),
+				mockops.EXPECT().GetLuksMappings(device).Return(nil, nil).Times(1),
+				mockops.EXPECT().IsRaidMember(device).Return(false).Times(1),
+				mockops.EXPECT().UdevSettle().Return(nil).Times(1),
+				mockops.EXPECT().Wipefs(device).Return(nil).Times(1),
+				mockops.EXPECT().GetDeviceSignatures(device).Return(nil, nil).Times(1),
+			)
+			err := fmt.Errorf("failed to create dir")
+			mockops.EXPECT().Mkdir(InstallDir).Return(err).Times(1)
+			ret := installerObj.InstallNode()
+			Expect(ret).Should(Equal(err))
+		})
+		It("HostRoleMaster role disk inventory failures don't fail the installation", func() {
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
+			mockops.EXPECT().ExecPrivilegeCommand(nil, "lsblk", "--paths", "--output", diskInventoryColumns).Return("", fmt.Errorf("lsblk failed")).Times(1)
+			mockops.EXPECT().GetVGByPV(device).Return("", fmt.Errorf("vgs failed")).Times(1)
+			mockops.EXPECT().IsRaidMember(device).Return(false).Times(1)
+			mockops.EXPECT().GetVGByPV(device).Return("", nil).Times(1)
+			mockops.EXPECT().GetLuksMappings(device).Return(nil, nil).Times(1)
+			mockops.EXPECT().IsRaidMember(device).Return(false).Times(1)
+			mockops.EXPECT().UdevSettle().Return(nil).Times(1)
+			mockops.EXPECT().Wipefs(device).Return(nil).Times(1)
+			mockops.EXPECT().GetDeviceSignatures(device).Return(nil, nil).Times(1)
+			err := fmt.Errorf("failed to create dir")
+			mockops.EXPECT().Mkdir(InstallDir).Return(err).Times(1)
+			ret := installerObj.InstallNode()
+			Expect(ret).Should(Equal(err))
+		})
 		It("HostRoleMaster role failed to cleanup disk", func() {
 			err := fmt.Errorf("Failed to remove vg")
 			cleanInstallDeviceError := func() {
+				diskInventoryLogged()
 				mockops.EXPECT().GetVGByPV(device).Return("vg1", nil).Times(1)
 				mockops.EXPECT().RemoveVG("vg1").Return(err).Times(1)
 			}
@@ -594,14 +1084,189 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			ret := installerObj.InstallNode()
 			Expect(ret).Should(Equal(err))
 		})
+		It("HostRoleMaster role retries wipefs when the device is busy", func() {
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
+			diskInventoryLogged()
+			mockops.EXPECT().GetVGByPV(device).Return("vg1", nil).Times(1)
+			mockops.EXPECT().RemoveVG("vg1").Return(nil).Times(1)
+			mockops.EXPECT().RemovePV(device).Return(nil).Times(1)
+			mockops.EXPECT().GetLuksMappings(device).Return(nil, nil).Times(1)
+			mockops.EXPECT().IsRaidMember(device).Return(false).Times(1)
+			gomock.InOrder(
+				mockops.EXPECT().UdevSettle().Return(nil).Times(1),
+				mockops.EXPECT().Wipefs(device).Return(fmt.Errorf("wipefs: error: /dev/vda: probing initialization failed: Device or resource busy")).Times(1),
+				mockops.EXPECT().UdevSettle().Return(nil).Times(1),
+				mockops.EXPECT().Wipefs(device).Return(nil).Times(1),
+				mockops.EXPECT().GetDeviceSignatures(device).Return(nil, nil).Times(1),
+			)
+			err := fmt.Errorf("failed to create dir")
+			mockops.EXPECT().Mkdir(InstallDir).Return(err).Times(1)
+			ret := installerObj.InstallNode()
+			Expect(ret).Should(Equal(err))
+		})
+		It("HostRoleMaster role fails when the device stays busy", func() {
+			err := fmt.Errorf("wipefs: error: /dev/vda: probing initialization failed: Device or resource busy")
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
+			diskInventoryLogged()
+			mockops.EXPECT().GetVGByPV(device).Return("", nil).Times(1)
+			mockops.EXPECT().GetLuksMappings(device).Return(nil, nil).Times(1)
+			mockops.EXPECT().IsRaidMember(device).Return(false).Times(1)
+			mockops.EXPECT().UdevSettle().Return(fmt.Errorf("timeout")).Times(wipefsMaxAttempts)
+			mockops.EXPECT().Wipefs(device).Return(err).Times(wipefsMaxAttempts)
+			ret := installerObj.InstallNode()
+			Expect(ret).Should(Equal(err))
+		})
+		It("HostRoleMaster role continues when no signatures are left after wiping", func() {
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
+			diskInventoryLogged()
+			mockops.EXPECT().GetVGByPV(device).Return("", nil).Times(1)
+			mockops.EXPECT().GetLuksMappings(device).Return(nil, nil).Times(1)
+			mockops.EXPECT().IsRaidMember(device).Return(false).Times(1)
+			gomock.InOrder(
+				mockops.EXPECT().UdevSettle().Return(nil).Times(1),
+				mockops.EXPECT().Wipefs(device).Return(nil).Times(1),
+				mockops.EXPECT().GetDeviceSignatures(device).Return([]string{}, nil).Times(1),
+			)
+			err := fmt.Errorf("failed to create dir")
+			mockops.EXPECT().Mkdir(InstallDir).Return(err).Times(1)
+			Expect(installerObj.InstallNode()).Should(Equal(err))
+		})
+		It("HostRoleMaster role fails when signatures are left after wiping", func() {
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
+			diskInventoryLogged()
+			mockops.EXPECT().GetVGByPV(device).Return("", nil).Times(1)
+			mockops.EXPECT().GetLuksMappings(device).Return(nil, nil).Times(1)
+			mockops.EXPECT().IsRaidMember(device).Return(false).Times(1)
+			mockops.EXPECT().UdevSettle().Return(nil).Times(1)
+			mockops.EXPECT().Wipefs(device).Return(nil).Times(1)
+			mockops.EXPECT().GetDeviceSignatures(device).Return([]string{"LVM2_member at offset 0x218", "gpt at offset 0x200"}, nil).Times(1)
+			mockops.EXPECT().Mkdir(gomock.Any()).Times(0)
+			ret := installerObj.InstallNode()
+			Expect(ret).Should(HaveOccurred())
+			Expect(ret.Error()).Should(Equal(fmt.Sprintf("device %s still has signatures after wiping it: "+
+				"LVM2_member at offset 0x218, gpt at offset 0x200, make sure the device isn't in use and is writable", device)))
+		})
+		It("HostRoleMaster role fails when the device can't be probed after wiping", func() {
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
+			diskInventoryLogged()
+			mockops.EXPECT().GetVGByPV(device).Return("", nil).Times(1)
+			mockops.EXPECT().GetLuksMappings(device).Return(nil, nil).Times(1)
+			mockops.EXPECT().IsRaidMember(device).Return(false).Times(1)
+			mockops.EXPECT().UdevSettle().Return(nil).Times(1)
+			mockops.EXPECT().Wipefs(device).Return(nil).Times(1)
+			mockops.EXPECT().GetDeviceSignatures(device).Return(nil, fmt.Errorf("no such device")).Times(1)
+			ret := installerObj.InstallNode()
+			Expect(ret).Should(HaveOccurred())
+			Expect(ret.Error()).Should(Equal(fmt.Sprintf("failed to verify that device %s was wiped: no such device", device)))
+		})
+		It("HostRoleMaster role fails when the VG has a preserved physical volume", func() {
+			installerObj.Config.PreserveDevices = config.ArrayFlags{"/dev/disk/by-id/data-disk"}
+			mockops.EXPECT().EvaluateDiskSymlink("/dev/disk/by-id/data-disk").Return("/dev/vdb").Times(1)
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
+			diskInventoryLogged()
+			mockops.EXPECT().GetVGByPV(device).Return("vg1", nil).Times(1)
+			mockops.EXPECT().GetPVsByVG("vg1").Return([]string{device, "/dev/vdb1"}, nil).Times(1)
+			mockops.EXPECT().RemoveVG(gomock.Any()).Times(0)
+			mockops.EXPECT().RemovePV(gomock.Any()).Times(0)
+			mockops.EXPECT().Wipefs(gomock.Any()).Times(0)
+			ret := installerObj.InstallNode()
+			Expect(ret).Should(HaveOccurred())
+			Expect(ret.Error()).Should(ContainSubstring("volume group vg1 on device /dev/vda has a physical volume on preserved device /dev/vdb1"))
+		})
+		It("HostRoleMaster role removes a VG without preserved physical volumes", func() {
+			installerObj.Config.PreserveDevices = config.ArrayFlags{"/dev/vdb"}
+			mockops.EXPECT().EvaluateDiskSymlink("/dev/vdb").Return("/dev/vdb").Times(1)
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
+			diskInventoryLogged()
+			mockops.EXPECT().GetVGByPV(device).Return("vg1", nil).Times(1)
+			mockops.EXPECT().GetPVsByVG("vg1").Return([]string{device, "/dev/vdc"}, nil).Times(1)
+			mockops.EXPECT().RemoveVG("vg1").Return(nil).Times(1)
+			mockops.EXPECT().RemovePV(device).Return(nil).Times(1)
+			mockops.EXPECT().GetLuksMappings(device).Return(nil, nil).Times(1)
+			mockops.EXPECT().IsRaidMember(device).Return(false).Times(1)
+			mockops.EXPECT().UdevSettle().Return(nil).Times(1)
+			mockops.EXPECT().Wipefs(device).Return(nil).Times(1)
+			mockops.EXPECT().GetDeviceSignatures(device).Return(nil, nil).Times(1)
+			err := fmt.Errorf("failed to create dir")
+			mockops.EXPECT().Mkdir(InstallDir).Return(err).Times(1)
+			ret := installerObj.InstallNode()
+			Expect(ret).Should(Equal(err))
+		})
+		It("HostRoleMaster role doesn't clean a preserved raid device", func() {
+			installerObj.Config.PreserveDevices = config.ArrayFlags{raidDevice}
+			mockops.EXPECT().EvaluateDiskSymlink(raidDevice).Return(raidDevice).Times(1)
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
+			diskInventoryLogged()
+			mockops.EXPECT().GetVGByPV(device).Return("", nil).Times(1)
+			mockops.EXPECT().GetLuksMappings(device).Return(nil, nil).Times(1)
+			mockops.EXPECT().IsRaidMember(device).Return(true).Times(1)
+			mockops.EXPECT().GetRaidDevices(device).Return([]string{raidDevice}, nil).Times(1)
+			mockops.EXPECT().GetDegradedRaidDevices(device).Return(nil, nil).Times(1)
+			mockops.EXPECT().GetVGByPV(raidDevice).Times(0)
+			mockops.EXPECT().CleanRaidMembership(device).Return(nil).Times(1)
+			mockops.EXPECT().UdevSettle().Return(nil).Times(1)
+			mockops.EXPECT().Wipefs(device).Return(nil).Times(1)
+			mockops.EXPECT().GetDeviceSignatures(device).Return(nil, nil).Times(1)
+			err := fmt.Errorf("failed to create dir")
+			mockops.EXPECT().Mkdir(InstallDir).Return(err).Times(1)
+			ret := installerObj.InstallNode()
+			Expect(ret).Should(Equal(err))
+		})
+		It("HostRoleMaster role refuses to clean a preserved install device", func() {
+			installerObj.Config.PreserveDevices = config.ArrayFlags{device + "4"}
+			mockops.EXPECT().EvaluateDiskSymlink(device + "4").Return(device + "4").Times(1)
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
+			diskInventoryLogged()
+			ret := installerObj.InstallNode()
+			Expect(ret).Should(HaveOccurred())
+			Expect(ret.Error()).Should(ContainSubstring("overlaps preserved device"))
+		})
+		It("HostRoleMaster role closes LUKS mappings before wiping the disk", func() {
+			luksMapping := "/dev/mapper/luks-1234"
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
+			diskInventoryLogged()
+			gomock.InOrder(
+				mockops.EXPECT().GetVGByPV(device).Return("", nil).Times(1),
+				mockops.EXPECT().GetLuksMappings(device).Return([]string{luksMapping}, nil).Times(1),
+				mockops.EXPECT().GetVGByPV(luksMapping).Return("vg1", nil).Times(1),
+				mockops.EXPECT().RemoveVG("vg1").Return(nil).Times(1),
+				mockops.EXPECT().RemovePV(luksMapping).Return(nil).Times(1),
+				mockops.EXPECT().CloseLuksMapping(luksMapping).Return(nil).Times(1),
+				mockops.EXPECT().IsRaidMember(device).Return(false).Times(1),
+				mockops.EXPECT().UdevSettle().Return(nil).Times(1),
+				mockops.EXPECT().Wipefs(device).Return(nil).Times(1),
+				mockops.EXPECT().GetDeviceSignatures(device).Return(nil, nil).Times(1),
+			)
+			err := fmt.Errorf("failed to create dir")
+			mockops.EXPECT().Mkdir(InstallDir).Return(err).Times(1)
+			ret := installerObj.InstallNode()
+			Expect(ret).Should(Equal(err))
+		})
+		It("HostRoleMaster role fails when a LUKS mapping can't be closed", func() {
+			luksMapping := "/dev/mapper/luks-1234"
+			err := fmt.Errorf("Device luks-1234 is still in use")
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
+			diskInventoryLogged()
+			mockops.EXPECT().GetVGByPV(device).Return("", nil).Times(1)
+			mockops.EXPECT().GetLuksMappings(device).Return([]string{luksMapping}, nil).Times(1)
+			mockops.EXPECT().GetVGByPV(luksMapping).Return("", nil).Times(1)
+			mockops.EXPECT().CloseLuksMapping(luksMapping).Return(err).Times(1)
+			ret := installerObj.InstallNode()
+			Expect(ret).Should(Equal(err))
+		})
 		It("HostRoleMaster role raid cleanup disk - happy flow", func() {
 			cleanInstallDeviceClean := func() {
+				diskInventoryLogged()
 				mockops.EXPECT().GetVGByPV(device).Return("", nil).Times(1)
+				mockops.EXPECT().GetLuksMappings(device).Return(nil, nil).Times(1)
 				mockops.EXPECT().IsRaidMember(device).Return(true).Times(1)
 				mockops.EXPECT().GetRaidDevices(device).Return([]string{raidDevice}, nil).Times(1)
+				mockops.EXPECT().GetDegradedRaidDevices(device).Return(nil, nil).Times(1)
 				mockops.EXPECT().GetVGByPV(raidDevice).Return("", nil).Times(1)
 				mockops.EXPECT().CleanRaidMembership(device).Return(nil).Times(1)
+				mockops.EXPECT().UdevSettle().Return(nil).Times(1)
 				mockops.EXPECT().Wipefs(device).Return(nil).Times(1)
+				mockops.EXPECT().GetDeviceSignatures(device).Return(nil, nil).Times(1)
 			}
 			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
 			cleanInstallDeviceClean()
@@ -614,9 +1279,12 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			err := fmt.Errorf("failed cleaning raid device")
 
 			cleanInstallDeviceClean := func() {
+				diskInventoryLogged()
 				mockops.EXPECT().GetVGByPV(device).Return("", nil).Times(1)
+				mockops.EXPECT().GetLuksMappings(device).Return(nil, nil).Times(1)
 				mockops.EXPECT().IsRaidMember(device).Return(true).Times(1)
 				mockops.EXPECT().GetRaidDevices(device).Return([]string{raidDevice}, nil).Times(1)
+				mockops.EXPECT().GetDegradedRaidDevices(device).Return(nil, nil).Times(1)
 				mockops.EXPECT().GetVGByPV(raidDevice).Return("", nil).Times(1)
 				mockops.EXPECT().CleanRaidMembership(device).Return(err).Times(1)
 			}
@@ -625,6 +1293,46 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			ret := installerObj.InstallNode()
 			Expect(ret).Should(Equal(err))
 		})
+		It("HostRoleMaster role zeroes the stale superblocks of a degraded raid", func() {
+			logger, hook := test.NewNullLogger()
+			installerObj = NewAssistedInstaller(logger, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
+			diskInventoryLogged()
+			mockops.EXPECT().GetVGByPV(device).Return("", nil).Times(1)
+			mockops.EXPECT().GetLuksMappings(device).Return(nil, nil).Times(1)
+			mockops.EXPECT().IsRaidMember(device).Return(true).Times(1)
+			mockops.EXPECT().GetRaidDevices(device).Return([]string{raidDevice}, nil).Times(1)
+			mockops.EXPECT().GetDegradedRaidDevices(device).Return([]string{raidDevice}, nil).Times(1)
+			mockops.EXPECT().GetVGByPV(raidDevice).Return("", nil).Times(1)
+			gomock.InOrder(
+				mockops.EXPECT().CleanRaidMembership(device).Return(nil).Times(1),
+				mockops.EXPECT().ZeroRaidSuperblocks(device).Return([]string{device + "3"}, nil).Times(1),
+				mockops.EXPECT().UdevSettle().Return(nil).Times(1),
+				mockops.EXPECT().Wipefs(device).Return(nil).Times(1),
+				mockops.EXPECT().GetDeviceSignatures(device).Return(nil, nil).Times(1),
+			)
+			err := fmt.Errorf("failed to create dir")
+			mockops.EXPECT().Mkdir(InstallDir).Return(err).Times(1)
+			Expect(installerObj.InstallNode()).Should(Equal(err))
+			Expect(hook.Entries).To(ContainElement(And(HaveField("Level", logrus.WarnLevel), HaveField("Message",
+				fmt.Sprintf("Raid devices %s of %s are degraded, looking for stale superblocks of their missing members after cleaning", raidDevice, device)))))
+			Expect(hook.Entries).To(ContainElement(HaveField("Message", fmt.Sprintf("Zeroed the stale raid superblocks of %s3", device))))
+		})
+		It("HostRoleMaster role fails when the stale superblocks of a degraded raid can't be zeroed", func() {
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
+			diskInventoryLogged()
+			mockops.EXPECT().GetVGByPV(device).Return("", nil).Times(1)
+			mockops.EXPECT().GetLuksMappings(device).Return(nil, nil).Times(1)
+			mockops.EXPECT().IsRaidMember(device).Return(true).Times(1)
+			mockops.EXPECT().GetRaidDevices(device).Return([]string{raidDevice}, nil).Times(1)
+			mockops.EXPECT().GetDegradedRaidDevices(device).Return([]string{raidDevice}, nil).Times(1)
+			mockops.EXPECT().GetVGByPV(raidDevice).Return("", nil).Times(1)
+			mockops.EXPECT().CleanRaidMembership(device).Return(nil).Times(1)
+			mockops.EXPECT().ZeroRaidSuperblocks(device).Return(nil, fmt.Errorf("device busy")).Times(1)
+			ret := installerObj.InstallNode()
+			Expect(ret).Should(HaveOccurred())
+			Expect(ret.Error()).Should(Equal(fmt.Sprintf("failed to zero the stale raid superblocks of %s: device busy", device)))
+		})
 		It("master role happy flow with ironic agent", func() {
 			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role},
 				{string(models.HostStageInstalling), conf.Role},
@@ -671,10 +1379,24 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			mkdirSuccess(InstallDir)
 			downloadHostIgnitionSuccess(infraEnvId, hostId, "master-host-id.ign")
 			err := fmt.Errorf("failed to write image to disk")
-			mockops.EXPECT().WriteImageToDisk(filepath.Join(InstallDir, "master-host-id.ign"), device, mockbmclient, installerArgs).Return(err).Times(3)
+			mockops.EXPECT().WriteImageToDisk(gomock.Any(), filepath.Join(InstallDir, "master-host-id.ign"), device, mockbmclient, installerArgs).Return(err).Times(3)
 			ret := installerObj.InstallNode()
 			Expect(ret).Should(Equal(fmt.Errorf("failed after 3 attempts, last error: failed to write image to disk")))
 		})
+		It("HostRoleMaster role fails fast on a disk I/O error", func() {
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role},
+				{string(models.HostStageInstalling), conf.Role},
+				{string(models.HostStageWritingImageToDisk)},
+			})
+			cleanInstallDevice()
+			mkdirSuccess(InstallDir)
+			downloadHostIgnitionSuccess(infraEnvId, hostId, "master-host-id.ign")
+			err := fmt.Errorf("Error: writing to disk: Input/output error (os error 5)")
+			mockops.EXPECT().WriteImageToDisk(gomock.Any(), filepath.Join(InstallDir, "master-host-id.ign"), device, mockbmclient, installerArgs).Return(err).Times(1)
+			ret := installerObj.InstallNode()
+			Expect(ret).To(HaveOccurred())
+			Expect(ret.Error()).To(Equal("disk /dev/vda appears faulty, it failed with an I/O error: Error: writing to disk: Input/output error (os error 5)"))
+		})
 		It("HostRoleMaster role failed to reboot", func() {
 			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role},
 				{string(models.HostStageInstalling), conf.Role},
@@ -706,6 +1428,7 @@ var _ = Describe("installer HostRoleMaster role", func() {
 		}
 		BeforeEach(func() {
 			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			requiredBinariesFound()
 			evaluateDiskSymlinkSuccess()
 		})
 		It("worker role happy flow", func() {
@@ -735,18 +1458,145 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			cleanInstallDevice()
 			mkdirSuccess(InstallDir)
 			downloadHostIgnitionSuccess(infraEnvId, hostId, "worker-host-id.ign")
-			mockops.EXPECT().WriteImageToDisk(filepath.Join(InstallDir, "worker-host-id.ign"), device, mockbmclient, nil).Return(nil).Times(1)
+			mockops.EXPECT().WriteImageToDisk(gomock.Any(), filepath.Join(InstallDir, "worker-host-id.ign"), device, mockbmclient, nil).Return(nil).Times(1)
 			setBootOrderSuccess(gomock.Any())
 			// failure must do nothing
 			reportLogProgressSuccess()
-			mockops.EXPECT().UploadInstallationLogs(false).Return("", errors.Errorf("Dummy")).Times(1)
+			mockops.EXPECT().UploadInstallationLogs(false).Return("", errors.Errorf("Dummy")).Times(uploadLogsMaxAttempts)
 			ironicAgentDoesntExist()
 			rebootSuccess()
 			ret := installerObj.InstallNode()
 			Expect(ret).Should(BeNil())
 		})
-	})
-	Context("None HA mode ", func() {
+		It("day-2 worker doesn't wait for the masters", func() {
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role},
+				{string(models.HostStageInstalling), conf.Role},
+				{string(models.HostStageWritingImageToDisk)},
+				{string(models.HostStageRebooting)},
+			})
+			mockbmclient.EXPECT().GetCluster(gomock.Any(), false).Return(&models.Cluster{Kind: swag.String(models.ClusterKindAddHostsCluster)}, nil).Times(1)
+			mockbmclient.EXPECT().ListsHostsForRole(gomock.Any(), gomock.Any()).Times(0)
+			cleanInstallDevice()
+			mkdirSuccess(InstallDir)
+			downloadHostIgnitionSuccess(infraEnvId, hostId, "worker-host-id.ign")
+			mockops.EXPECT().WriteImageToDisk(gomock.Any(), filepath.Join(InstallDir, "worker-host-id.ign"), device, mockbmclient, nil).Return(nil).Times(1)
+			setBootOrderSuccess(gomock.Any())
+			reportLogProgressSuccess()
+			mockops.EXPECT().UploadInstallationLogs(false).Return("", nil).Times(1)
+			ironicAgentDoesntExist()
+			rebootSuccess()
+			Expect(installerObj.InstallNode()).To(Succeed())
+		})
+		It("worker install cancelled while waiting for masters doesn't reboot", func() {
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role},
+				{string(models.HostStageInstalling), conf.Role},
+				{string(models.HostStageWritingImageToDisk)},
+				{string(models.HostStageWaitingForControlPlane)},
+			})
+			ctx, cancel := context.WithCancel(context.Background())
+			mockbmclient.EXPECT().GetCluster(gomock.Any(), false).Return(&models.Cluster{}, nil).Times(1)
+			// masters never become ready, cancel the installation once it waits for them
+			mockbmclient.EXPECT().ListsHostsForRole(gomock.Any(), "master").DoAndReturn(
+				func(ctx2 context.Context, role string) (models.HostList, error) {
+					cancel()
+					return models.HostList{}, nil
+				}).MinTimes(1)
+			cleanInstallDevice()
+			mkdirSuccess(InstallDir)
+			downloadHostIgnitionSuccess(infraEnvId, hostId, "worker-host-id.ign")
+			mockops.EXPECT().WriteImageToDisk(gomock.Any(), filepath.Join(InstallDir, "worker-host-id.ign"), device, mockbmclient, nil).Return(nil).Times(1)
+			setBootOrderSuccess(gomock.Any())
+			ret := installerObj.InstallNodeWithContext(ctx)
+			Expect(ret).Should(Equal(context.Canceled))
+		})
+		It("worker install stuck waiting for masters trips the overall install timeout", func() {
+			timeoutConf := conf
+			timeoutConf.OverallInstallTimeout = 100 * time.Millisecond
+			installerObj = NewAssistedInstaller(l, timeoutConf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role},
+				{string(models.HostStageInstalling), conf.Role},
+				{string(models.HostStageWritingImageToDisk)},
+				{string(models.HostStageWaitingForControlPlane)},
+			})
+			mockbmclient.EXPECT().GetCluster(gomock.Any(), false).Return(&models.Cluster{}, nil).Times(1)
+			// masters never become ready
+			mockbmclient.EXPECT().ListsHostsForRole(gomock.Any(), "master").Return(models.HostList{}, nil).AnyTimes()
+			cleanInstallDevice()
+			mkdirSuccess(InstallDir)
+			downloadHostIgnitionSuccess(infraEnvId, hostId, "worker-host-id.ign")
+			mockops.EXPECT().WriteImageToDisk(gomock.Any(), filepath.Join(InstallDir, "worker-host-id.ign"), device, mockbmclient, nil).Return(nil).Times(1)
+			setBootOrderSuccess(gomock.Any())
+			err := installerObj.InstallNodeWithContext(context.Background())
+			Expect(errors.Is(err, ErrOverallInstallTimeout)).To(BeTrue())
+			Expect(err.Error()).To(HavePrefix("overall install timeout"))
+		})
+		It("worker install stuck writing the image trips the overall install timeout", func() {
+			timeoutConf := conf
+			timeoutConf.OverallInstallTimeout = 100 * time.Millisecond
+			installerObj = NewAssistedInstaller(l, timeoutConf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role},
+				{string(models.HostStageInstalling), conf.Role},
+				{string(models.HostStageWritingImageToDisk)},
+			})
+			cleanInstallDevice()
+			mkdirSuccess(InstallDir)
+			downloadHostIgnitionSuccess(infraEnvId, hostId, "worker-host-id.ign")
+			// coreos-installer hangs until its context is cancelled
+			mockops.EXPECT().WriteImageToDisk(gomock.Any(), filepath.Join(InstallDir, "worker-host-id.ign"), device, mockbmclient, nil).DoAndReturn(
+				func(ctx context.Context, ignitionPath string, device string, progressReporter inventory_client.InventoryClient, extra []string) error {
+					<-ctx.Done()
+					return ctx.Err()
+				}).Times(1)
+			err := installerObj.InstallNodeWithContext(context.Background())
+			Expect(errors.Is(err, ErrOverallInstallTimeout)).To(BeTrue())
+		})
+		It("worker install stuck writing the image trips the stage timeout", func() {
+			timeoutConf := conf
+			timeoutConf.StageTimeouts = config.StageTimeouts{models.HostStageWritingImageToDisk: 100 * time.Millisecond}
+			timeoutConf.DefaultStageTimeout = time.Hour
+			installerObj = NewAssistedInstaller(l, timeoutConf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role},
+				{string(models.HostStageInstalling), conf.Role},
+				{string(models.HostStageWritingImageToDisk)},
+			})
+			cleanInstallDevice()
+			mkdirSuccess(InstallDir)
+			downloadHostIgnitionSuccess(infraEnvId, hostId, "worker-host-id.ign")
+			// coreos-installer hangs until its context is cancelled
+			mockops.EXPECT().WriteImageToDisk(gomock.Any(), filepath.Join(InstallDir, "worker-host-id.ign"), device, mockbmclient, nil).DoAndReturn(
+				func(ctx context.Context, ignitionPath string, device string, progressReporter inventory_client.InventoryClient, extra []string) error {
+					<-ctx.Done()
+					return ctx.Err()
+				}).Times(1)
+			err := installerObj.InstallNodeWithContext(context.Background())
+			Expect(errors.Is(err, ErrStageTimeout)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("stage Writing image to disk didn't complete within 100ms"))
+		})
+		It("worker install stuck waiting for masters trips the stage timeout", func() {
+			timeoutConf := conf
+			timeoutConf.StageTimeouts = config.StageTimeouts{models.HostStageWaitingForControlPlane: 100 * time.Millisecond}
+			timeoutConf.DefaultStageTimeout = time.Hour
+			installerObj = NewAssistedInstaller(l, timeoutConf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role},
+				{string(models.HostStageInstalling), conf.Role},
+				{string(models.HostStageWritingImageToDisk)},
+				{string(models.HostStageWaitingForControlPlane)},
+			})
+			mockbmclient.EXPECT().GetCluster(gomock.Any(), false).Return(&models.Cluster{}, nil).Times(1)
+			// masters never become ready
+			mockbmclient.EXPECT().ListsHostsForRole(gomock.Any(), "master").Return(models.HostList{}, nil).AnyTimes()
+			cleanInstallDevice()
+			mkdirSuccess(InstallDir)
+			downloadHostIgnitionSuccess(infraEnvId, hostId, "worker-host-id.ign")
+			mockops.EXPECT().WriteImageToDisk(gomock.Any(), filepath.Join(InstallDir, "worker-host-id.ign"), device, mockbmclient, nil).Return(nil).Times(1)
+			setBootOrderSuccess(gomock.Any())
+			err := installerObj.InstallNodeWithContext(context.Background())
+			Expect(errors.Is(err, ErrStageTimeout)).To(BeTrue())
+			Expect(errors.Is(err, ErrOverallInstallTimeout)).To(BeFalse())
+			Expect(err.Error()).To(ContainSubstring("stage Waiting for control plane didn't complete within 100ms"))
+		})
+	})
+	Context("None HA mode ", func() {
 
 		conf := config.Config{Role: string(models.HostRoleMaster),
 			ClusterID:            "cluster-id",
@@ -760,16 +1610,21 @@ var _ = Describe("installer HostRoleMaster role", func() {
 		}
 		BeforeEach(func() {
 			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			requiredBinariesFound()
 			evaluateDiskSymlinkSuccess()
 		})
 		mcoImage := conf.MCOImage
+		readRegistriesConfSuccess := func() {
+			mockops.EXPECT().ReadHostFile(utils.RegistriesConfPath).Return("", nil).Times(1)
+		}
 		extractIgnitionToFS := func(out string, err error) {
-			mockops.EXPECT().ExecPrivilegeCommand(
-				gomock.Any(), "podman", "run", "--net", "host",
+			mockops.EXPECT().ExecPrivilegeCommandContext(
+				gomock.Any(), gomock.Any(), "podman", "run", "--net", "host",
 				"--pid=host",
 				"--volume", "/:/rootfs:rw",
 				"--volume", "/usr/bin/rpm-ostree:/usr/bin/rpm-ostree",
 				"--privileged",
+				"--authfile", config.DefaultDockerConfigPath,
 				"--entrypoint", "/usr/bin/machine-config-daemon",
 				mcoImage,
 				"start", "--node-name", "localhost", "--root-mount", "/rootfs", "--once-from",
@@ -785,12 +1640,19 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			}
 		}
 		restartNetworkManager := func(err error) {
-			mockops.EXPECT().SystemctlAction("restart", "NetworkManager.service").Return(err).Times(1)
+			if err != nil {
+				mockops.EXPECT().ReadHostFile("/etc/resolv.conf").Return(validResolvConf, nil).Times(1)
+				mockops.EXPECT().SystemctlAction("restart", "NetworkManager.service").Return(err).Times(systemctlMaxAttempts)
+				return
+			}
+			mockops.EXPECT().ReadHostFile("/etc/resolv.conf").Return(validResolvConf, nil).Times(2)
+			mockops.EXPECT().SystemctlAction("restart", "NetworkManager.service").Return(nil).Times(1)
 		}
 		startServicesSuccess := func() {
 			services := []string{"bootkube.service", "progress.service", "approve-csr.service"}
 			for i := range services {
 				mockops.EXPECT().SystemctlAction("start", services[i]).Return(nil).Times(1)
+				serviceIsActive(services[i])
 			}
 		}
 		prepareControllerSuccess := func() {
@@ -804,20 +1666,33 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			mockops.EXPECT().ExecPrivilegeCommand(gomock.Any(), "systemctl", "status", "bootkube.service").Return("1", nil).Times(1)
 		}
 		extractSecretFromIgnitionSuccess := func() {
-			mockops.EXPECT().ExtractFromIgnition(filepath.Join(InstallDir, bootstrapIgn), dockerConfigFile).Return(nil).Times(1)
+			mockops.EXPECT().ExtractFromIgnition(filepath.Join(InstallDir, bootstrapIgn), config.DefaultDockerConfigPath, config.DefaultDockerConfigPath).Return(nil).Times(1)
+			mockops.EXPECT().ReadHostFile(config.DefaultDockerConfigPath).Return(validPullSecret, nil).Times(1)
 		}
 		singleNodeBootstrapSetup := func() {
 			cleanInstallDevice()
 			mkdirSuccess(InstallDir)
-			mkdirSuccess(sshDir)
+			mkdirSuccess(config.DefaultSshDir)
 			downloadFileSuccess(bootstrapIgn)
 			extractSecretFromIgnitionSuccess()
+			readRegistriesConfSuccess()
 			extractIgnitionToFS("Success", nil)
 			daemonReload(nil)
 		}
 		verifySingleNodeMasterIgnitionSuccess := func() {
 			mockops.EXPECT().ExecPrivilegeCommand(gomock.Any(), "stat", singleNodeMasterIgnitionPath).Return("", nil).Times(1)
 		}
+		singleNodeHosts := func(cpuCores int64, memoryBytes int64) map[string]inventory_client.HostData {
+			id := strfmt.UUID(hostId)
+			return map[string]inventory_client.HostData{"node0": {Host: &models.Host{ID: &id},
+				Inventory: &models.Inventory{CPU: &models.CPU{Count: cpuCores}, Memory: &models.Memory{PhysicalBytes: memoryBytes}}}}
+		}
+		singleNodePreflight := func(hosts map[string]inventory_client.HostData) {
+			mockbmclient.EXPECT().GetEnabledHostsNamesHosts(gomock.Any(), gomock.Any()).Return(hosts, nil).Times(1)
+		}
+		singleNodePreflightSuccess := func() {
+			singleNodePreflight(singleNodeHosts(8, 16*1024*1024*1024))
+		}
 
 		It("single node happy flow", func() {
 			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role},
@@ -826,6 +1701,7 @@ var _ = Describe("installer HostRoleMaster role", func() {
 				{string(models.HostStageRebooting)},
 			})
 			// single node bootstrap flow
+			singleNodePreflightSuccess()
 			singleNodeBootstrapSetup()
 			checkLocalHostname("localhost", nil)
 			restartNetworkManager(nil)
@@ -837,7 +1713,7 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			verifySingleNodeMasterIgnitionSuccess()
 			singleNodeMergeIgnitionSuccess()
 			downloadHostIgnitionSuccess(infraEnvId, hostId, "master-host-id.ign")
-			mockops.EXPECT().WriteImageToDisk(singleNodeMasterIgnitionPath, device, mockbmclient, nil).Return(nil).Times(1)
+			mockops.EXPECT().WriteImageToDisk(gomock.Any(), singleNodeMasterIgnitionPath, device, mockbmclient, nil).Return(nil).Times(1)
 			setBootOrderSuccess(gomock.Any())
 			uploadLogsSuccess(true)
 			reportLogProgressSuccess()
@@ -851,6 +1727,7 @@ var _ = Describe("installer HostRoleMaster role", func() {
 				{string(models.HostStageInstalling), string(models.HostRoleMaster)},
 			})
 			// single node bootstrap flow
+			singleNodePreflightSuccess()
 			singleNodeBootstrapSetup()
 			checkLocalHostname("not localhost", nil)
 			err := fmt.Errorf("Failed to restart NetworkManager")
@@ -863,6 +1740,7 @@ var _ = Describe("installer HostRoleMaster role", func() {
 				{string(models.HostStageInstalling), string(models.HostRoleMaster)},
 			})
 			// single node bootstrap flow
+			singleNodePreflightSuccess()
 			singleNodeBootstrapSetup()
 			checkLocalHostname("localhost", nil)
 			restartNetworkManager(nil)
@@ -876,7 +1754,1344 @@ var _ = Describe("installer HostRoleMaster role", func() {
 			ret := installerObj.InstallNode()
 			Expect(ret).Should(Equal(err))
 		})
+		Context("preflight", func() {
+			failedPreflight := func(hosts map[string]inventory_client.HostData, message string) {
+				updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
+				singleNodePreflight(hosts)
+				// nothing else is expected, the node must not be touched
+				ret := installerObj.InstallNode()
+				Expect(ret).Should(HaveOccurred())
+				Expect(ret.Error()).Should(ContainSubstring(message))
+			}
+			It("fails when the cluster has more than one host", func() {
+				hosts := singleNodeHosts(8, 16*1024*1024*1024)
+				otherId := strfmt.UUID("7916fa89-ea7a-443e-a862-b3e930309f65")
+				hosts["node1"] = inventory_client.HostData{Host: &models.Host{ID: &otherId}}
+				failedPreflight(hosts, "exactly one enabled host but the cluster has 2")
+			})
+			It("fails when the host isn't the cluster host", func() {
+				otherId := strfmt.UUID("7916fa89-ea7a-443e-a862-b3e930309f65")
+				failedPreflight(map[string]inventory_client.HostData{"node1": {Host: &models.Host{ID: &otherId}}}, "is not the single host")
+			})
+			It("only warns when the host doesn't have enough CPU cores", func() {
+				singleNodePreflight(singleNodeHosts(4, 32*1024*1024*1024))
+				_, err := installerObj.runPreflightChecks()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(installerObj.warnings).To(ConsistOf("single node installation requires at least 8 CPU cores but the host has 4"))
+			})
+			It("only warns when the host doesn't have enough memory", func() {
+				singleNodePreflight(singleNodeHosts(8, 8*1024*1024*1024))
+				_, err := installerObj.runPreflightChecks()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(installerObj.warnings).To(ConsistOf("single node installation requires at least 16 GiB of memory but the host has 8.0 GiB"))
+			})
+			It("fails when the hosts can't be fetched", func() {
+				updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
+				mockbmclient.EXPECT().GetEnabledHostsNamesHosts(gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("dummy")).Times(1)
+				Expect(installerObj.InstallNode()).Should(HaveOccurred())
+			})
+		})
+	})
+	Context("Progress file", func() {
+		var tempDir string
+		BeforeEach(func() {
+			var err error
+			tempDir, err = ioutil.TempDir("", "progress")
+			Expect(err).NotTo(HaveOccurred())
+		})
+		AfterEach(func() {
+			os.RemoveAll(tempDir)
+		})
+		readProgressFile := func(path string) progressFile {
+			data, err := ioutil.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			var content progressFile
+			Expect(json.Unmarshal(data, &content)).To(Succeed())
+			return content
+		}
+
+		It("updated on each stage transition", func() {
+			progressPath := filepath.Join(tempDir, "progress.json")
+			conf := config.Config{InfraEnvID: infraEnvId, HostID: hostId, ProgressFilePath: progressPath}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), "master"},
+				{string(models.HostStageWritingImageToDisk), "50%"},
+			})
+
+			installerObj.UpdateHostInstallProgress(models.HostStageStartingInstallation, "master")
+			content := readProgressFile(progressPath)
+			Expect(content.Stage).To(Equal(models.HostStageStartingInstallation))
+			Expect(content.Info).To(Equal("master"))
+
+			installerObj.UpdateHostInstallProgress(models.HostStageWritingImageToDisk, "50%")
+			content = readProgressFile(progressPath)
+			Expect(content.Stage).To(Equal(models.HostStageWritingImageToDisk))
+			Expect(content.Info).To(Equal("50%"))
+		})
+
+		It("write failure doesn't fail the progress update", func() {
+			conf := config.Config{InfraEnvID: infraEnvId, HostID: hostId,
+				ProgressFilePath: filepath.Join(tempDir, "missing-dir", "progress.json")}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			updateProgressSuccess([][]string{{string(models.HostStageRebooting)}})
+			installerObj.UpdateHostInstallProgress(models.HostStageRebooting, "")
+		})
+	})
+	Context("Format no disks", func() {
+		It("logs that no disks are configured", func() {
+			logger, hook := test.NewNullLogger()
+			installerObj = NewAssistedInstaller(logger, config.Config{Device: device}, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			installerObj.FormatDisks()
+			Expect(hook.Entries).To(HaveLen(1))
+			Expect(hook.LastEntry().Level).To(Equal(logrus.InfoLevel))
+			Expect(hook.LastEntry().Message).To(Equal("No disks configured for formatting"))
+		})
+	})
+	Context("Format disks", func() {
+		BeforeEach(func() {
+			conf := config.Config{Device: device, DisksToFormat: config.ArrayFlags{"/dev/sdb", "/dev/disk/by-id/install-disk", "/dev/sdc"}}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			mockops.EXPECT().EvaluateDiskSymlink(device).Return(device).Times(1)
+			mockops.EXPECT().EvaluateDiskSymlink("/dev/sdb").Return("/dev/sdb").Times(1)
+			mockops.EXPECT().EvaluateDiskSymlink("/dev/disk/by-id/install-disk").Return(device).Times(1)
+			mockops.EXPECT().EvaluateDiskSymlink("/dev/sdc").Return("/dev/sdc").Times(1)
+		})
+
+		It("skips the installation device", func() {
+			mockops.EXPECT().GetMountPoints("/dev/sdb").Return(nil, nil).Times(1)
+			mockops.EXPECT().GetMountPoints("/dev/sdc").Return(nil, nil).Times(1)
+			mockops.EXPECT().FormatDisk("/dev/sdb").Return(nil).Times(1)
+			mockops.EXPECT().FormatDisk("/dev/sdc").Return(nil).Times(1)
+			installerObj.FormatDisks()
+		})
+
+		It("skips mounted disks", func() {
+			mockops.EXPECT().GetMountPoints("/dev/sdb").Return([]string{"/var"}, nil).Times(1)
+			mockops.EXPECT().GetMountPoints("/dev/sdc").Return(nil, nil).Times(1)
+			mockops.EXPECT().FormatDisk("/dev/sdc").Return(nil).Times(1)
+			installerObj.FormatDisks()
+		})
+
+		It("skips disks whose mount points can't be verified", func() {
+			mockops.EXPECT().GetMountPoints("/dev/sdb").Return(nil, fmt.Errorf("dummy")).Times(1)
+			mockops.EXPECT().GetMountPoints("/dev/sdc").Return(nil, nil).Times(1)
+			mockops.EXPECT().FormatDisk("/dev/sdc").Return(fmt.Errorf("dummy")).Times(1)
+			installerObj.FormatDisks()
+		})
+
+		It("skips empty disks when configured", func() {
+			installerObj.SkipFormattingEmptyDisks = true
+			mockops.EXPECT().GetMountPoints("/dev/sdb").Return(nil, nil).Times(1)
+			mockops.EXPECT().GetMountPoints("/dev/sdc").Return(nil, nil).Times(1)
+			mockops.EXPECT().IsDiskEmpty("/dev/sdb").Return(true, nil).Times(1)
+			mockops.EXPECT().IsDiskEmpty("/dev/sdc").Return(false, nil).Times(1)
+			mockops.EXPECT().FormatDisk("/dev/sdc").Return(nil).Times(1)
+			installerObj.FormatDisks()
+		})
+
+		It("formats disks that can't be checked for being empty", func() {
+			installerObj.SkipFormattingEmptyDisks = true
+			mockops.EXPECT().GetMountPoints("/dev/sdb").Return(nil, nil).Times(1)
+			mockops.EXPECT().GetMountPoints("/dev/sdc").Return(nil, nil).Times(1)
+			mockops.EXPECT().IsDiskEmpty("/dev/sdb").Return(false, fmt.Errorf("dummy")).Times(1)
+			mockops.EXPECT().IsDiskEmpty("/dev/sdc").Return(true, nil).Times(1)
+			mockops.EXPECT().FormatDisk("/dev/sdb").Return(nil).Times(1)
+			installerObj.FormatDisks()
+		})
+
+		It("logs the outcome of every disk", func() {
+			logger, hook := test.NewNullLogger()
+			installerObj.log = logger
+			mockops.EXPECT().GetMountPoints("/dev/sdb").Return(nil, nil).Times(1)
+			mockops.EXPECT().GetMountPoints("/dev/sdc").Return(nil, nil).Times(1)
+			mockops.EXPECT().FormatDisk("/dev/sdb").Return(nil).Times(1)
+			mockops.EXPECT().FormatDisk("/dev/sdc").Return(fmt.Errorf("dummy")).Times(1)
+			installerObj.FormatDisks()
+			var messages []string
+			for _, entry := range hook.AllEntries() {
+				messages = append(messages, entry.Message)
+			}
+			Expect(messages).To(Equal([]string{
+				"3 disks requested for formatting: /dev/sdb, /dev/disk/by-id/install-disk, /dev/sdc",
+				"Formatted disk /dev/sdb",
+				"Refusing to format disk /dev/disk/by-id/install-disk",
+				"Failed to format disk /dev/sdc, err dummy",
+				"Formatted 1 of the 3 disks requested for formatting",
+			}))
+		})
+
+		It("formats empty disks by default", func() {
+			mockops.EXPECT().GetMountPoints("/dev/sdb").Return(nil, nil).Times(1)
+			mockops.EXPECT().GetMountPoints("/dev/sdc").Return(nil, nil).Times(1)
+			mockops.EXPECT().IsDiskEmpty(gomock.Any()).Times(0)
+			mockops.EXPECT().FormatDisk("/dev/sdb").Return(nil).Times(1)
+			mockops.EXPECT().FormatDisk("/dev/sdc").Return(nil).Times(1)
+			installerObj.FormatDisks()
+		})
+	})
+	Context("Logs sink", func() {
+		var tempDir string
+		BeforeEach(func() {
+			var err error
+			tempDir, err = ioutil.TempDir("", "logs-sink")
+			Expect(err).NotTo(HaveOccurred())
+		})
+		AfterEach(func() {
+			os.RemoveAll(tempDir)
+		})
+
+		It("local-dir sink writes the journal to files", func() {
+			logsDir := filepath.Join(tempDir, "logs")
+			conf := config.Config{HostID: hostId, LogsSink: config.LogsSinkLocalDir, LogsSinkDir: logsDir}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			mockops.EXPECT().ExecPrivilegeCommand(gomock.Any(), "journalctl", "--no-pager", "-b").Return("journal content", nil).Times(1)
+			mockops.EXPECT().ExecPrivilegeCommand(gomock.Any(), "journalctl", "--no-pager", "-b", "-u", "bootkube.service").Return("bootkube content", nil).Times(1)
+
+			Expect(installerObj.uploadInstallationLogs(true)).To(Succeed())
+			data, err := ioutil.ReadFile(filepath.Join(logsDir, "host-id_journal.log"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("journal content"))
+			data, err = ioutil.ReadFile(filepath.Join(logsDir, "host-id_bootkube.log"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("bootkube content"))
+		})
+
+		It("local-dir sink fails to collect the journal", func() {
+			conf := config.Config{HostID: hostId, LogsSink: config.LogsSinkLocalDir, LogsSinkDir: tempDir}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			mockops.EXPECT().ExecPrivilegeCommand(gomock.Any(), "journalctl", "--no-pager", "-b").Return("", fmt.Errorf("dummy")).Times(1)
+
+			Expect(installerObj.uploadInstallationLogs(false)).NotTo(Succeed())
+			files, err := ioutil.ReadDir(tempDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(BeEmpty())
+		})
+
+		It("upload retried with an increasing interval after transient failures", func() {
+			conf := config.Config{HostID: hostId}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			var attempts []time.Time
+			mockops.EXPECT().UploadInstallationLogs(false).DoAndReturn(func(bool) (string, error) {
+				attempts = append(attempts, time.Now())
+				if len(attempts) < uploadLogsMaxAttempts {
+					return "", fmt.Errorf("dummy")
+				}
+				return "dummy", nil
+			}).Times(uploadLogsMaxAttempts)
+			Expect(installerObj.uploadInstallationLogsWithRetry(false)).To(Succeed())
+			Expect(attempts[1].Sub(attempts[0])).To(BeNumerically(">=", uploadLogsRetryInterval))
+			Expect(attempts[2].Sub(attempts[1])).To(BeNumerically(">=", 2*uploadLogsRetryInterval))
+		})
+
+		It("upload gives up after all attempts fail", func() {
+			conf := config.Config{HostID: hostId}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			mockops.EXPECT().UploadInstallationLogs(true).Return("", fmt.Errorf("dummy")).Times(uploadLogsMaxAttempts)
+			err := installerObj.uploadInstallationLogsWithRetry(true)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("dummy"))
+		})
+
+		It("service sink uses the logs sender", func() {
+			conf := config.Config{HostID: hostId, LogsSink: config.LogsSinkService}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			uploadLogsSuccess(false)
+			Expect(installerObj.uploadInstallationLogs(false)).To(Succeed())
+		})
+
+		It("waits for the service to confirm the logs", func() {
+			confirmLogsUploadInterval = time.Millisecond
+			conf := config.Config{HostID: hostId, InfraEnvID: infraEnvId, ConfirmLogsUploadTimeout: time.Second}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			gomock.InOrder(
+				mockbmclient.EXPECT().GetHost(gomock.Any(), infraEnvId, hostId).Return(nil, fmt.Errorf("dummy")).Times(1),
+				mockbmclient.EXPECT().GetHost(gomock.Any(), infraEnvId, hostId).Return(&models.Host{LogsInfo: models.LogsStateRequested}, nil).Times(1),
+				mockbmclient.EXPECT().GetHost(gomock.Any(), infraEnvId, hostId).Return(&models.Host{LogsInfo: models.LogsStateCompleted}, nil).Times(1),
+			)
+			installerObj.confirmLogsUpload(context.Background())
+			Expect(installerObj.installResult().Warnings).To(BeEmpty())
+		})
+
+		It("reboots with a warning when the confirmation times out", func() {
+			confirmLogsUploadInterval = time.Millisecond
+			conf := config.Config{HostID: hostId, InfraEnvID: infraEnvId, ConfirmLogsUploadTimeout: 20 * time.Millisecond}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			mockbmclient.EXPECT().GetHost(gomock.Any(), infraEnvId, hostId).Return(&models.Host{LogsInfo: models.LogsStateRequested}, nil).MinTimes(1)
+			installerObj.confirmLogsUpload(context.Background())
+			Expect(installerObj.installResult().Warnings).To(ConsistOf(ContainSubstring("didn't confirm it received the installation logs")))
+		})
+
+		It("doesn't wait for a confirmation of logs that aren't sent to the service", func() {
+			conf := config.Config{HostID: hostId, LogsSink: config.LogsSinkLocalDir, ConfirmLogsUploadTimeout: time.Second}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			installerObj.confirmLogsUpload(context.Background())
+		})
+	})
+	Context("Stage change callback", func() {
+		type transition struct {
+			oldStage models.HostStage
+			newStage models.HostStage
+			info     string
+		}
+		BeforeEach(func() {
+			conf := config.Config{InfraEnvID: infraEnvId, HostID: hostId}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+		})
+
+		It("invoked on stage transitions", func() {
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), "master"},
+				{string(models.HostStageWaitingForControlPlane), waitingForBootstrapToPrepare},
+				{string(models.HostStageWaitingForControlPlane), waitingForMastersStatusInfo},
+				{string(models.HostStageRebooting)},
+			})
+			var transitions []transition
+			installerObj.OnStageChange(func(oldStage, newStage models.HostStage, info string) {
+				transitions = append(transitions, transition{oldStage: oldStage, newStage: newStage, info: info})
+			})
+
+			installerObj.UpdateHostInstallProgress(models.HostStageStartingInstallation, "master")
+			installerObj.UpdateHostInstallProgress(models.HostStageWaitingForControlPlane, waitingForBootstrapToPrepare)
+			installerObj.UpdateHostInstallProgress(models.HostStageWaitingForControlPlane, waitingForMastersStatusInfo)
+			installerObj.UpdateHostInstallProgress(models.HostStageRebooting, "")
+
+			Expect(transitions).To(Equal([]transition{
+				{oldStage: "", newStage: models.HostStageStartingInstallation, info: "master"},
+				{oldStage: models.HostStageStartingInstallation, newStage: models.HostStageWaitingForControlPlane, info: waitingForBootstrapToPrepare},
+				{oldStage: models.HostStageWaitingForControlPlane, newStage: models.HostStageRebooting, info: ""},
+			}))
+		})
+
+		It("measures the time spent in every stage", func() {
+			fakeClock := utils.NewFakeClock(time.Now())
+			installerObj.clock = fakeClock
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), "bootstrap"},
+				{string(models.HostStageWaitingForControlPlane), waitingForBootstrapToPrepare},
+				{string(models.HostStageWaitingForControlPlane), waitingForMastersStatusInfo},
+			})
+
+			installerObj.UpdateHostInstallProgress(models.HostStageStartingInstallation, "bootstrap")
+			fakeClock.Step(time.Minute)
+			installerObj.UpdateHostInstallProgress(models.HostStageWaitingForControlPlane, waitingForBootstrapToPrepare)
+			fakeClock.Step(time.Minute)
+			installerObj.UpdateHostInstallProgress(models.HostStageWaitingForControlPlane, waitingForMastersStatusInfo)
+			fakeClock.Step(time.Minute)
+
+			Expect(installerObj.installResult().StageDurations).To(Equal(map[models.HostStage]time.Duration{
+				models.HostStageStartingInstallation:   time.Minute,
+				models.HostStageWaitingForControlPlane: 2 * time.Minute,
+			}))
+		})
+
+		It("no callback registered", func() {
+			updateProgressSuccess([][]string{{string(models.HostStageRebooting)}})
+			installerObj.OnStageChange(nil)
+			installerObj.UpdateHostInstallProgress(models.HostStageRebooting, "")
+		})
+	})
+	Context("systemctl retries", func() {
+		BeforeEach(func() {
+			installerObj = NewAssistedInstaller(l, config.Config{}, mockops, mockbmclient, k8sBuilder, mockIgnition)
+		})
+
+		It("transient daemon-reload failure succeeds on retry", func() {
+			gomock.InOrder(
+				mockops.EXPECT().SystemctlAction("daemon-reload").Return(fmt.Errorf("Failed to connect to bus")).Times(1),
+				mockops.EXPECT().SystemctlAction("daemon-reload").Return(nil).Times(1),
+			)
+			Expect(installerObj.systemctlWithRetry("daemon-reload")).To(Succeed())
+		})
+
+		It("returns the last error once the attempts are exhausted", func() {
+			err := fmt.Errorf("Failed to connect to bus")
+			mockops.EXPECT().SystemctlAction("restart", "NetworkManager.service").Return(err).Times(systemctlMaxAttempts)
+			Expect(installerObj.systemctlWithRetry("restart", "NetworkManager.service")).To(Equal(err))
+		})
+	})
+	Context("resolv.conf after NetworkManager restart", func() {
+		BeforeEach(func() {
+			installerObj = NewAssistedInstaller(l, config.Config{}, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			resolvConfSettleTimeout = 20 * time.Millisecond
+		})
+
+		It("restores the snapshot when resolv.conf ends up empty", func() {
+			mockops.EXPECT().ReadHostFile("/etc/resolv.conf").Return("", nil).MinTimes(1)
+			mockops.EXPECT().WriteHostFile("/etc/resolv.conf", validResolvConf).Return(nil).Times(1)
+			installerObj.ensureResolvConf(validResolvConf)
+		})
+
+		It("restores the snapshot when resolv.conf has no nameservers", func() {
+			mockops.EXPECT().ReadHostFile("/etc/resolv.conf").Return("search example.com\n", nil).MinTimes(1)
+			mockops.EXPECT().WriteHostFile("/etc/resolv.conf", validResolvConf).Return(nil).Times(1)
+			installerObj.ensureResolvConf(validResolvConf)
+		})
+
+		It("keeps resolv.conf once nameservers show up", func() {
+			gomock.InOrder(
+				mockops.EXPECT().ReadHostFile("/etc/resolv.conf").Return("", nil).Times(1),
+				mockops.EXPECT().ReadHostFile("/etc/resolv.conf").Return("nameserver 10.0.0.1\n", nil).Times(1),
+			)
+			installerObj.ensureResolvConf(validResolvConf)
+		})
+
+		It("doesn't restore a snapshot without nameservers", func() {
+			installerObj.ensureResolvConf("")
+		})
+	})
+	Context("stubbed masters wait", func() {
+		conf := config.Config{Role: string(models.HostRoleWorker),
+			ClusterID:  "cluster-id",
+			InfraEnvID: "infra-env-id",
+			HostID:     "host-id",
+		}
+		stubbedInstaller := func(dryRun bool, outcome string) *installer {
+			stubbedConf := conf
+			stubbedConf.DryRunEnabled = dryRun
+			stubbedConf.DryMastersWaitOutcome = outcome
+			return NewAssistedInstaller(l, stubbedConf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+		}
+		It("ends the wait without a control plane in dry run", func() {
+			updateProgressSuccess([][]string{{string(models.HostStageWaitingForControlPlane)}})
+			mockbmclient.EXPECT().GetCluster(gomock.Any(), gomock.Any()).Times(0)
+			mockbmclient.EXPECT().ListsHostsForRole(gomock.Any(), gomock.Any()).Times(0)
+			Expect(stubbedInstaller(true, config.DryMastersWaitReady).workerWaitFor2ReadyMasters(context.Background())).To(Succeed())
+		})
+		It("fails the wait in dry run", func() {
+			updateProgressSuccess([][]string{{string(models.HostStageWaitingForControlPlane)}})
+			err := stubbedInstaller(true, config.DryMastersWaitFailed).workerWaitFor2ReadyMasters(context.Background())
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("stubbed wait for ready masters failed"))
+		})
+		It("is ignored outside of dry run", func() {
+			mockbmclient.EXPECT().GetCluster(gomock.Any(), false).Return(&models.Cluster{Kind: swag.String(models.ClusterKindAddHostsCluster)}, nil).Times(1)
+			Expect(stubbedInstaller(false, config.DryMastersWaitFailed).workerWaitFor2ReadyMasters(context.Background())).To(Succeed())
+		})
+	})
+	Context("preserved devices", func() {
+		It("matches the preserved devices and their partitions", func() {
+			preserved := []string{"/dev/sdb", "/dev/nvme0n1", "/dev/sdc2"}
+			for _, device := range []string{"/dev/sdb", "/dev/sdb1", "/dev/nvme0n1", "/dev/nvme0n1p3", "/dev/sdc2"} {
+				Expect(isPreservedDevice(device, preserved)).To(BeTrue(), device)
+			}
+			for _, device := range []string{"/dev/sda", "/dev/sdba", "/dev/nvme0n10", "/dev/sdc", "/dev/sdc1"} {
+				Expect(isPreservedDevice(device, preserved)).To(BeFalse(), device)
+			}
+		})
+	})
+	Context("SSH paths", func() {
+		It("generates the key pair and manifest under the overridden paths", func() {
+			conf := config.Config{SshDir: "/tmp/ssh", SshManifestPath: "/tmp/manifests/99-ssh.yaml"}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			mockops.EXPECT().ExecPrivilegeCommand(nil, "ssh-keygen", "-y", "-f", "/tmp/ssh/id_rsa").Return("", fmt.Errorf("No such file or directory")).Times(1)
+			mockops.EXPECT().ExecPrivilegeCommand(nil, "rm", "-f", "/tmp/ssh/id_rsa", "/tmp/ssh/id_rsa.pub").Return("", nil).Times(1)
+			mockops.EXPECT().ExecPrivilegeCommand(gomock.Any(), "ssh-keygen", "-q", "-f", "/tmp/ssh/id_rsa", "-N", "").Return("OK", nil).Times(1)
+			mockops.EXPECT().CreateOpenshiftSshManifest("/tmp/manifests/99-ssh.yaml", sshManifestTmpl, "/tmp/ssh/id_rsa.pub").Return(nil).Times(1)
+			Expect(installerObj.setupBootstrapSsh()).To(Succeed())
+		})
+	})
+	Context("docker config path", func() {
+		const dockerConfigPath = "/etc/containers/auth.json"
+		var conf config.Config
+
+		BeforeEach(func() {
+			conf = config.Config{MCOImage: "mco-image", DockerConfigPath: dockerConfigPath}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+		})
+
+		It("extracts the pull secret to the configured path", func() {
+			mockops.EXPECT().Mkdir(config.DefaultSshDir).Return(nil).Times(1)
+			downloadFileSuccess("bootstrap.ign")
+			mockops.EXPECT().ExtractFromIgnition(filepath.Join(InstallDir, "bootstrap.ign"), config.DefaultDockerConfigPath, dockerConfigPath).
+				Return(fmt.Errorf("dummy")).Times(1)
+			Expect(installerObj.startBootstrap(context.Background())).To(HaveOccurred())
+		})
+		It("fails on a malformed pull secret", func() {
+			mockops.EXPECT().Mkdir(config.DefaultSshDir).Return(nil).Times(1)
+			downloadFileSuccess("bootstrap.ign")
+			mockops.EXPECT().ExtractFromIgnition(filepath.Join(InstallDir, "bootstrap.ign"), config.DefaultDockerConfigPath, dockerConfigPath).
+				Return(nil).Times(1)
+			mockops.EXPECT().ReadHostFile(dockerConfigPath).Return(`{"auths":`, nil).Times(1)
+			err := installerObj.startBootstrap(context.Background())
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("pull secret extracted to /etc/containers/auth.json: is not valid JSON"))
+		})
+		It("stops once the installation is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			mockops.EXPECT().Mkdir(config.DefaultSshDir).Return(nil).Times(1)
+			downloadFileSuccess("bootstrap.ign")
+			mockops.EXPECT().ExtractFromIgnition(filepath.Join(InstallDir, "bootstrap.ign"), config.DefaultDockerConfigPath, dockerConfigPath).
+				Return(nil).Times(1)
+			mockops.EXPECT().ReadHostFile(dockerConfigPath).Return(`{"auths":{"quay.io":{"auth":"dXNlcjpwYXNz"}}}`, nil).Times(1)
+			mockops.EXPECT().ExecPrivilegeCommandContext(gomock.Any(), gomock.Any(), "podman", gomock.Any()).Times(0)
+			Expect(installerObj.startBootstrap(ctx)).To(Equal(context.Canceled))
+		})
+		It("pulls the MCO image with the configured path", func() {
+			mockops.EXPECT().ReadHostFile(utils.RegistriesConfPath).Return("", nil).Times(1)
+			mockops.EXPECT().ExecPrivilegeCommandContext(
+				gomock.Any(), gomock.Any(), "podman", "run", "--net", "host",
+				"--pid=host",
+				"--volume", "/:/rootfs:rw",
+				"--volume", "/usr/bin/rpm-ostree:/usr/bin/rpm-ostree",
+				"--privileged",
+				"--authfile", dockerConfigPath,
+				"--entrypoint", "/usr/bin/machine-config-daemon",
+				"mco-image",
+				"start", "--node-name", "localhost", "--root-mount", "/rootfs", "--once-from",
+				"/opt/install-dir/bootstrap.ign", "--skip-reboot").Return("", nil).Times(1)
+			Expect(installerObj.extractIgnitionToFS(context.Background(), "/opt/install-dir/bootstrap.ign")).To(Succeed())
+		})
+		It("reports running out of memory without retrying", func() {
+			mockops.EXPECT().ReadHostFile(utils.RegistriesConfPath).Return("", nil).Times(1)
+			mockops.EXPECT().ExecPrivilegeCommandContext(gomock.Any(), gomock.Any(), "podman", gomock.Any()).
+				Return("", &ops.ExecCommandError{Command: "podman", WaitStatus: oomKilledExitCode}).Times(1)
+			mockops.EXPECT().ReadHostFile(memInfoPath).Return("MemTotal:        4030464 kB\nMemFree:          102400 kB\nMemAvailable:     209715 kB\n", nil).Times(1)
+			err := installerObj.extractIgnitionToFS(context.Background(), "/opt/install-dir/bootstrap.ign")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HavePrefix("ran out of memory extracting ignition, host memory: MemTotal 3.8 GiB, MemAvailable 0.2 GiB"))
+		})
+	})
+	Context("required binaries", func() {
+		It("reports all the missing binaries before touching the node", func() {
+			conf := config.Config{Role: string(models.HostRoleBootstrap), InfraEnvID: infraEnvId, HostID: hostId, Device: device,
+				HighAvailabilityMode: models.ClusterHighAvailabilityModeFull}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
+			requiredBinariesFound("podman", "ssh-keygen")
+			err := installerObj.InstallNode()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("missing required host executables: podman, ssh-keygen"))
+		})
+		It("only requires the bootstrap binaries on the bootstrap", func() {
+			installerObj = NewAssistedInstaller(l, config.Config{Role: string(models.HostRoleWorker)}, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			Expect(installerObj.requiredBinaries()).NotTo(ContainElement("podman"))
+			installerObj = NewAssistedInstaller(l, config.Config{Role: string(models.HostRoleMaster), HighAvailabilityMode: models.ClusterHighAvailabilityModeNone},
+				mockops, mockbmclient, k8sBuilder, mockIgnition)
+			Expect(installerObj.requiredBinaries()).To(ContainElement("podman"))
+			Expect(installerObj.requiredBinaries()).NotTo(ContainElement("ssh-keygen"))
+		})
+	})
+	Context("preflight report", func() {
+		readReport := func(upfile io.Reader) preflightReport {
+			gz, err := gzip.NewReader(upfile)
+			Expect(err).NotTo(HaveOccurred())
+			tr := tar.NewReader(gz)
+			header, err := tr.Next()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(header.Name).To(Equal("preflight_report.json"))
+			var report preflightReport
+			Expect(json.NewDecoder(tr).Decode(&report)).To(Succeed())
+			return report
+		}
+
+		It("uploads the report of the failed preflight checks before failing", func() {
+			conf := config.Config{Role: string(models.HostRoleMaster), ClusterID: "cluster-id", InfraEnvID: infraEnvId, HostID: hostId, Device: device,
+				HighAvailabilityMode: models.ClusterHighAvailabilityModeFull, UploadPreflightReport: true, CACertPath: "/nonexistent/ca.crt"}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
+			requiredBinariesFound("wipefs")
+			mockops.EXPECT().ExecPrivilegeCommand(nil, "lsblk", "--paths", "--output", diskInventoryColumns).Return("/dev/vda disk 120G", nil).Times(1)
+			mockops.EXPECT().ExecPrivilegeCommand(nil, "ip", "-brief", "address").Return("", fmt.Errorf("dummy")).Times(1)
+			var report preflightReport
+			mockbmclient.EXPECT().UploadHostLogs(gomock.Any(), "cluster-id", infraEnvId, hostId, gomock.Any()).DoAndReturn(
+				func(ctx context.Context, clusterId, infraEnvId, hostId string, upfile io.Reader) error {
+					report = readReport(upfile)
+					return nil
+				}).Times(1)
+
+			err := installerObj.InstallNode()
+			Expect(err).To(MatchError("missing required host executables: wipefs"))
+			Expect(report.HostID).To(Equal(hostId))
+			Expect(report.Device).To(Equal(device))
+			Expect(report.Checks).To(Equal([]preflightCheck{{Name: "required binaries", Error: "missing required host executables: wipefs"}}))
+			Expect(report.Disks).To(Equal("/dev/vda disk 120G"))
+			Expect(report.Errors).To(ConsistOf(ContainSubstring("failed to list network addresses")))
+			Expect(report.Certificates).To(HaveLen(1))
+			Expect(report.Certificates[0].Path).To(Equal("/nonexistent/ca.crt"))
+			Expect(report.Certificates[0].Error).NotTo(BeEmpty())
+		})
+
+		reportUploaded := func() {
+			mockops.EXPECT().ExecPrivilegeCommand(nil, "lsblk", "--paths", "--output", diskInventoryColumns).Return("/dev/vda disk 120G", nil).Times(1)
+			mockops.EXPECT().ExecPrivilegeCommand(nil, "ip", "-brief", "address").Return("eth0 UP 192.168.126.10/24", nil).Times(1)
+			mockbmclient.EXPECT().UploadHostLogs(gomock.Any(), "cluster-id", infraEnvId, hostId, gomock.Any()).Return(nil).Times(1)
+		}
+
+		It("adds the report to the installation logs written after it", func() {
+			tempDir, err := ioutil.TempDir("", "logs")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(tempDir)
+			conf := config.Config{ClusterID: "cluster-id", InfraEnvID: infraEnvId, HostID: hostId, Device: device,
+				UploadPreflightReport: true, LogsSink: config.LogsSinkLocalDir, LogsSinkDir: tempDir}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			reportUploaded()
+			mockops.EXPECT().ExecPrivilegeCommand(gomock.Any(), "journalctl", "--no-pager", "-b").Return("journal", nil).Times(1)
+
+			installerObj.uploadPreflightReport([]preflightCheck{{Name: "required binaries"}})
+			Expect(installerObj.uploadInstallationLogs(false)).To(Succeed())
+			content, err := ioutil.ReadFile(filepath.Join(tempDir, fmt.Sprintf("%s_%s", hostId, preflightReportFileName)))
+			Expect(err).NotTo(HaveOccurred())
+			var report preflightReport
+			Expect(json.Unmarshal(content, &report)).To(Succeed())
+			Expect(report.Checks).To(Equal([]preflightCheck{{Name: "required binaries"}}))
+		})
+
+		It("logs the report for the logs sender that replaces it on the service", func() {
+			logger, hook := test.NewNullLogger()
+			conf := config.Config{ClusterID: "cluster-id", InfraEnvID: infraEnvId, HostID: hostId, Device: device, UploadPreflightReport: true}
+			installerObj = NewAssistedInstaller(logger, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			reportUploaded()
+			mockops.EXPECT().UploadInstallationLogs(false).DoAndReturn(func(bool) (string, error) {
+				Expect(hook.LastEntry().Message).To(And(HavePrefix("Preflight report:"), ContainSubstring(`"name": "required binaries"`)))
+				return "", nil
+			}).Times(1)
+
+			installerObj.uploadPreflightReport([]preflightCheck{{Name: "required binaries"}})
+			Expect(installerObj.uploadInstallationLogs(false)).To(Succeed())
+		})
+
+		It("reports the outcome of the passed preflight checks", func() {
+			conf := config.Config{Role: string(models.HostRoleWorker), InfraEnvID: infraEnvId, HostID: hostId, Device: device}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			requiredBinariesFound()
+			evaluateDiskSymlinkSuccess()
+			checks, err := installerObj.runPreflightChecks()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(checks).To(Equal([]preflightCheck{{Name: "required binaries"}, {Name: "installation device"}, {Name: "etcd device"}}))
+		})
+	})
+	Context("registry mirrors", func() {
+		It("logs the mirror the image is pulled through", func() {
+			logger, hook := test.NewNullLogger()
+			installerObj = NewAssistedInstaller(logger, config.Config{MCOImage: "quay.io/openshift-release-dev/ocp-v4.0-art-dev@sha256:1234"},
+				mockops, mockbmclient, k8sBuilder, mockIgnition)
+			registriesConf := "[[registry]]\nlocation = \"quay.io/openshift-release-dev/ocp-v4.0-art-dev\"\n" +
+				"[[registry.mirror]]\nlocation = \"mirror.example.com:5000/ocp4/openshift4\"\n"
+			mockops.EXPECT().ReadHostFile("/etc/containers/registries.conf").Return(registriesConf, nil).Times(1)
+			mockops.EXPECT().ExecPrivilegeCommandContext(gomock.Any(), gomock.Any(), "podman", gomock.Any()).Return("", nil).Times(1)
+			Expect(installerObj.extractIgnitionToFS(context.Background(), "/opt/install-dir/bootstrap.ign")).To(Succeed())
+			Expect(hook.Entries).To(ContainElement(HaveField("Message",
+				"Pulling quay.io/openshift-release-dev/ocp-v4.0-art-dev@sha256:1234 through the mirrors mirror.example.com:5000/ocp4/openshift4")))
+		})
+	})
+	Context("additional trust bundle", func() {
+		const bundle = "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"
+		var tempDir string
+		BeforeEach(func() {
+			var err error
+			tempDir, err = ioutil.TempDir("", "trust-bundle")
+			Expect(err).NotTo(HaveOccurred())
+			mockops.EXPECT().ReadHostFile("/etc/containers/registries.conf").Return("", nil).AnyTimes()
+		})
+		AfterEach(func() {
+			os.RemoveAll(tempDir)
+		})
+		writeFile := func(name, content string) string {
+			path := filepath.Join(tempDir, name)
+			Expect(ioutil.WriteFile(path, []byte(content), 0600)).To(Succeed())
+			return path
+		}
+		trustedBeforePull := func() {
+			gomock.InOrder(
+				mockops.EXPECT().WriteHostFile("/etc/pki/ca-trust/source/anchors/assisted-installer-ca.crt", bundle).Return(nil).Times(1),
+				mockops.EXPECT().ExecPrivilegeCommand(gomock.Any(), "update-ca-trust", "extract").Return("", nil).Times(1),
+				mockops.EXPECT().ExecPrivilegeCommandContext(gomock.Any(), gomock.Any(), "podman", gomock.Any()).Return("", nil).Times(1),
+			)
+		}
+
+		It("trusts the configured CA before pulling the MCO image", func() {
+			conf := config.Config{AdditionalTrustBundlePath: writeFile("ca.crt", bundle)}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			trustedBeforePull()
+			Expect(installerObj.extractIgnitionToFS(context.Background(), filepath.Join(tempDir, "bootstrap.ign"))).To(Succeed())
+		})
+
+		It("trusts the CA of the ignition before pulling the MCO image", func() {
+			ignitionPath := writeFile("bootstrap.ign", fmt.Sprintf(`{"ignition": {"version": "3.1.0"}, "storage": {"files": [{"path": "/etc/pki/ca-trust/source/anchors/ca.crt", "contents": {"source": "data:text/plain;charset=utf-8;base64,%s"}}]}}`,
+				base64.StdEncoding.EncodeToString([]byte(bundle))))
+			installerObj = NewAssistedInstaller(l, config.Config{}, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			trustedBeforePull()
+			Expect(installerObj.extractIgnitionToFS(context.Background(), ignitionPath)).To(Succeed())
+		})
+
+		It("pulls without updating the trust store when there is no additional CA", func() {
+			ignitionPath := writeFile("bootstrap.ign", `{"ignition": {"version": "3.1.0"}}`)
+			installerObj = NewAssistedInstaller(l, config.Config{}, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			mockops.EXPECT().ExecPrivilegeCommandContext(gomock.Any(), gomock.Any(), "podman", gomock.Any()).Return("", nil).Times(1)
+			Expect(installerObj.extractIgnitionToFS(context.Background(), ignitionPath)).To(Succeed())
+		})
+
+		It("fails before pulling when the configured CA isn't a certificate", func() {
+			conf := config.Config{AdditionalTrustBundlePath: writeFile("ca.crt", "not a certificate")}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			err := installerObj.extractIgnitionToFS(context.Background(), filepath.Join(tempDir, "bootstrap.ign"))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("has no PEM certificate"))
+		})
+	})
+	Context("pull secret validation", func() {
+		It("accepts a pull secret with registry auths", func() {
+			unusable, err := validatePullSecret(validPullSecret)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(unusable).To(BeEmpty())
+		})
+		It("accepts identity tokens and username and password credentials", func() {
+			unusable, err := validatePullSecret(`{"auths":{"quay.io":{"identitytoken":"token"},"registry.example.com":{"username":"user","password":"pass"}}}`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(unusable).To(BeEmpty())
+		})
+		It("returns the registries without usable credentials", func() {
+			unusable, err := validatePullSecret(`{"auths":{"quay.io":{"auth":"dXNlcjpwYXNz"},"registry.example.com":{},"mirror.example.com":{"auth":"dXNlcg=="}}}`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(unusable).To(Equal([]string{"mirror.example.com", "registry.example.com"}))
+		})
+		It("rejects malformed pull secrets", func() {
+			for content, expected := range map[string]string{
+				"":                                     "is not valid JSON",
+				"not json":                             "is not valid JSON",
+				`{}`:                                   "has no registry auths",
+				`{"auths":{}}`:                         "has no registry auths",
+				`{"auths":{"quay.io":{}}}`:             "has no usable registry auth",
+				`{"auths":{"quay.io":{"auth":"%%%"}}}`: "has no usable registry auth",
+				`{"auths":{"quay.io":{"auth":"dXNlcg=="}}}`: "has no usable registry auth",
+				`{"auths":{"quay.io":{"username":"user"}}}`: "has no usable registry auth",
+			} {
+				_, err := validatePullSecret(content)
+				Expect(err).To(HaveOccurred(), content)
+				Expect(err.Error()).To(Equal(expected), content)
+			}
+		})
+	})
+	Context("existing SSH key pair", func() {
+		const pubKey = "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQC7"
+		keyPath := config.DefaultSshDir + "/id_rsa"
+		pubKeyPath := keyPath + ".pub"
+
+		generateSshKeyPairSuccess := func() {
+			mockops.EXPECT().ExecPrivilegeCommand(nil, "rm", "-f", keyPath, pubKeyPath).Return("", nil).Times(1)
+			mockops.EXPECT().ExecPrivilegeCommand(gomock.Any(), "ssh-keygen", "-q", "-f", keyPath, "-N", "").Return("OK", nil).Times(1)
+		}
+
+		It("skips generation when a valid key pair exists", func() {
+			installerObj = NewAssistedInstaller(l, config.Config{}, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			mockops.EXPECT().ExecPrivilegeCommand(nil, "ssh-keygen", "-y", "-f", keyPath).Return(pubKey, nil).Times(1)
+			mockops.EXPECT().ReadHostFile(pubKeyPath).Return(pubKey+" root@bootstrap\n", nil).Times(1)
+			Expect(installerObj.generateSshKeyPair()).To(Succeed())
+		})
+
+		It("regenerates when the public key doesn't match", func() {
+			installerObj = NewAssistedInstaller(l, config.Config{}, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			mockops.EXPECT().ExecPrivilegeCommand(nil, "ssh-keygen", "-y", "-f", keyPath).Return(pubKey, nil).Times(1)
+			mockops.EXPECT().ReadHostFile(pubKeyPath).Return("ssh-rsa AAAAother root@bootstrap", nil).Times(1)
+			generateSshKeyPairSuccess()
+			Expect(installerObj.generateSshKeyPair()).To(Succeed())
+		})
 
+		It("regenerates when the public key is missing", func() {
+			installerObj = NewAssistedInstaller(l, config.Config{}, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			mockops.EXPECT().ExecPrivilegeCommand(nil, "ssh-keygen", "-y", "-f", keyPath).Return(pubKey, nil).Times(1)
+			mockops.EXPECT().ReadHostFile(pubKeyPath).Return("", fmt.Errorf("No such file or directory")).Times(1)
+			generateSshKeyPairSuccess()
+			Expect(installerObj.generateSshKeyPair()).To(Succeed())
+		})
+
+		It("regenerates an existing key pair when forced", func() {
+			installerObj = NewAssistedInstaller(l, config.Config{ForceSshKeyGeneration: true}, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			generateSshKeyPairSuccess()
+			Expect(installerObj.generateSshKeyPair()).To(Succeed())
+		})
+
+		It("fails when the existing key pair can't be removed", func() {
+			installerObj = NewAssistedInstaller(l, config.Config{ForceSshKeyGeneration: true}, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			err := fmt.Errorf("Permission denied")
+			mockops.EXPECT().ExecPrivilegeCommand(nil, "rm", "-f", keyPath, pubKeyPath).Return("", err).Times(1)
+			Expect(installerObj.generateSshKeyPair()).To(Equal(err))
+		})
+	})
+	Context("Bootstrap services", func() {
+		It("starts the default services", func() {
+			installerObj = NewAssistedInstaller(l, config.Config{}, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			var calls []*gomock.Call
+			for _, service := range config.DefaultBootstrapServices {
+				calls = append(calls, mockops.EXPECT().SystemctlAction("start", service).Return(nil).Times(1))
+			}
+			gomock.InOrder(calls...)
+			for _, service := range config.DefaultBootstrapServices {
+				serviceIsActive(service)
+			}
+			Expect(installerObj.startBootstrapServices()).To(Succeed())
+		})
+
+		It("starts the configured services in order", func() {
+			conf := config.Config{BootstrapServices: config.ArrayFlags{"custom-before.service", "bootkube.service", "progress.service"}}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			gomock.InOrder(
+				mockops.EXPECT().SystemctlAction("start", "custom-before.service").Return(nil).Times(1),
+				mockops.EXPECT().SystemctlAction("start", "bootkube.service").Return(nil).Times(1),
+				mockops.EXPECT().SystemctlAction("start", "progress.service").Return(nil).Times(1),
+			)
+			serviceIsActive("custom-before.service")
+			serviceIsActive("bootkube.service")
+			serviceIsActive("progress.service")
+			Expect(installerObj.startBootstrapServices()).To(Succeed())
+		})
+
+		It("stops at the first service that fails to start", func() {
+			conf := config.Config{BootstrapServices: config.ArrayFlags{"bootkube.service", "progress.service"}}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			mockops.EXPECT().SystemctlAction("start", "bootkube.service").Return(fmt.Errorf("failed")).Times(1)
+			Expect(installerObj.startBootstrapServices()).NotTo(Succeed())
+		})
+
+		It("fails when a service fails right after starting", func() {
+			conf := config.Config{BootstrapServices: config.ArrayFlags{"bootkube.service", "progress.service"}}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			mockops.EXPECT().SystemctlAction("start", "bootkube.service").Return(nil).Times(1)
+			mockops.EXPECT().SystemctlAction("start", "progress.service").Return(nil).Times(1)
+			serviceIsActive("bootkube.service")
+			gomock.InOrder(
+				mockops.EXPECT().ExecPrivilegeCommand(gomock.Any(), "systemctl", "is-active", "progress.service").Return("activating", fmt.Errorf("exit status 3")).Times(2),
+				mockops.EXPECT().ExecPrivilegeCommand(gomock.Any(), "systemctl", "is-active", "progress.service").Return("failed", fmt.Errorf("exit status 3")).Times(1),
+			)
+			err := installerObj.startBootstrapServices()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("service progress.service failed"))
+		})
+
+		It("accepts a oneshot service that already completed", func() {
+			conf := config.Config{BootstrapServices: config.ArrayFlags{"release-image.service"}}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			mockops.EXPECT().SystemctlAction("start", "release-image.service").Return(nil).Times(1)
+			mockops.EXPECT().ExecPrivilegeCommand(gomock.Any(), "systemctl", "is-active", "release-image.service").Return("inactive", fmt.Errorf("exit status 3")).Times(1)
+			mockops.EXPECT().ExecPrivilegeCommand(gomock.Any(), "systemctl", "show", "release-image.service",
+				"--property=Result", "--property=ExecMainStatus", "--property=ExecMainStartTimestampMonotonic").
+				Return("Result=success\nExecMainStatus=0\nExecMainStartTimestampMonotonic=123456789\n", nil).Times(1)
+			Expect(installerObj.startBootstrapServices()).To(Succeed())
+		})
+
+		It("fails when a oneshot service exited with an error", func() {
+			serviceActiveTimeout = 50 * time.Millisecond
+			defer func() { serviceActiveTimeout = 30 * time.Second }()
+			conf := config.Config{BootstrapServices: config.ArrayFlags{"release-image.service"}}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			mockops.EXPECT().SystemctlAction("start", "release-image.service").Return(nil).Times(1)
+			mockops.EXPECT().ExecPrivilegeCommand(gomock.Any(), "systemctl", "is-active", "release-image.service").Return("inactive", fmt.Errorf("exit status 3")).MinTimes(1)
+			mockops.EXPECT().ExecPrivilegeCommand(gomock.Any(), "systemctl", "show", "release-image.service",
+				"--property=Result", "--property=ExecMainStatus", "--property=ExecMainStartTimestampMonotonic").
+				Return("Result=exit-code\nExecMainStatus=1\nExecMainStartTimestampMonotonic=123456789\n", nil).MinTimes(1)
+			Expect(installerObj.startBootstrapServices()).NotTo(Succeed())
+		})
+
+		It("fails when a service doesn't become active in time", func() {
+			serviceActiveTimeout = 50 * time.Millisecond
+			defer func() { serviceActiveTimeout = 30 * time.Second }()
+			conf := config.Config{BootstrapServices: config.ArrayFlags{"bootkube.service"}}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			mockops.EXPECT().SystemctlAction("start", "bootkube.service").Return(nil).Times(1)
+			mockops.EXPECT().ExecPrivilegeCommand(gomock.Any(), "systemctl", "is-active", "bootkube.service").Return("inactive", fmt.Errorf("exit status 3")).MinTimes(2)
+			mockops.EXPECT().ExecPrivilegeCommand(gomock.Any(), "systemctl", "show", "bootkube.service",
+				"--property=Result", "--property=ExecMainStatus", "--property=ExecMainStartTimestampMonotonic").
+				Return("Result=success\nExecMainStatus=0\nExecMainStartTimestampMonotonic=0", nil).MinTimes(2)
+			err := installerObj.startBootstrapServices()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("service bootkube.service did not become active"))
+		})
+	})
+	Context("Fake clock", func() {
+		var fakeClock *utils.FakeClock
+		BeforeEach(func() {
+			conf := config.Config{InfraEnvID: infraEnvId, HostID: hostId}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			fakeClock = utils.NewFakeClock(time.Now())
+			installerObj.clock = fakeClock
+		})
+
+		It("waitForBootkube checks bootkube only when the clock moves", func() {
+			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), infraEnvId, hostId, models.HostStageWaitingForBootkube, "").Return(nil).Times(1)
+			statCalls := 0
+			mockops.EXPECT().ExecPrivilegeCommand(gomock.Any(), "stat", "/opt/openshift/.bootkube.done").DoAndReturn(
+				func(liveLogger io.Writer, command string, args ...string) (string, error) {
+					statCalls++
+					if statCalls < 3 {
+						return "", fmt.Errorf("no such file")
+					}
+					return "OK", nil
+				}).Times(3)
+			mockops.EXPECT().ExecPrivilegeCommand(gomock.Any(), "systemctl", "status", "bootkube.service").Return("1", nil).Times(1)
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				installerObj.waitForBootkube(context.Background())
+			}()
+			for i := 0; i < 3; i++ {
+				Eventually(fakeClock.HasWaiters).Should(BeTrue())
+				Consistently(done, 20*time.Millisecond).ShouldNot(BeClosed())
+				fakeClock.Step(generalWaitInterval)
+			}
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("updateConfiguringStatus polls at the configured interval", func() {
+			installerObj.Config.ConfiguringStatusInterval = time.Minute
+			polled := make(chan struct{}, 10)
+			mockbmclient.EXPECT().GetEnabledHostsNamesHosts(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, log logrus.FieldLogger) (map[string]inventory_client.HostData, error) {
+					polled <- struct{}{}
+					return nil, fmt.Errorf("dummy")
+				}).AnyTimes()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				installerObj.updateConfiguringStatus(ctx)
+			}()
+			Eventually(fakeClock.HasWaiters).Should(BeTrue())
+			fakeClock.Step(defaultConfiguringStatusInterval)
+			Consistently(polled, 20*time.Millisecond).ShouldNot(Receive())
+			fakeClock.Step(time.Minute - defaultConfiguringStatusInterval)
+			Eventually(polled).Should(Receive())
+			cancel()
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("waitForBootkube stops on context cancel", func() {
+			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), infraEnvId, hostId, models.HostStageWaitingForBootkube, "").Return(nil).Times(1)
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				installerObj.waitForBootkube(ctx)
+			}()
+			Eventually(fakeClock.HasWaiters).Should(BeTrue())
+			cancel()
+			Eventually(done).Should(BeClosed())
+		})
+	})
+	Context("high availability mode", func() {
+		validate := func(role models.HostRole, haMode string) error {
+			installerObj = NewAssistedInstaller(l, config.Config{Role: string(role), HighAvailabilityMode: haMode}, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			return installerObj.validateHighAvailabilityMode()
+		}
+		It("accepts the coherent role and mode combinations", func() {
+			Expect(validate(models.HostRoleMaster, models.ClusterHighAvailabilityModeFull)).To(Succeed())
+			Expect(validate(models.HostRoleMaster, models.ClusterHighAvailabilityModeNone)).To(Succeed())
+			Expect(validate(models.HostRoleBootstrap, models.ClusterHighAvailabilityModeFull)).To(Succeed())
+			Expect(validate(models.HostRoleWorker, "")).To(Succeed())
+			Expect(validate(models.HostRoleWorker, models.ClusterHighAvailabilityModeFull)).To(Succeed())
+		})
+		It("fails early on a master without a mode", func() {
+			conf := config.Config{Role: string(models.HostRoleMaster), InfraEnvID: infraEnvId, HostID: hostId, Device: device}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
+			err := installerObj.InstallNode()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal(`role master requires high-availability-mode Full or None, got ""`))
+		})
+		It("rejects unknown modes and roles", func() {
+			Expect(validate(models.HostRoleBootstrap, "Partial")).To(HaveOccurred())
+			Expect(validate(models.HostRoleAutoAssign, models.ClusterHighAvailabilityModeFull)).To(HaveOccurred())
+		})
+	})
+	Context("write image to disk", func() {
+		It("retries a transient write failure", func() {
+			installerObj = NewAssistedInstaller(l, config.Config{InfraEnvID: infraEnvId, HostID: hostId, Device: device}, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			updateProgressSuccess([][]string{{string(models.HostStageWritingImageToDisk)}})
+			gomock.InOrder(
+				mockops.EXPECT().WriteImageToDisk(gomock.Any(), "master.ign", device, mockbmclient, nil).Return(fmt.Errorf("No such file or directory")).Times(1),
+				mockops.EXPECT().WriteImageToDisk(gomock.Any(), "master.ign", device, mockbmclient, nil).Return(nil).Times(1),
+			)
+			Expect(installerObj.writeImageToDisk(context.Background(), "master.ign")).To(Succeed())
+		})
+	})
+	Context("not ready masters", func() {
+		It("logs why a master isn't counted as ready", func() {
+			logger, hook := test.NewNullLogger()
+			logger.SetLevel(logrus.DebugLevel)
+			installerObj = NewAssistedInstaller(logger, config.Config{}, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			nodes := GetKubeNodes(map[string]string{"node0": "7916fa89-ea7a-443e-a862-b3e930309f65"})
+			nodes.Items[0].Status.Conditions = []v1.NodeCondition{
+				{Type: v1.NodeReady, Status: v1.ConditionFalse, Reason: "KubeletNotReady", Message: "container runtime network not ready"},
+			}
+			var readyMasters []string
+			Expect(installerObj.updateReadyMasters(nodes, &readyMasters, inventoryNamesHost)).To(Succeed())
+			Expect(readyMasters).To(BeEmpty())
+			Expect(hook.Entries).To(ContainElement(HaveField("Message",
+				"Master node node0 isn't ready: Ready=False (KubeletNotReady: container runtime network not ready)")))
+		})
+		It("doesn't count masters missing the configured conditions", func() {
+			installerObj = NewAssistedInstaller(l, config.Config{NodeReadyConditions: config.ArrayFlags{"DiskPressure=False"}}, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			Expect(installerObj.setNodeReadiness()).To(Succeed())
+			nodes := GetKubeNodes(map[string]string{"node0": "7916fa89-ea7a-443e-a862-b3e930309f65"})
+			nodes.Items[0].Status.Conditions = append(nodes.Items[0].Status.Conditions, v1.NodeCondition{Type: v1.NodeDiskPressure, Status: v1.ConditionTrue})
+			var readyMasters []string
+			Expect(installerObj.updateReadyMasters(nodes, &readyMasters, inventoryNamesHost)).To(Succeed())
+			Expect(readyMasters).To(BeEmpty())
+		})
+	})
+	Context("unmatched nodes", func() {
+		var (
+			logger *logrus.Logger
+			hook   *test.Hook
+		)
+		updateUnmatchedMaster := func(policy string) ([]string, error) {
+			logger, hook = test.NewNullLogger()
+			logger.SetLevel(logrus.DebugLevel)
+			installerObj = NewAssistedInstaller(logger, config.Config{UnmatchedNodePolicy: policy}, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			nodes := GetKubeNodes(map[string]string{"external-node": "7916fa89-ea7a-443e-a862-b3e930309f65"})
+			var readyMasters []string
+			err := installerObj.updateReadyMasters(nodes, &readyMasters, map[string]inventory_client.HostData{})
+			return readyMasters, err
+		}
+
+		It("fails on a ready master that matches no inventory host by default", func() {
+			for _, policy := range []string{"", config.UnmatchedNodePolicyError} {
+				_, err := updateUnmatchedMaster(policy)
+				Expect(err).To(MatchError("Node external-node is not in inventory hosts"), policy)
+			}
+		})
+
+		It("warns about a ready master that matches no inventory host", func() {
+			readyMasters, err := updateUnmatchedMaster(config.UnmatchedNodePolicyWarn)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(readyMasters).To(Equal([]string{"external-node"}))
+			Expect(hook.Entries).To(ContainElement(And(HaveField("Level", logrus.WarnLevel),
+				HaveField("Message", "Node external-node is not in inventory hosts, not updating its installation status"))))
+		})
+
+		It("ignores a ready master that matches no inventory host", func() {
+			readyMasters, err := updateUnmatchedMaster(config.UnmatchedNodePolicyIgnore)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(readyMasters).To(Equal([]string{"external-node"}))
+			for _, entry := range hook.AllEntries() {
+				Expect(entry.Level).NotTo(BeNumerically("<=", logrus.WarnLevel), entry.Message)
+			}
+		})
+	})
+	Context("duplicate system UUIDs", func() {
+		It("reports masters sharing a system UUID once", func() {
+			logger, hook := test.NewNullLogger()
+			installerObj = NewAssistedInstaller(logger, config.Config{}, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			nodes := GetKubeNodes(map[string]string{"node0": "7916fa89-ea7a-443e-a862-b3e930309f65", "node1": "7916fa89-ea7a-443e-a862-b3e930309f65"})
+			for j := range nodes.Items {
+				nodes.Items[j].Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionFalse}}
+			}
+			var readyMasters []string
+			Expect(installerObj.updateReadyMasters(nodes, &readyMasters, inventoryNamesHost)).To(Succeed())
+			Expect(installerObj.updateReadyMasters(nodes, &readyMasters, inventoryNamesHost)).To(Succeed())
+			message := "nodes node0, node1 report the same system UUID 7916fa89-ea7a-443e-a862-b3e930309f65, they were probably cloned from the same VM"
+			Expect(installerObj.installResult().Warnings).To(Equal([]string{message}))
+			Expect(hook.Entries).To(ContainElement(And(HaveField("Message", message), HaveField("Level", logrus.ErrorLevel))))
+		})
+	})
+	Context("five masters topology", func() {
+		conf := config.Config{Role: string(models.HostRoleMaster), InfraEnvID: infraEnvId, HostID: hostId,
+			HighAvailabilityMode: models.ClusterHighAvailabilityModeFull, MasterCount: 5, MinReadyMasters: 4, OpenshiftVersion: "4.6"}
+		doneMasters := func(count int) models.HostList {
+			hosts := models.HostList{}
+			for j := 0; j < count; j++ {
+				hosts = append(hosts, &models.Host{Role: models.HostRoleMaster, Progress: &models.HostProgressInfo{CurrentStage: models.HostStageDone}})
+			}
+			return hosts
+		}
+
+		It("patches the control plane replicas to the minimum until enough masters are ready", func() {
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			hostsMap := map[string]inventory_client.HostData{}
+			kubeNodes := map[string]string{}
+			for j := 0; j < 4; j++ {
+				id := strfmt.UUID(uuid.New().String())
+				name := fmt.Sprintf("master-%d", j)
+				hostsMap[name] = inventory_client.HostData{Host: &models.Host{InfraEnvID: strfmt.UUID(infraEnvId), ID: &id}}
+				kubeNodes[name] = id.String()
+			}
+			threeNodes := map[string]string{"master-0": kubeNodes["master-0"], "master-1": kubeNodes["master-1"], "master-2": kubeNodes["master-2"]}
+			mockk8sclient.EXPECT().GetNetworkType().Return(ovnKubernetes, nil).Times(2)
+			mockk8sclient.EXPECT().GetControlPlaneReplicas().Return(5, nil).Times(1)
+			mockk8sclient.EXPECT().PatchControlPlaneReplicas(4).Return(nil).Times(1)
+			mockbmclient.EXPECT().GetEnabledHostsNamesHosts(gomock.Any(), gomock.Any()).Return(hostsMap, nil).Times(1)
+			gomock.InOrder(
+				mockk8sclient.EXPECT().ListMasterNodes().Return(GetKubeNodes(threeNodes), nil).Times(1),
+				mockk8sclient.EXPECT().ListMasterNodes().Return(GetKubeNodes(kubeNodes), nil).Times(1),
+			)
+			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), infraEnvId, gomock.Any(), models.HostStageJoined, "").Times(4)
+			mockk8sclient.EXPECT().UnPatchControlPlaneReplicas(5).Return(nil).Times(1)
+			Expect(installerObj.waitForMinMasterNodes(context.Background(), mockk8sclient)).To(Succeed())
+		})
+		It("doesn't patch control plane replicas that don't match the master count", func() {
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			mockk8sclient.EXPECT().GetNetworkType().Return(ovnKubernetes, nil).Times(2)
+			mockk8sclient.EXPECT().GetControlPlaneReplicas().Return(3, nil).Times(1)
+			Expect(installerObj.shouldControlPlaneReplicasPatchApplied(mockk8sclient)).To(BeFalse())
+		})
+		It("keeps the workers waiting until the minimum of masters is done", func() {
+			workerConf := conf
+			workerConf.Role = string(models.HostRoleWorker)
+			installerObj = NewAssistedInstaller(l, workerConf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			updateProgressSuccess([][]string{{string(models.HostStageWaitingForControlPlane)}})
+			mockbmclient.EXPECT().GetCluster(gomock.Any(), false).Return(&models.Cluster{}, nil).Times(1)
+			gomock.InOrder(
+				mockbmclient.EXPECT().ListsHostsForRole(gomock.Any(), "master").Return(doneMasters(3), nil).Times(1),
+				mockbmclient.EXPECT().ListsHostsForRole(gomock.Any(), "master").Return(doneMasters(4), nil).Times(1),
+			)
+			Expect(installerObj.workerWaitFor2ReadyMasters(context.Background())).To(Succeed())
+		})
+		It("rejects a minimum larger than the master count", func() {
+			invalidConf := conf
+			invalidConf.MinReadyMasters = 6
+			installerObj = NewAssistedInstaller(l, invalidConf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			Expect(installerObj.validateHighAvailabilityMode()).To(MatchError("min-ready-masters 6 is larger than master-count 5"))
+		})
+	})
+	Context("configuring filtered stages", func() {
+		hostsInStages := func() map[string]inventory_client.HostData {
+			return map[string]inventory_client.HostData{
+				"rebooting":   {Host: &models.Host{Progress: &models.HostProgressInfo{CurrentStage: models.HostStageRebooting}}},
+				"configuring": {Host: &models.Host{Progress: &models.HostProgressInfo{CurrentStage: models.HostStageConfiguring}}},
+				"done":        {Host: &models.Host{Progress: &models.HostProgressInfo{CurrentStage: models.HostStageDone}}},
+			}
+		}
+
+		It("filters the default stages", func() {
+			installerObj = NewAssistedInstaller(l, config.Config{}, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			hostsMap := hostsInStages()
+			installerObj.filterAlreadyUpdatedHosts(hostsMap)
+			Expect(hostsMap).To(HaveLen(1))
+			Expect(hostsMap).To(HaveKey("rebooting"))
+		})
+
+		It("filters the configured stages instead of the default ones", func() {
+			conf := config.Config{ConfiguringFilteredStages: config.ArrayFlags{string(models.HostStageRebooting)}}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			hostsMap := hostsInStages()
+			installerObj.filterAlreadyUpdatedHosts(hostsMap)
+			Expect(hostsMap).To(HaveLen(2))
+			Expect(hostsMap).To(HaveKey("configuring"))
+			Expect(hostsMap).To(HaveKey("done"))
+		})
+	})
+
+	Context("stage timeouts", func() {
+		var (
+			i         *installer
+			fakeClock *utils.FakeClock
+			ctx       context.Context
+			cancel    context.CancelFunc
+			done      chan struct{}
+		)
+
+		BeforeEach(func() {
+			i = NewAssistedInstaller(l, config.Config{
+				StageTimeouts:       config.StageTimeouts{models.HostStageInstalling: time.Minute},
+				DefaultStageTimeout: time.Hour,
+			}, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			fakeClock = utils.NewFakeClock(time.Now())
+			i.clock = fakeClock
+			ctx, cancel = context.WithCancel(context.Background())
+			done = make(chan struct{})
+			go func() {
+				defer close(done)
+				i.enforceStageTimeouts(ctx, cancel)
+			}()
+		})
+
+		AfterEach(func() {
+			cancel()
+			Eventually(done).Should(BeClosed())
+		})
+
+		// moveToStage waits for the watchdog to arm the timer of the new stage
+		moveToStage := func(stage models.HostStage) {
+			i.notifyStageChange(stage, "")
+			Eventually(fakeClock.HasWaiters).Should(BeTrue())
+		}
+
+		It("fails a stage exceeding its specific timeout", func() {
+			moveToStage(models.HostStageInstalling)
+			fakeClock.Step(time.Minute)
+			Eventually(ctx.Done()).Should(BeClosed())
+			Expect(i.getTimedOutStage()).To(Equal(models.HostStageInstalling))
+		})
+
+		It("falls back to the default timeout for other stages", func() {
+			moveToStage(models.HostStageWritingImageToDisk)
+			fakeClock.Step(time.Minute)
+			Consistently(ctx.Done(), 50*time.Millisecond).ShouldNot(BeClosed())
+			fakeClock.Step(time.Hour)
+			Eventually(ctx.Done()).Should(BeClosed())
+			Expect(i.getTimedOutStage()).To(Equal(models.HostStageWritingImageToDisk))
+		})
+
+		It("restarts the timeout when the stage changes", func() {
+			moveToStage(models.HostStageInstalling)
+			fakeClock.Step(50 * time.Second)
+			moveToStage(models.HostStageWritingImageToDisk)
+			fakeClock.Step(50 * time.Second)
+			Consistently(ctx.Done(), 50*time.Millisecond).ShouldNot(BeClosed())
+			Expect(i.getTimedOutStage()).To(BeEmpty())
+		})
+	})
+
+	Context("partition installation device", func() {
+		partition := device + "4"
+		conf := config.Config{Role: string(models.HostRoleMaster),
+			ClusterID:            "cluster-id",
+			InfraEnvID:           "infra-env-id",
+			HostID:               "host-id",
+			Device:               partition,
+			HighAvailabilityMode: models.ClusterHighAvailabilityModeFull,
+		}
+		BeforeEach(func() {
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+		})
+		It("fails the preflight before cleaning or writing the partition", func() {
+			requiredBinariesFound()
+			mockops.EXPECT().EvaluateDiskSymlink(partition).Return(partition).Times(1)
+			mockops.EXPECT().GetPartitionParent(partition).Return(device, nil).Times(1)
+			updateProgressSuccess([][]string{{string(models.HostStageStartingInstallation), conf.Role}})
+			mockops.EXPECT().Wipefs(gomock.Any()).Times(0)
+			mockops.EXPECT().WriteImageToDisk(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			ret := installerObj.InstallNode()
+			Expect(ret).Should(HaveOccurred())
+			Expect(ret.Error()).Should(Equal(fmt.Sprintf("installation device %s is a partition of %s, the image can only be written to a whole disk", partition, device)))
+		})
+		It("handles the device as a whole disk when it can't be checked", func() {
+			mockops.EXPECT().GetPartitionParent(partition).Return("", fmt.Errorf("no such file or directory")).Times(1)
+			Expect(installerObj.validateInstallDevice()).To(Succeed())
+		})
+	})
+
+	Context("inventory hosts map", func() {
+		It("doesn't modify the inventory map other goroutines iterate", func() {
+			installerObj = NewAssistedInstaller(l, config.Config{HostID: hostId}, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			currentHostID := strfmt.UUID(hostId)
+			inventoryHosts := map[string]inventory_client.HostData{"node0": {Host: &models.Host{ID: &currentHostID}}}
+			for j := 1; j < 10; j++ {
+				id := strfmt.UUID(uuid.New().String())
+				inventoryHosts[fmt.Sprintf("node%d", j)] = inventory_client.HostData{Host: &models.Host{ID: &id}}
+			}
+			mockbmclient.EXPECT().GetEnabledHostsNamesHosts(gomock.Any(), gomock.Any()).Return(inventoryHosts, nil).AnyTimes()
+
+			var wg sync.WaitGroup
+			for j := 0; j < 5; j++ {
+				wg.Add(2)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+					hostsMap, err := installerObj.getInventoryHostsMap(nil)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(hostsMap).To(HaveLen(9))
+					Expect(hostsMap).NotTo(HaveKey("node0"))
+				}()
+				go func() {
+					defer wg.Done()
+					for range inventoryHosts {
+					}
+				}()
+			}
+			wg.Wait()
+			Expect(inventoryHosts).To(HaveLen(10))
+		})
+	})
+	Context("file download timeout", func() {
+		blockingDownload := func(ctx context.Context, filename string, dest string) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		BeforeEach(func() {
+			installerObj = NewAssistedInstaller(l, config.Config{FileDownloadTimeout: 10 * time.Millisecond}, mockops, mockbmclient, k8sBuilder, mockIgnition)
+		})
+
+		It("cancels a stuck download and retries it", func() {
+			gomock.InOrder(
+				mockbmclient.EXPECT().DownloadFile(gomock.Any(), "bootstrap.ign", filepath.Join(InstallDir, "bootstrap.ign")).DoAndReturn(blockingDownload).Times(1),
+				mockbmclient.EXPECT().DownloadFile(gomock.Any(), "bootstrap.ign", filepath.Join(InstallDir, "bootstrap.ign")).Return(nil).Times(1),
+			)
+			Expect(installerObj.getFileFromService(context.Background(), "bootstrap.ign")).To(Equal(filepath.Join(InstallDir, "bootstrap.ign")))
+		})
+		It("fails when every attempt times out", func() {
+			mockbmclient.EXPECT().DownloadFile(gomock.Any(), "bootstrap.ign", gomock.Any()).DoAndReturn(blockingDownload).Times(downloadTimeoutAttempts)
+			_, err := installerObj.getFileFromService(context.Background(), "bootstrap.ign")
+			Expect(err).To(Equal(context.DeadlineExceeded))
+		})
+		It("doesn't retry a file that isn't found", func() {
+			mockbmclient.EXPECT().DownloadFile(gomock.Any(), "bootstrap.ign", gomock.Any()).Return(
+				&inventory_client.DownloadError{File: "bootstrap.ign", StatusCode: http.StatusNotFound, Err: fmt.Errorf("not found")}).Times(1)
+			_, err := installerObj.getFileFromService(context.Background(), "bootstrap.ign")
+			var downloadErr *inventory_client.DownloadError
+			Expect(errors.As(err, &downloadErr)).To(BeTrue())
+			Expect(downloadErr.StatusCode).To(Equal(http.StatusNotFound))
+		})
+		It("doesn't retry other errors", func() {
+			mockbmclient.EXPECT().DownloadFile(gomock.Any(), "bootstrap.ign", gomock.Any()).Return(fmt.Errorf("not found")).Times(1)
+			_, err := installerObj.getFileFromService(context.Background(), "bootstrap.ign")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Context("clock skew", func() {
+		It("accepts a skew within the tolerance", func() {
+			logger, hook := test.NewNullLogger()
+			mockbmclient.EXPECT().GetServiceTime(gomock.Any()).Return(time.Now().Add(-30*time.Second), nil).Times(1)
+			Expect(checkClockSkew(context.Background(), mockbmclient, 2*time.Minute, true, logger)).To(Succeed())
+			Expect(hook.Entries).To(BeEmpty())
+		})
+		It("warns about a skew above the tolerance", func() {
+			logger, hook := test.NewNullLogger()
+			mockbmclient.EXPECT().GetServiceTime(gomock.Any()).Return(time.Now().Add(10*time.Minute), nil).Times(1)
+			Expect(checkClockSkew(context.Background(), mockbmclient, 2*time.Minute, false, logger)).To(Succeed())
+			Expect(hook.LastEntry().Level).To(Equal(logrus.WarnLevel))
+			Expect(hook.LastEntry().Message).To(HavePrefix("host clock is 10m0s away from the service clock"))
+		})
+		It("fails on a skew above the tolerance when requested", func() {
+			mockbmclient.EXPECT().GetServiceTime(gomock.Any()).Return(time.Now().Add(-10*time.Minute), nil).Times(1)
+			err := checkClockSkew(context.Background(), mockbmclient, 2*time.Minute, true, l)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("more than the allowed 2m0s"))
+		})
+		It("doesn't fail when the service time is unavailable", func() {
+			mockbmclient.EXPECT().GetServiceTime(gomock.Any()).Return(time.Time{}, fmt.Errorf("connection refused")).Times(1)
+			Expect(checkClockSkew(context.Background(), mockbmclient, 2*time.Minute, true, l)).To(Succeed())
+		})
+	})
+	Context("ListNodes backoff", func() {
+		BeforeEach(func() {
+			conf := config.Config{InfraEnvID: infraEnvId, HostID: hostId}
+			installerObj = NewAssistedInstaller(l, conf, mockops, mockbmclient, k8sBuilder, mockIgnition)
+			listNodesBackoffMax = 40 * time.Millisecond
+		})
+		AfterEach(func() {
+			listNodesBackoffMax = 1 * time.Minute
+		})
+
+		It("backs off while the API server is unavailable", func() {
+			outage := 150 * time.Millisecond
+			start := time.Now()
+			var failedCalls []time.Time
+			mockbmclient.EXPECT().GetEnabledHostsNamesHosts(gomock.Any(), gomock.Any()).Return(inventoryNamesHost, nil).AnyTimes()
+			mockk8sclient.EXPECT().ListMasterNodes().DoAndReturn(func() (*v1.NodeList, error) {
+				if time.Since(start) < outage {
+					failedCalls = append(failedCalls, time.Now())
+					return nil, fmt.Errorf("connection refused")
+				}
+				return GetKubeNodes(map[string]string{"node0": "7916fa89-ea7a-443e-a862-b3e930309f65",
+					"node1": "eb82821f-bf21-4614-9a3b-ecb07929f238"}), nil
+			}).MinTimes(2)
+			mockbmclient.EXPECT().UpdateHostInstallProgress(gomock.Any(), gomock.Any(), gomock.Any(), models.HostStageJoined, "").Times(2)
+
+			installerObj.waitForMasterNodes(context.Background(), 2, mockk8sclient)
+
+			// polling every 5ms would give ~30 calls during the outage
+			Expect(len(failedCalls)).To(BeNumerically(">", 2))
+			Expect(len(failedCalls)).To(BeNumerically("<=", 10))
+			delay := generalWaitInterval
+			for i := 1; i < len(failedCalls); i++ {
+				Expect(failedCalls[i].Sub(failedCalls[i-1])).To(BeNumerically(">=", delay))
+				delay *= 2
+				if delay > listNodesBackoffMax {
+					delay = listNodesBackoffMax
+				}
+			}
+		})
 	})
 	AfterEach(func() {
 		ctrl.Finish()
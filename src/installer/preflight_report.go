@@ -0,0 +1,151 @@
+package installer
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"time"
+
+	"github.com/openshift/assisted-installer/src/utils"
+	"github.com/openshift/assisted-service/models"
+	"github.com/pkg/errors"
+)
+
+const preflightReportFileName = "preflight_report.json"
+
+// preflightCheck is the outcome of one of the checks run before the installation touches the node
+type preflightCheck struct {
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+}
+
+// certificateReport describes a certificate the installer was configured to trust
+type certificateReport struct {
+	Path     string    `json:"path"`
+	Subject  string    `json:"subject,omitempty"`
+	NotAfter time.Time `json:"not_after,omitempty"`
+	Expired  bool      `json:"expired,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// preflightReport is uploaded to the service before the installation does destructive work, so a node
+// that never boots into the installed system can still be diagnosed
+type preflightReport struct {
+	HostID       string              `json:"host_id"`
+	Role         string              `json:"role"`
+	Device       string              `json:"device"`
+	CreatedAt    time.Time           `json:"created_at"`
+	Checks       []preflightCheck    `json:"checks"`
+	Disks        string              `json:"disks,omitempty"`
+	Network      string              `json:"network,omitempty"`
+	Certificates []certificateReport `json:"certificates,omitempty"`
+	// Errors are the failures to collect parts of the report
+	Errors []string `json:"errors,omitempty"`
+}
+
+// runPreflightChecks runs the checks that must pass before anything on the node is touched, it stops at
+// the first failing check and returns the outcome of the checks that ran
+func (i *installer) runPreflightChecks() ([]preflightCheck, error) {
+	var checks []preflightCheck
+	run := func(name string, failure string, check func() error) error {
+		result := preflightCheck{Name: name}
+		err := check()
+		if err != nil {
+			i.log.WithError(err).Error(failure)
+			result.Error = err.Error()
+		}
+		checks = append(checks, result)
+		return err
+	}
+
+	if err := run("required binaries", "Required binaries preflight failed", i.verifyRequiredBinaries); err != nil {
+		return checks, err
+	}
+	i.Config.Device = i.ops.EvaluateDiskSymlink(i.Config.Device)
+	if err := run("installation device", "Installation device validation failed", i.validateInstallDevice); err != nil {
+		return checks, err
+	}
+	if err := run("etcd device", "Etcd device validation failed", i.validateEtcdDevice); err != nil {
+		return checks, err
+	}
+	if i.HighAvailabilityMode == models.ClusterHighAvailabilityModeNone {
+		if err := run("single node", "Single node preflight validation failed", i.validateSingleNodePreflight); err != nil {
+			return checks, err
+		}
+	}
+	return checks, nil
+}
+
+func (i *installer) buildPreflightReport(checks []preflightCheck) *preflightReport {
+	report := &preflightReport{
+		HostID:    i.HostID,
+		Role:      i.Config.Role,
+		Device:    i.Device,
+		CreatedAt: time.Now().UTC(),
+		Checks:    checks,
+	}
+	var err error
+	if report.Disks, err = i.ops.ExecPrivilegeCommand(nil, "lsblk", "--paths", "--output", diskInventoryColumns); err != nil {
+		report.Errors = append(report.Errors, errors.Wrap(err, "failed to list block devices").Error())
+	}
+	if report.Network, err = i.ops.ExecPrivilegeCommand(nil, "ip", "-brief", "address"); err != nil {
+		report.Errors = append(report.Errors, errors.Wrap(err, "failed to list network addresses").Error())
+	}
+	for _, path := range []string{i.CACertPath, i.AdditionalTrustBundlePath} {
+		if path != "" {
+			report.Certificates = append(report.Certificates, certificatesReport(path, report.CreatedAt)...)
+		}
+	}
+	return report
+}
+
+// certificatesReport describes the validity of every certificate of the PEM file
+func certificatesReport(path string, now time.Time) []certificateReport {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return []certificateReport{{Path: path, Error: err.Error()}}
+	}
+	var reports []certificateReport
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			reports = append(reports, certificateReport{Path: path, Error: err.Error()})
+			continue
+		}
+		reports = append(reports, certificateReport{Path: path, Subject: cert.Subject.String(), NotAfter: cert.NotAfter,
+			Expired: now.After(cert.NotAfter) || now.Before(cert.NotBefore)})
+	}
+	if len(reports) == 0 {
+		return []certificateReport{{Path: path, Error: "no PEM certificate"}}
+	}
+	return reports
+}
+
+// uploadPreflightReport uploads the report as the host logs, a failed upload doesn't stop the installation.
+// The installation logs take the place of the report on the service, so the report is kept to be added to them
+func (i *installer) uploadPreflightReport(checks []preflightCheck) {
+	content, err := json.MarshalIndent(i.buildPreflightReport(checks), "", "  ")
+	if err != nil {
+		i.log.WithError(err).Warn("Failed to serialize the preflight report")
+		return
+	}
+	i.preflightReport = content
+	var tarGz bytes.Buffer
+	entry := utils.NewTarEntry(bytes.NewReader(content), nil, int64(len(content)), preflightReportFileName)
+	if err = utils.WriteToTarGz(&tarGz, []utils.TarEntry{*entry}); err != nil {
+		i.log.WithError(err).Warn("Failed to archive the preflight report")
+		return
+	}
+	ctx := utils.GenerateRequestContext()
+	log := utils.RequestIDLogger(ctx, i.log)
+	if err = i.inventoryClient.UploadHostLogs(ctx, i.ClusterID, i.InfraEnvID, i.HostID, &tarGz); err != nil {
+		log.WithError(err).Warn("Failed to upload the preflight report")
+		return
+	}
+	log.Info("Uploaded the preflight report")
+}
@@ -1,11 +1,7 @@
 package installer
 
 const (
-	sshDir                       = "/root/.ssh"
-	sshKeyPath                   = sshDir + "/id_rsa"
-	sshPubKeyPath                = sshKeyPath + ".pub"
-	assistedInstallerSshManifest = "/opt/openshift/openshift/99_openshift-machineconfig_99-assisted-installer-master-ssh.yaml"
-	sshManifestTmpl              = `
+	sshManifestTmpl = `
 apiVersion: machineconfiguration.openshift.io/v1
 kind: MachineConfig
 metadata:
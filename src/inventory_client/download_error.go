@@ -0,0 +1,67 @@
+package inventory_client
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/swag"
+	"github.com/openshift/assisted-installer/src/utils"
+	aserror "github.com/openshift/assisted-service/pkg/error"
+)
+
+// DownloadError is returned when downloading a file from the service fails. StatusCode is the HTTP
+// status the service responded with, 0 when the service wasn't reached.
+type DownloadError struct {
+	File       string
+	StatusCode int
+	Err        error
+}
+
+func newDownloadError(file string, err error) *DownloadError {
+	return &DownloadError{File: file, StatusCode: responseStatusCode(err), Err: aserror.GetAssistedError(err)}
+}
+
+func (e *DownloadError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("failed to download %s: %s", e.File, e.Err)
+	}
+	return fmt.Sprintf("failed to download %s, service responded %d %s: %s", e.File, e.StatusCode, http.StatusText(e.StatusCode), e.Err)
+}
+
+func (e *DownloadError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable tells whether downloading again may succeed. Network errors and server errors are
+// retryable, other responses like 401, 403 or 404 will fail the same way again.
+func (e *DownloadError) Retryable() bool {
+	return e.StatusCode == 0 || utils.IsRetryableStatusCode(e.StatusCode)
+}
+
+// generatedErrorStatus matches the status in the message of the generated client errors, e.g.
+// "[PUT /v2/clusters/{cluster_id}/logs-progress][503] v2UpdateClusterLogsProgressServiceUnavailable"
+var generatedErrorStatus = regexp.MustCompile(`^\[[^\]]*\]\[(\d{3})\]`)
+
+// responseStatusCode returns the HTTP status of a service error response, 0 for the other errors
+func responseStatusCode(err error) int {
+	switch err := err.(type) {
+	case aserror.AssistedServiceErrorAPI:
+		code, _ := strconv.Atoi(swag.StringValue(err.GetPayload().Code))
+		if code == 0 {
+			// the payload is empty when the response had no body
+			if match := generatedErrorStatus.FindStringSubmatch(err.Error()); match != nil {
+				code, _ = strconv.Atoi(match[1])
+			}
+		}
+		return code
+	case aserror.AssistedServiceInfraErrorAPI:
+		return int(swag.Int32Value(err.GetPayload().Code))
+	case *runtime.APIError:
+		return err.Code
+	default:
+		return 0
+	}
+}
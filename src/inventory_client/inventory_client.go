@@ -13,6 +13,7 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -40,6 +41,16 @@ const (
 	DefaultRetryMaxDelay = time.Duration(10) * time.Second
 	DefaultMinRetries    = 10
 	DefaultMaxRetries    = 360
+	// bounds the back off a rate limited response asks for
+	maxRetryAfterDelay = 5 * time.Minute
+)
+
+// the log progress drives the logs state shown to the user, a report is retried when the service stays
+// unavailable for longer than the retries of the client cover
+var (
+	logProgressReportAttempts         = 3
+	logProgressReportRetryInterval    = 5 * time.Second
+	logProgressReportMaxRetryInterval = 10 * time.Second
 )
 
 //go:generate mockgen -source=inventory_client.go -package=inventory_client -destination=mock_inventory_client.go
@@ -51,22 +62,35 @@ type InventoryClient interface {
 	GetEnabledHostsNamesHosts(ctx context.Context, log logrus.FieldLogger) (map[string]HostData, error)
 	UploadIngressCa(ctx context.Context, ingressCA string, clusterId string) error
 	GetCluster(ctx context.Context, withHosts bool) (*models.Cluster, error)
+	GetHost(ctx context.Context, infraEnvId string, hostId string) (*models.Host, error)
 	ListsHostsForRole(ctx context.Context, role string) (models.HostList, error)
 	GetClusterMonitoredOperator(ctx context.Context, clusterId, operatorName string, openshiftVersion string) (*models.MonitoredOperator, error)
 	GetClusterMonitoredOLMOperators(ctx context.Context, clusterId string, openshiftVersion string) ([]models.MonitoredOperator, error)
 	CompleteInstallation(ctx context.Context, clusterId string, isSuccess bool, errorInfo string) error
 	GetHosts(ctx context.Context, log logrus.FieldLogger, skippedStatuses []string) (map[string]HostData, error)
 	UploadLogs(ctx context.Context, clusterId string, logsType models.LogsType, upfile io.Reader) error
+	UploadHostLogs(ctx context.Context, clusterId string, infraEnvId string, hostId string, upfile io.Reader) error
 	ClusterLogProgressReport(ctx context.Context, clusterId string, progress models.LogsState)
 	HostLogProgressReport(ctx context.Context, infraEnvId string, hostId string, progress models.LogsState)
 	UpdateClusterOperator(ctx context.Context, clusterId string, operatorName string, operatorStatus models.OperatorStatus, operatorStatusInfo string) error
+	GetServiceTime(ctx context.Context) (time.Time, error)
 }
 
+// Version is the version of the installer binaries, it's set at build time with
+// -ldflags "-X github.com/openshift/assisted-installer/src/inventory_client.Version=<version>"
+var Version = "dev"
+
 type inventoryClient struct {
 	ai        *client.AssistedInstall
 	clusterId strfmt.UUID
 	logger    logrus.FieldLogger
 	cache     ttlCache.SimpleCache
+	// httpClient doesn't retry, it's used for the calls that aren't part of the service API
+	httpClient *http.Client
+	serviceURL string
+	// downloadTransport is the retrying transport of the service API, the downloads wrap it to resume
+	// partial files
+	downloadTransport http.RoundTripper
 }
 
 type HostData struct {
@@ -75,15 +99,37 @@ type HostData struct {
 	Host      *models.Host
 }
 
+// DefaultUserAgent identifies the component, its version and the host it runs on when hostId is set
+func DefaultUserAgent(component string, hostId string) string {
+	if hostId == "" {
+		return fmt.Sprintf("%s/%s", component, Version)
+	}
+	return fmt.Sprintf("%s/%s (host %s)", component, Version, hostId)
+}
+
+type userAgentTransport struct {
+	transport http.RoundTripper
+	userAgent string
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify the request it was given
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.transport.RoundTrip(req)
+}
+
 func CreateInventoryClient(clusterId string, inventoryURL string, pullSecret string, insecure bool, caPath string,
-	logger *logrus.Logger, proxyFunc func(*http.Request) (*url.URL, error)) (*inventoryClient, error) {
+	logger *logrus.Logger, proxyFunc func(*http.Request) (*url.URL, error), userAgent string) (*inventoryClient, error) {
 	return CreateInventoryClientWithDelay(clusterId, inventoryURL, pullSecret, insecure, caPath,
-		logger, proxyFunc, DefaultRetryMinDelay, DefaultRetryMaxDelay, DefaultMaxRetries, DefaultMinRetries)
+		logger, proxyFunc, DefaultRetryMinDelay, DefaultRetryMaxDelay, DefaultMaxRetries, DefaultMinRetries, userAgent)
 }
 
+// CreateInventoryClientWithDelay creates a retrying inventory client, requests keep the default Go
+// User-Agent when userAgent is empty
 func CreateInventoryClientWithDelay(clusterId string, inventoryURL string, pullSecret string, insecure bool, caPath string,
 	logger logrus.FieldLogger, proxyFunc func(*http.Request) (*url.URL, error),
-	retryMinDelay, retryMaxDelay time.Duration, maxRetries int, minRetries int) (*inventoryClient, error) {
+	retryMinDelay, retryMaxDelay time.Duration, maxRetries int, minRetries int, userAgent string) (*inventoryClient, error) {
 	clientConfig := client.Config{}
 	var err error
 
@@ -102,7 +148,7 @@ func CreateInventoryClientWithDelay(clusterId string, inventoryURL string, pullS
 		}
 	}
 
-	transport := requestid.Transport(&http.Transport{
+	var transport http.RoundTripper = requestid.Transport(&http.Transport{
 		Proxy: proxyFunc,
 		DialContext: (&net.Dialer{
 			Timeout:   30 * time.Second,
@@ -118,6 +164,9 @@ func CreateInventoryClientWithDelay(clusterId string, inventoryURL string, pullS
 			RootCAs:            certs,
 		},
 	})
+	if userAgent != "" {
+		transport = &userAgentTransport{transport: transport, userAgent: userAgent}
+	}
 	// Add retry settings
 	tr := rehttp.NewTransport(
 		transport,
@@ -128,7 +177,11 @@ func CreateInventoryClientWithDelay(clusterId string, inventoryURL string, pullS
 			),
 			rehttp.RetryAll(
 				rehttp.RetryMaxRetries(maxRetries),
-				rehttp.RetryStatusInterval(405, 600),
+				// a resumed download with a range the file doesn't have won't succeed when retried
+				rehttp.RetryAny(
+					rehttp.RetryStatusInterval(405, http.StatusRequestedRangeNotSatisfiable),
+					rehttp.RetryStatusInterval(http.StatusRequestedRangeNotSatisfiable+1, 600),
+				),
 			),
 			rehttp.RetryAll(
 				rehttp.RetryMaxRetries(maxRetries),
@@ -139,7 +192,7 @@ func CreateInventoryClientWithDelay(clusterId string, inventoryURL string, pullS
 				RetryConnectionRefusedErr(),
 			),
 		),
-		rehttp.ExpJitterDelay(retryMinDelay, retryMaxDelay),
+		RetryAfterDelay(rehttp.ExpJitterDelay(retryMinDelay, retryMaxDelay), maxRetryAfterDelay),
 	)
 
 	clientConfig.Transport = tr
@@ -149,7 +202,15 @@ func CreateInventoryClientWithDelay(clusterId string, inventoryURL string, pullS
 	cache := ttlCache.NewCache()
 	cache.SetTTL(30 * time.Second)
 
-	return &inventoryClient{assistedInstallClient, strfmt.UUID(clusterId), logger, cache}, nil
+	return &inventoryClient{
+		ai:                assistedInstallClient,
+		clusterId:         strfmt.UUID(clusterId),
+		logger:            logger,
+		cache:             cache,
+		httpClient:        &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		serviceURL:        clientConfig.URL.String(),
+		downloadTransport: tr,
+	}, nil
 }
 
 func RetryConnectionRefusedErr() rehttp.RetryFn {
@@ -166,6 +227,45 @@ func RetryConnectionRefusedErr() rehttp.RetryFn {
 	}
 }
 
+// RetryAfterDelay backs off for the Retry-After of a rate limited response, up to max, and falls back
+// to delay for the other attempts
+func RetryAfterDelay(delay rehttp.DelayFn, max time.Duration) rehttp.DelayFn {
+	return func(attempt rehttp.Attempt) time.Duration {
+		if attempt.Response == nil || attempt.Response.StatusCode != http.StatusTooManyRequests {
+			return delay(attempt)
+		}
+		retryAfter, ok := parseRetryAfter(attempt.Response.Header.Get("Retry-After"), time.Now())
+		if !ok {
+			return delay(attempt)
+		}
+		if retryAfter > max {
+			return max
+		}
+		return retryAfter
+	}
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if delay := date.Sub(now); delay > 0 {
+		return delay, true
+	}
+	return 0, true
+}
+
 func readCACertificate(capath string, logger logrus.FieldLogger) (*x509.CertPool, error) {
 
 	if capath == "" {
@@ -187,21 +287,6 @@ func readCACertificate(capath string, logger logrus.FieldLogger) (*x509.CertPool
 	return pool, nil
 }
 
-func (c *inventoryClient) DownloadFile(ctx context.Context, filename string, dest string) error {
-	// open output file
-	fo, err := os.Create(dest)
-	if err != nil {
-		return err
-	}
-	// close fo on exit and check for its returned error
-	defer func() {
-		fo.Close()
-	}()
-	c.logger.Infof("Downloading file %s to %s", filename, dest)
-	_, err = c.ai.Installer.V2DownloadClusterFiles(ctx, c.createDownloadParams(filename), fo)
-	return aserror.GetAssistedError(err)
-}
-
 func (c *inventoryClient) DownloadClusterCredentials(ctx context.Context, filename string, dest string) error {
 	// open output file
 	fo, err := os.Create(dest)
@@ -238,7 +323,10 @@ func (c *inventoryClient) DownloadHostIgnition(ctx context.Context, infraEnvID s
 		HostID:     strfmt.UUID(hostID),
 	}
 	_, err = c.ai.Installer.V2DownloadHostIgnition(ctx, &params, fo)
-	return aserror.GetAssistedError(err)
+	if err != nil {
+		return newDownloadError(path.Base(dest), err)
+	}
+	return nil
 }
 
 func (c *inventoryClient) UpdateHostInstallProgress(ctx context.Context, infraEnvId, hostId string, newStage models.HostStage, info string) error {
@@ -261,6 +349,14 @@ func (c *inventoryClient) GetCluster(ctx context.Context, withHosts bool) (*mode
 	return cluster.Payload, nil
 }
 
+func (c *inventoryClient) GetHost(ctx context.Context, infraEnvId string, hostId string) (*models.Host, error) {
+	host, err := c.ai.Installer.V2GetHost(ctx, &installer.V2GetHostParams{InfraEnvID: strfmt.UUID(infraEnvId), HostID: strfmt.UUID(hostId)})
+	if err != nil {
+		return nil, err
+	}
+	return host.Payload, nil
+}
+
 func (c *inventoryClient) ListsHostsForRole(ctx context.Context, role string) (models.HostList, error) {
 	ret, err := c.ai.Installer.ListClusterHosts(ctx, &installer.ListClusterHostsParams{ClusterID: c.clusterId, Role: swag.String(role)})
 	if err != nil {
@@ -440,12 +536,58 @@ func (c *inventoryClient) UploadLogs(ctx context.Context, clusterId string, logs
 	return aserror.GetAssistedError(err)
 }
 
+// UploadHostLogs uploads logs of the host type, the service keeps them per host
+func (c *inventoryClient) UploadHostLogs(ctx context.Context, clusterId string, infraEnvId string, hostId string, upfile io.Reader) error {
+	infraEnvID, hostID := strfmt.UUID(infraEnvId), strfmt.UUID(hostId)
+	_, err := c.ai.Installer.V2UploadLogs(ctx,
+		&installer.V2UploadLogsParams{ClusterID: strfmt.UUID(clusterId), InfraEnvID: &infraEnvID, HostID: &hostID,
+			LogsType: string(models.LogsTypeHost), Upfile: runtime.NamedReader(fmt.Sprintf("%s_logs.tar.gz", models.LogsTypeHost), upfile)})
+	return aserror.GetAssistedError(err)
+}
+
+// serviceCallError classifies a failed service call for utils.IsRetryable by the status the service
+// responded with, only server errors and the calls that didn't reach the service are retried
+type serviceCallError struct {
+	err error
+}
+
+func (e *serviceCallError) Error() string {
+	return e.err.Error()
+}
+
+func (e *serviceCallError) Unwrap() error {
+	return e.err
+}
+
+func (e *serviceCallError) Retryable() bool {
+	if code := responseStatusCode(e.err); code != 0 {
+		return utils.IsRetryableStatusCode(code)
+	}
+	return utils.IsRetryable(e.err)
+}
+
+func (c *inventoryClient) reportLogProgress(ctx context.Context, report func() error) error {
+	return utils.RetryWithBackoff(logProgressReportAttempts, logProgressReportRetryInterval, logProgressReportMaxRetryInterval, c.logger, func() error {
+		err := report()
+		if err != nil && ctx.Err() != nil {
+			return utils.StopRetry(err)
+		}
+		if err != nil {
+			return &serviceCallError{err: err}
+		}
+		return nil
+	})
+}
+
 func (c *inventoryClient) ClusterLogProgressReport(ctx context.Context, clusterId string, progress models.LogsState) {
-	_, err := c.ai.Installer.V2UpdateClusterLogsProgress(ctx, &installer.V2UpdateClusterLogsProgressParams{
-		ClusterID: strfmt.UUID(clusterId),
-		LogsProgressParams: &models.LogsProgressParams{
-			LogsState: &progress,
-		},
+	err := c.reportLogProgress(ctx, func() error {
+		_, err := c.ai.Installer.V2UpdateClusterLogsProgress(ctx, &installer.V2UpdateClusterLogsProgressParams{
+			ClusterID: strfmt.UUID(clusterId),
+			LogsProgressParams: &models.LogsProgressParams{
+				LogsState: &progress,
+			},
+		})
+		return err
 	})
 	if err != nil {
 		c.logger.WithError(err).Errorf("failed to report log progress %s on cluster", progress)
@@ -453,12 +595,15 @@ func (c *inventoryClient) ClusterLogProgressReport(ctx context.Context, clusterI
 }
 
 func (c *inventoryClient) HostLogProgressReport(ctx context.Context, infraEnvId string, hostId string, progress models.LogsState) {
-	_, err := c.ai.Installer.V2UpdateHostLogsProgress(ctx, &installer.V2UpdateHostLogsProgressParams{
-		InfraEnvID: strfmt.UUID(infraEnvId),
-		HostID:     strfmt.UUID(hostId),
-		LogsProgressParams: &models.LogsProgressParams{
-			LogsState: &progress,
-		},
+	err := c.reportLogProgress(ctx, func() error {
+		_, err := c.ai.Installer.V2UpdateHostLogsProgress(ctx, &installer.V2UpdateHostLogsProgressParams{
+			InfraEnvID: strfmt.UUID(infraEnvId),
+			HostID:     strfmt.UUID(hostId),
+			LogsProgressParams: &models.LogsProgressParams{
+				LogsState: &progress,
+			},
+		})
+		return err
 	})
 	if err != nil {
 		c.logger.WithError(err).Errorf("failed to report log progress %s on host %s", progress, hostId)
@@ -480,3 +625,22 @@ func (c *inventoryClient) UpdateClusterOperator(ctx context.Context, clusterId s
 	})
 	return aserror.GetAssistedError(err)
 }
+
+// GetServiceTime returns the time of the service according to the Date header of its response, the
+// header is set whatever the status of the response is
+func (c *inventoryClient) GetServiceTime(ctx context.Context) (time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.serviceURL, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to reach the service: %w", err)
+	}
+	defer resp.Body.Close()
+	serviceTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid Date header %q in the service response: %w", resp.Header.Get("Date"), err)
+	}
+	return serviceTime, nil
+}
@@ -1,17 +1,27 @@
 package inventory_client
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/PuerkitoBio/rehttp"
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/swag"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/ghttp"
+	"github.com/openshift/assisted-service/client/installer"
 	"github.com/openshift/assisted-service/models"
 	"github.com/sirupsen/logrus"
 )
@@ -46,7 +56,7 @@ var _ = Describe("inventory_client_tests", func() {
 		server.SetAllowUnhandledRequests(true)
 		server.SetUnhandledRequestStatusCode(http.StatusInternalServerError) // 500
 		client, err = CreateInventoryClientWithDelay(clusterID, "http://"+server.Addr(), "pullSecret", true, "",
-			logger, nil, testRetryDelay, testRetryMaxDelay, testMaxRetries, testMaxRetries)
+			logger, nil, testRetryDelay, testRetryMaxDelay, testMaxRetries, testMaxRetries, "assisted-installer/test (host host-id)")
 		Expect(err).ShouldNot(HaveOccurred())
 		Expect(client).ShouldNot(BeNil())
 	})
@@ -104,6 +114,276 @@ var _ = Describe("inventory_client_tests", func() {
 			Expect(client.UpdateHostInstallProgress(context.Background(), infraEnvID, hostID, models.HostStageInstalling, "")).Should(HaveOccurred())
 		})
 	})
+
+	Context("log progress report", func() {
+		var (
+			hostID       = "host-id"
+			expectedJson = map[string]string{"logs_state": string(models.LogsStateRequested)}
+		)
+
+		// expectReport responds like the service, with the status code in the error payload
+		expectReport := func(path string, code int) {
+			body := []byte(fmt.Sprintf(`{"code": "%d", "reason": "%s"}`, code, http.StatusText(code)))
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", path),
+					ghttp.VerifyJSONRepresenting(expectedJson),
+					ghttp.RespondWith(code, body, http.Header{"Content-Type": []string{"application/json"}}),
+				),
+			)
+		}
+
+		BeforeEach(func() {
+			var err error
+			// the client doesn't retry, only the report itself is retried
+			client, err = CreateInventoryClientWithDelay(clusterID, "http://"+server.Addr(), "pullSecret", true, "",
+				logger, nil, testRetryDelay, testRetryMaxDelay, 0, 0, "assisted-installer/test (host host-id)")
+			Expect(err).ShouldNot(HaveOccurred())
+			logProgressReportRetryInterval = time.Millisecond
+			logProgressReportMaxRetryInterval = time.Millisecond
+			server.Start()
+		})
+
+		AfterEach(func() {
+			logProgressReportRetryInterval = 5 * time.Second
+			logProgressReportMaxRetryInterval = 10 * time.Second
+		})
+
+		It("retries a host report after a transient failure", func() {
+			path := fmt.Sprintf("/api/assisted-install/v2/infra-envs/%s/hosts/%s/logs-progress", infraEnvID, hostID)
+			expectReport(path, http.StatusServiceUnavailable)
+			expectReport(path, http.StatusNoContent)
+			client.HostLogProgressReport(context.Background(), infraEnvID, hostID, models.LogsStateRequested)
+			Expect(server.ReceivedRequests()).Should(HaveLen(2))
+		})
+
+		It("retries a cluster report after a transient failure", func() {
+			path := fmt.Sprintf("/api/assisted-install/v2/clusters/%s/logs-progress", clusterID)
+			expectReport(path, http.StatusInternalServerError)
+			expectReport(path, http.StatusNoContent)
+			client.ClusterLogProgressReport(context.Background(), clusterID, models.LogsStateRequested)
+			Expect(server.ReceivedRequests()).Should(HaveLen(2))
+		})
+
+		It("doesn't retry a report the service rejected", func() {
+			path := fmt.Sprintf("/api/assisted-install/v2/infra-envs/%s/hosts/%s/logs-progress", infraEnvID, hostID)
+			expectReport(path, http.StatusNotFound)
+			client.HostLogProgressReport(context.Background(), infraEnvID, hostID, models.LogsStateRequested)
+			Expect(server.ReceivedRequests()).Should(HaveLen(1))
+		})
+
+		It("gives up after the bounded attempts", func() {
+			client.HostLogProgressReport(context.Background(), infraEnvID, hostID, models.LogsStateRequested)
+			Expect(server.ReceivedRequests()).Should(HaveLen(logProgressReportAttempts))
+		})
+	})
+
+	Context("User-Agent", func() {
+		It("is set on the service calls and their retries", func() {
+			server.Start()
+			userAgent := http.Header{"User-Agent": []string{"assisted-installer/test (host host-id)"}}
+			server.AppendHandlers(
+				ghttp.CombineHandlers(ghttp.VerifyHeader(userAgent), ghttp.RespondWith(http.StatusServiceUnavailable, nil)),
+				ghttp.CombineHandlers(ghttp.VerifyHeader(userAgent), ghttp.RespondWith(http.StatusOK, nil)),
+			)
+			Expect(client.UpdateHostInstallProgress(context.Background(), infraEnvID, "host-id", models.HostStageInstalling, "")).ShouldNot(HaveOccurred())
+			Expect(server.ReceivedRequests()).Should(HaveLen(2))
+		})
+
+		It("includes the version and the host", func() {
+			Expect(DefaultUserAgent("assisted-installer", "host-id")).To(Equal("assisted-installer/dev (host host-id)"))
+			Expect(DefaultUserAgent("assisted-installer-controller", "")).To(Equal("assisted-installer-controller/dev"))
+		})
+	})
+
+	Context("Retry-After", func() {
+		It("backs off for the Retry-After of a rate limited response", func() {
+			server.Start()
+			server.AppendHandlers(
+				ghttp.RespondWith(http.StatusTooManyRequests, nil, http.Header{"Retry-After": []string{"2"}}),
+				ghttp.RespondWith(http.StatusOK, nil),
+			)
+			start := time.Now()
+			Expect(client.UpdateHostInstallProgress(context.Background(), infraEnvID, "host-id", models.HostStageInstalling, "")).ShouldNot(HaveOccurred())
+			Expect(time.Since(start)).To(BeNumerically(">=", 2*time.Second))
+			Expect(server.ReceivedRequests()).Should(HaveLen(2))
+		})
+
+		It("bounds the back off and falls back to the delay for the other responses", func() {
+			fallback := func(rehttp.Attempt) time.Duration { return time.Second }
+			delay := RetryAfterDelay(fallback, time.Minute)
+			rateLimited := func(retryAfter string) rehttp.Attempt {
+				return rehttp.Attempt{Response: &http.Response{StatusCode: http.StatusTooManyRequests,
+					Header: http.Header{"Retry-After": []string{retryAfter}}}}
+			}
+			Expect(delay(rateLimited("10"))).To(Equal(10 * time.Second))
+			Expect(delay(rateLimited("3600"))).To(Equal(time.Minute))
+			Expect(delay(rateLimited("soon"))).To(Equal(time.Second))
+			Expect(delay(rateLimited(time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat)))).To(
+				BeNumerically("~", 30*time.Second, 2*time.Second))
+			Expect(delay(rehttp.Attempt{Response: &http.Response{StatusCode: http.StatusServiceUnavailable,
+				Header: http.Header{"Retry-After": []string{"10"}}}})).To(Equal(time.Second))
+			Expect(delay(rehttp.Attempt{})).To(Equal(time.Second))
+		})
+	})
+
+	Context("DownloadFile", func() {
+		var (
+			dest         string
+			downloadPath = fmt.Sprintf("/api/assisted-install/v2/clusters/%s/downloads/files", clusterID)
+			octetStream  = http.Header{"Content-Type": []string{"application/octet-stream"}}
+		)
+
+		BeforeEach(func() {
+			dir, err := ioutil.TempDir("", "download")
+			Expect(err).NotTo(HaveOccurred())
+			dest = filepath.Join(dir, "bootstrap.ign")
+			server.Start()
+		})
+		AfterEach(func() {
+			os.RemoveAll(filepath.Dir(dest))
+		})
+
+		expectDownloaded := func() {
+			content, err := ioutil.ReadFile(dest)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal("hello world"))
+			Expect(dest + partialDownloadSuffix).NotTo(BeAnExistingFile())
+		}
+
+		It("fails with a non retryable download error when the file isn't found", func() {
+			server.AppendHandlers(ghttp.RespondWithJSONEncoded(http.StatusNotFound, models.Error{Code: swag.String("404"), Reason: swag.String("no such file")}))
+			err := client.DownloadFile(context.Background(), "bootstrap.ign", dest)
+			var downloadErr *DownloadError
+			Expect(errors.As(err, &downloadErr)).To(BeTrue())
+			Expect(downloadErr.StatusCode).To(Equal(http.StatusNotFound))
+			Expect(downloadErr.Retryable()).To(BeFalse())
+		})
+
+		It("downloads the whole file", func() {
+			server.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest(http.MethodGet, downloadPath, "file_name=bootstrap.ign"),
+				func(_ http.ResponseWriter, r *http.Request) { Expect(r.Header.Get("Range")).To(BeEmpty()) },
+				ghttp.RespondWith(http.StatusOK, "hello world", octetStream),
+			))
+			Expect(client.DownloadFile(context.Background(), "bootstrap.ign", dest)).To(Succeed())
+			expectDownloaded()
+		})
+
+		It("resumes an interrupted download", func() {
+			Expect(ioutil.WriteFile(dest+partialDownloadSuffix, []byte("hello "), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(dest+partialDownloadSuffix+downloadValidatorSuffix, []byte(`"v1"`), 0600)).To(Succeed())
+			server.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyHeader(http.Header{"Range": []string{"bytes=6-"}, "If-Range": []string{`"v1"`}}),
+				ghttp.RespondWith(http.StatusPartialContent, "world",
+					http.Header{"Content-Type": []string{"application/octet-stream"}, "Content-Range": []string{"bytes 6-10/11"}}),
+			))
+			Expect(client.DownloadFile(context.Background(), "bootstrap.ign", dest)).To(Succeed())
+			expectDownloaded()
+			Expect(dest + partialDownloadSuffix + downloadValidatorSuffix).NotTo(BeAnExistingFile())
+		})
+
+		It("downloads the whole file again when the partial file has no validator", func() {
+			Expect(ioutil.WriteFile(dest+partialDownloadSuffix, []byte("stale "), 0600)).To(Succeed())
+			server.AppendHandlers(ghttp.CombineHandlers(
+				func(_ http.ResponseWriter, r *http.Request) { Expect(r.Header.Get("Range")).To(BeEmpty()) },
+				ghttp.RespondWith(http.StatusOK, "hello world", octetStream),
+			))
+			Expect(client.DownloadFile(context.Background(), "bootstrap.ign", dest)).To(Succeed())
+			expectDownloaded()
+		})
+
+		It("downloads the whole file again when it changed on the service", func() {
+			Expect(ioutil.WriteFile(dest+partialDownloadSuffix, []byte("stale "), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(dest+partialDownloadSuffix+downloadValidatorSuffix, []byte(`"v1"`), 0600)).To(Succeed())
+			// If-Range doesn't match the current version, the whole file is sent
+			server.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyHeader(http.Header{"If-Range": []string{`"v1"`}}),
+				ghttp.RespondWith(http.StatusOK, "hello world", http.Header{"Content-Type": []string{"application/octet-stream"}, "ETag": []string{`"v2"`}}),
+			))
+			Expect(client.DownloadFile(context.Background(), "bootstrap.ign", dest)).To(Succeed())
+			expectDownloaded()
+		})
+
+		It("downloads the whole file again when the content range doesn't start at the partial file end", func() {
+			Expect(ioutil.WriteFile(dest+partialDownloadSuffix, []byte("hello "), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(dest+partialDownloadSuffix+downloadValidatorSuffix, []byte(`"v1"`), 0600)).To(Succeed())
+			server.AppendHandlers(
+				ghttp.RespondWith(http.StatusPartialContent, "lo world",
+					http.Header{"Content-Type": []string{"application/octet-stream"}, "Content-Range": []string{"bytes 3-10/11"}}),
+				ghttp.CombineHandlers(
+					func(_ http.ResponseWriter, r *http.Request) { Expect(r.Header.Get("Range")).To(BeEmpty()) },
+					ghttp.RespondWith(http.StatusOK, "hello world", octetStream),
+				),
+			)
+			Expect(client.DownloadFile(context.Background(), "bootstrap.ign", dest)).To(Succeed())
+			expectDownloaded()
+		})
+
+		It("downloads the whole file again when the partial file doesn't match", func() {
+			Expect(ioutil.WriteFile(dest+partialDownloadSuffix, []byte("hello world and more"), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(dest+partialDownloadSuffix+downloadValidatorSuffix, []byte(`"v1"`), 0600)).To(Succeed())
+			server.AppendHandlers(
+				ghttp.RespondWith(http.StatusRequestedRangeNotSatisfiable, nil),
+				ghttp.CombineHandlers(
+					func(_ http.ResponseWriter, r *http.Request) { Expect(r.Header.Get("Range")).To(BeEmpty()) },
+					ghttp.RespondWith(http.StatusOK, "hello world", octetStream),
+				),
+			)
+			Expect(client.DownloadFile(context.Background(), "bootstrap.ign", dest)).To(Succeed())
+			expectDownloaded()
+		})
+	})
+
+	Context("DownloadError", func() {
+		It("classifies the service responses", func() {
+			unauthorized := installer.NewV2DownloadClusterFilesUnauthorized()
+			unauthorized.Payload = &models.InfraError{Code: swag.Int32(http.StatusUnauthorized), Message: swag.String("unauthorized")}
+			notFound := installer.NewV2DownloadClusterFilesNotFound()
+			notFound.Payload = &models.Error{Code: swag.String("404"), Reason: swag.String("no such file")}
+			serverError := installer.NewV2DownloadClusterFilesInternalServerError()
+			serverError.Payload = &models.Error{Code: swag.String("500"), Reason: swag.String("database is down")}
+
+			for err, expected := range map[error]struct {
+				status    int
+				retryable bool
+			}{
+				unauthorized:                      {http.StatusUnauthorized, false},
+				notFound:                          {http.StatusNotFound, false},
+				serverError:                       {http.StatusInternalServerError, true},
+				fmt.Errorf("connection reset"):    {0, true},
+				runtime.NewAPIError("", nil, 503): {http.StatusServiceUnavailable, true},
+			} {
+				downloadErr := newDownloadError("bootstrap.ign", err)
+				Expect(downloadErr.StatusCode).To(Equal(expected.status), err.Error())
+				Expect(downloadErr.Retryable()).To(Equal(expected.retryable), err.Error())
+			}
+			Expect(newDownloadError("bootstrap.ign", notFound).Error()).To(Equal(
+				"failed to download bootstrap.ign, service responded 404 Not Found: AssistedServiceError Code: 404 Href:  ID: 0 Kind:  Reason: no such file"))
+		})
+	})
+
+	Context("GetServiceTime", func() {
+		It("returns the time of the service response", func() {
+			server.Start()
+			serviceTime := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+			server.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest(http.MethodHead, "/api/assisted-install"),
+				ghttp.RespondWith(http.StatusNotFound, nil, http.Header{"Date": []string{serviceTime.Format(http.TimeFormat)}}),
+			))
+			Expect(client.GetServiceTime(context.Background())).To(Equal(serviceTime))
+		})
+
+		It("fails without a Date header", func() {
+			server.Start()
+			server.AppendHandlers(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header()["Date"] = nil
+			})
+			_, err := client.GetServiceTime(context.Background())
+			Expect(err).To(HaveOccurred())
+			Expect(server.ReceivedRequests()).Should(HaveLen(1))
+		})
+	})
 })
 
 func expectServerCall(server *ghttp.Server, path string, expectedJson interface{}, returnedStatusCode int) {
@@ -121,3 +401,56 @@ func expectServerCall(server *ghttp.Server, path string, expectedJson interface{
 		),
 	)
 }
+
+var _ = Describe("recording inventory client", func() {
+	var (
+		buf    *bytes.Buffer
+		client InventoryClient
+		ctx    = context.Background()
+	)
+
+	BeforeEach(func() {
+		buf = &bytes.Buffer{}
+		client = NewRecordingInventoryClient(buf, logrus.New())
+	})
+
+	recordedCalls := func() []RecordedCall {
+		var calls []RecordedCall
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var call RecordedCall
+			Expect(json.Unmarshal([]byte(line), &call)).To(Succeed())
+			calls = append(calls, call)
+		}
+		return calls
+	}
+
+	It("records calls with their arguments instead of sending them", func() {
+		Expect(client.UpdateHostInstallProgress(ctx, "infra-env-id", "host-id", models.HostStageRebooting, "info")).To(Succeed())
+		Expect(client.CompleteInstallation(ctx, "cluster-id", false, "some error")).To(Succeed())
+		client.HostLogProgressReport(ctx, "infra-env-id", "host-id", models.LogsStateCompleted)
+		Expect(client.UploadLogs(ctx, "cluster-id", models.LogsTypeController, strings.NewReader("logs"))).To(Succeed())
+
+		calls := recordedCalls()
+		Expect(calls).To(HaveLen(4))
+		Expect(calls[0].Method).To(Equal("UpdateHostInstallProgress"))
+		Expect(calls[0].Args).To(Equal(map[string]interface{}{"infraEnvId": "infra-env-id", "hostId": "host-id",
+			"stage": string(models.HostStageRebooting), "info": "info"}))
+		Expect(calls[1].Method).To(Equal("CompleteInstallation"))
+		Expect(calls[1].Args).To(Equal(map[string]interface{}{"clusterId": "cluster-id", "isSuccess": false, "errorInfo": "some error"}))
+		Expect(calls[2].Method).To(Equal("HostLogProgressReport"))
+		Expect(calls[2].Args).To(HaveKeyWithValue("progress", string(models.LogsStateCompleted)))
+		Expect(calls[3].Method).To(Equal("UploadLogs"))
+		Expect(calls[3].Args).To(HaveKeyWithValue("size", float64(len("logs"))))
+	})
+
+	It("records read calls and fails them", func() {
+		cluster, err := client.GetCluster(ctx, true)
+		Expect(err).To(Equal(ErrRecordingOnly))
+		Expect(cluster).To(BeNil())
+
+		calls := recordedCalls()
+		Expect(calls).To(HaveLen(1))
+		Expect(calls[0].Method).To(Equal("GetCluster"))
+		Expect(calls[0].Args).To(Equal(map[string]interface{}{"withHosts": true}))
+	})
+})
@@ -8,6 +8,7 @@ import (
 	context "context"
 	io "io"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	models "github.com/openshift/assisted-service/models"
@@ -137,6 +138,21 @@ func (mr *MockInventoryClientMockRecorder) GetCluster(ctx, withHosts interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCluster", reflect.TypeOf((*MockInventoryClient)(nil).GetCluster), ctx, withHosts)
 }
 
+// GetHost mocks base method
+func (m *MockInventoryClient) GetHost(ctx context.Context, infraEnvId, hostId string) (*models.Host, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHost", ctx, infraEnvId, hostId)
+	ret0, _ := ret[0].(*models.Host)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetHost indicates an expected call of GetHost
+func (mr *MockInventoryClientMockRecorder) GetHost(ctx, infraEnvId, hostId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHost", reflect.TypeOf((*MockInventoryClient)(nil).GetHost), ctx, infraEnvId, hostId)
+}
+
 // ListsHostsForRole mocks base method
 func (m *MockInventoryClient) ListsHostsForRole(ctx context.Context, role string) (models.HostList, error) {
 	m.ctrl.T.Helper()
@@ -225,6 +241,20 @@ func (mr *MockInventoryClientMockRecorder) UploadLogs(ctx, clusterId, logsType,
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadLogs", reflect.TypeOf((*MockInventoryClient)(nil).UploadLogs), ctx, clusterId, logsType, upfile)
 }
 
+// UploadHostLogs mocks base method
+func (m *MockInventoryClient) UploadHostLogs(ctx context.Context, clusterId, infraEnvId, hostId string, upfile io.Reader) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UploadHostLogs", ctx, clusterId, infraEnvId, hostId, upfile)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UploadHostLogs indicates an expected call of UploadHostLogs
+func (mr *MockInventoryClientMockRecorder) UploadHostLogs(ctx, clusterId, infraEnvId, hostId, upfile interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadHostLogs", reflect.TypeOf((*MockInventoryClient)(nil).UploadHostLogs), ctx, clusterId, infraEnvId, hostId, upfile)
+}
+
 // ClusterLogProgressReport mocks base method
 func (m *MockInventoryClient) ClusterLogProgressReport(ctx context.Context, clusterId string, progress models.LogsState) {
 	m.ctrl.T.Helper()
@@ -262,3 +292,18 @@ func (mr *MockInventoryClientMockRecorder) UpdateClusterOperator(ctx, clusterId,
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateClusterOperator", reflect.TypeOf((*MockInventoryClient)(nil).UpdateClusterOperator), ctx, clusterId, operatorName, operatorStatus, operatorStatusInfo)
 }
+
+// GetServiceTime mocks base method
+func (m *MockInventoryClient) GetServiceTime(ctx context.Context) (time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetServiceTime", ctx)
+	ret0, _ := ret[0].(time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetServiceTime indicates an expected call of GetServiceTime
+func (mr *MockInventoryClientMockRecorder) GetServiceTime(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetServiceTime", reflect.TypeOf((*MockInventoryClient)(nil).GetServiceTime), ctx)
+}
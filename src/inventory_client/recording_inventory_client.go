@@ -0,0 +1,158 @@
+package inventory_client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/openshift/assisted-service/models"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrRecordingOnly is returned by the recording client for calls that need a response from the service
+var ErrRecordingOnly = errors.New("inventory call was recorded and not sent to the service")
+
+// RecordedCall is a single line of the recording written by the recording inventory client
+type RecordedCall struct {
+	Time   time.Time              `json:"time"`
+	Method string                 `json:"method"`
+	Args   map[string]interface{} `json:"args,omitempty"`
+}
+
+// recordingInventoryClient is a dry-run InventoryClient that serializes every call as a JSON line
+// instead of sending it to the service
+type recordingInventoryClient struct {
+	lock   sync.Mutex
+	writer io.Writer
+	log    logrus.FieldLogger
+}
+
+func NewRecordingInventoryClient(writer io.Writer, log logrus.FieldLogger) InventoryClient {
+	return &recordingInventoryClient{writer: writer, log: log}
+}
+
+// CreateRecordingInventoryClient returns a recording client that appends its calls to the given path
+func CreateRecordingInventoryClient(recordPath string, log logrus.FieldLogger) (InventoryClient, error) {
+	f, err := os.OpenFile(recordPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open inventory record file %s", recordPath)
+	}
+	log.Infof("Recording inventory calls to %s", recordPath)
+	return NewRecordingInventoryClient(f, log), nil
+}
+
+func (c *recordingInventoryClient) record(method string, args map[string]interface{}) {
+	line, err := json.Marshal(RecordedCall{Time: time.Now().UTC(), Method: method, Args: args})
+	if err != nil {
+		c.log.WithError(err).Warnf("Failed to serialize inventory call %s", method)
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, err = c.writer.Write(append(line, '\n')); err != nil {
+		c.log.WithError(err).Warnf("Failed to record inventory call %s", method)
+	}
+}
+
+func (c *recordingInventoryClient) DownloadFile(_ context.Context, filename string, dest string) error {
+	c.record("DownloadFile", map[string]interface{}{"filename": filename, "dest": dest})
+	return ErrRecordingOnly
+}
+
+func (c *recordingInventoryClient) DownloadClusterCredentials(_ context.Context, filename string, dest string) error {
+	c.record("DownloadClusterCredentials", map[string]interface{}{"filename": filename, "dest": dest})
+	return ErrRecordingOnly
+}
+
+func (c *recordingInventoryClient) DownloadHostIgnition(_ context.Context, infraEnvID string, hostID string, dest string) error {
+	c.record("DownloadHostIgnition", map[string]interface{}{"infraEnvId": infraEnvID, "hostId": hostID, "dest": dest})
+	return ErrRecordingOnly
+}
+
+func (c *recordingInventoryClient) UpdateHostInstallProgress(_ context.Context, infraEnvId string, hostId string, newStage models.HostStage, info string) error {
+	c.record("UpdateHostInstallProgress", map[string]interface{}{"infraEnvId": infraEnvId, "hostId": hostId, "stage": newStage, "info": info})
+	return nil
+}
+
+func (c *recordingInventoryClient) GetEnabledHostsNamesHosts(_ context.Context, _ logrus.FieldLogger) (map[string]HostData, error) {
+	c.record("GetEnabledHostsNamesHosts", nil)
+	return nil, ErrRecordingOnly
+}
+
+func (c *recordingInventoryClient) UploadIngressCa(_ context.Context, ingressCA string, clusterId string) error {
+	c.record("UploadIngressCa", map[string]interface{}{"ingressCA": ingressCA, "clusterId": clusterId})
+	return nil
+}
+
+func (c *recordingInventoryClient) GetCluster(_ context.Context, withHosts bool) (*models.Cluster, error) {
+	c.record("GetCluster", map[string]interface{}{"withHosts": withHosts})
+	return nil, ErrRecordingOnly
+}
+
+func (c *recordingInventoryClient) GetHost(_ context.Context, infraEnvId string, hostId string) (*models.Host, error) {
+	c.record("GetHost", map[string]interface{}{"infraEnvId": infraEnvId, "hostId": hostId})
+	return nil, ErrRecordingOnly
+}
+
+func (c *recordingInventoryClient) ListsHostsForRole(_ context.Context, role string) (models.HostList, error) {
+	c.record("ListsHostsForRole", map[string]interface{}{"role": role})
+	return nil, ErrRecordingOnly
+}
+
+func (c *recordingInventoryClient) GetClusterMonitoredOperator(_ context.Context, clusterId, operatorName string, openshiftVersion string) (*models.MonitoredOperator, error) {
+	c.record("GetClusterMonitoredOperator", map[string]interface{}{"clusterId": clusterId, "operatorName": operatorName, "openshiftVersion": openshiftVersion})
+	return nil, ErrRecordingOnly
+}
+
+func (c *recordingInventoryClient) GetClusterMonitoredOLMOperators(_ context.Context, clusterId string, openshiftVersion string) ([]models.MonitoredOperator, error) {
+	c.record("GetClusterMonitoredOLMOperators", map[string]interface{}{"clusterId": clusterId, "openshiftVersion": openshiftVersion})
+	return nil, ErrRecordingOnly
+}
+
+func (c *recordingInventoryClient) CompleteInstallation(_ context.Context, clusterId string, isSuccess bool, errorInfo string) error {
+	c.record("CompleteInstallation", map[string]interface{}{"clusterId": clusterId, "isSuccess": isSuccess, "errorInfo": errorInfo})
+	return nil
+}
+
+func (c *recordingInventoryClient) GetHosts(_ context.Context, _ logrus.FieldLogger, skippedStatuses []string) (map[string]HostData, error) {
+	c.record("GetHosts", map[string]interface{}{"skippedStatuses": skippedStatuses})
+	return nil, ErrRecordingOnly
+}
+
+// UploadLogs drains the logs so that a writer on the other end of a pipe is not blocked and records their size
+func (c *recordingInventoryClient) UploadLogs(_ context.Context, clusterId string, logsType models.LogsType, upfile io.Reader) error {
+	size, err := io.Copy(ioutil.Discard, upfile)
+	c.record("UploadLogs", map[string]interface{}{"clusterId": clusterId, "logsType": logsType, "size": size})
+	return err
+}
+
+func (c *recordingInventoryClient) UploadHostLogs(_ context.Context, clusterId string, infraEnvId string, hostId string, upfile io.Reader) error {
+	size, err := io.Copy(ioutil.Discard, upfile)
+	c.record("UploadHostLogs", map[string]interface{}{"clusterId": clusterId, "infraEnvId": infraEnvId, "hostId": hostId, "size": size})
+	return err
+}
+
+func (c *recordingInventoryClient) ClusterLogProgressReport(_ context.Context, clusterId string, progress models.LogsState) {
+	c.record("ClusterLogProgressReport", map[string]interface{}{"clusterId": clusterId, "progress": progress})
+}
+
+func (c *recordingInventoryClient) HostLogProgressReport(_ context.Context, infraEnvId string, hostId string, progress models.LogsState) {
+	c.record("HostLogProgressReport", map[string]interface{}{"infraEnvId": infraEnvId, "hostId": hostId, "progress": progress})
+}
+
+func (c *recordingInventoryClient) UpdateClusterOperator(_ context.Context, clusterId string, operatorName string, operatorStatus models.OperatorStatus, operatorStatusInfo string) error {
+	c.record("UpdateClusterOperator", map[string]interface{}{"clusterId": clusterId, "operatorName": operatorName,
+		"operatorStatus": operatorStatus, "operatorStatusInfo": operatorStatusInfo})
+	return nil
+}
+
+func (c *recordingInventoryClient) GetServiceTime(_ context.Context) (time.Time, error) {
+	c.record("GetServiceTime", nil)
+	return time.Time{}, ErrRecordingOnly
+}
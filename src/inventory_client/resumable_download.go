@@ -0,0 +1,155 @@
+package inventory_client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// partialDownloadSuffix is appended to the destination of a download until it completes, an
+	// interrupted download is resumed from the partial file
+	partialDownloadSuffix = ".part"
+	// downloadValidatorSuffix is appended to the partial file to keep the ETag or Last-Modified of the
+	// file the partial bytes were downloaded from
+	downloadValidatorSuffix = ".validator"
+)
+
+// errPartialMismatch is returned when the service can't send the rest of the partial file, the
+// partial file is then downloaded again from the start
+var errPartialMismatch = errors.New("partial download doesn't match the file on the service")
+
+// resumeTransport resumes a download from the end of the partial file. The Range is sent with an
+// If-Range holding the validator of the file the partial bytes came from, so a file the service
+// regenerated since is sent whole and the partial bytes are dropped.
+type resumeTransport struct {
+	transport     http.RoundTripper
+	file          *os.File
+	offset        int64
+	validator     string
+	validatorPath string
+}
+
+func (t *resumeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.offset > 0 {
+		req = req.Clone(req.Context())
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", t.offset))
+		req.Header.Set("If-Range", t.validator)
+	}
+	res, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+		if start, ok := contentRangeStart(res.Header.Get("Content-Range")); !ok || start != t.offset {
+			res.Body.Close()
+			return nil, errors.Wrapf(errPartialMismatch, "got content range %q for a download resumed from byte %d",
+				res.Header.Get("Content-Range"), t.offset)
+		}
+		// the generated reader only writes the content of a 200 response
+		res.StatusCode = http.StatusOK
+	case http.StatusOK:
+		// the whole file, the partial bytes if any belong to another version of it
+		if err = t.restart(res.Header); err != nil {
+			res.Body.Close()
+			return nil, err
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		res.Body.Close()
+		return nil, errors.Wrapf(errPartialMismatch, "range from byte %d not satisfiable", t.offset)
+	}
+	return res, nil
+}
+
+// restart drops the partial bytes and keeps the validator of the file being downloaded
+func (t *resumeTransport) restart(header http.Header) error {
+	if err := t.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	validator := header.Get("ETag")
+	if validator == "" {
+		validator = header.Get("Last-Modified")
+	}
+	if validator == "" {
+		return os.RemoveAll(t.validatorPath)
+	}
+	return ioutil.WriteFile(t.validatorPath, []byte(validator), 0644)
+}
+
+// contentRangeStart parses the first byte of a "bytes <first>-<last>/<size>" Content-Range
+func contentRangeStart(contentRange string) (int64, bool) {
+	var start, end int64
+	var size string
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%s", &start, &end, &size); err != nil {
+		return 0, false
+	}
+	return start, true
+}
+
+func (c *inventoryClient) downloadFileFrom(ctx context.Context, filename string, transport *resumeTransport) error {
+	params := c.createDownloadParams(filename)
+	params.HTTPClient = &http.Client{Transport: transport}
+	_, err := c.ai.Installer.V2DownloadClusterFiles(ctx, params, transport.file)
+	return err
+}
+
+// DownloadFile downloads to a partial file next to dest and renames it once complete. When the
+// partial file already exists, only the missing bytes are requested from the service.
+func (c *inventoryClient) DownloadFile(ctx context.Context, filename string, dest string) error {
+	partial := dest + partialDownloadSuffix
+	fo, err := os.OpenFile(partial, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer fo.Close()
+	transport := &resumeTransport{transport: c.downloadTransport, file: fo, validatorPath: partial + downloadValidatorSuffix}
+	if transport.offset, err = fo.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	if transport.offset > 0 {
+		validator, readErr := ioutil.ReadFile(transport.validatorPath)
+		transport.validator = strings.TrimSpace(string(validator))
+		if readErr != nil || transport.validator == "" {
+			c.logger.Warnf("Partial download of %s can't be matched with the file on the service, downloading it again", filename)
+			if err = transport.restart(http.Header{}); err != nil {
+				return err
+			}
+			transport.offset = 0
+		}
+	}
+	if transport.offset > 0 {
+		c.logger.Infof("Resuming download of file %s to %s from byte %d", filename, dest, transport.offset)
+	} else {
+		c.logger.Infof("Downloading file %s to %s", filename, dest)
+	}
+	err = c.downloadFileFrom(ctx, filename, transport)
+	if errors.Is(err, errPartialMismatch) {
+		c.logger.WithError(err).Warnf("Partial download of %s doesn't match the file on the service, downloading it again", filename)
+		if err = transport.restart(http.Header{}); err != nil {
+			return err
+		}
+		transport.offset = 0
+		err = c.downloadFileFrom(ctx, filename, transport)
+	}
+	if err != nil {
+		return newDownloadError(filename, err)
+	}
+	if err = fo.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(partial, dest); err != nil {
+		return err
+	}
+	return os.RemoveAll(transport.validatorPath)
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -35,6 +36,7 @@ import (
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	certificatesClient "k8s.io/client-go/kubernetes/typed/certificates/v1"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 	runtimeconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
 
@@ -49,8 +51,8 @@ type K8SClient interface {
 	ListMasterNodes() (*v1.NodeList, error)
 	PatchEtcd() error
 	UnPatchEtcd() error
-	PatchControlPlaneReplicas() error
-	UnPatchControlPlaneReplicas() error
+	PatchControlPlaneReplicas(replicas int) error
+	UnPatchControlPlaneReplicas(replicas int) error
 	ListNodes() (*v1.NodeList, error)
 	ListMachines() (*machinev1beta1.MachineList, error)
 	RunOCctlCommand(args []string, kubeconfigPath string, o ops.Ops) (string, error)
@@ -59,15 +61,18 @@ type K8SClient interface {
 	GetConfigMap(namespace string, name string) (*v1.ConfigMap, error)
 	GetPodLogs(namespace string, podName string, sinceSeconds int64) (string, error)
 	GetPodLogsAsBuffer(namespace string, podName string, sinceSeconds int64) (*bytes.Buffer, error)
+	FollowPodLogsAsBuffer(namespace string, podName string, sinceSeconds int64, followFor time.Duration, maxBytes int64) (*bytes.Buffer, error)
 	GetPods(namespace string, labelMatch map[string]string, fieldSelector string) ([]v1.Pod, error)
 	GetCSV(namespace string, name string) (*olmv1alpha1.ClusterServiceVersion, error)
 	GetCSVFromSubscription(namespace string, name string) (string, error)
 	IsMetalProvisioningExists() (bool, error)
+	ListMachineConfigPools() ([]MachineConfigPool, error)
 	ListBMHs() (metal3v1alpha1.BareMetalHostList, error)
 	GetBMH(name string) (*metal3v1alpha1.BareMetalHost, error)
 	UpdateBMHStatus(bmh *metal3v1alpha1.BareMetalHost) error
 	UpdateBMH(bmh *metal3v1alpha1.BareMetalHost) error
 	SetProxyEnvVars() error
+	GetClusterProxy() (*configv1.Proxy, error)
 	GetClusterVersion(name string) (*configv1.ClusterVersion, error)
 	GetNetworkType() (string, error)
 	GetServiceNetworks() ([]string, error)
@@ -82,6 +87,8 @@ type K8SClient interface {
 	PatchNamespace(namespace string, data []byte) error
 	GetNode(name string) (*v1.Node, error)
 	PatchNodeLabels(nodeName string, nodeLabels string) error
+	PatchConfigMapAnnotations(namespace, name string, annotations map[string]string) error
+	LeaderElectionLock(namespace, name, identity string) resourcelock.Interface
 }
 
 type K8SClientBuilder func(configPath string, logger logrus.FieldLogger) (K8SClient, error)
@@ -354,12 +361,12 @@ func (c *k8sClient) updateControlPlaneReplicas(value string) error {
 	return nil
 }
 
-func (c *k8sClient) PatchControlPlaneReplicas() error {
-	return c.updateControlPlaneReplicas("2")
+func (c *k8sClient) PatchControlPlaneReplicas(replicas int) error {
+	return c.updateControlPlaneReplicas(strconv.Itoa(replicas))
 }
 
-func (c *k8sClient) UnPatchControlPlaneReplicas() error {
-	return c.updateControlPlaneReplicas("3")
+func (c *k8sClient) UnPatchControlPlaneReplicas(replicas int) error {
+	return c.updateControlPlaneReplicas(strconv.Itoa(replicas))
 }
 
 func (c *k8sClient) RunOCctlCommand(args []string, kubeconfigPath string, o ops.Ops) (string, error) {
@@ -405,9 +412,12 @@ func (c *k8sClient) GetConfigMap(namespace string, name string) (*v1.ConfigMap,
 	return cm, nil
 }
 
+func (c *k8sClient) GetClusterProxy() (*configv1.Proxy, error) {
+	return c.proxyClient.Get(context.TODO(), "cluster", metav1.GetOptions{})
+}
+
 func (c *k8sClient) SetProxyEnvVars() error {
-	options := metav1.GetOptions{}
-	proxy, err := c.proxyClient.Get(context.TODO(), "cluster", options)
+	proxy, err := c.GetClusterProxy()
 	if err != nil {
 		return err
 	}
@@ -481,6 +491,25 @@ func (c *k8sClient) GetPodLogsAsBuffer(namespace string, podName string, sinceSe
 	return buf, nil
 }
 
+// FollowPodLogsAsBuffer streams the pod logs for followFor and returns what was read until then,
+// at most maxBytes of it
+func (c *k8sClient) FollowPodLogsAsBuffer(namespace string, podName string, sinceSeconds int64, followFor time.Duration, maxBytes int64) (*bytes.Buffer, error) {
+	podLogOpts := v1.PodLogOptions{Follow: true}
+	if sinceSeconds > 0 {
+		podLogOpts.SinceSeconds = &sinceSeconds
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), followFor)
+	defer cancel()
+	req := c.client.CoreV1().Pods(namespace).GetLogs(podName, &podLogOpts)
+	podLogs, err := req.Stream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer podLogs.Close()
+
+	return utils.ReadStreamUntilDone(ctx, podLogs, maxBytes)
+}
+
 func (c *k8sClient) IsMetalProvisioningExists() (bool, error) {
 	u := &unstructured.Unstructured{}
 	u.SetGroupVersionKind(schema.GroupVersionKind{
@@ -504,6 +533,50 @@ func (c *k8sClient) IsMetalProvisioningExists() (bool, error) {
 	return true, nil
 }
 
+// MachineConfigPool holds the status of a machine config pool. The machine config operator types
+// aren't vendored, so pools are read as unstructured objects.
+type MachineConfigPool struct {
+	Name                string
+	MachineCount        int64
+	UpdatedMachineCount int64
+	Updated             bool
+	Degraded            bool
+}
+
+func (c *k8sClient) ListMachineConfigPools() ([]MachineConfigPool, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "machineconfiguration.openshift.io",
+		Kind:    "MachineConfigPoolList",
+		Version: "v1",
+	})
+	if err := c.runtimeClient.List(context.Background(), list); err != nil {
+		return nil, err
+	}
+
+	pools := make([]MachineConfigPool, 0, len(list.Items))
+	for _, item := range list.Items {
+		pool := MachineConfigPool{Name: item.GetName()}
+		pool.MachineCount, _, _ = unstructured.NestedInt64(item.Object, "status", "machineCount")
+		pool.UpdatedMachineCount, _, _ = unstructured.NestedInt64(item.Object, "status", "updatedMachineCount")
+		conditions, _, _ := unstructured.NestedSlice(item.Object, "status", "conditions")
+		for _, condition := range conditions {
+			cond, ok := condition.(map[string]interface{})
+			if !ok || cond["status"] != string(v1.ConditionTrue) {
+				continue
+			}
+			switch cond["type"] {
+			case "Updated":
+				pool.Updated = true
+			case "Degraded":
+				pool.Degraded = true
+			}
+		}
+		pools = append(pools, pool)
+	}
+	return pools, nil
+}
+
 func (c *k8sClient) ListBMHs() (metal3v1alpha1.BareMetalHostList, error) {
 	hosts := metal3v1alpha1.BareMetalHostList{}
 	opts := &runtimeclient.ListOptions{
@@ -600,3 +673,20 @@ func (c *k8sClient) PatchNodeLabels(nodeName string, nodeLabels string) error {
 	_, err := c.client.CoreV1().Nodes().Patch(context.Background(), nodeName, types.MergePatchType, data, metav1.PatchOptions{})
 	return err
 }
+
+func (c *k8sClient) PatchConfigMapAnnotations(namespace, name string, annotations map[string]string) error {
+	data, err := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"annotations": annotations}})
+	if err != nil {
+		return err
+	}
+	_, err = c.client.CoreV1().ConfigMaps(namespace).Patch(context.Background(), name, types.MergePatchType, data, metav1.PatchOptions{})
+	return err
+}
+
+func (c *k8sClient) LeaderElectionLock(namespace, name, identity string) resourcelock.Interface {
+	return &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Client:     c.client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+}
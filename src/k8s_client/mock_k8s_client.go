@@ -7,6 +7,7 @@ package k8s_client
 import (
 	bytes "bytes"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
@@ -16,6 +17,7 @@ import (
 	v1alpha10 "github.com/operator-framework/api/pkg/operators/v1alpha1"
 	v10 "k8s.io/api/certificates/v1"
 	v11 "k8s.io/api/core/v1"
+	resourcelock "k8s.io/client-go/tools/leaderelection/resourcelock"
 )
 
 // MockK8SClient is a mock of K8SClient interface
@@ -85,31 +87,31 @@ func (mr *MockK8SClientMockRecorder) UnPatchEtcd() *gomock.Call {
 }
 
 // PatchControlPlaneReplicas mocks base method
-func (m *MockK8SClient) PatchControlPlaneReplicas() error {
+func (m *MockK8SClient) PatchControlPlaneReplicas(replicas int) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "PatchControlPlaneReplicas")
+	ret := m.ctrl.Call(m, "PatchControlPlaneReplicas", replicas)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // PatchControlPlaneReplicas indicates an expected call of PatchControlPlaneReplicas
-func (mr *MockK8SClientMockRecorder) PatchControlPlaneReplicas() *gomock.Call {
+func (mr *MockK8SClientMockRecorder) PatchControlPlaneReplicas(replicas interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PatchControlPlaneReplicas", reflect.TypeOf((*MockK8SClient)(nil).PatchControlPlaneReplicas))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PatchControlPlaneReplicas", reflect.TypeOf((*MockK8SClient)(nil).PatchControlPlaneReplicas), replicas)
 }
 
 // UnPatchControlPlaneReplicas mocks base method
-func (m *MockK8SClient) UnPatchControlPlaneReplicas() error {
+func (m *MockK8SClient) UnPatchControlPlaneReplicas(replicas int) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UnPatchControlPlaneReplicas")
+	ret := m.ctrl.Call(m, "UnPatchControlPlaneReplicas", replicas)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UnPatchControlPlaneReplicas indicates an expected call of UnPatchControlPlaneReplicas
-func (mr *MockK8SClientMockRecorder) UnPatchControlPlaneReplicas() *gomock.Call {
+func (mr *MockK8SClientMockRecorder) UnPatchControlPlaneReplicas(replicas interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnPatchControlPlaneReplicas", reflect.TypeOf((*MockK8SClient)(nil).UnPatchControlPlaneReplicas))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnPatchControlPlaneReplicas", reflect.TypeOf((*MockK8SClient)(nil).UnPatchControlPlaneReplicas), replicas)
 }
 
 // ListNodes mocks base method
@@ -231,6 +233,36 @@ func (mr *MockK8SClientMockRecorder) GetPodLogsAsBuffer(namespace, podName, sinc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPodLogsAsBuffer", reflect.TypeOf((*MockK8SClient)(nil).GetPodLogsAsBuffer), namespace, podName, sinceSeconds)
 }
 
+// FollowPodLogsAsBuffer mocks base method
+func (m *MockK8SClient) FollowPodLogsAsBuffer(namespace, podName string, sinceSeconds int64, followFor time.Duration, maxBytes int64) (*bytes.Buffer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FollowPodLogsAsBuffer", namespace, podName, sinceSeconds, followFor, maxBytes)
+	ret0, _ := ret[0].(*bytes.Buffer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FollowPodLogsAsBuffer indicates an expected call of FollowPodLogsAsBuffer
+func (mr *MockK8SClientMockRecorder) FollowPodLogsAsBuffer(namespace, podName, sinceSeconds, followFor, maxBytes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FollowPodLogsAsBuffer", reflect.TypeOf((*MockK8SClient)(nil).FollowPodLogsAsBuffer), namespace, podName, sinceSeconds, followFor, maxBytes)
+}
+
+// ListMachineConfigPools mocks base method
+func (m *MockK8SClient) ListMachineConfigPools() ([]MachineConfigPool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListMachineConfigPools")
+	ret0, _ := ret[0].([]MachineConfigPool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListMachineConfigPools indicates an expected call of ListMachineConfigPools
+func (mr *MockK8SClientMockRecorder) ListMachineConfigPools() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMachineConfigPools", reflect.TypeOf((*MockK8SClient)(nil).ListMachineConfigPools))
+}
+
 // GetPods mocks base method
 func (m *MockK8SClient) GetPods(namespace string, labelMatch map[string]string, fieldSelector string) ([]v11.Pod, error) {
 	m.ctrl.T.Helper()
@@ -363,6 +395,21 @@ func (mr *MockK8SClientMockRecorder) SetProxyEnvVars() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetProxyEnvVars", reflect.TypeOf((*MockK8SClient)(nil).SetProxyEnvVars))
 }
 
+// GetClusterProxy mocks base method
+func (m *MockK8SClient) GetClusterProxy() (*v1.Proxy, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetClusterProxy")
+	ret0, _ := ret[0].(*v1.Proxy)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetClusterProxy indicates an expected call of GetClusterProxy
+func (mr *MockK8SClientMockRecorder) GetClusterProxy() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetClusterProxy", reflect.TypeOf((*MockK8SClient)(nil).GetClusterProxy))
+}
+
 // GetClusterVersion mocks base method
 func (m *MockK8SClient) GetClusterVersion(name string) (*v1.ClusterVersion, error) {
 	m.ctrl.T.Helper()
@@ -568,3 +615,31 @@ func (mr *MockK8SClientMockRecorder) PatchNodeLabels(nodeName, nodeLabels interf
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PatchNodeLabels", reflect.TypeOf((*MockK8SClient)(nil).PatchNodeLabels), nodeName, nodeLabels)
 }
+
+// PatchConfigMapAnnotations mocks base method
+func (m *MockK8SClient) PatchConfigMapAnnotations(namespace, name string, annotations map[string]string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PatchConfigMapAnnotations", namespace, name, annotations)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PatchConfigMapAnnotations indicates an expected call of PatchConfigMapAnnotations
+func (mr *MockK8SClientMockRecorder) PatchConfigMapAnnotations(namespace, name, annotations interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PatchConfigMapAnnotations", reflect.TypeOf((*MockK8SClient)(nil).PatchConfigMapAnnotations), namespace, name, annotations)
+}
+
+// LeaderElectionLock mocks base method
+func (m *MockK8SClient) LeaderElectionLock(namespace, name, identity string) resourcelock.Interface {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LeaderElectionLock", namespace, name, identity)
+	ret0, _ := ret[0].(resourcelock.Interface)
+	return ret0
+}
+
+// LeaderElectionLock indicates an expected call of LeaderElectionLock
+func (mr *MockK8SClientMockRecorder) LeaderElectionLock(namespace, name, identity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LeaderElectionLock", reflect.TypeOf((*MockK8SClient)(nil).LeaderElectionLock), namespace, name, identity)
+}
@@ -3,8 +3,9 @@ package main
 import (
 	"context"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
-	"sync"
 	"time"
 
 	"github.com/golang/mock/gomock"
@@ -52,6 +53,9 @@ func main() {
 	if err != nil {
 		log.Fatal(err.Error())
 	}
+	if err = Options.ControllerConfig.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	if Options.ControllerConfig.DryRunEnabled {
 		if err = config.DryParseClusterHosts(Options.ControllerConfig.DryRunClusterHostsPath, &Options.ControllerConfig.ParsedClusterHosts); err != nil {
@@ -89,10 +93,19 @@ func main() {
 	// everything in assisted-controller runs in loops, we prefer to fail early on error and to retry on the next loop
 	// this will allow us to show service error more quickly
 	// Currently we will retry maximum for 10 times per call
-	client, err := inventory_client.CreateInventoryClientWithDelay(Options.ControllerConfig.ClusterID,
-		Options.ControllerConfig.URL, Options.ControllerConfig.PullSecretToken, Options.ControllerConfig.SkipCertVerification,
-		Options.ControllerConfig.CACertPath, logger, utils.ProxyFromEnvVars, inventory_client.DefaultRetryMinDelay,
-		inventory_client.DefaultRetryMaxDelay, maximumInventoryClientRetries, inventory_client.DefaultMinRetries)
+	var client inventory_client.InventoryClient
+	if Options.ControllerConfig.DryRunEnabled && Options.ControllerConfig.DryInventoryRecordPath != "" {
+		client, err = inventory_client.CreateRecordingInventoryClient(Options.ControllerConfig.DryInventoryRecordPath, logger)
+	} else {
+		userAgent := Options.ControllerConfig.UserAgent
+		if userAgent == "" {
+			userAgent = inventory_client.DefaultUserAgent("assisted-installer-controller", "")
+		}
+		client, err = inventory_client.CreateInventoryClientWithDelay(Options.ControllerConfig.ClusterID,
+			Options.ControllerConfig.URL, Options.ControllerConfig.PullSecretToken, Options.ControllerConfig.SkipCertVerification,
+			Options.ControllerConfig.CACertPath, logger, inventoryProxyFunc(kc, Options.ControllerConfig.URL, logger), inventory_client.DefaultRetryMinDelay,
+			inventory_client.DefaultRetryMaxDelay, maximumInventoryClientRetries, inventory_client.DefaultMinRetries, userAgent)
+	}
 	if err != nil {
 		log.Fatalf("Failed to create inventory client %v", err)
 	}
@@ -104,43 +117,61 @@ func main() {
 		kc,
 	)
 
-	var wg sync.WaitGroup
 	mainContext, mainContextCancel := context.WithCancel(context.Background())
 
-	// No need to cancel with context, will finish quickly
-	// we should fix try to fix dns service issue as soon as possible
-	if !Options.ControllerConfig.DryRunEnabled {
-		// This check is unnecessary in dry run mode, and mocking for it is complicated
-		go assistedController.HackDNSAddressConflict(&wg)
-		wg.Add(1)
+	if Options.ControllerConfig.LeaderElectionEnabled {
+		if err = assistedController.AcquireLeadership(mainContext, func() {
+			log.Fatalf("Lost leadership, exiting")
+		}); err != nil {
+			log.Fatalf("Failed to acquire leadership %v", err)
+		}
 	}
-	assistedController.SetReadyState()
 
-	// While adding new routine don't miss to add wg.add(1)
-	// without adding it will panic
+	runDone := make(chan struct{})
+	go func() {
+		defer close(runDone)
+		assistedController.Run(mainContext)
+	}()
 
 	defer func() {
 		// stop all go routines
 		mainContextCancel()
 		logger.Infof("Waiting for all go routines to finish")
-		wg.Wait()
+		<-runDone
 		logger.Infof("Finished all")
 	}()
 
-	go assistedController.WaitAndUpdateNodesStatus(mainContext, &wg)
-	wg.Add(1)
-	go assistedController.PostInstallConfigs(mainContext, &wg)
-	wg.Add(1)
-	go assistedController.UpdateBMHs(mainContext, &wg)
-	wg.Add(1)
-
-	go assistedController.UploadLogs(mainContext, &wg)
-	wg.Add(1)
-
 	// monitoring installation by cluster status
 	waitForInstallation(client, logger, assistedController.Status)
 }
 
+// inventoryProxyFunc returns the proxy function for the inventory client. The cluster wide proxy is
+// used when configured, otherwise we fall back to the proxy env vars. The proxy is bypassed for the
+// in-cluster destinations, including the service when it runs in the cluster.
+func inventoryProxyFunc(kc k8s_client.K8SClient, serviceURL string, log logrus.FieldLogger) func(*http.Request) (*url.URL, error) {
+	httpProxy, httpsProxy, noProxy := os.Getenv("HTTP_PROXY"), os.Getenv("HTTPS_PROXY"), os.Getenv("NO_PROXY")
+	proxy, err := kc.GetClusterProxy()
+	switch {
+	case err != nil:
+		log.WithError(err).Warnf("Failed to get cluster proxy, using proxy env vars")
+	case proxy.Status.HTTPProxy == "" && proxy.Status.HTTPSProxy == "":
+		log.Infof("Cluster proxy is not configured, using proxy env vars")
+	default:
+		log.Infof("Using cluster proxy %+v for inventory client", proxy.Status)
+		httpProxy, httpsProxy, noProxy = proxy.Status.HTTPProxy, proxy.Status.HTTPSProxy, proxy.Status.NoProxy
+	}
+	if httpProxy == "" && httpsProxy == "" {
+		return utils.ProxyFromEnvVars
+	}
+	serviceNetworks, err := kc.GetServiceNetworks()
+	if err != nil {
+		log.WithError(err).Warnf("Failed to get the service networks, only bypassing the proxy for the in-cluster domains")
+	}
+	noProxy = utils.InClusterNoProxy(noProxy, serviceNetworks, serviceURL)
+	log.Infof("Inventory client bypasses the proxy for %s", noProxy)
+	return utils.ProxyFuncFromSettings(httpProxy, httpsProxy, noProxy)
+}
+
 // waitForInstallation monitor cluster status and is blocking main from cancelling all go routine s
 // if cluster status is (cancelled,installed) there is no need to continue and we will exit.
 // if cluster is in error, in addition to stop waiting we need to set error status to tell upload logs to send must-gather.
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"testing"
 	"time"
 
@@ -12,8 +13,11 @@ import (
 	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	configv1 "github.com/openshift/api/config/v1"
 	assistedinstallercontroller "github.com/openshift/assisted-installer/src/assisted_installer_controller"
 	"github.com/openshift/assisted-installer/src/inventory_client"
+	"github.com/openshift/assisted-installer/src/k8s_client"
+	"github.com/openshift/assisted-installer/src/utils"
 	"github.com/openshift/assisted-service/models"
 	"github.com/sirupsen/logrus"
 )
@@ -137,3 +141,109 @@ var _ = Describe("installer HostRoleMaster role", func() {
 	})
 
 })
+
+var _ = Describe("inventoryProxyFunc", func() {
+	var (
+		l             = logrus.New()
+		ctrl          *gomock.Controller
+		mockk8sclient *k8s_client.MockK8SClient
+		req           *http.Request
+	)
+	const serviceURL = "https://api.openshift.com"
+
+	l.SetOutput(ioutil.Discard)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockk8sclient = k8s_client.NewMockK8SClient(ctrl)
+		var err error
+		req, err = http.NewRequest(http.MethodGet, "https://api.openshift.com/api/assisted-install", nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+
+	It("uses the cluster proxy when configured", func() {
+		proxy := &configv1.Proxy{Status: configv1.ProxyStatus{
+			HTTPProxy:  "http://proxy.example.com:3128",
+			HTTPSProxy: "http://secure-proxy.example.com:3128",
+			NoProxy:    "internal.example.com",
+		}}
+		mockk8sclient.EXPECT().GetClusterProxy().Return(proxy, nil).Times(1)
+		mockk8sclient.EXPECT().GetServiceNetworks().Return([]string{"172.30.0.0/16"}, nil).Times(1)
+		proxyFunc := inventoryProxyFunc(mockk8sclient, serviceURL, l)
+
+		proxyURL, err := proxyFunc(req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(proxyURL.String()).To(Equal("http://secure-proxy.example.com:3128"))
+
+		noProxyReq, err := http.NewRequest(http.MethodGet, "https://internal.example.com/api", nil)
+		Expect(err).NotTo(HaveOccurred())
+		proxyURL, err = proxyFunc(noProxyReq)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(proxyURL).To(BeNil())
+	})
+
+	It("bypasses the proxy for in-cluster destinations", func() {
+		proxy := &configv1.Proxy{Status: configv1.ProxyStatus{HTTPProxy: "http://proxy.example.com:3128"}}
+		mockk8sclient.EXPECT().GetClusterProxy().Return(proxy, nil).Times(1)
+		mockk8sclient.EXPECT().GetServiceNetworks().Return([]string{"172.30.0.0/16", "fd02::/112"}, nil).Times(1)
+		proxyFunc := inventoryProxyFunc(mockk8sclient, "http://assisted-service:8090", l)
+
+		for _, destination := range []string{
+			"http://assisted-service:8090/api/assisted-install",
+			"http://172.30.0.10:8090/api",
+			"http://[fd02::10]:8090/api",
+			"http://assisted-service.assisted-installer.svc:8090/api",
+			"http://assisted-service.assisted-installer.svc.cluster.local:8090/api",
+		} {
+			inClusterReq, err := http.NewRequest(http.MethodGet, destination, nil)
+			Expect(err).NotTo(HaveOccurred())
+			proxyURL, err := proxyFunc(inClusterReq)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(proxyURL).To(BeNil(), destination)
+		}
+
+		externalReq, err := http.NewRequest(http.MethodGet, "http://10.0.0.10:8090/api", nil)
+		Expect(err).NotTo(HaveOccurred())
+		proxyURL, err := proxyFunc(externalReq)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(proxyURL.String()).To(Equal("http://proxy.example.com:3128"))
+	})
+
+	It("bypasses the proxy for the in-cluster domains when the service networks can't be read", func() {
+		proxy := &configv1.Proxy{Status: configv1.ProxyStatus{HTTPProxy: "http://proxy.example.com:3128"}}
+		mockk8sclient.EXPECT().GetClusterProxy().Return(proxy, nil).Times(1)
+		mockk8sclient.EXPECT().GetServiceNetworks().Return(nil, fmt.Errorf("dummy")).Times(1)
+		proxyFunc := inventoryProxyFunc(mockk8sclient, serviceURL, l)
+
+		inClusterReq, err := http.NewRequest(http.MethodGet, "http://assisted-service.assisted-installer.svc:8090/api", nil)
+		Expect(err).NotTo(HaveOccurred())
+		proxyURL, err := proxyFunc(inClusterReq)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(proxyURL).To(BeNil())
+
+		externalReq, err := http.NewRequest(http.MethodGet, "http://api.openshift.com/api/assisted-install", nil)
+		Expect(err).NotTo(HaveOccurred())
+		proxyURL, err = proxyFunc(externalReq)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(proxyURL.String()).To(Equal("http://proxy.example.com:3128"))
+	})
+
+	It("falls back to env vars when the cluster proxy is not configured", func() {
+		mockk8sclient.EXPECT().GetClusterProxy().Return(&configv1.Proxy{}, nil).Times(1)
+		proxyURL, err := inventoryProxyFunc(mockk8sclient, serviceURL, l)(req)
+		Expect(err).NotTo(HaveOccurred())
+		expectedURL, _ := utils.ProxyFromEnvVars(req)
+		Expect(fmt.Sprint(proxyURL)).To(Equal(fmt.Sprint(expectedURL)))
+	})
+
+	It("falls back to env vars when the cluster proxy can't be read", func() {
+		mockk8sclient.EXPECT().GetClusterProxy().Return(nil, fmt.Errorf("dummy")).Times(1)
+		proxyURL, err := inventoryProxyFunc(mockk8sclient, serviceURL, l)(req)
+		Expect(err).NotTo(HaveOccurred())
+		expectedURL, _ := utils.ProxyFromEnvVars(req)
+		Expect(fmt.Sprint(proxyURL)).To(Equal(fmt.Sprint(expectedURL)))
+	})
+})
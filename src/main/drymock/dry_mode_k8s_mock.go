@@ -76,6 +76,8 @@ Dry`)
 func PrepareControllerDryMock(mockk8sclient *k8s_client.MockK8SClient, logger *logrus.Logger, o ops.Ops, clusterHosts config.DryClusterHosts) {
 	// Called by main
 	mockk8sclient.EXPECT().SetProxyEnvVars().Return(nil).AnyTimes()
+	mockk8sclient.EXPECT().GetClusterProxy().Return(&configv1.Proxy{}, nil).AnyTimes()
+	mockk8sclient.EXPECT().GetServiceNetworks().Return([]string{}, nil).AnyTimes()
 
 	// Called a lot
 	mockk8sclient.EXPECT().CreateEvent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Do(func(namespace, name, message, component string) {
@@ -11,7 +11,12 @@ import (
 func main() {
 	installerConfig := &config.Config{}
 	installerConfig.ProcessArgs(os.Args[1:])
-	logger := utils.InitLogger(installerConfig.Verbose, true, installerConfig.ForcedHostID, config.DefaultDryRunConfig.DryRunEnabled)
+	// the dry run fake host ID wins, it also tells the log files of the dry run hosts apart
+	hostID := installerConfig.ForcedHostID
+	if hostID == "" {
+		hostID = installerConfig.HostID
+	}
+	logger := utils.InitLogger(installerConfig.Verbose, true, hostID, config.DefaultDryRunConfig.DryRunEnabled)
 	installerConfig.PullSecretToken = os.Getenv("PULL_SECRET_TOKEN")
 	if installerConfig.PullSecretToken == "" {
 		logger.Warnf("Agent Authentication Token not set")
@@ -5,6 +5,7 @@
 package ops
 
 import (
+	context "context"
 	io "io"
 	reflect "reflect"
 
@@ -55,6 +56,26 @@ func (mr *MockOpsMockRecorder) ExecPrivilegeCommand(liveLogger, command interfac
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecPrivilegeCommand", reflect.TypeOf((*MockOps)(nil).ExecPrivilegeCommand), varargs...)
 }
 
+// ExecPrivilegeCommandContext mocks base method
+func (m *MockOps) ExecPrivilegeCommandContext(ctx context.Context, liveLogger io.Writer, command string, args ...string) (string, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, liveLogger, command}
+	for _, a := range args {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ExecPrivilegeCommandContext", varargs...)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExecPrivilegeCommandContext indicates an expected call of ExecPrivilegeCommandContext
+func (mr *MockOpsMockRecorder) ExecPrivilegeCommandContext(ctx, liveLogger, command interface{}, args ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, liveLogger, command}, args...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecPrivilegeCommandContext", reflect.TypeOf((*MockOps)(nil).ExecPrivilegeCommandContext), varargs...)
+}
+
 // ExecCommand mocks base method
 func (m *MockOps) ExecCommand(liveLogger io.Writer, command string, args ...string) (string, error) {
 	m.ctrl.T.Helper()
@@ -90,17 +111,17 @@ func (mr *MockOpsMockRecorder) Mkdir(dirName interface{}) *gomock.Call {
 }
 
 // WriteImageToDisk mocks base method
-func (m *MockOps) WriteImageToDisk(ignitionPath, device string, progressReporter inventory_client.InventoryClient, extra []string) error {
+func (m *MockOps) WriteImageToDisk(ctx context.Context, ignitionPath, device string, progressReporter inventory_client.InventoryClient, extra []string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "WriteImageToDisk", ignitionPath, device, progressReporter, extra)
+	ret := m.ctrl.Call(m, "WriteImageToDisk", ctx, ignitionPath, device, progressReporter, extra)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // WriteImageToDisk indicates an expected call of WriteImageToDisk
-func (mr *MockOpsMockRecorder) WriteImageToDisk(ignitionPath, device, progressReporter, extra interface{}) *gomock.Call {
+func (mr *MockOpsMockRecorder) WriteImageToDisk(ctx, ignitionPath, device, progressReporter, extra interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteImageToDisk", reflect.TypeOf((*MockOps)(nil).WriteImageToDisk), ignitionPath, device, progressReporter, extra)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteImageToDisk", reflect.TypeOf((*MockOps)(nil).WriteImageToDisk), ctx, ignitionPath, device, progressReporter, extra)
 }
 
 // Reboot mocks base method
@@ -131,18 +152,33 @@ func (mr *MockOpsMockRecorder) SetBootOrder(device interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetBootOrder", reflect.TypeOf((*MockOps)(nil).SetBootOrder), device)
 }
 
+// GetEfiBootEntries mocks base method
+func (m *MockOps) GetEfiBootEntries() ([]EfiBootEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetEfiBootEntries")
+	ret0, _ := ret[0].([]EfiBootEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetEfiBootEntries indicates an expected call of GetEfiBootEntries
+func (mr *MockOpsMockRecorder) GetEfiBootEntries() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEfiBootEntries", reflect.TypeOf((*MockOps)(nil).GetEfiBootEntries))
+}
+
 // ExtractFromIgnition mocks base method
-func (m *MockOps) ExtractFromIgnition(ignitionPath, fileToExtract string) error {
+func (m *MockOps) ExtractFromIgnition(ignitionPath, fileToExtract, destination string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ExtractFromIgnition", ignitionPath, fileToExtract)
+	ret := m.ctrl.Call(m, "ExtractFromIgnition", ignitionPath, fileToExtract, destination)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // ExtractFromIgnition indicates an expected call of ExtractFromIgnition
-func (mr *MockOpsMockRecorder) ExtractFromIgnition(ignitionPath, fileToExtract interface{}) *gomock.Call {
+func (mr *MockOpsMockRecorder) ExtractFromIgnition(ignitionPath, fileToExtract, destination interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExtractFromIgnition", reflect.TypeOf((*MockOps)(nil).ExtractFromIgnition), ignitionPath, fileToExtract)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExtractFromIgnition", reflect.TypeOf((*MockOps)(nil).ExtractFromIgnition), ignitionPath, fileToExtract, destination)
 }
 
 // SystemctlAction mocks base method
@@ -292,6 +328,36 @@ func (mr *MockOpsMockRecorder) CleanRaidMembership(device interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CleanRaidMembership", reflect.TypeOf((*MockOps)(nil).CleanRaidMembership), device)
 }
 
+// GetDegradedRaidDevices mocks base method
+func (m *MockOps) GetDegradedRaidDevices(device string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDegradedRaidDevices", device)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDegradedRaidDevices indicates an expected call of GetDegradedRaidDevices
+func (mr *MockOpsMockRecorder) GetDegradedRaidDevices(device interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDegradedRaidDevices", reflect.TypeOf((*MockOps)(nil).GetDegradedRaidDevices), device)
+}
+
+// ZeroRaidSuperblocks mocks base method
+func (m *MockOps) ZeroRaidSuperblocks(device string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ZeroRaidSuperblocks", device)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ZeroRaidSuperblocks indicates an expected call of ZeroRaidSuperblocks
+func (mr *MockOpsMockRecorder) ZeroRaidSuperblocks(device interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ZeroRaidSuperblocks", reflect.TypeOf((*MockOps)(nil).ZeroRaidSuperblocks), device)
+}
+
 // GetMCSLogs mocks base method
 func (m *MockOps) GetMCSLogs() (string, error) {
 	m.ctrl.T.Helper()
@@ -336,6 +402,108 @@ func (mr *MockOpsMockRecorder) ReloadHostFile(filepath interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReloadHostFile", reflect.TypeOf((*MockOps)(nil).ReloadHostFile), filepath)
 }
 
+// ReadHostFile mocks base method
+func (m *MockOps) ReadHostFile(filepath string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadHostFile", filepath)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadHostFile indicates an expected call of ReadHostFile
+func (mr *MockOpsMockRecorder) ReadHostFile(filepath interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadHostFile", reflect.TypeOf((*MockOps)(nil).ReadHostFile), filepath)
+}
+
+// WriteHostFile mocks base method
+func (m *MockOps) WriteHostFile(filepath, content string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteHostFile", filepath, content)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WriteHostFile indicates an expected call of WriteHostFile
+func (mr *MockOpsMockRecorder) WriteHostFile(filepath, content interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteHostFile", reflect.TypeOf((*MockOps)(nil).WriteHostFile), filepath, content)
+}
+
+// GetLuksMappings mocks base method
+func (m *MockOps) GetLuksMappings(device string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLuksMappings", device)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLuksMappings indicates an expected call of GetLuksMappings
+func (mr *MockOpsMockRecorder) GetLuksMappings(device interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLuksMappings", reflect.TypeOf((*MockOps)(nil).GetLuksMappings), device)
+}
+
+// CloseLuksMapping mocks base method
+func (m *MockOps) CloseLuksMapping(name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CloseLuksMapping", name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CloseLuksMapping indicates an expected call of CloseLuksMapping
+func (mr *MockOpsMockRecorder) CloseLuksMapping(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CloseLuksMapping", reflect.TypeOf((*MockOps)(nil).CloseLuksMapping), name)
+}
+
+// GetDeviceSignatures mocks base method
+func (m *MockOps) GetDeviceSignatures(device string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeviceSignatures", device)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeviceSignatures indicates an expected call of GetDeviceSignatures
+func (mr *MockOpsMockRecorder) GetDeviceSignatures(device interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeviceSignatures", reflect.TypeOf((*MockOps)(nil).GetDeviceSignatures), device)
+}
+
+// UdevSettle mocks base method
+func (m *MockOps) UdevSettle() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UdevSettle")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UdevSettle indicates an expected call of UdevSettle
+func (mr *MockOpsMockRecorder) UdevSettle() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UdevSettle", reflect.TypeOf((*MockOps)(nil).UdevSettle))
+}
+
+// GetPVsByVG mocks base method
+func (m *MockOps) GetPVsByVG(vgName string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPVsByVG", vgName)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPVsByVG indicates an expected call of GetPVsByVG
+func (mr *MockOpsMockRecorder) GetPVsByVG(vgName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPVsByVG", reflect.TypeOf((*MockOps)(nil).GetPVsByVG), vgName)
+}
+
 // CreateOpenshiftSshManifest mocks base method
 func (m *MockOps) CreateOpenshiftSshManifest(filePath, template, sshPubKeyPath string) error {
 	m.ctrl.T.Helper()
@@ -370,6 +538,26 @@ func (mr *MockOpsMockRecorder) GetMustGatherLogs(workDir, kubeconfigPath interfa
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMustGatherLogs", reflect.TypeOf((*MockOps)(nil).GetMustGatherLogs), varargs...)
 }
 
+// GetNodeJournalLogs mocks base method
+func (m *MockOps) GetNodeJournalLogs(kubeconfigPath, nodeName string, units ...string) (string, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{kubeconfigPath, nodeName}
+	for _, a := range units {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "GetNodeJournalLogs", varargs...)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetNodeJournalLogs indicates an expected call of GetNodeJournalLogs
+func (mr *MockOpsMockRecorder) GetNodeJournalLogs(kubeconfigPath, nodeName interface{}, units ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{kubeconfigPath, nodeName}, units...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNodeJournalLogs", reflect.TypeOf((*MockOps)(nil).GetNodeJournalLogs), varargs...)
+}
+
 // CreateRandomHostname mocks base method
 func (m *MockOps) CreateRandomHostname(hostname string) error {
 	m.ctrl.T.Helper()
@@ -413,6 +601,21 @@ func (mr *MockOpsMockRecorder) EvaluateDiskSymlink(arg0 interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EvaluateDiskSymlink", reflect.TypeOf((*MockOps)(nil).EvaluateDiskSymlink), arg0)
 }
 
+// GetPartitionParent mocks base method
+func (m *MockOps) GetPartitionParent(device string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPartitionParent", device)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPartitionParent indicates an expected call of GetPartitionParent
+func (mr *MockOpsMockRecorder) GetPartitionParent(device interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPartitionParent", reflect.TypeOf((*MockOps)(nil).GetPartitionParent), device)
+}
+
 // FormatDisk mocks base method
 func (m *MockOps) FormatDisk(arg0 string) error {
 	m.ctrl.T.Helper()
@@ -427,6 +630,36 @@ func (mr *MockOpsMockRecorder) FormatDisk(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FormatDisk", reflect.TypeOf((*MockOps)(nil).FormatDisk), arg0)
 }
 
+// GetMountPoints mocks base method
+func (m *MockOps) GetMountPoints(disk string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMountPoints", disk)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMountPoints indicates an expected call of GetMountPoints
+func (mr *MockOpsMockRecorder) GetMountPoints(disk interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMountPoints", reflect.TypeOf((*MockOps)(nil).GetMountPoints), disk)
+}
+
+// IsDiskEmpty mocks base method
+func (m *MockOps) IsDiskEmpty(disk string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsDiskEmpty", disk)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsDiskEmpty indicates an expected call of IsDiskEmpty
+func (mr *MockOpsMockRecorder) IsDiskEmpty(disk interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsDiskEmpty", reflect.TypeOf((*MockOps)(nil).IsDiskEmpty), disk)
+}
+
 // CreateManifests mocks base method
 func (m *MockOps) CreateManifests(arg0 string, arg1 []byte) error {
 	m.ctrl.T.Helper()
@@ -2,6 +2,8 @@ package ops
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"os"
@@ -28,36 +30,57 @@ import (
 const (
 	coreosInstallerExecutable       = "coreos-installer"
 	dryRunCoreosInstallerExecutable = "dry-installer"
+	// nodeJournalMaxLines bounds the journal read from a node, it is uploaded with the controller logs
+	nodeJournalMaxLines = 10000
 )
 
+// sysBlockPath lists the block devices, a partition has a partition attribute and is nested under its disk
+var sysBlockPath = "/sys/class/block"
+
 //go:generate mockgen -source=ops.go -package=ops -destination=mock_ops.go
 type Ops interface {
 	ExecPrivilegeCommand(liveLogger io.Writer, command string, args ...string) (string, error)
+	// ExecPrivilegeCommandContext is like ExecPrivilegeCommand but kills the command once ctx is done
+	ExecPrivilegeCommandContext(ctx context.Context, liveLogger io.Writer, command string, args ...string) (string, error)
 	ExecCommand(liveLogger io.Writer, command string, args ...string) (string, error)
 	Mkdir(dirName string) error
-	WriteImageToDisk(ignitionPath string, device string, progressReporter inventory_client.InventoryClient, extra []string) error
+	WriteImageToDisk(ctx context.Context, ignitionPath string, device string, progressReporter inventory_client.InventoryClient, extra []string) error
 	Reboot() error
 	SetBootOrder(device string) error
-	ExtractFromIgnition(ignitionPath string, fileToExtract string) error
+	GetEfiBootEntries() ([]EfiBootEntry, error)
+	ExtractFromIgnition(ignitionPath string, fileToExtract string, destination string) error
 	SystemctlAction(action string, args ...string) error
 	PrepareController() error
 	GetVGByPV(pvName string) (string, error)
+	GetPVsByVG(vgName string) ([]string, error)
 	RemoveVG(vgName string) error
 	RemoveLV(lvName, vgName string) error
 	RemovePV(pvName string) error
 	Wipefs(device string) error
+	GetDeviceSignatures(device string) ([]string, error)
+	UdevSettle() error
 	IsRaidMember(device string) bool
 	GetRaidDevices(device string) ([]string, error)
 	CleanRaidMembership(device string) error
+	GetDegradedRaidDevices(device string) ([]string, error)
+	ZeroRaidSuperblocks(device string) ([]string, error)
+	GetLuksMappings(device string) ([]string, error)
+	CloseLuksMapping(name string) error
 	GetMCSLogs() (string, error)
 	UploadInstallationLogs(isBootstrap bool) (string, error)
 	ReloadHostFile(filepath string) error
+	ReadHostFile(filepath string) (string, error)
+	WriteHostFile(filepath string, content string) error
 	CreateOpenshiftSshManifest(filePath, template, sshPubKeyPath string) error
 	GetMustGatherLogs(workDir, kubeconfigPath string, images ...string) (string, error)
+	GetNodeJournalLogs(kubeconfigPath, nodeName string, units ...string) (string, error)
 	CreateRandomHostname(hostname string) error
 	GetHostname() (string, error)
 	EvaluateDiskSymlink(string) string
+	GetPartitionParent(device string) (string, error)
 	FormatDisk(string) error
+	GetMountPoints(disk string) ([]string, error)
+	IsDiskEmpty(disk string) (bool, error)
 	CreateManifests(string, []byte) error
 	DryRebootHappened(markerPath string) bool
 }
@@ -73,6 +96,9 @@ const (
 	controllerDeploySecretTemplate = "assisted-installer-controller-secret.yaml.template"
 )
 
+// EfiBootLabel is the label of the EFI boot entry SetBootOrder creates
+const EfiBootLabel = "Red Hat Enterprise Linux"
+
 type ops struct {
 	log             logrus.FieldLogger
 	logWriter       *utils.LogWriter
@@ -108,6 +134,10 @@ func NewOpsWithConfig(installerConfig *config.Config, logger logrus.FieldLogger,
 // ExecPrivilegeCommand execute a command in the host environment via nsenter
 
 func (o *ops) ExecPrivilegeCommand(liveLogger io.Writer, command string, args ...string) (string, error) {
+	return o.ExecPrivilegeCommandContext(context.Background(), liveLogger, command, args...)
+}
+
+func (o *ops) ExecPrivilegeCommandContext(ctx context.Context, liveLogger io.Writer, command string, args ...string) (string, error) {
 	// nsenter is used here to launch processes inside the container in a way that makes said processes feel
 	// and behave as if they're running on the host directly rather than inside the container
 	commandBase := "nsenter"
@@ -131,7 +161,7 @@ func (o *ops) ExecPrivilegeCommand(liveLogger io.Writer, command string, args ..
 	}
 
 	arguments = append(arguments, args...)
-	return o.ExecCommand(liveLogger, commandBase, arguments...)
+	return o.execCommand(ctx, liveLogger, commandBase, arguments...)
 }
 
 type ExecCommandError struct {
@@ -166,9 +196,12 @@ func (e *ExecCommandError) DetailedError() string {
 
 // ExecCommand executes command.
 func (o *ops) ExecCommand(liveLogger io.Writer, command string, args ...string) (string, error) {
+	return o.execCommand(context.Background(), liveLogger, command, args...)
+}
 
+func (o *ops) execCommand(ctx context.Context, liveLogger io.Writer, command string, args ...string) (string, error) {
 	var stdoutBuf bytes.Buffer
-	cmd := exec.Command(command, args...)
+	cmd := exec.CommandContext(ctx, command, args...)
 	if liveLogger != nil {
 		cmd.Stdout = io.MultiWriter(liveLogger, &stdoutBuf)
 		cmd.Stderr = io.MultiWriter(liveLogger, &stdoutBuf)
@@ -231,7 +264,7 @@ func (o *ops) SystemctlAction(action string, args ...string) error {
 	return errors.Wrapf(err, "Failed executing systemctl %s %s", action, args)
 }
 
-func (o *ops) WriteImageToDisk(ignitionPath string, device string, progressReporter inventory_client.InventoryClient, extraArgs []string) error {
+func (o *ops) WriteImageToDisk(ctx context.Context, ignitionPath string, device string, progressReporter inventory_client.InventoryClient, extraArgs []string) error {
 	allArgs := installerArgs(ignitionPath, device, extraArgs)
 	o.log.Infof("Writing image and ignition to disk with arguments: %v", allArgs)
 
@@ -243,7 +276,7 @@ func (o *ops) WriteImageToDisk(ignitionPath string, device string, progressRepor
 		installerExecutable = dryRunCoreosInstallerExecutable
 	}
 
-	_, err := o.ExecPrivilegeCommand(NewCoreosInstallerLogWriter(o.log, progressReporter, o.installerConfig.InfraEnvID, o.installerConfig.HostID),
+	_, err := o.ExecPrivilegeCommandContext(ctx, NewCoreosInstallerLogWriter(o.log, progressReporter, o.installerConfig.InfraEnvID, o.installerConfig.HostID),
 		installerExecutable, allArgs...)
 	return err
 }
@@ -266,6 +299,21 @@ func (o *ops) EvaluateDiskSymlink(device string) string {
 	return device
 }
 
+// GetPartitionParent returns the disk the device is a partition of, or an empty string for a whole disk
+func (o *ops) GetPartitionParent(device string) (string, error) {
+	sysPath, err := filepath.EvalSymlinks(filepath.Join(sysBlockPath, filepath.Base(device)))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to find block device %s", device)
+	}
+	if _, err = os.Stat(filepath.Join(sysPath, "partition")); err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", errors.Wrapf(err, "failed to check if %s is a partition", device)
+	}
+	return filepath.Join("/dev", filepath.Base(filepath.Dir(sysPath))), nil
+}
+
 func (o *ops) FormatDisk(disk string) error {
 	if o.installerConfig.DryRunEnabled {
 		return nil
@@ -280,6 +328,30 @@ func (o *ops) FormatDisk(disk string) error {
 	return nil
 }
 
+// GetMountPoints returns the mount points of the disk and all of its partitions
+func (o *ops) GetMountPoints(disk string) ([]string, error) {
+	output, err := o.ExecPrivilegeCommand(nil, "lsblk", "--noheadings", "--output", "MOUNTPOINT", disk)
+	if err != nil {
+		return nil, err
+	}
+	var mountPoints []string
+	for _, line := range strings.Split(output, "\n") {
+		if mountPoint := strings.TrimSpace(line); mountPoint != "" {
+			mountPoints = append(mountPoints, mountPoint)
+		}
+	}
+	return mountPoints, nil
+}
+
+// IsDiskEmpty returns true if wipefs finds no partition table or filesystem signature on the disk
+func (o *ops) IsDiskEmpty(disk string) (bool, error) {
+	output, err := o.ExecPrivilegeCommand(nil, "wipefs", "--no-act", "--noheadings", disk)
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(output) == "", nil
+}
+
 func installerArgs(ignitionPath string, device string, extra []string) []string {
 	allArgs := []string{"install", "--insecure", "-i", ignitionPath}
 	if extra != nil {
@@ -312,7 +384,7 @@ func (o *ops) SetBootOrder(device string) error {
 	o.log.Info("Setting efibootmgr to boot from disk")
 
 	// efi-system is installed onto partition 2
-	out, err := o.ExecPrivilegeCommand(o.logWriter, "efibootmgr", "-v", "-d", device, "-p", "2", "-c", "-L", "Red Hat Enterprise Linux", "-l", o.getEfiFilePath())
+	out, err := o.ExecPrivilegeCommand(o.logWriter, "efibootmgr", "-v", "-d", device, "-p", "2", "-c", "-L", EfiBootLabel, "-l", o.getEfiFilePath())
 	if err != nil {
 		o.log.Errorf("Failed to set efibootmgr to boot from disk %s, err: %s", device, err)
 		return err
@@ -321,8 +393,58 @@ func (o *ops) SetBootOrder(device string) error {
 	return nil
 }
 
+// EfiBootEntry is a boot entry listed by efibootmgr
+type EfiBootEntry struct {
+	Number string
+	Label  string
+	Active bool
+	// PartUUID is the GPT partition the entry boots from, empty for entries that don't boot from a disk
+	PartUUID string
+}
+
+var (
+	efiBootEntryRegex    = regexp.MustCompile(`^Boot([0-9A-Fa-f]{4})(\*?)\s+(.*)$`)
+	efiBootPartUUIDRegex = regexp.MustCompile(`HD\([0-9]+,GPT,([0-9A-Fa-f-]+),`)
+)
+
+// GetEfiBootEntries lists the EFI boot entries, there are none on BIOS systems
+func (o *ops) GetEfiBootEntries() ([]EfiBootEntry, error) {
+	if o.installerConfig.DryRunEnabled {
+		return nil, nil
+	}
+	if _, err := o.ExecPrivilegeCommand(nil, "test", "-d", "/sys/firmware/efi"); err != nil {
+		return nil, nil
+	}
+	out, err := o.ExecPrivilegeCommand(nil, "efibootmgr", "-v")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list the EFI boot entries")
+	}
+	return parseEfiBootEntries(out), nil
+}
+
+func parseEfiBootEntries(output string) []EfiBootEntry {
+	var entries []EfiBootEntry
+	for _, line := range strings.Split(output, "\n") {
+		match := efiBootEntryRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		entry := EfiBootEntry{Number: match[1], Active: match[2] == "*"}
+		// efibootmgr separates the label from the device path with a tab
+		entry.Label = strings.TrimSpace(strings.SplitN(match[3], "\t", 2)[0])
+		if partUUID := efiBootPartUUIDRegex.FindStringSubmatchIndex(match[3]); partUUID != nil {
+			entry.PartUUID = strings.ToLower(match[3][partUUID[2]:partUUID[3]])
+			if !strings.Contains(match[3], "\t") {
+				entry.Label = strings.TrimSpace(match[3][:partUUID[0]])
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
 func (o *ops) handleDuplicateEntries(output string) {
-	r := regexp.MustCompile(`Boot(.*) has same label Red Hat Enterprise Linux`)
+	r := regexp.MustCompile(`Boot(.*) has same label ` + EfiBootLabel)
 	for _, line := range strings.Split(output, "\n") {
 		DupBootEntry := r.FindStringSubmatch(line)
 		if len(DupBootEntry) > 0 {
@@ -352,7 +474,8 @@ func (o *ops) getEfiFilePath() string {
 	return fmt.Sprintf("\\EFI\\redhat\\%s", efiFileName)
 }
 
-func (o *ops) ExtractFromIgnition(ignitionPath string, fileToExtract string) error {
+// ExtractFromIgnition writes the content of fileToExtract in the ignition to destination
+func (o *ops) ExtractFromIgnition(ignitionPath string, fileToExtract string, destination string) error {
 	if o.installerConfig.DryRunEnabled {
 		return nil
 	}
@@ -378,16 +501,16 @@ func (o *ops) ExtractFromIgnition(ignitionPath string, fileToExtract string) err
 		return err
 	}
 
-	o.log.Infof("Moving %s to %s", tmpFile, fileToExtract)
-	dir := filepath.Dir(fileToExtract)
-	_, err = o.ExecPrivilegeCommand(o.logWriter, "mkdir", "-p", filepath.Dir(fileToExtract))
+	o.log.Infof("Moving %s to %s", tmpFile, destination)
+	dir := filepath.Dir(destination)
+	_, err = o.ExecPrivilegeCommand(o.logWriter, "mkdir", "-p", dir)
 	if err != nil {
 		o.log.Errorf("Failed to create directory %s ", dir)
 		return err
 	}
-	_, err = o.ExecPrivilegeCommand(o.logWriter, "mv", tmpFile, fileToExtract)
+	_, err = o.ExecPrivilegeCommand(o.logWriter, "mv", tmpFile, destination)
 	if err != nil {
-		o.log.Errorf("Error occurred while moving %s to %s", tmpFile, fileToExtract)
+		o.log.Errorf("Error occurred while moving %s to %s", tmpFile, destination)
 		return err
 	}
 	return nil
@@ -515,6 +638,27 @@ func (o *ops) GetVGByPV(pvName string) (string, error) {
 	return "", nil
 }
 
+func (o *ops) GetPVsByVG(vgName string) ([]string, error) {
+	output, err := o.ExecPrivilegeCommand(o.logWriter, "vgs", "--noheadings", "-o", "vg_name,pv_name")
+	if err != nil {
+		o.log.Errorf("Failed to list VGs in the system")
+		return nil, err
+	}
+
+	var pvs []string
+	for _, line := range strings.Split(output, "\n") {
+		res := strings.Fields(line)
+		if len(res) < 2 {
+			continue
+		}
+
+		if res[0] == vgName {
+			pvs = append(pvs, res[1])
+		}
+	}
+	return pvs, nil
+}
+
 func (o *ops) RemoveVG(vgName string) error {
 	output, err := o.ExecPrivilegeCommand(o.logWriter, "vgremove", vgName, "-y")
 	if err != nil {
@@ -549,6 +693,57 @@ func (o *ops) Wipefs(device string) error {
 	return err
 }
 
+// GetDeviceSignatures probes the device for the signatures wipefs would erase, filesystems, partition tables,
+// LVM physical volumes and raid members, without erasing them
+func (o *ops) GetDeviceSignatures(device string) ([]string, error) {
+	output, err := o.ExecPrivilegeCommand(nil, "wipefs", "--noheadings", "--output", "TYPE,OFFSET", device)
+	if err != nil {
+		o.log.Errorf("Failed to probe the signatures of %s", device)
+		return nil, err
+	}
+
+	var signatures []string
+	for _, line := range strings.Split(output, "\n") {
+		res := strings.Fields(line)
+		if len(res) == 2 {
+			signatures = append(signatures, fmt.Sprintf("%s at offset %s", res[0], res[1]))
+		}
+	}
+	return signatures, nil
+}
+
+// GetLuksMappings returns the open dm-crypt mappings on the device or on one of its partitions
+func (o *ops) GetLuksMappings(device string) ([]string, error) {
+	output, err := o.ExecPrivilegeCommand(nil, "lsblk", "--paths", "--list", "--noheadings", "--output", "NAME,TYPE", device)
+	if err != nil {
+		o.log.Errorf("Failed to list the block devices of %s", device)
+		return nil, err
+	}
+
+	var mappings []string
+	for _, line := range strings.Split(output, "\n") {
+		res := strings.Fields(line)
+		if len(res) == 2 && res[1] == "crypt" {
+			mappings = append(mappings, res[0])
+		}
+	}
+	return mappings, nil
+}
+
+func (o *ops) CloseLuksMapping(name string) error {
+	output, err := o.ExecPrivilegeCommand(o.logWriter, "cryptsetup", "close", name)
+	if err != nil {
+		o.log.Errorf("Failed to close LUKS mapping %s, output %s, error %s", name, output, err)
+	}
+	return err
+}
+
+// UdevSettle waits for the pending udev events, e.g. the ones triggered by removing a VG, to be handled
+func (o *ops) UdevSettle() error {
+	_, err := o.ExecPrivilegeCommand(o.logWriter, "udevadm", "settle")
+	return err
+}
+
 func (o *ops) IsRaidMember(device string) bool {
 	raidDevices, err := o.getRaidDevices2Members()
 
@@ -612,15 +807,72 @@ func (o *ops) GetRaidDevices(deviceName string) ([]string, error) {
 	return result, nil
 }
 
+// GetDegradedRaidDevices returns the raid arrays the device or its partitions belong to that have fewer
+// members than they were created with. The missing members aren't listed by mdadm, so their superblocks
+// aren't cleaned with the membership.
+func (o *ops) GetDegradedRaidDevices(deviceName string) ([]string, error) {
+	raidDevices, numDevices, err := o.scanRaidDevices()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	expression, _ := regexp.Compile(deviceName + "[\\d]*")
+	for raidDeviceName, raidArrayMembers := range raidDevices {
+		if numDevices[raidDeviceName] <= len(raidArrayMembers) {
+			continue
+		}
+		for _, raidMember := range raidArrayMembers {
+			if expression.MatchString(raidMember) {
+				o.log.Warnf("Raid device %s is degraded, it has %d of its %d members: %s", raidDeviceName,
+					len(raidArrayMembers), numDevices[raidDeviceName], strings.Join(raidArrayMembers, ","))
+				result = append(result, raidDeviceName)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// ZeroRaidSuperblocks zeroes the raid superblocks left on the device and its partitions, whether they
+// are listed as members of an array or not, and returns the cleaned devices
+func (o *ops) ZeroRaidSuperblocks(device string) ([]string, error) {
+	output, err := o.ExecPrivilegeCommand(o.logWriter, "lsblk", "--noheadings", "--paths", "--list", "--output", "NAME", device)
+	if err != nil {
+		return nil, err
+	}
+
+	var zeroed []string
+	for _, name := range strings.Fields(output) {
+		// examine fails when there is no superblock on the device
+		if _, err = o.ExecPrivilegeCommand(nil, "mdadm", "--examine", name); err != nil {
+			continue
+		}
+		o.log.Infof("Cleaning stale raid superblock of %s", name)
+		if _, err = o.ExecPrivilegeCommand(o.logWriter, "mdadm", "--zero-superblock", name); err != nil {
+			return zeroed, err
+		}
+		zeroed = append(zeroed, name)
+	}
+	return zeroed, nil
+}
+
 func (o *ops) getRaidDevices2Members() (map[string][]string, error) {
+	result, _, err := o.scanRaidDevices()
+	return result, err
+}
+
+// scanRaidDevices returns the members of the raid arrays and the number of members they were created with
+func (o *ops) scanRaidDevices() (map[string][]string, map[string]int, error) {
 	output, err := o.ExecPrivilegeCommand(o.logWriter, "mdadm", "-v", "--query", "--detail", "--scan")
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	lines := strings.Split(output, "\n")
 	result := make(map[string][]string)
+	numDevices := make(map[string]int)
 
 	/*
 		The output pattern is:
@@ -637,6 +889,11 @@ func (o *ops) getRaidDevices2Members() (map[string][]string, error) {
 
 		fields := strings.Fields(lines[i])
 		raidDeviceName := fields[1]
+		for _, field := range fields[2:] {
+			if strings.HasPrefix(field, "num-devices=") {
+				numDevices[raidDeviceName], _ = strconv.Atoi(strings.TrimPrefix(field, "num-devices="))
+			}
+		}
 		i++
 
 		// Ensuring that we have at least two lines per device.
@@ -656,7 +913,7 @@ func (o *ops) getRaidDevices2Members() (map[string][]string, error) {
 		i++
 	}
 
-	return result, nil
+	return result, numDevices, nil
 }
 
 func (o *ops) removeDeviceFromRaidArray(deviceName string, raidDeviceName string, raidArrayMembers []string) error {
@@ -730,10 +987,14 @@ func (o *ops) GetMCSLogs() (string, error) {
 // ( for example UploadLogs), must be reflected here (input parameters, etc'),
 // if needed
 func (o *ops) UploadInstallationLogs(isBootstrap bool) (string, error) {
+	url := o.installerConfig.URL
+	if o.installerConfig.LogsSink == config.LogsSinkCustomURL {
+		url = o.installerConfig.LogsSinkURL
+	}
 	command := "podman"
 	args := []string{"run", "--rm", "--privileged", "--net=host", "--pid=host", "-v", "/run/systemd/journal/socket:/run/systemd/journal/socket",
 		"-v", "/var/log:/var/log", o.installerConfig.AgentImage, "logs_sender",
-		"-cluster-id", o.installerConfig.ClusterID, "-url", o.installerConfig.URL,
+		"-cluster-id", o.installerConfig.ClusterID, "-url", url,
 		"-host-id", o.installerConfig.HostID, "-infra-env-id", o.installerConfig.InfraEnvID,
 		"-pull-secret-token", o.installerConfig.PullSecretToken,
 		fmt.Sprintf("-insecure=%s", strconv.FormatBool(o.installerConfig.SkipCertVerification)),
@@ -804,6 +1065,17 @@ func (o *ops) CreateOpenshiftSshManifest(filePath, tmpl, sshPubKeyPath string) e
 	return nil
 }
 
+// GetNodeJournalLogs reads the last journal lines of the given units, or of the whole journal when no
+// unit is given, from the node through oc adm node-logs
+func (o *ops) GetNodeJournalLogs(kubeconfigPath, nodeName string, units ...string) (string, error) {
+	args := []string{fmt.Sprintf("--kubeconfig=%s", kubeconfigPath), "adm", "node-logs", nodeName,
+		fmt.Sprintf("--tail=%d", nodeJournalMaxLines)}
+	for _, unit := range units {
+		args = append(args, fmt.Sprintf("--unit=%s", unit))
+	}
+	return o.ExecCommand(nil, "oc", args...)
+}
+
 func (o *ops) GetMustGatherLogs(workDir, kubeconfigPath string, images ...string) (string, error) {
 	//invoke oc adm must-gather command in the working directory
 	var imageOption string = ""
@@ -844,6 +1116,25 @@ func (o *ops) GetMustGatherLogs(workDir, kubeconfigPath string, images ...string
 	return path.Join(workDir, tarName), nil
 }
 
+// ReadHostFile returns the content of a file on the host
+func (o *ops) ReadHostFile(filepath string) (string, error) {
+	if o.installerConfig.DryRunEnabled {
+		return "", nil
+	}
+	return o.ExecPrivilegeCommand(nil, "cat", filepath)
+}
+
+// WriteHostFile replaces the content of a file on the host
+func (o *ops) WriteHostFile(filepath string, content string) error {
+	if o.installerConfig.DryRunEnabled {
+		return nil
+	}
+	// the content is passed encoded so it doesn't have to be escaped for the shell
+	command := fmt.Sprintf("echo %s | base64 -d > %s", base64.StdEncoding.EncodeToString([]byte(content)), filepath)
+	_, err := o.ExecPrivilegeCommand(o.logWriter, "bash", "-c", command)
+	return errors.Wrapf(err, "failed to write %s on the host", filepath)
+}
+
 func (o *ops) CreateRandomHostname(hostname string) error {
 	command := fmt.Sprintf("echo %s > /etc/hostname", hostname)
 	o.log.Infof("create random hostname with command %s", command)
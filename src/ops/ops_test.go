@@ -1,10 +1,17 @@
 package ops
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/openshift/assisted-installer/src/config"
+	"github.com/sirupsen/logrus"
 )
 
 var _ = Describe("ExecCommandError", func() {
@@ -83,3 +90,75 @@ var _ = Describe("installerArgs", func() {
 		Expect(args).To(Equal(expected))
 	})
 })
+
+var _ = Describe("parseEfiBootEntries", func() {
+	It("parses the entries listed by efibootmgr", func() {
+		output := "BootCurrent: 0001\nTimeout: 0 seconds\nBootOrder: 0003,0001\n" +
+			"Boot0001* UEFI PXEv4\tPciRoot(0x0)/Pci(0x3,0x0)/MAC(525400123456,1)/IPv4(0.0.0.00.0.0.0,0,0)\n" +
+			"Boot0003* Red Hat Enterprise Linux\tHD(2,GPT,1A2B3C4D-0000-4000-8000-000000000002,0x1000,0x3f800)/File(\\EFI\\redhat\\shimx64.efi)\n" +
+			"Boot0004  Red Hat Enterprise Linux HD(2,GPT,5e6f7a8b-0000-4000-8000-000000000002,0x1000,0x3f800)/File(\\EFI\\redhat\\shimx64.efi)\n"
+		Expect(parseEfiBootEntries(output)).To(Equal([]EfiBootEntry{
+			{Number: "0001", Label: "UEFI PXEv4", Active: true},
+			{Number: "0003", Label: EfiBootLabel, Active: true, PartUUID: "1a2b3c4d-0000-4000-8000-000000000002"},
+			{Number: "0004", Label: EfiBootLabel, Active: false, PartUUID: "5e6f7a8b-0000-4000-8000-000000000002"},
+		}))
+	})
+
+	It("returns no entries for an empty output", func() {
+		Expect(parseEfiBootEntries("")).To(BeEmpty())
+	})
+})
+
+var _ = Describe("partition installation device", func() {
+	var (
+		o               *ops
+		tempDir         string
+		oldSysBlockPath string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = ioutil.TempDir("", "sys-block")
+		Expect(err).NotTo(HaveOccurred())
+		// /sys/class/block links to the devices, partitions are nested under their disk
+		devices := filepath.Join(tempDir, "devices")
+		Expect(os.MkdirAll(filepath.Join(devices, "vda", "vda4"), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(devices, "vda", "vda4", "partition"), []byte("4\n"), 0644)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(tempDir, "class"), 0755)).To(Succeed())
+		Expect(os.Symlink(filepath.Join(devices, "vda"), filepath.Join(tempDir, "class", "vda"))).To(Succeed())
+		Expect(os.Symlink(filepath.Join(devices, "vda", "vda4"), filepath.Join(tempDir, "class", "vda4"))).To(Succeed())
+		oldSysBlockPath = sysBlockPath
+		sysBlockPath = filepath.Join(tempDir, "class")
+		o = &ops{log: logrus.New()}
+	})
+
+	AfterEach(func() {
+		sysBlockPath = oldSysBlockPath
+		os.RemoveAll(tempDir)
+	})
+
+	It("returns the disk of a partition", func() {
+		Expect(o.GetPartitionParent("/dev/vda4")).To(Equal("/dev/vda"))
+	})
+
+	It("returns nothing for a whole disk", func() {
+		Expect(o.GetPartitionParent("/dev/vda")).To(BeEmpty())
+	})
+
+	It("fails for a missing device", func() {
+		_, err := o.GetPartitionParent("/dev/vdb")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("execCommand", func() {
+	It("kills the command once its context is done", func() {
+		o := &ops{log: logrus.New(), installerConfig: &config.Config{}}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := o.execCommand(ctx, nil, "sleep", "10")
+		Expect(err).To(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+	})
+})
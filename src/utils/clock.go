@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock allows code that waits on time to be driven manually in tests
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// RealClock is the Clock backed by the time package
+type RealClock struct{}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+func (RealClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (RealClock) NewTicker(d time.Duration) Ticker {
+	return &realTicker{ticker: time.NewTicker(d)}
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t *realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t *realTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// FakeClock is a Clock that only moves when Step is called
+type FakeClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	waiters []*fakeClockWaiter
+}
+
+type fakeClockWaiter struct {
+	target  time.Time
+	period  time.Duration
+	ch      chan time.Time
+	stopped bool
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (f *FakeClock) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.now
+}
+
+func (f *FakeClock) After(d time.Duration) <-chan time.Time {
+	return f.addWaiter(d, 0).ch
+}
+
+func (f *FakeClock) NewTicker(d time.Duration) Ticker {
+	return &fakeTicker{clock: f, waiter: f.addWaiter(d, d)}
+}
+
+func (f *FakeClock) addWaiter(d time.Duration, period time.Duration) *fakeClockWaiter {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	w := &fakeClockWaiter{target: f.now.Add(d), period: period, ch: make(chan time.Time, 1)}
+	f.waiters = append(f.waiters, w)
+	return w
+}
+
+// HasWaiters returns true if anyone is waiting on After or a ticker of this clock
+func (f *FakeClock) HasWaiters() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, w := range f.waiters {
+		if !w.stopped {
+			return true
+		}
+	}
+	return false
+}
+
+// Step moves the clock forward and fires every After and ticker that became due.
+// Like time.Ticker, ticks are dropped if the previous one wasn't consumed yet
+func (f *FakeClock) Step(d time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.now = f.now.Add(d)
+	var waiters []*fakeClockWaiter
+	for _, w := range f.waiters {
+		if w.stopped {
+			continue
+		}
+		if !w.target.After(f.now) {
+			select {
+			case w.ch <- f.now:
+			default:
+			}
+			if w.period == 0 {
+				continue
+			}
+			for !w.target.After(f.now) {
+				w.target = w.target.Add(w.period)
+			}
+		}
+		waiters = append(waiters, w)
+	}
+	f.waiters = waiters
+}
+
+type fakeTicker struct {
+	clock  *FakeClock
+	waiter *fakeClockWaiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.waiter.ch
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+	t.waiter.stopped = true
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FakeClock", func() {
+	var (
+		start     = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		fakeClock *FakeClock
+	)
+	BeforeEach(func() {
+		fakeClock = NewFakeClock(start)
+	})
+
+	It("After fires only once the clock moved past the duration", func() {
+		ch := fakeClock.After(10 * time.Second)
+		Expect(fakeClock.HasWaiters()).To(BeTrue())
+		fakeClock.Step(5 * time.Second)
+		Expect(ch).NotTo(Receive())
+		fakeClock.Step(5 * time.Second)
+		Expect(ch).To(Receive(Equal(start.Add(10 * time.Second))))
+		Expect(fakeClock.HasWaiters()).To(BeFalse())
+		Expect(fakeClock.Now()).To(Equal(start.Add(10 * time.Second)))
+	})
+
+	It("ticker fires every period until stopped", func() {
+		ticker := fakeClock.NewTicker(time.Second)
+		fakeClock.Step(time.Second)
+		Expect(ticker.C()).To(Receive())
+		fakeClock.Step(500 * time.Millisecond)
+		Expect(ticker.C()).NotTo(Receive())
+		fakeClock.Step(500 * time.Millisecond)
+		Expect(ticker.C()).To(Receive())
+
+		ticker.Stop()
+		Expect(fakeClock.HasWaiters()).To(BeFalse())
+		fakeClock.Step(time.Second)
+		Expect(ticker.C()).NotTo(Receive())
+	})
+})
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"regexp"
+)
+
+const redactionMask = '*'
+
+// secretPatterns match secrets that pods may print in their logs, the first group of every
+// pattern is the secret value itself
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)bearer\s+([A-Za-z0-9\-._~+/]+=*)`),
+	regexp.MustCompile(`(?i)(?:token|password|passwd|secret|api[_-]?key|pull[_-]?secret|auth)["']?\s*[:=]\s*["']?([^\s"',;}]+)`),
+	regexp.MustCompile(`(eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+)`),
+	regexp.MustCompile(`(sha256~[A-Za-z0-9_-]{20,})`),
+}
+
+// RedactSecrets masks the secrets found in line in place. The masked line keeps its length
+// so sizes computed before the redaction stay valid.
+func RedactSecrets(line []byte) []byte {
+	for _, pattern := range secretPatterns {
+		for _, match := range pattern.FindAllSubmatchIndex(line, -1) {
+			for i := match[2]; i < match[3]; i++ {
+				line[i] = redactionMask
+			}
+		}
+	}
+	return line
+}
+
+type redactingReader struct {
+	reader  *bufio.Reader
+	pending bytes.Buffer
+	err     error
+}
+
+// NewRedactingReader returns a reader that masks secrets in r line by line, only the current
+// line is buffered
+func NewRedactingReader(r io.Reader) io.Reader {
+	return &redactingReader{reader: bufio.NewReader(r)}
+}
+
+func (r *redactingReader) Read(p []byte) (int, error) {
+	for r.pending.Len() == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		var line []byte
+		line, r.err = r.reader.ReadBytes('\n')
+		r.pending.Write(RedactSecrets(line))
+	}
+	return r.pending.Read(p)
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing/iotest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Redaction", func() {
+	const fakeToken = "sha256~AbCdEfGhIjKlMnOpQrStUvWxYz0123456789"
+
+	redact := func(logs string) string {
+		return string(RedactSecrets([]byte(logs)))
+	}
+
+	It("masks secrets keeping the line length", func() {
+		for _, line := range []string{
+			"Authorization: Bearer " + fakeToken,
+			"login with token=" + fakeToken,
+			`{"password": "` + fakeToken + `"}`,
+			"using " + fakeToken,
+		} {
+			redacted := redact(line)
+			Expect(redacted).NotTo(ContainSubstring(fakeToken), line)
+			Expect(redacted).To(ContainSubstring(strings.Repeat("*", len(fakeToken))), line)
+			Expect(redacted).To(HaveLen(len(line)), line)
+		}
+	})
+
+	It("keeps lines without secrets", func() {
+		line := "I1015 10:00:00.000000 1 controller.go:42] node master-0 is Ready\n"
+		Expect(redact(line)).To(Equal(line))
+	})
+
+	It("redacts a streamed reader line by line", func() {
+		logs := "starting\nrequest with Bearer " + fakeToken + "\ndone"
+		// read one byte at a time to make sure lines are redacted as a whole
+		out, err := ioutil.ReadAll(NewRedactingReader(iotest.OneByteReader(strings.NewReader(logs))))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(out)).To(Equal("starting\nrequest with Bearer " + strings.Repeat("*", len(fakeToken)) + "\ndone"))
+	})
+
+	It("returns the errors of the underlying reader", func() {
+		out, err := ioutil.ReadAll(NewRedactingReader(iotest.TimeoutReader(strings.NewReader("line\n"))))
+		Expect(err).To(Equal(iotest.ErrTimeout))
+		Expect(string(out)).To(Equal("line\n"))
+	})
+})
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"strings"
+)
+
+// RegistriesConfPath is where podman reads the registries configuration, including the mirrors of
+// disconnected clusters
+const RegistriesConfPath = "/etc/containers/registries.conf"
+
+type registryEntry struct {
+	prefix   string
+	location string
+	mirrors  []string
+}
+
+// GetRegistryMirrors returns the mirrors registriesConf configures for image, in the order podman tries
+// them. Only the [[registry]] tables of the v2 format, which disconnected clusters use, are supported.
+// It's only meant for logging, podman does its own resolution of the mirrors.
+func GetRegistryMirrors(registriesConf string, image string) []string {
+	var best *registryEntry
+	for _, registry := range parseRegistriesConf(registriesConf) {
+		prefix := registry.prefix
+		if prefix == "" {
+			prefix = registry.location
+		}
+		if !imageMatchesPrefix(image, prefix) {
+			continue
+		}
+		if best == nil || len(prefix) > len(best.prefix) {
+			best = &registryEntry{prefix: prefix, mirrors: registry.mirrors}
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return best.mirrors
+}
+
+func imageMatchesPrefix(image, prefix string) bool {
+	if prefix == "" || !strings.HasPrefix(image, prefix) {
+		return false
+	}
+	if len(image) == len(prefix) {
+		return true
+	}
+	return strings.ContainsAny(image[len(prefix):len(prefix)+1], "/:@")
+}
+
+func parseRegistriesConf(registriesConf string) []*registryEntry {
+	var registries []*registryEntry
+	var current *registryEntry
+	inMirror := false
+	for _, line := range strings.Split(registriesConf, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case line == "[[registry]]":
+			current = &registryEntry{}
+			registries = append(registries, current)
+			inMirror = false
+		case line == "[[registry.mirror]]":
+			inMirror = current != nil
+		case strings.HasPrefix(line, "["):
+			current = nil
+			inMirror = false
+		case current != nil:
+			kv := strings.SplitN(line, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			key := strings.TrimSpace(kv[0])
+			value := strings.Trim(strings.TrimSpace(kv[1]), `"'`)
+			switch {
+			case inMirror && key == "location":
+				current.mirrors = append(current.mirrors, value)
+			case !inMirror && key == "location":
+				current.location = value
+			case !inMirror && key == "prefix":
+				current.prefix = value
+			}
+		}
+	}
+	return registries
+}
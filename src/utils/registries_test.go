@@ -0,0 +1,46 @@
+package utils
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Registry mirrors", func() {
+	const registriesConf = `
+unqualified-search-registries = ["registry.access.redhat.com", "docker.io"]
+
+[[registry]]
+  prefix = ""
+  location = "quay.io/openshift-release-dev/ocp-v4.0-art-dev"
+  mirror-by-digest-only = true
+
+  [[registry.mirror]]
+    location = "mirror.example.com:5000/ocp4/openshift4" # local mirror
+
+  [[registry.mirror]]
+    location = 'backup.example.com/ocp4/openshift4'
+
+[[registry]]
+  location = "quay.io/openshift-release-dev"
+
+  [[registry.mirror]]
+    location = "mirror.example.com:5000/openshift-release-dev"
+`
+	const mcoImage = "quay.io/openshift-release-dev/ocp-v4.0-art-dev@sha256:dc1a34f55c712b2b9c5e5a14dd85e67cbdae11fd147046ac2fef9eaf179ab221"
+
+	It("returns the mirrors of the most specific registry", func() {
+		Expect(GetRegistryMirrors(registriesConf, mcoImage)).To(Equal([]string{
+			"mirror.example.com:5000/ocp4/openshift4",
+			"backup.example.com/ocp4/openshift4",
+		}))
+		Expect(GetRegistryMirrors(registriesConf, "quay.io/openshift-release-dev/ocp-release:4.9.0-x86_64")).To(Equal([]string{
+			"mirror.example.com:5000/openshift-release-dev",
+		}))
+	})
+
+	It("returns no mirrors for images that aren't mirrored", func() {
+		Expect(GetRegistryMirrors(registriesConf, "quay.io/openshift-release-dev-extra/image:latest")).To(BeEmpty())
+		Expect(GetRegistryMirrors(registriesConf, "registry.example.com/image:latest")).To(BeEmpty())
+		Expect(GetRegistryMirrors("", mcoImage)).To(BeEmpty())
+	})
+})
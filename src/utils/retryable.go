@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/go-openapi/runtime"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// transientErrnos are the system errors that usually go away by themselves
+var transientErrnos = []syscall.Errno{
+	syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.ECONNABORTED, syscall.EPIPE,
+	syscall.ETIMEDOUT, syscall.EBUSY, syscall.EAGAIN,
+}
+
+// IsRetryableStatusCode returns true for the HTTP responses that may succeed when the request is sent again.
+// A conflict isn't one of them, sending the same request again conflicts the same way.
+func IsRetryableStatusCode(code int) bool {
+	return code >= http.StatusInternalServerError || code == http.StatusRequestTimeout ||
+		code == http.StatusTooManyRequests
+}
+
+// IsRetryable returns true if err is a transient failure, like a timeout, a reset connection, a busy
+// device or a 5xx response, that may go away on the next attempt. Errors that will fail the same way
+// again, like authentication failures and missing resources, and unknown errors aren't retryable.
+// An error can classify itself by implementing Retryable() bool.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var stop *stopRetryError
+	if errors.As(err, &stop) {
+		return false
+	}
+	var classified interface{ Retryable() bool }
+	if errors.As(err, &classified) {
+		return classified.Retryable()
+	}
+	var apiErr *runtime.APIError
+	if errors.As(err, &apiErr) {
+		return IsRetryableStatusCode(apiErr.Code)
+	}
+	var statusErr apierrors.APIStatus
+	if errors.As(err, &statusErr) {
+		return IsRetryableStatusCode(int(statusErr.Status().Code))
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	for _, errno := range transientErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
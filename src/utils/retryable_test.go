@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/go-openapi/runtime"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+type classifiedError bool
+
+func (e classifiedError) Error() string   { return "classified" }
+func (e classifiedError) Retryable() bool { return bool(e) }
+
+var _ = Describe("IsRetryable", func() {
+	pods := schema.GroupResource{Resource: "pods"}
+
+	It("retries transient errors", func() {
+		for name, err := range map[string]error{
+			"deadline exceeded":             context.DeadlineExceeded,
+			"network timeout":               &net.OpError{Op: "dial", Err: timeoutError{}},
+			"connection reset":              &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)},
+			"connection refused":            errors.Wrap(syscall.ECONNREFUSED, "failed to connect"),
+			"busy device":                   &os.PathError{Op: "open", Path: "/dev/sda", Err: syscall.EBUSY},
+			"unexpected EOF":                fmt.Errorf("reading body: %w", io.ErrUnexpectedEOF),
+			"service 503":                   &runtime.APIError{OperationName: "V2GetCluster", Code: 503},
+			"service 429":                   errors.Wrap(&runtime.APIError{Code: 429}, "get cluster"),
+			"kube internal error":           apierrors.NewInternalError(fmt.Errorf("etcd")),
+			"kube server timeout":           apierrors.NewServerTimeout(pods, "list", 1),
+			"error classified as retryable": fmt.Errorf("wrapped: %w", classifiedError(true)),
+		} {
+			Expect(IsRetryable(err)).To(BeTrue(), name)
+		}
+	})
+
+	It("doesn't retry permanent errors", func() {
+		for name, err := range map[string]error{
+			"no error":                           nil,
+			"unknown error":                      fmt.Errorf("failed"),
+			"cancelled":                          context.Canceled,
+			"service 401":                        &runtime.APIError{Code: 401},
+			"service 404":                        errors.Wrap(&runtime.APIError{Code: 404}, "download file"),
+			"kube not found":                     apierrors.NewNotFound(pods, "pod"),
+			"kube unauthorized":                  apierrors.NewUnauthorized("token expired"),
+			"kube forbidden":                     apierrors.NewForbidden(pods, "pod", fmt.Errorf("rbac")),
+			"kube conflict":                      apierrors.NewConflict(pods, "pod", fmt.Errorf("modified")),
+			"service 409":                        &runtime.APIError{Code: 409},
+			"stopped retry of a transient error": StopRetry(context.DeadlineExceeded),
+			"error classified as permanent":      errors.Wrap(classifiedError(false), "wrapped"),
+		} {
+			Expect(IsRetryable(err)).To(BeFalse(), name)
+		}
+	})
+})
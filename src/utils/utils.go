@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -9,6 +10,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -26,6 +28,7 @@ import (
 	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
 	"github.com/sirupsen/logrus"
 	"github.com/vincent-petithory/dataurl"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 )
 
 var (
@@ -62,8 +65,39 @@ func NewLogWriter(logger logrus.FieldLogger) *LogWriter {
 	return &LogWriter{logger}
 }
 
+// HostIDLogField is set on every record of the installer logger, so the logs of many hosts can be told
+// apart once aggregated
+const HostIDLogField = "host_id"
+
+// fieldsHook adds fixed fields to every record, unless the record already has them
+type fieldsHook struct {
+	fields logrus.Fields
+}
+
+func (h *fieldsHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *fieldsHook) Fire(entry *logrus.Entry) error {
+	for key, value := range h.fields {
+		if _, ok := entry.Data[key]; !ok {
+			entry.Data[key] = value
+		}
+	}
+	return nil
+}
+
+// AddPersistentFields makes every record of the logger carry the fields, including the records logged
+// directly through the logger rather than through an entry
+func AddPersistentFields(log *logrus.Logger, fields logrus.Fields) {
+	log.AddHook(&fieldsHook{fields: fields})
+}
+
 func InitLogger(verbose bool, enableJournal bool, hostID string, dryMode bool) *logrus.Logger {
 	var log = logrus.New()
+	if hostID != "" {
+		AddPersistentFields(log, logrus.Fields{HostIDLogField: hostID})
+	}
 	// log to console and file
 	logPath := "/var/log/assisted-installer.log"
 	if dryMode {
@@ -81,9 +115,13 @@ func InitLogger(verbose bool, enableJournal bool, hostID string, dryMode bool) *
 	}
 	// log to journal
 	if enableJournal {
+		dryAgentID := ""
+		if dryMode {
+			dryAgentID = hostID
+		}
 		journalLogger.SetJournalLogging(log, &journalLogger.JournalWriter{}, map[string]interface{}{
 			"TAG":          "installer",
-			"DRY_AGENT_ID": hostID,
+			"DRY_AGENT_ID": dryAgentID,
 		})
 	}
 
@@ -161,12 +199,33 @@ func FindAndRemoveElementFromStringList(s []string, r string) []string {
 	return s
 }
 
+type stopRetryError struct {
+	err error
+}
+
+func (e *stopRetryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *stopRetryError) Unwrap() error {
+	return e.err
+}
+
+// StopRetry makes Retry return err right away instead of retrying an error that won't go away
+func StopRetry(err error) error {
+	return &stopRetryError{err: err}
+}
+
 func Retry(attempts int, sleep time.Duration, log logrus.FieldLogger, f func() error) (err error) {
+	var stop *stopRetryError
 	for i := 0; i < attempts-1; i++ {
 		err = f()
 		if err == nil {
 			return
 		}
+		if errors.As(err, &stop) {
+			return stop.err
+		}
 		time.Sleep(sleep)
 		log.Warnf("Retrying after error: %s", err)
 	}
@@ -175,9 +234,173 @@ func Retry(attempts int, sleep time.Duration, log logrus.FieldLogger, f func() e
 	if err == nil {
 		return
 	}
+	if errors.As(err, &stop) {
+		return stop.err
+	}
+	return fmt.Errorf("failed after %d attempts, last error: %s", attempts, err)
+}
+
+// RetryWithBackoff is like Retry but doubles the sleep after every attempt up to max, and gives up
+// right away on errors that IsRetryable doesn't consider transient
+func RetryWithBackoff(attempts int, initial, max time.Duration, log logrus.FieldLogger, f func() error) (err error) {
+	backoff := NewFailureBackoff(initial, max)
+	for i := 0; i < attempts; i++ {
+		if err = f(); err == nil {
+			return nil
+		}
+		if !IsRetryable(err) {
+			var stop *stopRetryError
+			if errors.As(err, &stop) {
+				return stop.err
+			}
+			return err
+		}
+		if i < attempts-1 {
+			delay := backoff.Failure()
+			log.Warnf("Retrying in %s after error: %s", delay, err)
+			time.Sleep(delay)
+		}
+	}
 	return fmt.Errorf("failed after %d attempts, last error: %s", attempts, err)
 }
 
+// RetryAllWithBackoff is like RetryWithBackoff but retries every error until the attempts are exhausted
+// or f returns StopRetry, and returns the error of the last attempt as is
+func RetryAllWithBackoff(attempts int, initial, max time.Duration, log logrus.FieldLogger, f func() error) (err error) {
+	backoff := NewFailureBackoff(initial, max)
+	var stop *stopRetryError
+	for i := 0; i < attempts; i++ {
+		if err = f(); err == nil {
+			return nil
+		}
+		if errors.As(err, &stop) {
+			return stop.err
+		}
+		if i < attempts-1 {
+			delay := backoff.Failure()
+			log.Warnf("Retrying in %s after error: %s", delay, err)
+			time.Sleep(delay)
+		}
+	}
+	return err
+}
+
+// ForEachConcurrent calls fn for every index in [0, count) running at most maxWorkers calls
+// at the same time. All calls are made even if some of them fail, the returned error
+// aggregates all the failures
+func ForEachConcurrent(count int, maxWorkers int, fn func(index int) error) error {
+	if maxWorkers < 1 {
+		maxWorkers = 1
+	}
+	var (
+		wg        sync.WaitGroup
+		lock      sync.Mutex
+		errs      []error
+		semaphore = make(chan struct{}, maxWorkers)
+	)
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(index int) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			if err := fn(index); err != nil {
+				lock.Lock()
+				errs = append(errs, err)
+				lock.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return utilerrors.NewAggregate(errs)
+}
+
+// ReadStreamUntilDone copies the stream into a buffer until it ends, maxBytes were read or ctx is done.
+// The stream is closed once ctx is done so a followed stream doesn't block the read forever, reaching
+// the deadline is not an error.
+func ReadStreamUntilDone(ctx context.Context, stream io.ReadCloser, maxBytes int64) (*bytes.Buffer, error) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = stream.Close()
+		case <-done:
+		}
+	}()
+
+	buf := new(bytes.Buffer)
+	_, err := io.Copy(buf, io.LimitReader(stream, maxBytes))
+	if err != nil && ctx.Err() != nil {
+		err = nil
+	}
+	return buf, err
+}
+
+// FailureBackoff tracks consecutive failures of a polled call. After every failure the next
+// attempt is postponed by a delay that doubles up to max, a success resets it.
+type FailureBackoff struct {
+	initial     time.Duration
+	max         time.Duration
+	delay       time.Duration
+	nextAttempt time.Time
+}
+
+func NewFailureBackoff(initial, max time.Duration) *FailureBackoff {
+	return &FailureBackoff{initial: initial, max: max}
+}
+
+// Ready returns false while the call should still be skipped after a failure
+func (b *FailureBackoff) Ready() bool {
+	return !time.Now().Before(b.nextAttempt)
+}
+
+// Failure records a failed attempt and returns how long the next attempt is postponed
+func (b *FailureBackoff) Failure() time.Duration {
+	if b.delay == 0 {
+		b.delay = b.initial
+	} else {
+		b.delay *= 2
+	}
+	if b.delay > b.max {
+		b.delay = b.max
+	}
+	b.nextAttempt = time.Now().Add(b.delay)
+	return b.delay
+}
+
+func (b *FailureBackoff) Success() {
+	b.delay = 0
+	b.nextAttempt = time.Time{}
+}
+
+// IsIPv6CIDR returns true if the given CIDR is an IPv6 network
+func IsIPv6CIDR(cidr string) (bool, error) {
+	ip, _, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false, err
+	}
+	return ip.To4() == nil, nil
+}
+
+// ClassifyNetworks reports which IP families appear in the given CIDRs, invalid CIDRs are ignored
+func ClassifyNetworks(cidrs []string) (hasV4, hasV6 bool) {
+	for _, cidr := range cidrs {
+		isV6, err := IsIPv6CIDR(cidr)
+		if err != nil {
+			continue
+		}
+		if isV6 {
+			hasV6 = true
+		} else {
+			hasV4 = true
+		}
+	}
+	return hasV4, hasV6
+}
+
 func GetHostIpsFromInventory(inventory *models.Inventory) ([]string, error) {
 	var ips []string
 	for _, netInt := range inventory.Interfaces {
@@ -228,6 +451,30 @@ func WaitForPredicateWithContext(ctx context.Context, timeout time.Duration, int
 	})
 }
 
+// WaitForPredicateWithElapsed is like WaitForPredicateWithContext but also returns how long the wait
+// took, e.g. to log how long it took for a condition to be met
+func WaitForPredicateWithElapsed(ctx context.Context, timeout time.Duration, interval time.Duration, predicate func() bool) (time.Duration, error) {
+	start := time.Now()
+	err := WaitForPredicateWithContext(ctx, timeout, interval, predicate)
+	return time.Since(start), err
+}
+
+// WaitForPredicateImmediate is like WaitForPredicate but checks the predicate once before
+// waiting for the first interval, so it returns right away if the condition already holds
+func WaitForPredicateImmediate(timeout time.Duration, interval time.Duration, predicate func() bool) error {
+	return WaitForPredicateImmediateWithContext(context.TODO(), timeout, interval, predicate)
+}
+
+func WaitForPredicateImmediateWithContext(ctx context.Context, timeout time.Duration, interval time.Duration, predicate func() bool) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if predicate() {
+		return nil
+	}
+	return WaitForPredicateWithContext(ctx, timeout, interval, predicate)
+}
+
 func WaitForPredicateParamsWithContext(ctx context.Context, timeout time.Duration, interval time.Duration, predicate func(arg interface{}) bool, arg interface{}) error {
 	return WaitForPredicateWithTimer(ctx, timeout, interval, func(timer *time.Timer) bool {
 		return predicate(arg)
@@ -254,13 +501,87 @@ func envVarsProxyFunc() func(*url.URL) (*url.URL, error) {
 	return envVarsProxyFuncValue
 }
 
+// ProxyFuncFromSettings returns a proxy function for the given proxy settings, in the same
+// form as ProxyFromEnvVars
+func ProxyFuncFromSettings(httpProxy, httpsProxy, noProxy string) func(*http.Request) (*url.URL, error) {
+	proxyFunc := (&httpproxy.Config{
+		HTTPProxy:  httpProxy,
+		HTTPSProxy: httpsProxy,
+		NoProxy:    noProxy,
+	}).ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+}
+
+// inClusterDomains are the DNS suffixes of the in-cluster services
+var inClusterDomains = []string{".svc", ".cluster.local"}
+
+// InClusterNoProxy adds to noProxy the destinations that must be reached directly from a pod: the
+// service networks, the in-cluster service domains and the service URL host when it is in-cluster,
+// e.g. a short service name resolved through the pod search domains
+func InClusterNoProxy(noProxy string, serviceNetworks []string, serviceURL string) string {
+	entries := []string{}
+	for _, entry := range strings.Split(noProxy, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	add := func(entry string) {
+		for _, existing := range entries {
+			if strings.EqualFold(existing, entry) {
+				return
+			}
+		}
+		entries = append(entries, entry)
+	}
+	for _, network := range serviceNetworks {
+		add(network)
+	}
+	for _, domain := range inClusterDomains {
+		add(domain)
+	}
+	if u, err := url.Parse(serviceURL); err == nil && isInClusterHost(u.Hostname(), serviceNetworks) {
+		add(u.Hostname())
+	}
+	return strings.Join(entries, ",")
+}
+
+func isInClusterHost(host string, serviceNetworks []string) bool {
+	if host == "" {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		for _, network := range serviceNetworks {
+			if _, cidr, err := net.ParseCIDR(network); err == nil && cidr.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	if !strings.Contains(host, ".") {
+		return true
+	}
+	for _, domain := range inClusterDomains {
+		if strings.HasSuffix(strings.ToLower(host), domain) {
+			return true
+		}
+	}
+	return false
+}
+
 func SetNoProxyEnv(noProxy string) {
 	os.Setenv("NO_PROXY", noProxy)
 	os.Setenv("no_proxy", noProxy)
 }
 
 func GenerateRequestContext() context.Context {
-	return requestid.ToContext(context.Background(), requestid.NewID())
+	return GenerateChildRequestContext(context.Background())
+}
+
+// GenerateChildRequestContext adds a new request id to ctx, the request is cancelled with ctx
+func GenerateChildRequestContext(ctx context.Context) context.Context {
+	return requestid.ToContext(ctx, requestid.NewID())
 }
 
 func RequestIDLogger(ctx context.Context, log logrus.FieldLogger) logrus.FieldLogger {
@@ -286,7 +607,8 @@ func EtcdPatchRequired(openshiftVersion string) (bool, error) {
 
 func CsvStatusToOperatorStatus(csvStatus string) models.OperatorStatus {
 	switch csvStatus {
-	case string(operatorsv1alpha1.CSVPhaseSucceeded):
+	// a CSV being replaced was installed successfully and keeps serving until its successor takes over
+	case string(operatorsv1alpha1.CSVPhaseSucceeded), string(operatorsv1alpha1.CSVPhaseReplacing):
 		return models.OperatorStatusAvailable
 	case string(operatorsv1alpha1.CSVPhaseFailed):
 		return models.OperatorStatusFailed
@@ -295,18 +617,49 @@ func CsvStatusToOperatorStatus(csvStatus string) models.OperatorStatus {
 	}
 }
 
-func ClusterOperatorConditionsToMonitoredOperatorStatus(conditions []configv1.ClusterOperatorStatusCondition) (models.OperatorStatus, string) {
+// CsvStatusToOperatorStatusAndMessage is like CsvStatusToOperatorStatus and explains in the
+// returned message the phases that don't speak for themselves
+func CsvStatusToOperatorStatusAndMessage(csvStatus string, csvMessage string) (models.OperatorStatus, string) {
+	var reason string
+	switch csvStatus {
+	case string(operatorsv1alpha1.CSVPhaseReplacing):
+		reason = "Operator is being upgraded to a newer version"
+	case string(operatorsv1alpha1.CSVPhaseDeleting):
+		reason = "Operator version is being deleted"
+	default:
+		return CsvStatusToOperatorStatus(csvStatus), csvMessage
+	}
+	if csvMessage != "" {
+		reason = fmt.Sprintf("%s: %s", reason, csvMessage)
+	}
+	return CsvStatusToOperatorStatus(csvStatus), reason
+}
+
+// ClusterOperatorConditionsToMonitoredOperatorStatus returns the operator status, its message and the
+// type of the condition that decided it. The condition type is empty when no condition was true.
+func ClusterOperatorConditionsToMonitoredOperatorStatus(conditions []configv1.ClusterOperatorStatusCondition) (models.OperatorStatus, string, configv1.ClusterStatusConditionType) {
+	return ClusterOperatorConditionsToMonitoredOperatorStatusWithGrace(conditions, 0, time.Now())
+}
+
+// ClusterOperatorConditionsToMonitoredOperatorStatusWithGrace is like ClusterOperatorConditionsToMonitoredOperatorStatus
+// but reports an operator that became degraded less than degradedGrace before now as progressing, as
+// operators tend to degrade for a short while during rollouts
+func ClusterOperatorConditionsToMonitoredOperatorStatusWithGrace(conditions []configv1.ClusterOperatorStatusCondition,
+	degradedGrace time.Duration, now time.Time) (models.OperatorStatus, string, configv1.ClusterStatusConditionType) {
 	for _, condition := range conditions {
 		if condition.Type == configv1.OperatorAvailable && condition.Status == configv1.ConditionTrue {
-			return models.OperatorStatusAvailable, condition.Message
+			return models.OperatorStatusAvailable, condition.Message, condition.Type
 		}
 		if condition.Type == configv1.OperatorProgressing && condition.Status == configv1.ConditionTrue {
-			return models.OperatorStatusProgressing, condition.Message
+			return models.OperatorStatusProgressing, condition.Message, condition.Type
 		}
 		if condition.Type == configv1.OperatorDegraded && condition.Status == configv1.ConditionTrue {
-			return models.OperatorStatusFailed, condition.Message
+			if degradedGrace > 0 && now.Sub(condition.LastTransitionTime.Time) < degradedGrace {
+				return models.OperatorStatusProgressing, condition.Message, condition.Type
+			}
+			return models.OperatorStatusFailed, condition.Message, condition.Type
 		}
 	}
 
-	return models.OperatorStatusProgressing, ""
+	return models.OperatorStatusProgressing, "", ""
 }
@@ -1,15 +1,27 @@
 package utils
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	configv1 "github.com/openshift/api/config/v1"
+	"github.com/openshift/assisted-service/models"
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
 	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestUtils(t *testing.T) {
@@ -114,6 +126,157 @@ var _ = Describe("Verify_utils", func() {
 			Expect(callCount).Should(Equal(tries))
 
 		})
+		It("stops retrying", func() {
+			callCount := 0
+			permanent := fmt.Errorf("permanent")
+			err := Retry(3, time.Millisecond, l, func() error {
+				callCount++
+				return StopRetry(permanent)
+			})
+			Expect(err).Should(Equal(permanent))
+			Expect(callCount).Should(Equal(1))
+		})
+		It("retries transient errors with backoff", func() {
+			callCount := 0
+			err := RetryWithBackoff(3, time.Millisecond, 2*time.Millisecond, l, func() error {
+				callCount++
+				return context.DeadlineExceeded
+			})
+			Expect(err).Should(Equal(fmt.Errorf("failed after 3 attempts, last error: %s", context.DeadlineExceeded)))
+			Expect(callCount).Should(Equal(3))
+		})
+		It("doesn't retry permanent errors with backoff", func() {
+			callCount := 0
+			permanent := fmt.Errorf("permanent")
+			err := RetryWithBackoff(3, time.Millisecond, 2*time.Millisecond, l, func() error {
+				callCount++
+				return permanent
+			})
+			Expect(err).Should(Equal(permanent))
+			Expect(callCount).Should(Equal(1))
+		})
+		It("stops retrying with backoff", func() {
+			callCount := 0
+			err := RetryWithBackoff(3, time.Millisecond, 2*time.Millisecond, l, func() error {
+				callCount++
+				if callCount == 2 {
+					return StopRetry(context.DeadlineExceeded)
+				}
+				return context.DeadlineExceeded
+			})
+			Expect(err).Should(Equal(context.DeadlineExceeded))
+			Expect(callCount).Should(Equal(2))
+		})
+		It("retries every error with backoff and returns the last one", func() {
+			var calls []time.Time
+			last := fmt.Errorf("permanent")
+			err := RetryAllWithBackoff(3, 10*time.Millisecond, time.Second, l, func() error {
+				calls = append(calls, time.Now())
+				return last
+			})
+			Expect(err).Should(Equal(last))
+			Expect(calls).Should(HaveLen(3))
+			Expect(calls[1].Sub(calls[0])).Should(BeNumerically(">=", 10*time.Millisecond))
+			Expect(calls[2].Sub(calls[1])).Should(BeNumerically(">=", 20*time.Millisecond))
+		})
+		It("stops retrying every error with backoff", func() {
+			callCount := 0
+			permanent := fmt.Errorf("permanent")
+			err := RetryAllWithBackoff(3, time.Millisecond, 2*time.Millisecond, l, func() error {
+				callCount++
+				return StopRetry(permanent)
+			})
+			Expect(err).Should(Equal(permanent))
+			Expect(callCount).Should(Equal(1))
+		})
+	})
+	Context("test for each concurrent", func() {
+		It("calls fn for every index", func() {
+			var lock sync.Mutex
+			called := make(map[int]bool)
+			err := ForEachConcurrent(10, 3, func(index int) error {
+				lock.Lock()
+				defer lock.Unlock()
+				called[index] = true
+				return nil
+			})
+			Expect(err).Should(BeNil())
+			Expect(called).Should(HaveLen(10))
+		})
+		It("aggregates errors", func() {
+			err := ForEachConcurrent(5, 2, func(index int) error {
+				if index%2 == 0 {
+					return fmt.Errorf("failed %d", index)
+				}
+				return nil
+			})
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("failed 0"))
+			Expect(err.Error()).Should(ContainSubstring("failed 2"))
+			Expect(err.Error()).Should(ContainSubstring("failed 4"))
+		})
+		It("bounds concurrency", func() {
+			var running, maxRunning int32
+			err := ForEachConcurrent(20, 4, func(index int) error {
+				current := atomic.AddInt32(&running, 1)
+				for {
+					observed := atomic.LoadInt32(&maxRunning)
+					if current <= observed || atomic.CompareAndSwapInt32(&maxRunning, observed, current) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				return nil
+			})
+			Expect(err).Should(BeNil())
+			Expect(maxRunning).Should(BeNumerically("<=", 4))
+			Expect(maxRunning).Should(BeNumerically(">", 1))
+		})
+		It("no items", func() {
+			Expect(ForEachConcurrent(0, 4, func(index int) error {
+				return fmt.Errorf("should not be called")
+			})).Should(BeNil())
+		})
+	})
+	Context("test wait for predicate immediate", func() {
+		It("returns immediately when the predicate is true at entry", func() {
+			callCount := 0
+			start := time.Now()
+			err := WaitForPredicateImmediate(time.Hour, time.Hour, func() bool {
+				callCount++
+				return true
+			})
+			Expect(err).Should(BeNil())
+			Expect(callCount).Should(Equal(1))
+			Expect(time.Since(start)).Should(BeNumerically("<", time.Second))
+		})
+		It("keeps checking on interval", func() {
+			callCount := 0
+			err := WaitForPredicateImmediate(time.Second, time.Millisecond, func() bool {
+				callCount++
+				return callCount == 3
+			})
+			Expect(err).Should(BeNil())
+			Expect(callCount).Should(Equal(3))
+		})
+		It("times out", func() {
+			err := WaitForPredicateImmediate(10*time.Millisecond, time.Millisecond, func() bool {
+				return false
+			})
+			Expect(err).Should(HaveOccurred())
+		})
+		It("doesn't check the predicate on a cancelled context", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			callCount := 0
+			err := WaitForPredicateImmediateWithContext(ctx, time.Second, time.Millisecond, func() bool {
+				callCount++
+				return true
+			})
+			Expect(err).Should(Equal(context.Canceled))
+			Expect(callCount).Should(Equal(0))
+		})
 	})
 })
 
@@ -164,3 +327,264 @@ var _ = Describe("EtcdPatchRequired", func() {
 		Expect(err).To(HaveOccurred())
 	})
 })
+
+var _ = Describe("Networks classification", func() {
+	It("IsIPv6CIDR", func() {
+		isV6, err := IsIPv6CIDR("172.30.0.0/16")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(isV6).To(BeFalse())
+
+		isV6, err = IsIPv6CIDR("fd02::/112")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(isV6).To(BeTrue())
+
+		_, err = IsIPv6CIDR("172.30.0.0")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("v4 only", func() {
+		hasV4, hasV6 := ClassifyNetworks([]string{"172.30.0.0/16", "10.0.0.0/8"})
+		Expect(hasV4).To(BeTrue())
+		Expect(hasV6).To(BeFalse())
+	})
+
+	It("v6 only", func() {
+		hasV4, hasV6 := ClassifyNetworks([]string{"fd02::/112"})
+		Expect(hasV4).To(BeFalse())
+		Expect(hasV6).To(BeTrue())
+	})
+
+	It("dual-stack", func() {
+		hasV4, hasV6 := ClassifyNetworks([]string{"172.30.0.0/16", "fd02::/112"})
+		Expect(hasV4).To(BeTrue())
+		Expect(hasV6).To(BeTrue())
+	})
+
+	It("ignores invalid networks", func() {
+		hasV4, hasV6 := ClassifyNetworks([]string{"not-a-cidr", "fd02::/112"})
+		Expect(hasV4).To(BeFalse())
+		Expect(hasV6).To(BeTrue())
+
+		hasV4, hasV6 = ClassifyNetworks(nil)
+		Expect(hasV4).To(BeFalse())
+		Expect(hasV6).To(BeFalse())
+	})
+})
+
+var _ = Describe("AddPersistentFields", func() {
+	It("adds the host ID to every emitted record", func() {
+		var out bytes.Buffer
+		log := logrus.New()
+		log.SetOutput(&out)
+		log.SetFormatter(&logrus.JSONFormatter{})
+		AddPersistentFields(log, logrus.Fields{HostIDLogField: "host-id"})
+
+		log.Info("from the logger")
+		log.WithField("stage", "Installing").Warn("from an entry")
+		log.WithField(HostIDLogField, "other-host-id").Info("overriding the field")
+
+		var records []map[string]interface{}
+		scanner := bufio.NewScanner(&out)
+		for scanner.Scan() {
+			record := map[string]interface{}{}
+			Expect(json.Unmarshal(scanner.Bytes(), &record)).To(Succeed())
+			records = append(records, record)
+		}
+		Expect(records).To(HaveLen(3))
+		Expect(records[0]).To(HaveKeyWithValue(HostIDLogField, "host-id"))
+		Expect(records[1]).To(HaveKeyWithValue(HostIDLogField, "host-id"))
+		Expect(records[1]).To(HaveKeyWithValue("stage", "Installing"))
+		Expect(records[2]).To(HaveKeyWithValue(HostIDLogField, "other-host-id"))
+	})
+})
+
+var _ = Describe("WaitForPredicateWithElapsed", func() {
+	It("returns how long the predicate took to be met", func() {
+		calls := 0
+		elapsed, err := WaitForPredicateWithElapsed(context.TODO(), time.Second, 10*time.Millisecond, func() bool {
+			calls++
+			return calls == 3
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(elapsed).To(BeNumerically(">=", 30*time.Millisecond))
+		Expect(elapsed).To(BeNumerically("<", time.Second))
+	})
+
+	It("returns the elapsed time of a timed out wait", func() {
+		elapsed, err := WaitForPredicateWithElapsed(context.TODO(), 50*time.Millisecond, 10*time.Millisecond, func() bool {
+			return false
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(elapsed).To(BeNumerically(">=", 50*time.Millisecond))
+	})
+})
+
+var _ = Describe("InClusterNoProxy", func() {
+	It("adds the service networks and the in-cluster domains", func() {
+		Expect(InClusterNoProxy("internal.example.com, .svc", []string{"172.30.0.0/16"}, "https://api.openshift.com")).
+			To(Equal("internal.example.com,.svc,172.30.0.0/16,.cluster.local"))
+	})
+
+	It("adds the service host when it is in-cluster", func() {
+		Expect(InClusterNoProxy("", nil, "http://assisted-service:8090")).To(Equal(".svc,.cluster.local,assisted-service"))
+		Expect(InClusterNoProxy("", []string{"172.30.0.0/16"}, "http://172.30.0.10:8090")).
+			To(Equal("172.30.0.0/16,.svc,.cluster.local,172.30.0.10"))
+		Expect(InClusterNoProxy("", []string{"172.30.0.0/16"}, "http://10.0.0.10:8090")).To(Equal("172.30.0.0/16,.svc,.cluster.local"))
+	})
+})
+
+var _ = Describe("FailureBackoff", func() {
+	It("doubles the delay up to the max and resets on success", func() {
+		backoff := NewFailureBackoff(10*time.Millisecond, 35*time.Millisecond)
+		Expect(backoff.Ready()).To(BeTrue())
+
+		Expect(backoff.Failure()).To(Equal(10 * time.Millisecond))
+		Expect(backoff.Ready()).To(BeFalse())
+		Expect(backoff.Failure()).To(Equal(20 * time.Millisecond))
+		Expect(backoff.Failure()).To(Equal(35 * time.Millisecond))
+		Expect(backoff.Failure()).To(Equal(35 * time.Millisecond))
+		Eventually(backoff.Ready, 100*time.Millisecond, 5*time.Millisecond).Should(BeTrue())
+
+		backoff.Failure()
+		backoff.Success()
+		Expect(backoff.Ready()).To(BeTrue())
+		Expect(backoff.Failure()).To(Equal(10 * time.Millisecond))
+	})
+})
+
+var _ = Describe("ReadStreamUntilDone", func() {
+	It("reads the whole stream when it ends", func() {
+		buf, err := ReadStreamUntilDone(context.Background(), ioutil.NopCloser(strings.NewReader("some logs")), 1024)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(buf.String()).To(Equal("some logs"))
+	})
+
+	It("stops at the deadline of a followed stream", func() {
+		pr, pw := io.Pipe()
+		defer pw.Close()
+		go func() {
+			_, _ = pw.Write([]byte("line 1\n"))
+			_, _ = pw.Write([]byte("line 2\n"))
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		buf, err := ReadStreamUntilDone(ctx, pr, 1024)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(buf.String()).To(Equal("line 1\nline 2\n"))
+	})
+
+	It("bounds the number of bytes read", func() {
+		pr, pw := io.Pipe()
+		defer pw.Close()
+		go func() {
+			for {
+				if _, err := pw.Write([]byte("0123456789")); err != nil {
+					return
+				}
+			}
+		}()
+
+		buf, err := ReadStreamUntilDone(context.Background(), pr, 25)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(buf.String()).To(Equal("0123456789012345678901234"))
+	})
+
+	It("returns read errors", func() {
+		pr, pw := io.Pipe()
+		go func() {
+			_, _ = pw.Write([]byte("partial"))
+			_ = pw.CloseWithError(fmt.Errorf("connection reset"))
+		}()
+
+		buf, err := ReadStreamUntilDone(context.Background(), pr, 1024)
+		Expect(err).To(MatchError("connection reset"))
+		Expect(buf.String()).To(Equal("partial"))
+	})
+})
+
+var _ = Describe("CsvStatusToOperatorStatus", func() {
+	It("maps the CSV phases", func() {
+		Expect(CsvStatusToOperatorStatus(string(operatorsv1alpha1.CSVPhaseSucceeded))).To(Equal(models.OperatorStatusAvailable))
+		Expect(CsvStatusToOperatorStatus(string(operatorsv1alpha1.CSVPhaseFailed))).To(Equal(models.OperatorStatusFailed))
+		Expect(CsvStatusToOperatorStatus(string(operatorsv1alpha1.CSVPhaseInstalling))).To(Equal(models.OperatorStatusProgressing))
+		Expect(CsvStatusToOperatorStatus(string(operatorsv1alpha1.CSVPhaseReplacing))).To(Equal(models.OperatorStatusAvailable))
+		Expect(CsvStatusToOperatorStatus(string(operatorsv1alpha1.CSVPhaseDeleting))).To(Equal(models.OperatorStatusProgressing))
+	})
+
+	It("reports a replaced CSV as an upgrading operator", func() {
+		status, message := CsvStatusToOperatorStatusAndMessage(string(operatorsv1alpha1.CSVPhaseReplacing), "being replaced by csv: lso.4.9.1")
+		Expect(status).To(Equal(models.OperatorStatusAvailable))
+		Expect(message).To(Equal("Operator is being upgraded to a newer version: being replaced by csv: lso.4.9.1"))
+	})
+
+	It("reports a deleted CSV as progressing", func() {
+		status, message := CsvStatusToOperatorStatusAndMessage(string(operatorsv1alpha1.CSVPhaseDeleting), "")
+		Expect(status).To(Equal(models.OperatorStatusProgressing))
+		Expect(message).To(Equal("Operator version is being deleted"))
+	})
+
+	It("keeps the CSV message of the other phases", func() {
+		status, message := CsvStatusToOperatorStatusAndMessage(string(operatorsv1alpha1.CSVPhaseInstalling), "waiting for deployment")
+		Expect(status).To(Equal(models.OperatorStatusProgressing))
+		Expect(message).To(Equal("waiting for deployment"))
+	})
+})
+
+var _ = Describe("ClusterOperatorConditionsToMonitoredOperatorStatus", func() {
+	var (
+		now      = time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+		degraded = func(since time.Duration) []configv1.ClusterOperatorStatusCondition {
+			return []configv1.ClusterOperatorStatusCondition{
+				{Type: configv1.OperatorAvailable, Status: configv1.ConditionFalse},
+				{Type: configv1.OperatorDegraded, Status: configv1.ConditionTrue, Message: "pods crashing",
+					LastTransitionTime: metav1.NewTime(now.Add(-since))},
+			}
+		}
+	)
+
+	It("reports a degraded operator as failed by default", func() {
+		status, message, condition := ClusterOperatorConditionsToMonitoredOperatorStatus(degraded(time.Second))
+		Expect(status).To(Equal(models.OperatorStatusFailed))
+		Expect(message).To(Equal("pods crashing"))
+		Expect(condition).To(Equal(configv1.OperatorDegraded))
+	})
+
+	It("reports a transient degraded operator as progressing", func() {
+		status, message, condition := ClusterOperatorConditionsToMonitoredOperatorStatusWithGrace(degraded(time.Minute), 5*time.Minute, now)
+		Expect(status).To(Equal(models.OperatorStatusProgressing))
+		Expect(message).To(Equal("pods crashing"))
+		Expect(condition).To(Equal(configv1.OperatorDegraded))
+	})
+
+	It("reports a persistent degraded operator as failed", func() {
+		status, _, _ := ClusterOperatorConditionsToMonitoredOperatorStatusWithGrace(degraded(10*time.Minute), 5*time.Minute, now)
+		Expect(status).To(Equal(models.OperatorStatusFailed))
+	})
+
+	It("returns the condition that decided the status", func() {
+		status, message, condition := ClusterOperatorConditionsToMonitoredOperatorStatus([]configv1.ClusterOperatorStatusCondition{
+			{Type: configv1.OperatorAvailable, Status: configv1.ConditionTrue, Message: "all good"},
+			{Type: configv1.OperatorDegraded, Status: configv1.ConditionTrue, Message: "one replica down"},
+		})
+		Expect(status).To(Equal(models.OperatorStatusAvailable))
+		Expect(message).To(Equal("all good"))
+		Expect(condition).To(Equal(configv1.OperatorAvailable))
+
+		status, _, condition = ClusterOperatorConditionsToMonitoredOperatorStatus([]configv1.ClusterOperatorStatusCondition{
+			{Type: configv1.OperatorAvailable, Status: configv1.ConditionFalse},
+			{Type: configv1.OperatorProgressing, Status: configv1.ConditionTrue},
+		})
+		Expect(status).To(Equal(models.OperatorStatusProgressing))
+		Expect(condition).To(Equal(configv1.OperatorProgressing))
+	})
+
+	It("returns no condition when none is true", func() {
+		status, message, condition := ClusterOperatorConditionsToMonitoredOperatorStatus([]configv1.ClusterOperatorStatusCondition{
+			{Type: configv1.OperatorAvailable, Status: configv1.ConditionFalse},
+		})
+		Expect(status).To(Equal(models.OperatorStatusProgressing))
+		Expect(message).To(BeEmpty())
+		Expect(condition).To(BeEmpty())
+	})
+})